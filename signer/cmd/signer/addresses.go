@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/datastore/postgres"
+	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/integrity"
+	"github.com/mara-labs/transactionsigner/pkg/kms"
+	"github.com/mara-labs/transactionsigner/pkg/registry"
+	"github.com/mara-labs/transactionsigner/pkg/sepior"
+)
+
+func runAuditAddresses(args []string) error {
+	fs := flag.NewFlagSet("audit addresses", flag.ExitOnError)
+	batchSize := fs.Int("batch-size", 500, "rows fetched per query")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("could not load configuration: %w", err)
+	}
+
+	store, err := postgres.New(cfg)
+	if err != nil {
+		return fmt.Errorf("could not connect to postgres: %w", err)
+	}
+
+	defer store.Close()
+
+	backends, err := newBackends(cfg)
+	if err != nil {
+		return err
+	}
+
+	report, err := integrity.Check(context.Background(), store, backends, integrity.Options{BatchSize: *batchSize})
+	if err != nil {
+		return err
+	}
+
+	return printAddressReport(os.Stdout, report)
+}
+
+// newBackends connects to the signer backends the same way the lambda does,
+// without retries as the commands report failures rather than retry them
+func newBackends(cfg config.Configuration) (*registry.Registry, error) {
+	backends := map[string]models.Signer{}
+
+	for _, name := range cfg.SignerBackends {
+		name = strings.TrimSpace(name)
+
+		switch name {
+		case config.SignerBackendSepior:
+			client, err := sepior.New(cfg)
+			if err != nil {
+				return nil, fmt.Errorf("could not initialize sepior client: %w", err)
+			}
+
+			backends[name] = client
+		case config.SignerBackendKMS:
+			client, err := kms.New(cfg)
+			if err != nil {
+				return nil, fmt.Errorf("could not initialize kms client: %w", err)
+			}
+
+			backends[name] = client
+		default:
+			return nil, fmt.Errorf("unknown signer backend %q", name)
+		}
+	}
+
+	return registry.New(cfg, backends)
+}
+
+func printAddressReport(out io.Writer, report integrity.Report) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	for _, p := range report.Problems {
+		fmt.Fprintf(w, "wallet %d\tderivation path %d\tFAIL %s\t%s\n", p.WalletID, p.DerivationPathID, p.Kind, p.Detail)
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "checked %d wallets and %d derivation paths, %d verified, %d multisig skipped, %d problems\n",
+		report.Wallets, report.DerivationPaths, report.Verified, report.Skipped, len(report.Problems))
+
+	if len(report.Problems) != 0 {
+		return errVerificationFailed
+	}
+
+	return nil
+}
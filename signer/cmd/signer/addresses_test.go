@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mara-labs/transactionsigner/pkg/integrity"
+)
+
+func TestPrintAddressReport(t *testing.T) {
+	var out bytes.Buffer
+
+	err := printAddressReport(&out, integrity.Report{Wallets: 2, DerivationPaths: 2, Verified: 2})
+	require.NoError(t, err)
+	require.Contains(t, out.String(), "checked 2 wallets and 2 derivation paths, 2 verified")
+
+	out.Reset()
+
+	err = printAddressReport(&out, integrity.Report{
+		Wallets:         1,
+		DerivationPaths: 1,
+		Problems: []integrity.Problem{
+			{Kind: integrity.ProblemAddressMismatch, WalletID: 1, DerivationPathID: 1, Detail: "stored 0x1"},
+		},
+	})
+	require.ErrorIs(t, err, errVerificationFailed)
+	require.Contains(t, out.String(), "FAIL address_mismatch")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/datastore/postgres"
+	"github.com/mara-labs/transactionsigner/pkg/audit"
+)
+
+const auditUsage = `usage:
+  signer audit verify [-batch-size n] [-expect-hash hash]
+  signer audit addresses [-batch-size n]`
+
+func runAudit(args []string) error {
+	if len(args) == 0 {
+		return errors.New(auditUsage)
+	}
+
+	switch args[0] {
+	case "verify":
+		return runAuditVerify(args[1:])
+	case "addresses":
+		return runAuditAddresses(args[1:])
+	default:
+		return errors.New(auditUsage)
+	}
+}
+
+func runAuditVerify(args []string) error {
+	fs := flag.NewFlagSet("audit verify", flag.ExitOnError)
+	batchSize := fs.Int("batch-size", 500, "entries fetched per query")
+	expectHash := fs.String("expect-hash", "", "hash of the last entry recorded by a previous run, detects entries removed from the end of the log")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("could not load configuration: %w", err)
+	}
+
+	store, err := postgres.New(cfg)
+	if err != nil {
+		return fmt.Errorf("could not connect to postgres: %w", err)
+	}
+
+	defer store.Close()
+
+	report, err := audit.Verify(context.Background(), store, audit.Options{
+		BatchSize:  *batchSize,
+		ExpectHash: *expectHash,
+	})
+	if err != nil {
+		return fmt.Errorf("could not read the audit log: %w", err)
+	}
+
+	return printAuditReport(os.Stdout, report, len(*expectHash) != 0)
+}
+
+func printAuditReport(out io.Writer, report audit.Report, checkExpectedHash bool) error {
+	for _, p := range report.Problems {
+		fmt.Fprintf(out, "entry %d: FAIL %s\n", p.Seq, p.Reason)
+	}
+
+	failed := len(report.Problems) != 0
+
+	if checkExpectedHash && !report.ExpectedHashFound {
+		fmt.Fprintln(out, "FAIL the expected hash is no longer in the log, entries were removed")
+		failed = true
+	}
+
+	fmt.Fprintf(out, "checked %d entries, last entry %d has hash %s\n", report.Entries, report.LastSeq, report.LastHash)
+
+	if failed {
+		return errVerificationFailed
+	}
+
+	return nil
+}
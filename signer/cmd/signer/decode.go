@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/mara-labs/transactionsigner/pkg/ethtx"
+)
+
+var txTypeNames = map[uint8]string{
+	types.LegacyTxType:     "legacy",
+	types.AccessListTxType: "access list (EIP-2930)",
+	types.DynamicFeeTxType: "dynamic fee (EIP-1559)",
+}
+
+func runDecode(args []string) error {
+	fs := flag.NewFlagSet("decode", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: signer decode [raw_tx|signed_tx|-]")
+		fmt.Fprintln(fs.Output(), "reads the hex encoded transaction from stdin when it is omitted or -")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	raw, err := readInput(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	tx, err := ethtx.Decode(raw)
+	if err != nil {
+		return fmt.Errorf("could not decode transaction: %w", err)
+	}
+
+	return printTransaction(os.Stdout, tx)
+}
+
+func printTransaction(out io.Writer, tx *types.Transaction) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	typeName, ok := txTypeNames[tx.Type()]
+	if !ok {
+		typeName = "unknown"
+	}
+
+	fmt.Fprintf(w, "type:\t%d (%s)\n", tx.Type(), typeName)
+	fmt.Fprintf(w, "hash:\t%s\n", tx.Hash().Hex())
+
+	// legacy transactions only carry the chain id in their signature
+	if tx.Type() == types.LegacyTxType && !ethtx.IsSigned(tx) {
+		fmt.Fprintf(w, "chain id:\t%s\n", "unknown, unsigned legacy transaction")
+	} else {
+		fmt.Fprintf(w, "chain id:\t%s\n", tx.ChainId())
+	}
+
+	fmt.Fprintf(w, "nonce:\t%d\n", tx.Nonce())
+
+	if tx.To() == nil {
+		fmt.Fprintf(w, "to:\t%s\n", "contract creation")
+	} else {
+		fmt.Fprintf(w, "to:\t%s\n", tx.To().Hex())
+	}
+
+	fmt.Fprintf(w, "value:\t%s\n", tx.Value())
+	fmt.Fprintf(w, "gas:\t%d\n", tx.Gas())
+
+	if tx.Type() == types.DynamicFeeTxType {
+		fmt.Fprintf(w, "max fee per gas:\t%s\n", tx.GasFeeCap())
+		fmt.Fprintf(w, "max priority fee per gas:\t%s\n", tx.GasTipCap())
+	} else {
+		fmt.Fprintf(w, "gas price:\t%s\n", tx.GasPrice())
+	}
+
+	fmt.Fprintf(w, "data:\t%s\n", hexutil.Encode(tx.Data()))
+
+	if ethtx.IsSigned(tx) {
+		sender, err := ethtx.Sender(tx)
+		if err != nil {
+			fmt.Fprintf(w, "sender:\tcould not recover sender: %v\n", err)
+		} else {
+			fmt.Fprintf(w, "sender:\t%s\n", sender.Hex())
+		}
+
+		v, r, s := tx.RawSignatureValues()
+		fmt.Fprintf(w, "signature:\tv=%s r=%s s=%s\n", v, hexutil.EncodeBig(r), hexutil.EncodeBig(s))
+	} else {
+		fmt.Fprintf(w, "sender:\t%s\n", "unsigned")
+	}
+
+	call, err := ethtx.DecodeERC20Call(tx.Data())
+
+	switch {
+	case errors.Is(err, ethtx.ErrNotERC20Call):
+	case err != nil:
+		fmt.Fprintf(w, "erc20:\tcould not decode calldata: %v\n", err)
+	default:
+		fmt.Fprintf(w, "erc20 method:\t%s\n", call.Method)
+
+		switch call.Method {
+		case "transfer":
+			fmt.Fprintf(w, "erc20 to:\t%s\n", call.To.Hex())
+		case "approve":
+			fmt.Fprintf(w, "erc20 spender:\t%s\n", call.Spender.Hex())
+		case "transferFrom":
+			fmt.Fprintf(w, "erc20 from:\t%s\n", call.From.Hex())
+			fmt.Fprintf(w, "erc20 to:\t%s\n", call.To.Hex())
+		}
+
+		fmt.Fprintf(w, "erc20 amount:\t%s\n", call.Amount)
+	}
+
+	return w.Flush()
+}
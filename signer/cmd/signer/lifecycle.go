@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/datastore/postgres"
+	"github.com/mara-labs/transactionsigner/models"
+)
+
+const lifecycleUsage = "usage: signer lifecycle <transaction_id>"
+
+func runLifecycle(args []string) error {
+	if len(args) != 1 {
+		return errors.New(lifecycleUsage)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("could not load configuration: %w", err)
+	}
+
+	store, err := postgres.New(cfg)
+	if err != nil {
+		return fmt.Errorf("could not connect to postgres: %w", err)
+	}
+
+	defer store.Close()
+
+	trans, err := store.GetTransactionByUUID(context.Background(), args[0])
+	if err != nil {
+		return err
+	}
+
+	history, err := store.ListTransactionStates(context.Background(), trans.ID)
+	if err != nil {
+		return fmt.Errorf("could not read the state history: %w", err)
+	}
+
+	return printLifecycle(os.Stdout, trans, history)
+}
+
+func printLifecycle(out io.Writer, trans *models.Transaction, history []models.StateTransition) error {
+	fmt.Fprintf(out, "transaction %d is %s, hash %s\n", trans.ID, trans.State, trans.TRXHash)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	for _, h := range history {
+		from := string(h.From)
+		if len(from) == 0 {
+			from = "-"
+		}
+
+		fmt.Fprintf(w, "%s\t%s -> %s\t%s\t%s\n", h.Created.UTC().Format(time.RFC3339), from, h.To, h.Actor, h.Reason)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,100 @@
+// Command signer implements offline tooling to inspect and verify the
+// transactions handled by the transaction signer
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
+
+var commands = []command{
+	{
+		name:        "decode",
+		description: "decode a raw or signed transaction and print its fields",
+		run:         runDecode,
+	},
+	{
+		name:        "verify",
+		description: "verify a signed queue item against the wallets database",
+		run:         runVerify,
+	},
+	{
+		name:        "audit",
+		description: "verify the signing audit log or the addresses of the wallets",
+		run:         runAudit,
+	},
+	{
+		name:        "wallet",
+		description: "provision a wallet with a new key or the next address of a key",
+		run:         runWallet,
+	},
+	{
+		name:        "lifecycle",
+		description: "print the state history of a transaction",
+		run:         runLifecycle,
+	},
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: signer <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.description)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+
+		if err := c.run(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if name == "help" || name == "-h" || name == "--help" {
+		usage(os.Stdout)
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	usage(os.Stderr)
+	os.Exit(2)
+}
+
+// readInput returns the value of the argument or reads it from stdin when the
+// argument is empty or "-"
+func readInput(arg string) (string, error) {
+	if len(arg) != 0 && arg != "-" {
+		return arg, nil
+	}
+
+	b, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
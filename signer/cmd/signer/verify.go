@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/datastore/postgres"
+	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/ethtx"
+)
+
+var errVerificationFailed = errors.New("verification failed")
+
+// verifyCheck is the outcome of a single verification step
+type verifyCheck struct {
+	name   string
+	passed bool
+	detail string
+}
+
+type verifyExpectations struct {
+	walletID int64
+	keyID    string
+	path     string
+}
+
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	file := fs.String("file", "-", "path to a JSON encoded SignedTXQueueItem, - reads from stdin")
+	walletID := fs.Int64("wallet-id", 0, "sender_wallets row the transaction is expected to be signed by, defaults to the wallet_row_id of the item")
+	keyID := fs.String("key-id", "", "key id the wallet is expected to sign with")
+	path := fs.String("path", "", "derivation path the wallet is expected to sign with, e.g. 44/60/0/0/1")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	item, err := readSignedItem(*file)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("could not load configuration: %w", err)
+	}
+
+	store, err := postgres.New(cfg)
+	if err != nil {
+		return fmt.Errorf("could not connect to postgres: %w", err)
+	}
+
+	defer store.Close()
+
+	checks := verifyItem(context.Background(), cfg, store, item, verifyExpectations{
+		walletID: *walletID,
+		keyID:    *keyID,
+		path:     *path,
+	})
+
+	return printChecks(os.Stdout, checks)
+}
+
+func readSignedItem(file string) (models.SignedTXQueueItem, error) {
+	var item models.SignedTXQueueItem
+
+	var r io.Reader = os.Stdin
+
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return item, err
+		}
+
+		defer f.Close()
+
+		r = f
+	}
+
+	if err := json.NewDecoder(r).Decode(&item); err != nil {
+		return item, fmt.Errorf("could not decode queue item: %w", err)
+	}
+
+	return item, nil
+}
+
+// verifyItem checks that the signed transaction was produced by a wallet we
+// know about, with the key and derivation path stored for it. Checks stop at
+// the first failure that makes the following ones meaningless
+func verifyItem(ctx context.Context, cfg config.Configuration, datastore models.Datastore,
+	item models.SignedTXQueueItem, expected verifyExpectations,
+) []verifyCheck {
+	var checks []verifyCheck
+
+	tx, err := ethtx.Decode(item.SignedTX)
+	if err != nil {
+		return append(checks, verifyCheck{name: "decode", detail: err.Error()})
+	}
+
+	checks = append(checks, verifyCheck{name: "decode", passed: true, detail: tx.Hash().Hex()})
+
+	sender, err := ethtx.Sender(tx)
+	if err != nil {
+		return append(checks, verifyCheck{name: "sender", detail: err.Error()})
+	}
+
+	checks = append(checks, verifyCheck{name: "sender", passed: true, detail: sender.Hex()})
+
+	if item.Version >= models.SignedTXQueueItemV2 {
+		checks = append(checks, payloadCheck(item, tx, sender))
+	}
+
+	wallet, walletCheck := verifyWallet(ctx, datastore, item, expected, tx, sender)
+
+	checks = append(checks, walletCheck)
+
+	if wallet == nil {
+		return checks
+	}
+
+	keyCheck := verifyCheck{name: "key id", passed: true, detail: wallet.KeyID}
+	if len(expected.keyID) != 0 && expected.keyID != wallet.KeyID {
+		keyCheck.passed = false
+		keyCheck.detail = fmt.Sprintf("expected %s, wallet uses %s", expected.keyID, wallet.KeyID)
+	}
+
+	checks = append(checks, keyCheck)
+
+	derivationPath, err := datastore.GetDerivationPath(ctx, models.FindDerivationPathOptions{
+		WalletID: wallet.ID,
+	})
+	if err != nil {
+		return append(checks, verifyCheck{name: "derivation path", detail: err.Error()})
+	}
+
+	walletPath, err := derivationPath.WalletPath(wallet)
+	if err == nil {
+		err = models.ValidateDerivationPath(walletPath, config.BIP44CoinType(cfg, int64(wallet.ChainID)))
+	}
+
+	if err != nil {
+		return append(checks, verifyCheck{name: "derivation path", detail: err.Error()})
+	}
+
+	path := models.FormatDerivationPath(walletPath)
+
+	pathCheck := verifyCheck{name: "derivation path", passed: true, detail: path}
+
+	if len(expected.path) != 0 {
+		expectedPath, err := models.ParseDerivationPath(expected.path)
+		if err != nil {
+			return append(checks, verifyCheck{name: "derivation path", detail: err.Error()})
+		}
+
+		if formatted := models.FormatDerivationPath(expectedPath); formatted != path {
+			pathCheck.passed = false
+			pathCheck.detail = fmt.Sprintf("expected %s, wallet uses %s", formatted, path)
+		}
+	}
+
+	return append(checks, pathCheck)
+}
+
+// verifyWallet loads the wallet the item claims to be signed by, from the
+// expected wallet ID or the wallet_row_id of the item, and checks that the
+// transaction was signed by its address on its chain. Items without a wallet
+// ID are looked up by their sender, which only shows the sender is a known
+// wallet
+func verifyWallet(ctx context.Context, datastore models.Datastore, item models.SignedTXQueueItem,
+	expected verifyExpectations, tx *types.Transaction, sender common.Address,
+) (*models.SenderWallet, verifyCheck) {
+	walletID := expected.walletID
+	if walletID == 0 {
+		walletID = item.WalletRowID
+	}
+
+	if walletID == 0 {
+		wallet, err := datastore.FindWallet(ctx, models.FindWalletOptions{
+			Address: sender.Hex(),
+			ChainID: tx.ChainId().Int64(),
+		})
+		if err != nil {
+			return nil, verifyCheck{name: "wallet", detail: err.Error()}
+		}
+
+		return wallet, verifyCheck{
+			name:   "wallet",
+			passed: true,
+			detail: fmt.Sprintf("id=%d found by sender address", wallet.ID),
+		}
+	}
+
+	wallet, err := datastore.GetWallet(ctx, walletID)
+	if err != nil {
+		return nil, verifyCheck{name: "wallet", detail: err.Error()}
+	}
+
+	address := strings.TrimSpace(wallet.Address)
+	detail := fmt.Sprintf("id=%d address=%s chain=%d", wallet.ID, address, wallet.ChainID)
+
+	if !strings.EqualFold(address, sender.Hex()) {
+		return wallet, verifyCheck{name: "wallet", detail: fmt.Sprintf("%s, transaction is signed by %s", detail, sender.Hex())}
+	}
+
+	if int64(wallet.ChainID) != tx.ChainId().Int64() {
+		return wallet, verifyCheck{name: "wallet", detail: fmt.Sprintf("%s, transaction is for chain %s", detail, tx.ChainId())}
+	}
+
+	return wallet, verifyCheck{name: "wallet", passed: true, detail: detail}
+}
+
+// payloadCheck compares the transaction details of a versioned item with the
+// signed transaction they were taken from
+func payloadCheck(item models.SignedTXQueueItem, tx *types.Transaction, sender common.Address) verifyCheck {
+	var recipient string
+	if to := tx.To(); to != nil {
+		recipient = to.Hex()
+	}
+
+	var mismatches []string
+
+	for _, f := range []struct {
+		name           string
+		item, expected string
+	}{
+		{"tx_hash", item.TxHash, tx.Hash().Hex()},
+		{"chain_id", fmt.Sprint(item.ChainID), tx.ChainId().String()},
+		{"sender", strings.ToLower(item.Sender), strings.ToLower(sender.Hex())},
+		{"recipient", strings.ToLower(item.Recipient), strings.ToLower(recipient)},
+		{"nonce", fmt.Sprint(item.Nonce), fmt.Sprint(tx.Nonce())},
+	} {
+		if f.item != f.expected {
+			mismatches = append(mismatches, fmt.Sprintf("%s is %s, transaction has %s", f.name, f.item, f.expected))
+		}
+	}
+
+	if len(mismatches) != 0 {
+		return verifyCheck{name: "payload", detail: strings.Join(mismatches, ", ")}
+	}
+
+	return verifyCheck{name: "payload", passed: true, detail: fmt.Sprintf("version %d", item.Version)}
+}
+
+func printChecks(out io.Writer, checks []verifyCheck) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	failed := false
+
+	for _, c := range checks {
+		status := "ok"
+		if !c.passed {
+			status = "FAIL"
+			failed = true
+		}
+
+		fmt.Fprintf(w, "%s:\t%s\t%s\n", c.name, status, c.detail)
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if failed {
+		return errVerificationFailed
+	}
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/mocks"
+	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/ethtx"
+)
+
+func TestVerifyItem(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+
+	signedTX, err := types.SignNewTx(key, types.NewEIP155Signer(big.NewInt(123456)), &types.LegacyTx{
+		Nonce: 1, To: &to, Value: big.NewInt(1), Gas: 21000, GasPrice: big.NewInt(1),
+	})
+	require.NoError(t, err)
+
+	item := models.SignedTXQueueItem{SignedTX: ethtx.Encode(signedTX)}
+
+	versioned := models.SignedTXQueueItem{
+		Version:   models.SignedTXQueueItemV2,
+		SignedTX:  item.SignedTX,
+		TxHash:    signedTX.Hash().Hex(),
+		ChainID:   123456,
+		Sender:    sender.Hex(),
+		Recipient: to.Hex(),
+		Nonce:     1,
+	}
+
+	cfg := config.Configuration{BIP44CoinTypes: map[int64]uint32{123456: 614}}
+
+	tampered := versioned
+	tampered.Nonce = 2
+
+	wallet := &models.SenderWallet{ID: 1, Address: sender.Hex(), ChainID: 123456, KeyID: "key", AddressIndex: 3}
+	derivationPath := &models.DerivationPath{WalletID: 1, Purpose: 44, CoinType: 614, Account: 4, AddressIndex: 3}
+
+	tt := []struct {
+		name     string
+		item     models.SignedTXQueueItem
+		expected verifyExpectations
+		passed   bool
+		mockFn   func(*mocks.Store)
+	}{
+		{
+			name:   "signed by a known wallet",
+			item:   item,
+			passed: true,
+			mockFn: func(s *mocks.Store) {
+				s.EXPECT().FindWallet(gomock.Any(), models.FindWalletOptions{
+					Address: sender.Hex(), ChainID: 123456,
+				}).Times(1).Return(wallet, nil)
+
+				s.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
+					Return(derivationPath, nil)
+			},
+		},
+		{
+			name:   "details of a versioned item match the transaction",
+			item:   versioned,
+			passed: true,
+			mockFn: func(s *mocks.Store) {
+				s.EXPECT().FindWallet(gomock.Any(), gomock.Any()).Times(1).Return(wallet, nil)
+				s.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
+					Return(derivationPath, nil)
+			},
+		},
+		{
+			name: "details of a versioned item differ from the transaction",
+			item: tampered,
+			mockFn: func(s *mocks.Store) {
+				s.EXPECT().FindWallet(gomock.Any(), gomock.Any()).Times(1).Return(wallet, nil)
+				s.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
+					Return(derivationPath, nil)
+			},
+		},
+		{
+			name:     "key id and path match the expectations",
+			item:     item,
+			expected: verifyExpectations{keyID: "key", path: "m/44/614/4/0/3"},
+			passed:   true,
+			mockFn: func(s *mocks.Store) {
+				s.EXPECT().FindWallet(gomock.Any(), gomock.Any()).Times(1).Return(wallet, nil)
+				s.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
+					Return(derivationPath, nil)
+			},
+		},
+		{
+			name:     "unexpected derivation path",
+			item:     item,
+			expected: verifyExpectations{path: "44/614/4/0/1"},
+			mockFn: func(s *mocks.Store) {
+				s.EXPECT().FindWallet(gomock.Any(), gomock.Any()).Times(1).Return(wallet, nil)
+				s.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
+					Return(derivationPath, nil)
+			},
+		},
+		{
+			name: "address index of the wallet and its derivation path differ",
+			item: item,
+			mockFn: func(s *mocks.Store) {
+				s.EXPECT().FindWallet(gomock.Any(), gomock.Any()).Times(1).Return(wallet, nil)
+				s.EXPECT().GetDerivationPath(gomock.Any(), models.FindDerivationPathOptions{WalletID: 1}).Times(1).
+					Return(&models.DerivationPath{WalletID: 1, Purpose: 44, CoinType: 614, Account: 4, AddressIndex: 1}, nil)
+			},
+		},
+		{
+			name: "coin type is not the one of the chain",
+			item: item,
+			mockFn: func(s *mocks.Store) {
+				s.EXPECT().FindWallet(gomock.Any(), gomock.Any()).Times(1).Return(wallet, nil)
+				s.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
+					Return(&models.DerivationPath{WalletID: 1, Purpose: 44, CoinType: 60, Account: 4, AddressIndex: 3}, nil)
+			},
+		},
+		{
+			name: "sender is not a known wallet",
+			item: item,
+			mockFn: func(s *mocks.Store) {
+				s.EXPECT().FindWallet(gomock.Any(), gomock.Any()).Times(1).
+					Return(nil, models.ErrWalletNotFound)
+			},
+		},
+		{
+			name:   "signed by the wallet of the item",
+			item:   models.SignedTXQueueItem{SignedTX: item.SignedTX, WalletRowID: 1},
+			passed: true,
+			mockFn: func(s *mocks.Store) {
+				s.EXPECT().GetWallet(gomock.Any(), int64(1)).Times(1).
+					Return(&models.SenderWallet{ID: 1, Address: sender.Hex(), ChainID: 123456, KeyID: "key", AddressIndex: 3}, nil)
+				s.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
+					Return(derivationPath, nil)
+			},
+		},
+		{
+			name:     "signed by another wallet than the expected one",
+			item:     item,
+			expected: verifyExpectations{walletID: 2},
+			mockFn: func(s *mocks.Store) {
+				s.EXPECT().GetWallet(gomock.Any(), int64(2)).Times(1).
+					Return(&models.SenderWallet{ID: 2, Address: "0xe004bb7a6cd6e00d3dabf717d809e665bdeaa671", ChainID: 123456}, nil)
+				s.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
+					Return(&models.DerivationPath{WalletID: 2, Purpose: 44, CoinType: 614}, nil)
+			},
+		},
+		{
+			name:     "wallet on another chain",
+			item:     item,
+			expected: verifyExpectations{walletID: 1},
+			mockFn: func(s *mocks.Store) {
+				s.EXPECT().GetWallet(gomock.Any(), int64(1)).Times(1).
+					Return(&models.SenderWallet{ID: 1, Address: sender.Hex(), ChainID: 614, KeyID: "key", AddressIndex: 3}, nil)
+				s.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
+					Return(derivationPath, nil)
+			},
+		},
+		{
+			name:   "unsigned transaction",
+			item:   models.SignedTXQueueItem{SignedTX: "eb80830f424082791894e004bb7a6cd6e00d3dabf717d809e665bdeaa6718902b5e3af16b188000080808080"},
+			mockFn: func(*mocks.Store) {},
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mocks.NewStore(ctrl)
+			v.mockFn(store)
+
+			checks := verifyItem(context.Background(), cfg, store, v.item, v.expected)
+
+			passed := true
+			for _, c := range checks {
+				passed = passed && c.passed
+			}
+
+			require.Equal(t, v.passed, passed)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/datastore/postgres"
+	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/chains"
+	"github.com/mara-labs/transactionsigner/pkg/provisioning"
+)
+
+const walletUsage = `usage:
+  signer wallet create -user-id id -chain-id id [-network-type mainnet|testnet] [-key-id id] [-backend name] [-account n]`
+
+func runWallet(args []string) error {
+	if len(args) == 0 || args[0] != "create" {
+		return errors.New(walletUsage)
+	}
+
+	fs := flag.NewFlagSet("wallet create", flag.ExitOnError)
+	userID := fs.Int64("user-id", 0, "users row the wallet belongs to")
+	chainID := fs.Int64("chain-id", 0, "chain the wallet is used on")
+	networkType := fs.String("network-type", string(models.NetworkTypeMainnet), "mainnet or testnet")
+	keyID := fs.String("key-id", "", "derive the next address of this key instead of creating a new key")
+	backend := fs.String("backend", "", "signer backend holding the key, defaults to the routing rules")
+	account := fs.Uint("account", 0, "bip44 account of the derivation path")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("could not load configuration: %w", err)
+	}
+
+	store, err := postgres.New(cfg)
+	if err != nil {
+		return fmt.Errorf("could not connect to postgres: %w", err)
+	}
+
+	defer store.Close()
+
+	backends, err := newBackends(cfg)
+	if err != nil {
+		return err
+	}
+
+	chainRegistry, err := chains.New(cfg)
+	if err != nil {
+		return fmt.Errorf("could not load the chain registry: %w", err)
+	}
+
+	wallet, err := provisioning.New(cfg, store, backends, chainRegistry).Provision(context.Background(), provisioning.Request{
+		UserID:      *userID,
+		ChainID:     *chainID,
+		NetworkType: models.NetworkType(*networkType),
+		KeyID:       *keyID,
+		Backend:     *backend,
+		Account:     uint32(*account),
+	})
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(wallet)
+}
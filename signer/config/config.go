@@ -2,14 +2,50 @@
 package config
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/caarlos0/env/v9"
+
+	"github.com/mara-labs/transactionsigner/pkg/secrets"
+)
+
+const (
+	// RunModeLambda runs the signer behind lambda.Start
+	RunModeLambda = "lambda"
+	// RunModeWorker runs the signer as a long running process that polls
+	// the input queue
+	RunModeWorker = "worker"
 )
 
+const (
+	// SignerBackendSepior signs with the Sepior TSM nodes
+	SignerBackendSepior = "sepior"
+	// SignerBackendKMS signs with AWS KMS secp256k1 keys
+	SignerBackendKMS = "kms"
+)
+
+const (
+	// QueueBackendSQS reads and writes AWS SQS queues
+	QueueBackendSQS = "sqs"
+	// QueueBackendMemory keeps the queues in memory, for tests and local runs
+	QueueBackendMemory = "memory"
+	// QueueBackendPostgres keeps the queues in a postgres table
+	QueueBackendPostgres = "postgres"
+)
+
+const defaultSecretsRegion = "eu-west-2"
+
 // Configuration holds important config values to start and configure the way
 // the gRPC server starts up amongst others.
-// This struct is filled up directly from environmental values
+// This struct is filled up directly from environmental values. Any string
+// field can hold a secret reference such as secretsmanager://name#key,
+// ssm://param or file:///path which is resolved by Load
 type Configuration struct {
 	LogLevel    string `json:"level" env:"LOG_LEVEL"`
 	Environment string `env:"ENVIRONMENT"`
@@ -17,18 +53,133 @@ type Configuration struct {
 	WalletsPostgresDSN      string `env:"WALLETS_POSTGRES_DSN"`
 	TransactionsPostgresDSN string `env:"TRANSACTIONS_POSTGRES_DSN"`
 
+	// DatastoreCacheEnabled keeps wallets and derivation paths in memory
+	// across warm invocations. Entries of a wallet whose updated timestamp,
+	// or the one of its derivation paths, changed are loaded again
+	DatastoreCacheEnabled bool          `env:"DATASTORE_CACHE_ENABLED" envDefault:"false"`
+	DatastoreCacheTTL     time.Duration `env:"DATASTORE_CACHE_TTL" envDefault:"5m"`
+	// DatastoreCacheNegativeTTL is how long unknown wallets are remembered
+	DatastoreCacheNegativeTTL time.Duration `env:"DATASTORE_CACHE_NEGATIVE_TTL" envDefault:"30s"`
+	DatastoreCacheMaxEntries  int           `env:"DATASTORE_CACHE_MAX_ENTRIES" envDefault:"10000"`
+
 	ServiceName string `env:"SERVICE_NAME"`
+	RunMode     string `env:"RUN_MODE" envDefault:"lambda"`
+
+	// DeadlineSafetyMargin is taken off the lambda deadline so a hung call
+	// fails before lambda kills the process
+	DeadlineSafetyMargin time.Duration `env:"DEADLINE_SAFETY_MARGIN" envDefault:"10s"`
+	// MinSigningTime is the time needed to sign, record and forward a
+	// transaction. Messages are returned for retry when less is left
+	MinSigningTime time.Duration `env:"MIN_SIGNING_TIME" envDefault:"15s"`
+
+	// OutputQueueRoutes maps chain IDs, optionally with a priority, to the
+	// queue their signed transactions are written to, e.g.
+	// 1=signed_eth,1:high=signed_eth_fast. SQS_WRITE_QUEUE_NAME takes the
+	// chains without a route, leaving it empty fails them
+	OutputQueueRoutes string `env:"OUTPUT_QUEUE_ROUTES"`
+	// UserOperationQueueName takes the signed user operations of chains
+	// without a user_operation_queue in the chain registry
+	UserOperationQueueName string `env:"USER_OPERATION_QUEUE_NAME"`
+
+	// QueueBackend selects the queue implementation, the queue names are
+	// taken from SQS_WRITE_QUEUE_NAME and SQS_READ_QUEUE_NAME for all of them
+	QueueBackend string `env:"QUEUE_BACKEND" envDefault:"sqs"`
+	// QueuePostgresDSN is the database of the postgres queue, it defaults to
+	// the transactions database
+	QueuePostgresDSN string `env:"QUEUE_POSTGRES_DSN"`
+
+	// TransactionInsertFallback inserts a new transaction row when the
+	// upstream service did not create one, instead of rejecting the message
+	TransactionInsertFallback bool `env:"TRANSACTION_INSERT_FALLBACK" envDefault:"false"`
+
+	// SignedTXQueueItemVersion is the payload version of signed transactions,
+	// 1 keeps the payload consumers that predate versioning expect
+	SignedTXQueueItemVersion int `env:"SIGNED_TX_QUEUE_ITEM_VERSION" envDefault:"1"`
+
+	// MessageAuthInboundKeys lists the keys producers sign created
+	// transactions with, a JSON list usually kept behind a secret reference
+	MessageAuthInboundKeys string `env:"MESSAGE_AUTH_INBOUND_KEYS"`
+	// MessageAuthRequired rejects created transactions that are not signed
+	MessageAuthRequired bool `env:"MESSAGE_AUTH_REQUIRED" envDefault:"false"`
+	// MessageAuthOutboundKeys lists the keys signed transactions are signed
+	// with, MessageAuthOutboundKeyID selects the one in use
+	MessageAuthOutboundKeys  string `env:"MESSAGE_AUTH_OUTBOUND_KEYS"`
+	MessageAuthOutboundKeyID string `env:"MESSAGE_AUTH_OUTBOUND_KEY_ID"`
 
 	SQSRegion             string `env:"SQS_REGION"`
 	SQSWriteQueueName     string `env:"SQS_WRITE_QUEUE_NAME"`
+	SQSReadQueueName      string `env:"SQS_READ_QUEUE_NAME"`
 	SQSLocalstackEndpoint string `env:"SQS_LOCALSTACK_ENDPOINT"`
 
+	WorkerConcurrency       int           `env:"WORKER_CONCURRENCY" envDefault:"4"`
+	WorkerMaxMessages       int           `env:"WORKER_MAX_MESSAGES" envDefault:"10"`
+	WorkerWaitTime          time.Duration `env:"WORKER_WAIT_TIME" envDefault:"20s"`
+	WorkerVisibilityTimeout time.Duration `env:"WORKER_VISIBILITY_TIMEOUT" envDefault:"60s"`
+
 	SepiorSecretName         string `env:"SEPIOR_SECRET_NAME"`
 	SepiorSecretAWSRegion    string `env:"SEPIOR_SECRET_AWS_REGION"`
 	SepiorLocalstackEndpoint string `env:"SEPIOR_LOCALSTACK_ENDPOINT"`
+	// SepiorSecretTTL is how long the credentials are used before they are
+	// fetched again. Zero only refreshes them when the TSM rejects them. A
+	// failed refresh is retried after 30s, the current session is kept
+	// meanwhile
+	SepiorSecretTTL time.Duration `env:"SEPIOR_SECRET_TTL" envDefault:"15m"`
+
+	KMSRegion             string `env:"KMS_REGION"`
+	KMSLocalstackEndpoint string `env:"KMS_LOCALSTACK_ENDPOINT"`
+
+	// SignerBackends lists the signer backends that are initialized
+	SignerBackends []string `env:"SIGNER_BACKENDS" envDefault:"sepior"`
+	// SignerDefaultBackend signs for wallets that match no other route
+	SignerDefaultBackend string `env:"SIGNER_DEFAULT_BACKEND" envDefault:"sepior"`
+	// SignerKeyPrefixRoutes maps key ID prefixes to backends, e.g.
+	// arn:aws:kms:=kms,tsm-=sepior
+	SignerKeyPrefixRoutes string `env:"SIGNER_KEY_PREFIX_ROUTES"`
+	// SignerChainRoutes maps chain IDs to backends, e.g. 1=sepior,5=kms
+	SignerChainRoutes string `env:"SIGNER_CHAIN_ROUTES"`
+
+	// SignerRetryMaxAttempts bounds the attempts made for retryable signing
+	// errors, the deadline of the message bounds their duration
+	SignerRetryMaxAttempts     int           `env:"SIGNER_RETRY_MAX_ATTEMPTS" envDefault:"3"`
+	SignerRetryInitialInterval time.Duration `env:"SIGNER_RETRY_INITIAL_INTERVAL" envDefault:"200ms"`
+	SignerRetryMaxInterval     time.Duration `env:"SIGNER_RETRY_MAX_INTERVAL" envDefault:"2s"`
+	// SignerBreakerFailureThreshold is the amount of consecutive failures
+	// that opens the circuit breaker of a backend, zero disables it
+	SignerBreakerFailureThreshold uint32        `env:"SIGNER_BREAKER_FAILURE_THRESHOLD" envDefault:"5"`
+	SignerBreakerOpenTimeout      time.Duration `env:"SIGNER_BREAKER_OPEN_TIMEOUT" envDefault:"30s"`
+	SignerBreakerHalfOpenRequests uint32        `env:"SIGNER_BREAKER_HALF_OPEN_REQUESTS" envDefault:"1"`
+
+	// BIP44CoinTypes maps chain IDs to the coin type their derivation paths
+	// must use, e.g. 1:60,614:614. Chains that are not listed use
+	// DefaultBIP44CoinType
+	BIP44CoinTypes map[int64]uint32 `env:"BIP44_COIN_TYPES"`
+
+	// TestnetChainIDs lists the chains that are testnets, their transactions
+	// and wallets are never recorded as mainnet
+	TestnetChainIDs []int64 `env:"TESTNET_CHAIN_IDS"`
+
+	// ChainRegistry describes the chains the signer serves, a JSON list
+	// usually kept behind a secret reference. Without it MARA_CHAIN_ID and
+	// MARA_CHAIN_RPC describe the only known chain
+	ChainRegistry string `env:"CHAIN_REGISTRY"`
 
 	MaraChainRPC string `env:"MARA_CHAIN_RPC"`
 	MaraChainID  string `env:"MARA_CHAIN_ID"`
+	// ContractDeployers lists the wallets that may create contracts on
+	// MARA_CHAIN_ID, chains of CHAIN_REGISTRY list them in contract_deployers
+	ContractDeployers []string `env:"CONTRACT_DEPLOYERS"`
+
+	SecretsAWSRegion          string        `env:"SECRETS_AWS_REGION"`
+	SecretsLocalstackEndpoint string        `env:"SECRETS_LOCALSTACK_ENDPOINT"`
+	SecretsCacheTTL           time.Duration `env:"SECRETS_CACHE_TTL" envDefault:"5m"`
+
+	// Secrets is the resolver the secret references were resolved with.
+	// Values that are refreshed while running go through it so they share
+	// its cache
+	Secrets *secrets.Resolver
+	// SecretReferences maps the env name of every field that was read from a
+	// secret reference to that reference
+	SecretReferences map[string]string
 }
 
 // IsLocal checks if the defined environment mode for the app is "local".
@@ -37,14 +188,181 @@ type Configuration struct {
 // Must be turned off in production
 func IsLocal(cfg Configuration) bool { return strings.ToUpper(cfg.Environment) == "LOCAL" }
 
+// IsWorker checks if the app should run as a standalone worker polling the
+// input queue instead of being invoked by lambda
+func IsWorker(cfg Configuration) bool {
+	return strings.ToLower(cfg.RunMode) == RunModeWorker
+}
+
+// DefaultBIP44CoinType is the coin type of ether, derivation paths of chains
+// that are not listed in BIP44_COIN_TYPES must use it
+const DefaultBIP44CoinType = 60
+
+// BIP44CoinType returns the coin type the derivation paths of the chain must
+// use
+func BIP44CoinType(cfg Configuration, chainID int64) uint32 {
+	if coinType, ok := cfg.BIP44CoinTypes[chainID]; ok {
+		return coinType
+	}
+
+	return DefaultBIP44CoinType
+}
+
+// IsTestnetChain checks if the chain is listed in TESTNET_CHAIN_IDS
+func IsTestnetChain(cfg Configuration, chainID int64) bool {
+	return slices.Contains(cfg.TestnetChainIDs, chainID)
+}
+
+// NewSecretResolver creates the resolver used for secret references, with the
+// AWS providers pointed at localstack in local mode
+func NewSecretResolver(cfg Configuration) *secrets.Resolver {
+	opts := secrets.Options{
+		Region: cfg.SecretsAWSRegion,
+		TTL:    cfg.SecretsCacheTTL,
+	}
+
+	if len(strings.TrimSpace(opts.Region)) == 0 {
+		opts.Region = defaultSecretsRegion
+	}
+
+	if IsLocal(cfg) {
+		opts.LocalstackEndpoint = cfg.SecretsLocalstackEndpoint
+		if len(opts.LocalstackEndpoint) == 0 {
+			opts.LocalstackEndpoint = "http://host.docker.internal:4566"
+		}
+	}
+
+	return secrets.NewDefaultResolver(opts)
+}
+
 // Load creates and fills up the Configuration struct with values from the
-// environment from a .env file
+// environment from a .env file. Secret references are resolved before the
+// values are parsed, so any field can be kept behind one
 func Load() (Configuration, error) {
+	environment := environ()
+
+	// the resolver is configured from the values that are not references
+	for _, name := range resolverEnvNames {
+		if secrets.IsReference(environment[name]) {
+			return Configuration{}, fmt.Errorf("%s configures the secret resolver and can not be a secret reference", name)
+		}
+	}
+
+	var bootstrap Configuration
+
+	if err := env.ParseWithOptions(&bootstrap, env.Options{Environment: withoutReferences(environment)}); err != nil {
+		return bootstrap, err
+	}
+
+	resolver := NewSecretResolver(bootstrap)
+
+	references, err := resolveReferences(context.Background(), environment, resolver)
+	if err != nil {
+		return bootstrap, err
+	}
+
 	var cfg Configuration
 
-	if err := env.Parse(&cfg); err != nil {
+	if err := env.ParseWithOptions(&cfg, env.Options{Environment: environment}); err != nil {
 		return cfg, err
 	}
 
+	cfg.Secrets = resolver
+	cfg.SecretReferences = references
+
 	return cfg, nil
 }
+
+// resolverEnvNames are the values NewSecretResolver reads
+var resolverEnvNames = []string{"ENVIRONMENT", "SECRETS_AWS_REGION", "SECRETS_LOCALSTACK_ENDPOINT", "SECRETS_CACHE_TTL"}
+
+// environ returns the environment as a map
+func environ() map[string]string {
+	environment := map[string]string{}
+
+	for _, kv := range os.Environ() {
+		if name, value, ok := strings.Cut(kv, "="); ok {
+			environment[name] = value
+		}
+	}
+
+	return environment
+}
+
+// envNames returns the env names the fields of Configuration are read from
+func envNames() []string {
+	t := reflect.TypeOf(Configuration{})
+	names := make([]string, 0, t.NumField())
+
+	for i := 0; i < t.NumField(); i++ {
+		if name, _, _ := strings.Cut(t.Field(i).Tag.Get("env"), ","); len(name) != 0 {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// withoutReferences returns the environment without the configuration values
+// that are secret references
+func withoutReferences(environment map[string]string) map[string]string {
+	plain := make(map[string]string, len(environment))
+
+	for name, value := range environment {
+		plain[name] = value
+	}
+
+	for _, name := range envNames() {
+		if secrets.IsReference(plain[name]) {
+			delete(plain, name)
+		}
+	}
+
+	return plain
+}
+
+// resolveReferences replaces every configuration value of the environment
+// that is a secret reference with the text it points to, the field parses
+// that text as if it was set directly. It returns the references by env name
+func resolveReferences(ctx context.Context, environment map[string]string, resolver *secrets.Resolver) (map[string]string, error) {
+	references := map[string]string{}
+
+	for _, name := range envNames() {
+		ref := environment[name]
+		if !secrets.IsReference(ref) {
+			continue
+		}
+
+		value, err := resolver.Resolve(ctx, ref)
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve %s: %w", name, err)
+		}
+
+		references[name] = ref
+		environment[name] = value
+	}
+
+	return references, nil
+}
+
+// SecretValue returns the current value of the field read from the env
+// variable name. Fields that were read from a secret reference are resolved
+// again, the resolver serves them from its cache until SECRETS_CACHE_TTL
+// passed
+func SecretValue(ctx context.Context, cfg Configuration, name string) (string, error) {
+	if ref, ok := cfg.SecretReferences[name]; ok && cfg.Secrets != nil {
+		return cfg.Secrets.Resolve(ctx, ref)
+	}
+
+	v := reflect.ValueOf(cfg)
+	t := v.Type()
+
+	for i := 0; i < v.NumField(); i++ {
+		envName, _, _ := strings.Cut(t.Field(i).Tag.Get("env"), ",")
+		if envName == name && v.Field(i).Kind() == reflect.String {
+			return v.Field(i).String(), nil
+		}
+	}
+
+	return "", fmt.Errorf("no configuration field is read from %s", name)
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	dsnPath := filepath.Join(dir, "wallets-dsn")
+	require.NoError(t, os.WriteFile(dsnPath, []byte("postgres://mara:secret@db/wallets\n"), 0o600))
+
+	credsPath := filepath.Join(dir, "transactions")
+	require.NoError(t, os.WriteFile(credsPath, []byte(`{"dsn":"postgres://mara:secret@db/transactions"}`), 0o600))
+
+	t.Setenv("WALLETS_POSTGRES_DSN", "file://"+dsnPath)
+	t.Setenv("TRANSACTIONS_POSTGRES_DSN", "file://"+credsPath+"#dsn")
+	t.Setenv("SERVICE_NAME", "transaction_signer")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	require.Equal(t, "postgres://mara:secret@db/wallets", cfg.WalletsPostgresDSN)
+	require.Equal(t, "postgres://mara:secret@db/transactions", cfg.TransactionsPostgresDSN)
+	require.Equal(t, "transaction_signer", cfg.ServiceName)
+
+	require.Equal(t, "file://"+dsnPath, cfg.SecretReferences["WALLETS_POSTGRES_DSN"])
+	require.NotContains(t, cfg.SecretReferences, "SERVICE_NAME")
+
+	t.Setenv("WALLETS_POSTGRES_DSN", "file://"+filepath.Join(dir, "missing"))
+
+	_, err = Load()
+	require.Error(t, err)
+}
+
+func TestLoad_TypedReferences(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(name, value string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(value), 0o600))
+
+		return "file://" + path
+	}
+
+	t.Setenv("WORKER_CONCURRENCY", write("concurrency", "8\n"))
+	t.Setenv("DATASTORE_CACHE_ENABLED", write("cache", "true"))
+	t.Setenv("DATASTORE_CACHE_TTL", write("ttl", "2m"))
+	t.Setenv("SIGNER_BACKENDS", write("backends", "kms,sepior"))
+	t.Setenv("BIP44_COIN_TYPES", write("coin-types", "614:614"))
+
+	cfg, err := Load()
+	require.NoError(t, err)
+
+	// the resolved text goes through the parser of the field
+	require.Equal(t, 8, cfg.WorkerConcurrency)
+	require.True(t, cfg.DatastoreCacheEnabled)
+	require.Equal(t, 2*time.Minute, cfg.DatastoreCacheTTL)
+	require.Equal(t, []string{"kms", "sepior"}, cfg.SignerBackends)
+	require.Equal(t, map[int64]uint32{614: 614}, cfg.BIP44CoinTypes)
+	require.Contains(t, cfg.SecretReferences, "WORKER_CONCURRENCY")
+
+	t.Setenv("WORKER_CONCURRENCY", write("concurrency", "many"))
+
+	_, err = Load()
+	require.Error(t, err)
+
+	t.Setenv("WORKER_CONCURRENCY", "8")
+	t.Setenv("SECRETS_CACHE_TTL", write("secrets-ttl", "1m"))
+
+	_, err = Load()
+	require.ErrorContains(t, err, "SECRETS_CACHE_TTL")
+}
+
+func TestSecretValue(t *testing.T) {
+	keysPath := filepath.Join(t.TempDir(), "keys")
+	require.NoError(t, os.WriteFile(keysPath, []byte(`[{"id":"k1"}]`), 0o600))
+
+	t.Setenv("MESSAGE_AUTH_INBOUND_KEYS", "file://"+keysPath)
+	t.Setenv("SERVICE_NAME", "transaction_signer")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	require.Equal(t, `[{"id":"k1"}]`, cfg.MessageAuthInboundKeys)
+
+	require.NoError(t, os.WriteFile(keysPath, []byte(`[{"id":"k2"}]`), 0o600))
+
+	value, err := SecretValue(context.Background(), cfg, "MESSAGE_AUTH_INBOUND_KEYS")
+	require.NoError(t, err)
+	require.Equal(t, `[{"id":"k1"}]`, value, "the cached value is used until the ttl passed")
+
+	cfg.Secrets.Invalidate(cfg.SecretReferences["MESSAGE_AUTH_INBOUND_KEYS"])
+
+	value, err = SecretValue(context.Background(), cfg, "MESSAGE_AUTH_INBOUND_KEYS")
+	require.NoError(t, err)
+	require.Equal(t, `[{"id":"k2"}]`, value)
+
+	value, err = SecretValue(context.Background(), cfg, "SERVICE_NAME")
+	require.NoError(t, err)
+	require.Equal(t, "transaction_signer", value)
+
+	_, err = SecretValue(context.Background(), cfg, "UNKNOWN")
+	require.Error(t, err)
+}
+
+func TestBIP44CoinType(t *testing.T) {
+	cfg := Configuration{BIP44CoinTypes: map[int64]uint32{614: 614}}
+
+	require.Equal(t, uint32(614), BIP44CoinType(cfg, 614))
+	require.Equal(t, uint32(DefaultBIP44CoinType), BIP44CoinType(cfg, 1))
+}
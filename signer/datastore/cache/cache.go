@@ -0,0 +1,265 @@
+// Package cache implements a read-through cache of wallets and derivation
+// paths in front of a datastore. It is kept in memory so it survives warm
+// lambda invocations.
+//
+// Every hit checks the updated timestamps of the wallet and its derivation
+// paths first, an entry of a wallet that changed, e.g. moved to another key,
+// is dropped and loaded again before DATASTORE_CACHE_TTL passed
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	ddlambda "github.com/DataDog/datadog-lambda-go"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/models"
+)
+
+const (
+	hitMetric  = "transaction_signer.cache.hit"
+	missMetric = "transaction_signer.cache.miss"
+
+	entityWallet         = "wallet"
+	entityDerivationPath = "derivation_path"
+)
+
+type entry struct {
+	key string
+
+	wallet         *models.SenderWallet
+	derivationPath *models.DerivationPath
+	// err is set for negative entries
+	err error
+	// version is the version of the wallet read before the entry was
+	// loaded, the entry is dropped once the wallet has another one
+	version models.WalletVersion
+
+	expiresAt time.Time
+}
+
+// Store caches GetWallet and GetDerivationPath of the wrapped datastore, every
+// other call goes straight through
+type Store struct {
+	models.Datastore
+
+	ttl         time.Duration
+	negativeTTL time.Duration
+	maxEntries  int
+	now         func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+// New wraps datastore with a cache configured by the DATASTORE_CACHE_*
+// values
+func New(datastore models.Datastore, cfg config.Configuration) *Store {
+	return &Store{
+		Datastore:   datastore,
+		ttl:         cfg.DatastoreCacheTTL,
+		negativeTTL: cfg.DatastoreCacheNegativeTTL,
+		maxEntries:  cfg.DatastoreCacheMaxEntries,
+		now:         time.Now,
+		entries:     map[string]*list.Element{},
+		lru:         list.New(),
+	}
+}
+
+// GetWallet returns the cached wallet or loads it
+func (s *Store) GetWallet(ctx context.Context, walletRowID int64) (*models.SenderWallet, error) {
+	key := walletKey(walletRowID)
+
+	e, err := s.current(ctx, key, walletRowID)
+	if err != nil {
+		return nil, err
+	}
+
+	if e != nil {
+		hit(entityWallet)
+
+		if e.err != nil {
+			return nil, e.err
+		}
+
+		wallet := *e.wallet
+
+		return &wallet, nil
+	}
+
+	miss(entityWallet)
+
+	// the version is read first, a change made while the wallet is loaded
+	// is then seen on the next read
+	version, err := s.Datastore.GetWalletVersion(ctx, walletRowID)
+	if err != nil && !errors.Is(err, models.ErrWalletNotFound) {
+		return nil, err
+	}
+
+	wallet, err := s.Datastore.GetWallet(ctx, walletRowID)
+	if errors.Is(err, models.ErrWalletNotFound) {
+		s.store(&entry{key: key, err: err}, s.negativeTTL)
+		return nil, err
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	cached := *wallet
+	s.store(&entry{key: key, wallet: &cached, version: version}, s.ttl)
+
+	return wallet, nil
+}
+
+// GetDerivationPath returns the cached derivation path of the wallet or loads
+// it
+func (s *Store) GetDerivationPath(ctx context.Context, opts models.FindDerivationPathOptions) (*models.DerivationPath, error) {
+	key := derivationPathKey(opts.WalletID)
+
+	e, err := s.current(ctx, key, opts.WalletID)
+	if err != nil {
+		return nil, err
+	}
+
+	if e != nil {
+		hit(entityDerivationPath)
+
+		if e.err != nil {
+			return nil, e.err
+		}
+
+		derivationPath := *e.derivationPath
+
+		return &derivationPath, nil
+	}
+
+	miss(entityDerivationPath)
+
+	version, err := s.Datastore.GetWalletVersion(ctx, opts.WalletID)
+	if err != nil && !errors.Is(err, models.ErrWalletNotFound) {
+		return nil, err
+	}
+
+	derivationPath, err := s.Datastore.GetDerivationPath(ctx, opts)
+	if errors.Is(err, models.ErrDerivationPathNotFound) {
+		s.store(&entry{key: key, err: err, version: version}, s.negativeTTL)
+		return nil, err
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	cached := *derivationPath
+	s.store(&entry{key: key, derivationPath: &cached, version: version}, s.ttl)
+
+	return derivationPath, nil
+}
+
+// current returns the entry while it has not expired and the wallet and its
+// derivation paths are unchanged, an entry of a changed wallet is dropped.
+// Unknown wallets are not checked, they are only kept for the negative TTL
+func (s *Store) current(ctx context.Context, key string, walletRowID int64) (*entry, error) {
+	e, ok := s.lookup(key)
+	if !ok {
+		return nil, nil
+	}
+
+	if errors.Is(e.err, models.ErrWalletNotFound) {
+		return e, nil
+	}
+
+	version, err := s.Datastore.GetWalletVersion(ctx, walletRowID)
+	if err != nil && !errors.Is(err, models.ErrWalletNotFound) {
+		return nil, err
+	}
+
+	if !version.Equal(e.version) {
+		s.remove(key)
+		return nil, nil
+	}
+
+	return e, nil
+}
+
+// Purge drops every cached entry
+func (s *Store) Purge() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = map[string]*list.Element{}
+	s.lru.Init()
+}
+
+// lookup returns the entry if it has not expired yet
+func (s *Store) lookup(key string) (*entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*entry)
+	if !s.now().Before(e.expiresAt) {
+		return nil, false
+	}
+
+	s.lru.MoveToFront(el)
+
+	return e, true
+}
+
+func (s *Store) store(e *entry, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	e.expiresAt = s.now().Add(ttl)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[e.key]; ok {
+		el.Value = e
+		s.lru.MoveToFront(el)
+
+		return
+	}
+
+	s.entries[e.key] = s.lru.PushFront(e)
+
+	for s.maxEntries > 0 && s.lru.Len() > s.maxEntries {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(*entry).key)
+	}
+}
+
+func (s *Store) remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[key]; ok {
+		s.lru.Remove(el)
+		delete(s.entries, key)
+	}
+}
+
+func walletKey(walletRowID int64) string { return fmt.Sprintf("wallet:%d", walletRowID) }
+
+func derivationPathKey(walletRowID int64) string {
+	return fmt.Sprintf("derivation_path:%d", walletRowID)
+}
+
+func hit(entity string) { ddlambda.Metric(hitMetric, 1, "entity:"+entity) }
+
+func miss(entity string) { ddlambda.Metric(missMetric, 1, "entity:"+entity) }
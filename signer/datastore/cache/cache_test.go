@@ -0,0 +1,238 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/mocks"
+	"github.com/mara-labs/transactionsigner/models"
+)
+
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+// versions are the wallet versions the test datastore reports, wallets
+// without one do not exist
+type versions map[int64]models.WalletVersion
+
+func newTestStore(t *testing.T, maxEntries int) (*Store, *mocks.Store, *clock, versions) {
+	ctrl := gomock.NewController(t)
+	next := mocks.NewStore(ctrl)
+
+	c := &clock{now: time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)}
+
+	v := versions{1: {WalletUpdated: time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC), DerivationPaths: 1}}
+
+	next.EXPECT().GetWalletVersion(gomock.Any(), gomock.Any()).AnyTimes().
+		DoAndReturn(func(_ context.Context, walletRowID int64) (models.WalletVersion, error) {
+			version, ok := v[walletRowID]
+			if !ok {
+				return models.WalletVersion{}, models.ErrWalletNotFound
+			}
+
+			return version, nil
+		})
+
+	s := New(next, config.Configuration{
+		DatastoreCacheTTL:         time.Minute,
+		DatastoreCacheNegativeTTL: 10 * time.Second,
+		DatastoreCacheMaxEntries:  maxEntries,
+	})
+	s.now = c.Now
+
+	return s, next, c, v
+}
+
+func TestStore_GetWallet(t *testing.T) {
+	ctx := context.Background()
+	wallet := &models.SenderWallet{ID: 1, KeyID: "MizBEqdhZ160syGCPFxYo6Lkxbiw", Updated: time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)}
+
+	t.Run("wallets are cached until they expire", func(t *testing.T) {
+		s, next, c, _ := newTestStore(t, 10)
+		next.EXPECT().GetWallet(ctx, int64(1)).Times(2).Return(wallet, nil)
+
+		for i := 0; i < 3; i++ {
+			got, err := s.GetWallet(ctx, 1)
+			require.NoError(t, err)
+			require.Equal(t, wallet, got)
+		}
+
+		c.now = c.now.Add(time.Minute)
+
+		_, err := s.GetWallet(ctx, 1)
+		require.NoError(t, err)
+	})
+
+	t.Run("a changed wallet is loaded again before the ttl", func(t *testing.T) {
+		s, next, _, v := newTestStore(t, 10)
+
+		moved := *wallet
+		moved.KeyID = "other-key"
+
+		gomock.InOrder(
+			next.EXPECT().GetWallet(ctx, int64(1)).Return(wallet, nil),
+			next.EXPECT().GetWallet(ctx, int64(1)).Return(&moved, nil),
+		)
+
+		got, err := s.GetWallet(ctx, 1)
+		require.NoError(t, err)
+		require.Equal(t, wallet, got)
+
+		version := v[1]
+		version.WalletUpdated = time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+		v[1] = version
+
+		for i := 0; i < 2; i++ {
+			got, err = s.GetWallet(ctx, 1)
+			require.NoError(t, err)
+			require.Equal(t, &moved, got)
+		}
+	})
+
+	t.Run("unknown wallets are cached for the negative ttl", func(t *testing.T) {
+		s, next, c, _ := newTestStore(t, 10)
+		next.EXPECT().GetWallet(ctx, int64(2)).Times(2).Return(nil, models.ErrWalletNotFound)
+
+		for i := 0; i < 2; i++ {
+			_, err := s.GetWallet(ctx, 2)
+			require.ErrorIs(t, err, models.ErrWalletNotFound)
+		}
+
+		c.now = c.now.Add(10 * time.Second)
+
+		_, err := s.GetWallet(ctx, 2)
+		require.ErrorIs(t, err, models.ErrWalletNotFound)
+	})
+
+	t.Run("other errors are not cached", func(t *testing.T) {
+		s, next, _, _ := newTestStore(t, 10)
+		next.EXPECT().GetWallet(ctx, int64(1)).Return(nil, errors.New("connection refused"))
+		next.EXPECT().GetWallet(ctx, int64(1)).Return(wallet, nil)
+
+		_, err := s.GetWallet(ctx, 1)
+		require.Error(t, err)
+
+		got, err := s.GetWallet(ctx, 1)
+		require.NoError(t, err)
+		require.Equal(t, wallet, got)
+	})
+
+	t.Run("callers can not modify cached wallets", func(t *testing.T) {
+		s, next, _, _ := newTestStore(t, 10)
+		next.EXPECT().GetWallet(ctx, int64(1)).Return(&models.SenderWallet{ID: 1, KeyID: "MizBEqdhZ160syGCPFxYo6Lkxbiw"}, nil)
+
+		got, err := s.GetWallet(ctx, 1)
+		require.NoError(t, err)
+
+		got.KeyID = "changed"
+
+		got, err = s.GetWallet(ctx, 1)
+		require.NoError(t, err)
+		require.Equal(t, "MizBEqdhZ160syGCPFxYo6Lkxbiw", got.KeyID)
+	})
+
+	t.Run("least recently used entries are evicted", func(t *testing.T) {
+		s, next, _, _ := newTestStore(t, 2)
+		next.EXPECT().GetWallet(ctx, int64(1)).Return(wallet, nil)
+		next.EXPECT().GetWallet(ctx, int64(2)).Return(wallet, nil)
+		next.EXPECT().GetWallet(ctx, int64(3)).Return(wallet, nil)
+		next.EXPECT().GetWallet(ctx, int64(2)).Return(wallet, nil)
+
+		for _, id := range []int64{1, 2, 1, 3, 1, 2} {
+			_, err := s.GetWallet(ctx, id)
+			require.NoError(t, err)
+		}
+	})
+}
+
+func TestStore_GetDerivationPath(t *testing.T) {
+	ctx := context.Background()
+	opts := models.FindDerivationPathOptions{WalletID: 1}
+	path := &models.DerivationPath{ID: 1, WalletID: 1, Purpose: 44, CoinType: 60, AddressIndex: 3}
+
+	t.Run("paths are cached", func(t *testing.T) {
+		s, next, _, _ := newTestStore(t, 10)
+		next.EXPECT().GetDerivationPath(ctx, opts).Return(path, nil)
+
+		for i := 0; i < 2; i++ {
+			got, err := s.GetDerivationPath(ctx, opts)
+			require.NoError(t, err)
+			require.Equal(t, path, got)
+		}
+	})
+
+	t.Run("missing paths are cached for the negative ttl", func(t *testing.T) {
+		s, next, c, _ := newTestStore(t, 10)
+		next.EXPECT().GetDerivationPath(ctx, opts).Times(2).Return(nil, models.ErrDerivationPathNotFound)
+
+		for i := 0; i < 2; i++ {
+			_, err := s.GetDerivationPath(ctx, opts)
+			require.ErrorIs(t, err, models.ErrDerivationPathNotFound)
+		}
+
+		c.now = c.now.Add(10 * time.Second)
+
+		_, err := s.GetDerivationPath(ctx, opts)
+		require.ErrorIs(t, err, models.ErrDerivationPathNotFound)
+	})
+
+	t.Run("paths of unchanged wallets are kept", func(t *testing.T) {
+		s, next, c, _ := newTestStore(t, 10)
+		next.EXPECT().GetDerivationPath(ctx, opts).Times(1).Return(path, nil)
+
+		for i := 0; i < 2; i++ {
+			_, err := s.GetDerivationPath(ctx, opts)
+			require.NoError(t, err)
+
+			c.now = c.now.Add(30 * time.Second)
+		}
+	})
+
+	t.Run("a changed derivation path is loaded again before the ttl", func(t *testing.T) {
+		s, next, _, v := newTestStore(t, 10)
+
+		moved := *path
+		moved.AddressIndex = 4
+
+		gomock.InOrder(
+			next.EXPECT().GetDerivationPath(ctx, opts).Return(path, nil),
+			next.EXPECT().GetDerivationPath(ctx, opts).Return(&moved, nil),
+		)
+
+		_, err := s.GetDerivationPath(ctx, opts)
+		require.NoError(t, err)
+
+		version := v[1]
+		version.DerivationPathUpdated = time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+		v[1] = version
+
+		got, err := s.GetDerivationPath(ctx, opts)
+		require.NoError(t, err)
+		require.Equal(t, &moved, got)
+	})
+
+	t.Run("errors of the version check are returned", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		next := mocks.NewStore(ctrl)
+		s := New(next, config.Configuration{DatastoreCacheTTL: time.Minute})
+
+		gomock.InOrder(
+			next.EXPECT().GetWalletVersion(ctx, int64(1)).Return(models.WalletVersion{}, nil),
+			next.EXPECT().GetDerivationPath(ctx, opts).Return(path, nil),
+			next.EXPECT().GetWalletVersion(ctx, int64(1)).Return(models.WalletVersion{}, errors.New("connection refused")),
+		)
+
+		_, err := s.GetDerivationPath(ctx, opts)
+		require.NoError(t, err)
+
+		_, err = s.GetDerivationPath(ctx, opts)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mara-labs/transactionsigner/models"
+)
+
+// auditLockID is the advisory lock serializing appends to the audit log so
+// sequence numbers are contiguous and every entry links to the last one
+const auditLockID = 0x7369676e
+
+// AppendAuditEntry appends the entry to the signing audit log, chaining it to
+// the last entry
+func (s *Store) AppendAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	tx, err := s.transactionsDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback() //nolint: errcheck
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", auditLockID); err != nil {
+		return err
+	}
+
+	var (
+		lastSeq  int64
+		lastHash = models.AuditGenesisHash
+	)
+
+	err = tx.QueryRowContext(ctx, "SELECT seq, hash FROM signing_audit_log ORDER BY seq DESC LIMIT 1").
+		Scan(&lastSeq, &lastHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	entry.Seq = lastSeq + 1
+	entry.PrevHash = lastHash
+	entry.Created = time.Now().UTC().Truncate(time.Microsecond)
+	entry.Hash = entry.ComputeHash()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO signing_audit_log
+(seq, key_id, derivation_path, unsigned_hash, signed_hash, request_id, message_id, policy_decision, error, created, prev_hash, hash)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		entry.Seq, entry.KeyID, entry.DerivationPath, entry.UnsignedHash, entry.SignedHash,
+		entry.RequestID, entry.MessageID, string(entry.PolicyDecision), entry.Error,
+		entry.Created, entry.PrevHash, entry.Hash)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListAuditEntries retrieves audit entries in sequence order
+func (s *Store) ListAuditEntries(ctx context.Context, afterSeq int64, limit int) ([]models.AuditEntry, error) {
+	rows, err := s.transactionsDB.QueryContext(ctx, `SELECT
+seq, key_id, derivation_path, unsigned_hash, signed_hash, request_id, message_id, policy_decision, error, created, prev_hash, hash
+FROM signing_audit_log WHERE seq > $1 ORDER BY seq LIMIT $2`, afterSeq, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+
+	for rows.Next() {
+		var (
+			entry          models.AuditEntry
+			policyDecision string
+		)
+
+		if err := rows.Scan(&entry.Seq, &entry.KeyID, &entry.DerivationPath, &entry.UnsignedHash,
+			&entry.SignedHash, &entry.RequestID, &entry.MessageID, &policyDecision, &entry.Error,
+			&entry.Created, &entry.PrevHash, &entry.Hash); err != nil {
+			return nil, err
+		}
+
+		entry.PolicyDecision = models.PolicyDecision(policyDecision)
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
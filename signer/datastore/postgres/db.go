@@ -6,9 +6,12 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"math/big"
+	"strings"
 
 	"github.com/ericlagergren/decimal"
 	"github.com/lib/pq"
+	"github.com/volatiletech/null/v8"
 	"github.com/volatiletech/sqlboiler/v4/boil"
 	"github.com/volatiletech/sqlboiler/v4/queries/qm"
 	"github.com/volatiletech/sqlboiler/v4/types"
@@ -24,6 +27,10 @@ import (
 type Store struct {
 	walletsDB      *sql.DB
 	transactionsDB *sql.DB
+
+	// actor is recorded with the state changes the store makes on behalf of
+	// the service
+	actor string
 }
 
 // New creates a new store backed by Postgres
@@ -50,9 +57,15 @@ func New(cfg config.Configuration) (*Store, error) {
 
 	boil.DebugMode = config.IsLocal(cfg)
 
+	actor := cfg.ServiceName
+	if len(actor) == 0 {
+		actor = defaultActor
+	}
+
 	return &Store{
 		transactionsDB: db,
 		walletsDB:      walletsDB,
+		actor:          actor,
 	}, nil
 }
 
@@ -65,29 +78,62 @@ func (s *Store) Close() error {
 	return s.transactionsDB.Close()
 }
 
-// GetDerivationPath retrieves the bip32 path for the given keyID
+// GetDerivationPath retrieves the bip32 path of the given wallet. A wallet
+// with more than one path is reported instead of picking one of them
 func (s *Store) GetDerivationPath(ctx context.Context, opts models.FindDerivationPathOptions) (*models.DerivationPath, error) {
-	derivedPathFromDB, err := dbmodels.DerivationPaths(
-		qm.InnerJoin(`sender_wallets as w ON w.id = "derivation_paths".wallet_id AND w.key_id = ?`, opts.KeyID)).
-		One(ctx, s.walletsDB)
-	if errors.Is(err, sql.ErrNoRows) {
+	derivedPathsFromDB, err := dbmodels.DerivationPaths(
+		dbmodels.DerivationPathWhere.WalletID.EQ(null.IntFrom(int(opts.WalletID))),
+		qm.OrderBy("id"),
+		qm.Limit(2)).
+		All(ctx, s.walletsDB)
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(derivedPathsFromDB) {
+	case 0:
 		return nil, models.ErrDerivationPathNotFound
+	case 1:
+	default:
+		return nil, fmt.Errorf("%w: wallet %d", models.ErrAmbiguousDerivationPath, opts.WalletID)
 	}
 
+	return toDerivationPath(derivedPathsFromDB[0]), nil
+}
+
+// ListDerivationPaths returns at most limit derivation paths with an id
+// greater than afterID, in order
+func (s *Store) ListDerivationPaths(ctx context.Context, afterID int64, limit int) ([]models.DerivationPath, error) {
+	derivedPathsFromDB, err := dbmodels.DerivationPaths(
+		qm.Where("id > ?", afterID),
+		qm.OrderBy("id"),
+		qm.Limit(limit)).
+		All(ctx, s.walletsDB)
 	if err != nil {
 		return nil, err
 	}
 
+	paths := make([]models.DerivationPath, 0, len(derivedPathsFromDB))
+
+	for _, derivedPathFromDB := range derivedPathsFromDB {
+		paths = append(paths, *toDerivationPath(derivedPathFromDB))
+	}
+
+	return paths, nil
+}
+
+func toDerivationPath(derivedPathFromDB *dbmodels.DerivationPath) *models.DerivationPath {
 	return &models.DerivationPath{
-		ID:       int64(derivedPathFromDB.ID),
-		WalletID: uint32(derivedPathFromDB.WalletID.Int),
-		Purpose:  uint32(derivedPathFromDB.Purpose),
-		CoinType: uint32(derivedPathFromDB.CoinType),
-		Account:  uint32(derivedPathFromDB.Account),
-		Change:   uint32(derivedPathFromDB.Change),
-		Created:  derivedPathFromDB.Created,
-		Updated:  derivedPathFromDB.Updated,
-	}, nil
+		ID:           int64(derivedPathFromDB.ID),
+		WalletID:     uint32(derivedPathFromDB.WalletID.Int),
+		Purpose:      uint32(derivedPathFromDB.Purpose),
+		CoinType:     uint32(derivedPathFromDB.CoinType),
+		Account:      uint32(derivedPathFromDB.Account),
+		Change:       uint32(derivedPathFromDB.Change),
+		AddressIndex: uint32(derivedPathFromDB.AddressIndex),
+		Created:      derivedPathFromDB.Created,
+		Updated:      derivedPathFromDB.Updated,
+	}
 }
 
 // GetWallet retrieves the wallet that has the accompanying address
@@ -103,17 +149,94 @@ func (s *Store) GetWallet(ctx context.Context, walletRowID int64) (*models.Sende
 		return nil, err
 	}
 
+	return toSenderWallet(retrievedWallet), nil
+}
+
+// GetWalletVersion returns the updated timestamps of the wallet and of its
+// newest derivation path, and how many paths it has
+func (s *Store) GetWalletVersion(ctx context.Context, walletRowID int64) (models.WalletVersion, error) {
+	var (
+		version     models.WalletVersion
+		pathUpdated sql.NullTime
+	)
+
+	err := s.walletsDB.QueryRowContext(ctx, `SELECT w.updated, max(d.updated), count(d.id)
+FROM sender_wallets w LEFT JOIN derivation_paths d ON d.wallet_id = w.id
+WHERE w.id = $1 GROUP BY w.id, w.updated`, walletRowID).
+		Scan(&version.WalletUpdated, &pathUpdated, &version.DerivationPaths)
+	if errors.Is(err, sql.ErrNoRows) {
+		return version, models.ErrWalletNotFound
+	}
+
+	if err != nil {
+		return version, err
+	}
+
+	version.DerivationPathUpdated = pathUpdated.Time
+
+	return version, nil
+}
+
+// FindWallet retrieves the wallet that owns the given address. The address is
+// compared case insensitively as checksummed and lower case forms are both
+// stored
+func (s *Store) FindWallet(ctx context.Context, opts models.FindWalletOptions) (*models.SenderWallet, error) {
+	mods := []qm.QueryMod{
+		qm.Where("lower(trim(address)) = lower(?)", strings.TrimSpace(opts.Address)),
+	}
+
+	if opts.ChainID != 0 {
+		mods = append(mods, qm.Where("chain_id = ?", opts.ChainID))
+	}
+
+	retrievedWallet, err := dbmodels.SenderWallets(mods...).One(ctx, s.walletsDB)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrWalletNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return toSenderWallet(retrievedWallet), nil
+}
+
+// ListWallets returns at most limit wallets with an id greater than afterID,
+// in order
+func (s *Store) ListWallets(ctx context.Context, afterID int64, limit int) ([]models.SenderWallet, error) {
+	retrievedWallets, err := dbmodels.SenderWallets(
+		qm.Where("id > ?", afterID),
+		qm.OrderBy("id"),
+		qm.Limit(limit)).
+		All(ctx, s.walletsDB)
+	if err != nil {
+		return nil, err
+	}
+
+	wallets := make([]models.SenderWallet, 0, len(retrievedWallets))
+
+	for _, retrievedWallet := range retrievedWallets {
+		wallets = append(wallets, *toSenderWallet(retrievedWallet))
+	}
+
+	return wallets, nil
+}
+
+func toSenderWallet(retrievedWallet *dbmodels.SenderWallet) *models.SenderWallet {
 	return &models.SenderWallet{
-		UserID:       retrievedWallet.UserID.Int,
-		ID:           int64(retrievedWallet.ID),
-		Address:      retrievedWallet.Address,
-		ChainID:      retrievedWallet.ChainID,
-		KeyID:        retrievedWallet.KeyID,
-		IsMultisig:   retrievedWallet.IsMultisig,
-		Created:      retrievedWallet.Created,
-		Updated:      retrievedWallet.Updated,
-		AddressIndex: retrievedWallet.AddressIndex,
-	}, nil
+		UserID:        retrievedWallet.UserID.Int,
+		ID:            int64(retrievedWallet.ID),
+		Address:       retrievedWallet.Address,
+		ChainID:       retrievedWallet.ChainID,
+		KeyID:         retrievedWallet.KeyID,
+		IsMultisig:    retrievedWallet.IsMultisig,
+		Created:       retrievedWallet.Created,
+		Updated:       retrievedWallet.Updated,
+		AddressIndex:  retrievedWallet.AddressIndex,
+		SignerBackend: retrievedWallet.SignerBackend.String,
+		AddressType:   models.AddressType(retrievedWallet.AddressType),
+		NetworkType:   models.NetworkType(retrievedWallet.NetworkType),
+	}
 }
 
 // CreateTransaction persists a transaction into the db
@@ -138,5 +261,96 @@ func (s *Store) CreateTransaction(ctx context.Context, trans *models.Transaction
 		Amount:            types.NewDecimal(amount),
 	}
 
-	return t.Insert(ctx, s.transactionsDB, boil.Infer())
+	if len(trans.TransactionUUID) != 0 {
+		t.TransactionUUID = null.StringFrom(trans.TransactionUUID)
+	}
+
+	if len(trans.BytecodeHash) != 0 {
+		t.ContractBytecodeHash = null.StringFrom(trans.BytecodeHash)
+	}
+
+	if len(trans.SignedTX) != 0 {
+		t.SignedTX = null.StringFrom(trans.SignedTX)
+	}
+
+	tx, err := s.transactionsDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback() //nolint: errcheck
+
+	if err := t.Insert(ctx, tx, boil.Infer()); err != nil {
+		return err
+	}
+
+	err = s.recordTransition(ctx, tx, t.ID, "", models.TransitionOptions{
+		To:     trans.State,
+		Reason: "inserted by the signer",
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// the row ID and timestamps are set by the database
+	trans.ID = t.ID
+	trans.Created = t.Created
+	trans.Updated = t.Updated
+
+	return nil
+}
+
+// GetTransactionByUUID retrieves the transaction the upstream service created
+// with the given ID
+func (s *Store) GetTransactionByUUID(ctx context.Context, transactionUUID string) (*models.Transaction, error) {
+	t, err := transactions.Transactions(
+		transactions.TransactionWhere.TransactionUUID.EQ(null.StringFrom(transactionUUID))).
+		One(ctx, s.transactionsDB)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrTransactionNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return toTransaction(t), nil
+}
+
+func toTransaction(t *transactions.Transaction) *models.Transaction {
+	trans := &models.Transaction{
+		ID:                t.ID,
+		TRXHash:           t.TRXHash,
+		ChainID:           int64(t.ChainID),
+		NetworkType:       models.NetworkType(t.NetworkType),
+		State:             models.State(t.State),
+		TransferType:      models.TransferType(t.TransferType),
+		SenderAddress:     t.SenderAddress,
+		RecipientAddress:  t.RecipientAddress,
+		Nonce:             int64(t.Nonce),
+		IsSenderPayingGas: t.IsSenderPayingGas,
+		TransactionUUID:   t.TransactionUUID.String,
+		BytecodeHash:      t.ContractBytecodeHash.String,
+		SignedTX:          t.SignedTX.String,
+		Created:           t.Created,
+		Updated:           t.Updated,
+	}
+
+	if t.Amount.Big != nil {
+		trans.Amount = t.Amount.Big.Float(new(big.Float))
+	}
+
+	if t.MaxFee.Big != nil {
+		trans.MaxFee, _ = t.MaxFee.Big.Int64()
+	}
+
+	if t.MaxPriorityFee.Big != nil {
+		trans.MaxPriorityFee, _ = t.MaxPriorityFee.Big.Int64()
+	}
+
+	return trans
 }
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"os"
 	"strings"
 	"testing"
 
@@ -20,6 +21,7 @@ import (
 	_ "github.com/lib/pq"
 	"github.com/mara-labs/transactionsigner/config"
 	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/audit"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"github.com/testcontainers/testcontainers-go"
@@ -106,6 +108,23 @@ func (p *PostgresDatabaseTestSuite) SetupTest() {
 			require.NoError(p.T(), err)
 		}
 
+		// migrations owned by the signer are tracked separately from the
+		// chain-db ones so both sets can be applied to the same database
+		if _, err := os.Stat(fmt.Sprintf("migrations/%s", extraPath)); err == nil {
+			signerDriver, err := postgres.WithInstance(db, &postgres.Config{MigrationsTable: "signer_schema_migrations"})
+			require.NoError(p.T(), err)
+
+			signerMigrator, err := migrate.NewWithDatabaseInstance(
+				fmt.Sprintf("file://migrations/%s", extraPath),
+				"postgres", signerDriver)
+			require.NoError(p.T(), err)
+
+			err = signerMigrator.Up()
+			if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+				require.NoError(p.T(), err)
+			}
+		}
+
 		fixtures, err := testfixtures.New(
 			testfixtures.Database(db),
 			testfixtures.Dialect("postgres"),
@@ -164,9 +183,10 @@ func (p *PostgresDatabaseTestSuite) TestGetSenderWallet() {
 	require.NoError(p.T(), err)
 
 	tt := []struct {
-		valid   bool
-		rowID   int64
-		address string
+		valid         bool
+		rowID         int64
+		address       string
+		signerBackend string
 	}{
 		{
 			valid:   true,
@@ -174,9 +194,10 @@ func (p *PostgresDatabaseTestSuite) TestGetSenderWallet() {
 			address: "mara.eth",
 		},
 		{
-			valid:   true,
-			rowID:   2,
-			address: "chain.mara.eth",
+			valid:         true,
+			rowID:         2,
+			address:       "chain.mara.eth",
+			signerBackend: "sepior",
 		},
 		{
 			valid: false,
@@ -194,6 +215,7 @@ func (p *PostgresDatabaseTestSuite) TestGetSenderWallet() {
 
 		require.NoError(p.T(), err)
 		require.Equal(p.T(), v.address, strings.TrimRight(wallet.Address, " "))
+		require.Equal(p.T(), v.signerBackend, wallet.SignerBackend)
 	}
 }
 
@@ -213,38 +235,79 @@ func (p *PostgresDatabaseTestSuite) TestGetDerivationPath() {
 		wallet   string
 		coinType uint32
 		Account  uint32
-		keyID    string
+		walletID int64
+		err      error
 	}{
 		{
 			valid:    true,
 			wallet:   "mara.eth",
 			coinType: 614,
 			Account:  4,
-			keyID:    "MizBEqdhZ160syGCPFxYo6Lkxbiw",
+			walletID: 1,
 		},
 		{
 			valid:    true,
 			wallet:   "chain.mara.eth",
 			coinType: 700,
 			Account:  5,
-			keyID:    "MizBEqdhZ160syGCPFfjfkjf",
+			walletID: 2,
+		},
+		{
+			wallet:   "shared.mara.eth",
+			walletID: 3,
+			err:      models.ErrAmbiguousDerivationPath,
+		},
+		{
+			walletID: 5,
+			err:      models.ErrDerivationPathNotFound,
 		},
 	}
 
 	for _, v := range tt {
 		derivationPath, err := db.GetDerivationPath(context.Background(), models.FindDerivationPathOptions{
-			KeyID: v.keyID,
+			WalletID: v.walletID,
 		})
 
 		if !v.valid {
-			require.Error(p.T(), err)
+			require.ErrorIs(p.T(), err, v.err)
 			continue
 		}
 
 		require.NoError(p.T(), err)
 		require.Equal(p.T(), v.coinType, derivationPath.CoinType)
 		require.Equal(p.T(), v.Account, derivationPath.Account)
+		require.Equal(p.T(), uint32(1), derivationPath.AddressIndex)
+	}
+}
+
+func (p *PostgresDatabaseTestSuite) TestGetWalletVersion() {
+	cfg := config.Configuration{
+		Environment:             "local",
+		WalletsPostgresDSN:      p.getDSN("walletstest"),
+		TransactionsPostgresDSN: p.getDSN("transactionstest"),
 	}
+
+	db, err := New(cfg)
+	require.NoError(p.T(), err)
+
+	version, err := db.GetWalletVersion(context.Background(), 1)
+	require.NoError(p.T(), err)
+	require.Equal(p.T(), 1, version.DerivationPaths)
+
+	// see testdata/fixtures/derivation_paths.yml, wallet 3 has two paths
+	shared, err := db.GetWalletVersion(context.Background(), 3)
+	require.NoError(p.T(), err)
+	require.Equal(p.T(), 2, shared.DerivationPaths)
+
+	_, err = db.walletsDB.Exec(`UPDATE derivation_paths SET updated = now() + interval '1 hour' WHERE wallet_id = 1`)
+	require.NoError(p.T(), err)
+
+	changed, err := db.GetWalletVersion(context.Background(), 1)
+	require.NoError(p.T(), err)
+	require.False(p.T(), version.Equal(changed))
+
+	_, err = db.GetWalletVersion(context.Background(), 5)
+	require.ErrorIs(p.T(), err, models.ErrWalletNotFound)
 }
 
 func (p *PostgresDatabaseTestSuite) TestCreateTransaction() {
@@ -270,4 +333,305 @@ func (p *PostgresDatabaseTestSuite) TestCreateTransaction() {
 	}
 
 	require.NoError(p.T(), db.CreateTransaction(context.Background(), tx))
+	require.NotZero(p.T(), tx.ID)
+
+	history, err := db.ListTransactionStates(context.Background(), tx.ID)
+	require.NoError(p.T(), err)
+	require.Len(p.T(), history, 1)
+	require.Equal(p.T(), models.State(""), history[0].From)
+	require.Equal(p.T(), models.StateCreated, history[0].To)
+	require.Equal(p.T(), defaultActor, history[0].Actor)
+}
+
+func (p *PostgresDatabaseTestSuite) TestCreateTransaction_ContractDeployment() {
+	cfg := config.Configuration{
+		WalletsPostgresDSN:      p.getDSN("walletstest"),
+		TransactionsPostgresDSN: p.getDSN("transactionstest"),
+		Environment:             "local",
+	}
+
+	db, err := New(cfg)
+	require.NoError(p.T(), err)
+
+	tx := &models.Transaction{
+		SenderAddress:    "0x6ac7ea33f8831ea9dcc53393aaa88b25a785dbf0",
+		RecipientAddress: "0x343c43A37D37dfF08AE8C4A11544c718AbB4fCF8",
+		State:            models.StateSigned,
+		Nonce:            1,
+		TRXHash:          "0x3f6e0f8d4fbdc2cae3a3ed43e6d6c7d1a9e8e6c1f3b1cd52a4b6f1f1d5c5b9a2",
+		NetworkType:      models.NetworkTypeTestnet,
+		TransferType:     models.TransferTypeContractDeployment,
+		Amount:           big.NewFloat(0),
+		ChainID:          614,
+		TransactionUUID:  "4d0b6a5e-1f0e-4a35-9c55-0f7e2f1f6b8a",
+		BytecodeHash:     "0x1c3374235d773b2189aed115aa13143020fcdbbe86e38f358cf3e4771b2f0244",
+	}
+
+	require.NoError(p.T(), db.CreateTransaction(context.Background(), tx))
+
+	created, err := db.GetTransactionByUUID(context.Background(), tx.TransactionUUID)
+	require.NoError(p.T(), err)
+	require.Equal(p.T(), models.TransferTypeContractDeployment, created.TransferType)
+	require.Equal(p.T(), tx.RecipientAddress, created.RecipientAddress)
+	require.Equal(p.T(), tx.BytecodeHash, created.BytecodeHash)
+}
+
+func (p *PostgresDatabaseTestSuite) TestTransitionTransaction() {
+	cfg := config.Configuration{
+		WalletsPostgresDSN:      p.getDSN("walletstest"),
+		TransactionsPostgresDSN: p.getDSN("transactionstest"),
+		Environment:             "local",
+	}
+
+	db, err := New(cfg)
+	require.NoError(p.T(), err)
+
+	_, err = db.GetTransactionByUUID(context.Background(), "00000000-0000-0000-0000-000000000000")
+	require.ErrorIs(p.T(), err, models.ErrTransactionNotFound)
+
+	// see testdata/fixtures/trx/transactions.yml
+	tx, err := db.GetTransactionByUUID(context.Background(), "bc26bc00-a919-46ef-9ee1-88c22e9de7fb")
+	require.NoError(p.T(), err)
+	require.Equal(p.T(), 2, tx.ID)
+	require.Equal(p.T(), models.StateCreated, tx.State)
+
+	stale := *tx
+
+	tx.TRXHash = "0x5e1d3a76fbf824220eafc8c79ad578ad2b67d01b0c2425eb1f1347e8f50882ab"
+	tx.Nonce = 4
+	tx.MaxFee = 30
+	tx.MaxPriorityFee = 2
+	tx.SignedTX = "02f86682026604021e8252089400000000000000000000000000000000000000008080c0"
+
+	require.NoError(p.T(), db.TransitionTransaction(context.Background(), tx, models.TransitionOptions{
+		To:     models.StateSigned,
+		Reason: "signed",
+	}))
+	require.Equal(p.T(), models.StateSigned, tx.State)
+
+	signed, err := db.GetTransactionByUUID(context.Background(), "bc26bc00-a919-46ef-9ee1-88c22e9de7fb")
+	require.NoError(p.T(), err)
+	require.Equal(p.T(), models.StateSigned, signed.State)
+	require.Equal(p.T(), tx.TRXHash, signed.TRXHash)
+	require.Equal(p.T(), int64(4), signed.Nonce)
+	require.Equal(p.T(), int64(30), signed.MaxFee)
+	require.Equal(p.T(), int64(2), signed.MaxPriorityFee)
+	require.Equal(p.T(), tx.SignedTX, signed.SignedTX)
+	require.True(p.T(), tx.Updated.Equal(signed.Updated))
+
+	// the row changed since stale was read
+	err = db.TransitionTransaction(context.Background(), &stale, models.TransitionOptions{To: models.StateSigned})
+	require.ErrorIs(p.T(), err, models.ErrTransactionConflict)
+
+	err = db.TransitionTransaction(context.Background(), signed, models.TransitionOptions{To: models.StateCreated})
+	require.ErrorIs(p.T(), err, models.ErrIllegalTransition)
+
+	// a signed row is never signed again, its hash would be replaced
+	err = db.TransitionTransaction(context.Background(), signed, models.TransitionOptions{To: models.StateSigned})
+	require.ErrorIs(p.T(), err, models.ErrIllegalTransition)
+
+	require.NoError(p.T(), db.TransitionTransaction(context.Background(), signed, models.TransitionOptions{
+		To:     models.StateSubmitted,
+		Actor:  "operator",
+		Reason: "broadcast",
+	}))
+
+	history, err := db.ListTransactionStates(context.Background(), tx.ID)
+	require.NoError(p.T(), err)
+	require.Len(p.T(), history, 2)
+
+	require.Equal(p.T(), models.StateCreated, history[0].From)
+	require.Equal(p.T(), models.StateSigned, history[0].To)
+	require.Equal(p.T(), defaultActor, history[0].Actor)
+	require.Equal(p.T(), "signed", history[0].Reason)
+
+	require.Equal(p.T(), models.StateSigned, history[1].From)
+	require.Equal(p.T(), models.StateSubmitted, history[1].To)
+	require.Equal(p.T(), "operator", history[1].Actor)
+	require.Equal(p.T(), "broadcast", history[1].Reason)
+}
+
+func (p *PostgresDatabaseTestSuite) TestRecordUserOperation() {
+	cfg := config.Configuration{
+		WalletsPostgresDSN:      p.getDSN("walletstest"),
+		TransactionsPostgresDSN: p.getDSN("transactionstest"),
+		Environment:             "local",
+	}
+
+	db, err := New(cfg)
+	require.NoError(p.T(), err)
+
+	nonce, _ := new(big.Int).SetString("6277101735386680763835789423207666416102355444464034512896", 10)
+
+	op := &models.UserOperationRecord{
+		UserOpHash:      "0x8f2d1e5ab1b4b6e0b3c8d1e8a7f0c2b3d4e5f60718293a4b5c6d7e8f90a1b2c3",
+		ChainID:         614,
+		EntryPoint:      "0x5FF137D4b0FDCD49DcA30c7CF57E578a026d2789",
+		Sender:          "0x6ac7ea33f8831ea9dcc53393aaa88b25a785dbf0",
+		Owner:           "0xe004bb7a6cd6e00d3dabf717d809e665bdeaa671",
+		Nonce:           nonce,
+		WalletRowID:     3,
+		TransactionUUID: "9a3e2d8c-7b6f-4e1a-8c2d-5f4e3b2a1c0d",
+		State:           models.StateSigned,
+		Operation:       models.UserOperation{Signature: []byte{1}},
+	}
+
+	require.NoError(p.T(), db.RecordUserOperation(context.Background(), op))
+	require.NotZero(p.T(), op.ID)
+
+	// signing the operation again keeps the stored row and signature
+	again := *op
+	again.ID = 0
+	again.Operation = models.UserOperation{Signature: []byte{2}}
+
+	require.NoError(p.T(), db.RecordUserOperation(context.Background(), &again))
+	require.Equal(p.T(), op.ID, again.ID)
+	require.Equal(p.T(), op.Created, again.Created)
+	require.Equal(p.T(), op.Operation.Signature, again.Operation.Signature)
+
+	var (
+		count     int
+		signature string
+		stored    string
+	)
+
+	err = db.transactionsDB.QueryRow(`SELECT count(*), max(operation->>'signature'), max(nonce::text)
+FROM user_operations WHERE user_op_hash = $1`, op.UserOpHash).Scan(&count, &signature, &stored)
+	require.NoError(p.T(), err)
+	require.Equal(p.T(), 1, count)
+	require.Equal(p.T(), "0x01", signature)
+	require.Equal(p.T(), nonce.String(), stored)
+
+	// operations past signed are left alone
+	_, err = db.transactionsDB.Exec(`UPDATE user_operations SET state = 'submitted' WHERE user_op_hash = $1`, op.UserOpHash)
+	require.NoError(p.T(), err)
+
+	again.ID = 0
+	require.ErrorIs(p.T(), db.RecordUserOperation(context.Background(), &again), models.ErrUserOperationProcessed)
+}
+
+func (p *PostgresDatabaseTestSuite) TestAuditLog() {
+	cfg := config.Configuration{
+		WalletsPostgresDSN:      p.getDSN("walletstest"),
+		TransactionsPostgresDSN: p.getDSN("transactionstest"),
+		Environment:             "local",
+	}
+
+	db, err := New(cfg)
+	require.NoError(p.T(), err)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(p.T(), db.AppendAuditEntry(context.Background(), &models.AuditEntry{
+			KeyID:          "MizBEqdhZ160syGCPFxYo6Lkxbiw",
+			DerivationPath: "44/614/4/0/3",
+			MessageID:      fmt.Sprint(i),
+			PolicyDecision: models.PolicyDecisionAllowed,
+		}))
+	}
+
+	entries, err := db.ListAuditEntries(context.Background(), 1, 10)
+	require.NoError(p.T(), err)
+	require.Len(p.T(), entries, 2)
+	require.Equal(p.T(), int64(2), entries[0].Seq)
+	require.Equal(p.T(), entries[0].Hash, entries[1].PrevHash)
+	require.Equal(p.T(), entries[1].Hash, entries[1].ComputeHash())
+
+	report, err := audit.Verify(context.Background(), db, audit.Options{BatchSize: 2})
+	require.NoError(p.T(), err)
+	require.Empty(p.T(), report.Problems)
+	require.Equal(p.T(), int64(3), report.Entries)
+
+	_, err = db.transactionsDB.Exec("UPDATE signing_audit_log SET key_id = 'another key' WHERE seq = 2")
+	require.Error(p.T(), err, "the audit log is append only")
+}
+
+func (p *PostgresDatabaseTestSuite) TestListWalletsAndDerivationPaths() {
+	cfg := config.Configuration{
+		Environment:             "local",
+		WalletsPostgresDSN:      p.getDSN("walletstest"),
+		TransactionsPostgresDSN: p.getDSN("transactionstest"),
+	}
+
+	db, err := New(cfg)
+	require.NoError(p.T(), err)
+
+	ctx := context.Background()
+
+	// see testdata/fixtures/sender_wallets.yml
+	wallets, err := db.ListWallets(ctx, 0, 2)
+	require.NoError(p.T(), err)
+	require.Len(p.T(), wallets, 2)
+	require.Equal(p.T(), int64(1), wallets[0].ID)
+
+	wallets, err = db.ListWallets(ctx, wallets[1].ID, 2)
+	require.NoError(p.T(), err)
+	require.Len(p.T(), wallets, 1)
+	require.Equal(p.T(), "MizBEqdhZ160syGCPFxYo6Lkxbiw", wallets[0].KeyID)
+
+	// see testdata/fixtures/derivation_paths.yml
+	paths, err := db.ListDerivationPaths(ctx, 2, 10)
+	require.NoError(p.T(), err)
+	require.Len(p.T(), paths, 2)
+	require.Equal(p.T(), uint32(3), paths[0].WalletID)
+	require.Equal(p.T(), uint32(3), paths[1].WalletID)
+}
+
+func (p *PostgresDatabaseTestSuite) TestCreateWallet() {
+	cfg := config.Configuration{
+		Environment:             "local",
+		WalletsPostgresDSN:      p.getDSN("walletstest"),
+		TransactionsPostgresDSN: p.getDSN("transactionstest"),
+	}
+
+	db, err := New(cfg)
+	require.NoError(p.T(), err)
+
+	ctx := context.Background()
+
+	opts := models.CreateWalletOptions{
+		UserID:        12,
+		ChainID:       614,
+		NetworkType:   models.NetworkTypeMainnet,
+		KeyID:         "MizBEqdhZ160syGCPFxYo6Lkxbiw",
+		SignerBackend: "sepior",
+		Purpose:       44,
+		CoinType:      614,
+	}
+
+	var derivedPath []uint32
+
+	address := func(_ context.Context, path []uint32) (string, error) {
+		derivedPath = path
+		return "0x8ba1f109551bD432803012645Ac136ddd64DBA72", nil
+	}
+
+	// see testdata/fixtures/sender_wallets.yml, the highest index of the key is 3
+	wallet, err := db.CreateWallet(ctx, opts, address)
+	require.NoError(p.T(), err)
+	require.Equal(p.T(), 4, wallet.AddressIndex)
+	require.Equal(p.T(), []uint32{44, 614, 0, 0, 4}, derivedPath)
+	require.Equal(p.T(), "sepior", wallet.SignerBackend)
+
+	derivationPath, err := db.GetDerivationPath(ctx, models.FindDerivationPathOptions{WalletID: wallet.ID})
+	require.NoError(p.T(), err)
+	require.Equal(p.T(), uint32(4), derivationPath.AddressIndex)
+
+	// the same address can not be provisioned twice on a chain
+	_, err = db.CreateWallet(ctx, opts, address)
+	require.ErrorIs(p.T(), err, models.ErrWalletExists)
+
+	opts.UserID = 404
+	_, err = db.CreateWallet(ctx, opts, address)
+	require.ErrorIs(p.T(), err, models.ErrUserNotFound)
+
+	// nothing is stored when the address can not be derived
+	opts.UserID = 12
+	_, err = db.CreateWallet(ctx, opts, func(context.Context, []uint32) (string, error) {
+		return "", errors.New("key not found")
+	})
+	require.Error(p.T(), err)
+
+	wallets, err := db.ListWallets(ctx, wallet.ID, 10)
+	require.NoError(p.T(), err)
+	require.Empty(p.T(), wallets)
 }
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS signing_audit_log;
+DROP FUNCTION IF EXISTS signing_audit_log_append_only();
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS signing_audit_log (
+    seq             BIGINT PRIMARY KEY,
+    key_id          TEXT NOT NULL,
+    derivation_path TEXT NOT NULL DEFAULT '',
+    unsigned_hash   TEXT NOT NULL DEFAULT '',
+    signed_hash     TEXT NOT NULL DEFAULT '',
+    request_id      TEXT NOT NULL DEFAULT '',
+    message_id      TEXT NOT NULL DEFAULT '',
+    policy_decision TEXT NOT NULL DEFAULT '',
+    error           TEXT NOT NULL DEFAULT '',
+    created         TIMESTAMPTZ NOT NULL,
+    prev_hash       TEXT NOT NULL,
+    hash            TEXT NOT NULL UNIQUE
+);
+
+CREATE OR REPLACE FUNCTION signing_audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'signing_audit_log is append only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER signing_audit_log_no_update_delete
+    BEFORE UPDATE OR DELETE ON signing_audit_log
+    FOR EACH ROW EXECUTE FUNCTION signing_audit_log_append_only();
+
+CREATE TRIGGER signing_audit_log_no_truncate
+    BEFORE TRUNCATE ON signing_audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION signing_audit_log_append_only();
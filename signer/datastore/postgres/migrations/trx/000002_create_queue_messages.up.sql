@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS queue_messages (
+    id            BIGSERIAL PRIMARY KEY,
+    queue         TEXT NOT NULL,
+    body          TEXT NOT NULL,
+    attributes    JSONB NOT NULL DEFAULT '{}',
+    receive_count INTEGER NOT NULL DEFAULT 0,
+    visible_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS queue_messages_queue_visible_at_idx ON queue_messages (queue, visible_at, id);
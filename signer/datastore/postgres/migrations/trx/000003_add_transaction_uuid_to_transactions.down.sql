@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS transactions_transaction_uuid_idx;
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS transaction_uuid;
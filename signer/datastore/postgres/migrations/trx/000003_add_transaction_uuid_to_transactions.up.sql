@@ -0,0 +1,3 @@
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS transaction_uuid UUID;
+
+CREATE UNIQUE INDEX IF NOT EXISTS transactions_transaction_uuid_idx ON transactions (transaction_uuid);
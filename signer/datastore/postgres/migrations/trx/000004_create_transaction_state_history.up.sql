@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS transaction_state_history (
+    id             BIGSERIAL PRIMARY KEY,
+    transaction_id INTEGER NOT NULL REFERENCES transactions (id),
+    from_state     TEXT NOT NULL DEFAULT '',
+    to_state       TEXT NOT NULL,
+    actor          TEXT NOT NULL,
+    reason         TEXT NOT NULL DEFAULT '',
+    created        TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS transaction_state_history_transaction_id_idx
+    ON transaction_state_history (transaction_id, id);
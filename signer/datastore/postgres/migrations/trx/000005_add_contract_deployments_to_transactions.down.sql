@@ -0,0 +1,2 @@
+-- postgres can not drop enum values, contract_deployment stays in the enum
+ALTER TABLE transactions DROP COLUMN IF EXISTS contract_bytecode_hash;
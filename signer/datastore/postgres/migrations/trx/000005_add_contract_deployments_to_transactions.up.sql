@@ -0,0 +1,14 @@
+-- the enum type is owned by the upstream schema, look it up from the column
+DO $$
+DECLARE
+    transfer_type_enum REGTYPE;
+BEGIN
+    SELECT atttypid::REGTYPE INTO transfer_type_enum
+    FROM pg_attribute
+    WHERE attrelid = 'transactions'::REGCLASS AND attname = 'transfer_type';
+
+    EXECUTE format('ALTER TYPE %s ADD VALUE IF NOT EXISTS %L', transfer_type_enum, 'contract_deployment');
+END
+$$;
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS contract_bytecode_hash TEXT;
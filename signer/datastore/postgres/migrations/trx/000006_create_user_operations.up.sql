@@ -0,0 +1,20 @@
+-- wallet_id points to sender_wallets in the wallets database, hence no
+-- foreign key
+CREATE TABLE IF NOT EXISTS user_operations (
+    id               BIGSERIAL PRIMARY KEY,
+    user_op_hash     TEXT NOT NULL UNIQUE,
+    chain_id         BIGINT NOT NULL,
+    entry_point      TEXT NOT NULL,
+    sender           TEXT NOT NULL,
+    owner            TEXT NOT NULL,
+    nonce            NUMERIC(78, 0) NOT NULL,
+    wallet_id        BIGINT NOT NULL,
+    transaction_uuid UUID,
+    state            TEXT NOT NULL,
+    operation        JSONB NOT NULL,
+    created          TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated          TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS user_operations_sender_idx
+    ON user_operations (chain_id, sender, nonce);
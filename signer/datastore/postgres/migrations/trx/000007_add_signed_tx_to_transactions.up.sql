@@ -0,0 +1,3 @@
+-- the signed transaction is kept so that a message delivered again for a
+-- signed row queues the same transaction instead of signing a new one
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS signed_tx TEXT;
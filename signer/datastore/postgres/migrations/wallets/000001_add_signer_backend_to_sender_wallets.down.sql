@@ -0,0 +1 @@
+ALTER TABLE sender_wallets DROP COLUMN IF EXISTS signer_backend;
@@ -0,0 +1 @@
+ALTER TABLE sender_wallets ADD COLUMN IF NOT EXISTS signer_backend TEXT;
@@ -121,20 +121,22 @@ type TransferType string
 
 // Enum values for TransferType
 const (
-	TransferTypeEoa           TransferType = "eoa"
-	TransferTypeSmartContract TransferType = "smart_contract"
+	TransferTypeEoa                TransferType = "eoa"
+	TransferTypeSmartContract      TransferType = "smart_contract"
+	TransferTypeContractDeployment TransferType = "contract_deployment"
 )
 
 func AllTransferType() []TransferType {
 	return []TransferType{
 		TransferTypeEoa,
 		TransferTypeSmartContract,
+		TransferTypeContractDeployment,
 	}
 }
 
 func (e TransferType) IsValid() error {
 	switch e {
-	case TransferTypeEoa, TransferTypeSmartContract:
+	case TransferTypeEoa, TransferTypeSmartContract, TransferTypeContractDeployment:
 		return nil
 	default:
 		return errors.New("enum is not valid")
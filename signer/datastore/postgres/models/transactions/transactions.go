@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/friendsofgo/errors"
+	"github.com/volatiletech/null/v8"
 	"github.com/volatiletech/sqlboiler/v4/boil"
 	"github.com/volatiletech/sqlboiler/v4/queries"
 	"github.com/volatiletech/sqlboiler/v4/queries/qm"
@@ -24,92 +25,107 @@ import (
 
 // Transaction is an object representing the database table.
 type Transaction struct {
-	ID                int               `boil:"id" json:"id" toml:"id" yaml:"id"`
-	TRXHash           string            `boil:"trx_hash" json:"trx_hash" toml:"trx_hash" yaml:"trx_hash"`
-	ChainID           int               `boil:"chain_id" json:"chain_id" toml:"chain_id" yaml:"chain_id"`
-	NetworkType       NetworkType       `boil:"network_type" json:"network_type" toml:"network_type" yaml:"network_type"`
-	State             State             `boil:"state" json:"state" toml:"state" yaml:"state"`
-	TransferType      TransferType      `boil:"transfer_type" json:"transfer_type" toml:"transfer_type" yaml:"transfer_type"`
-	SenderAddress     string            `boil:"sender_address" json:"sender_address" toml:"sender_address" yaml:"sender_address"`
-	RecipientAddress  string            `boil:"recipient_address" json:"recipient_address" toml:"recipient_address" yaml:"recipient_address"`
-	Amount            types.Decimal     `boil:"amount" json:"amount" toml:"amount" yaml:"amount"`
-	Nonce             int               `boil:"nonce" json:"nonce" toml:"nonce" yaml:"nonce"`
-	MaxFee            types.NullDecimal `boil:"max_fee" json:"max_fee,omitempty" toml:"max_fee" yaml:"max_fee,omitempty"`
-	MaxPriorityFee    types.NullDecimal `boil:"max_priority_fee" json:"max_priority_fee,omitempty" toml:"max_priority_fee" yaml:"max_priority_fee,omitempty"`
-	IsSenderPayingGas bool              `boil:"is_sender_paying_gas" json:"is_sender_paying_gas" toml:"is_sender_paying_gas" yaml:"is_sender_paying_gas"`
-	Created           time.Time         `boil:"created" json:"created" toml:"created" yaml:"created"`
-	Updated           time.Time         `boil:"updated" json:"updated" toml:"updated" yaml:"updated"`
+	ID                   int               `boil:"id" json:"id" toml:"id" yaml:"id"`
+	TRXHash              string            `boil:"trx_hash" json:"trx_hash" toml:"trx_hash" yaml:"trx_hash"`
+	ChainID              int               `boil:"chain_id" json:"chain_id" toml:"chain_id" yaml:"chain_id"`
+	NetworkType          NetworkType       `boil:"network_type" json:"network_type" toml:"network_type" yaml:"network_type"`
+	State                State             `boil:"state" json:"state" toml:"state" yaml:"state"`
+	TransferType         TransferType      `boil:"transfer_type" json:"transfer_type" toml:"transfer_type" yaml:"transfer_type"`
+	SenderAddress        string            `boil:"sender_address" json:"sender_address" toml:"sender_address" yaml:"sender_address"`
+	RecipientAddress     string            `boil:"recipient_address" json:"recipient_address" toml:"recipient_address" yaml:"recipient_address"`
+	Amount               types.Decimal     `boil:"amount" json:"amount" toml:"amount" yaml:"amount"`
+	Nonce                int               `boil:"nonce" json:"nonce" toml:"nonce" yaml:"nonce"`
+	MaxFee               types.NullDecimal `boil:"max_fee" json:"max_fee,omitempty" toml:"max_fee" yaml:"max_fee,omitempty"`
+	MaxPriorityFee       types.NullDecimal `boil:"max_priority_fee" json:"max_priority_fee,omitempty" toml:"max_priority_fee" yaml:"max_priority_fee,omitempty"`
+	IsSenderPayingGas    bool              `boil:"is_sender_paying_gas" json:"is_sender_paying_gas" toml:"is_sender_paying_gas" yaml:"is_sender_paying_gas"`
+	Created              time.Time         `boil:"created" json:"created" toml:"created" yaml:"created"`
+	Updated              time.Time         `boil:"updated" json:"updated" toml:"updated" yaml:"updated"`
+	TransactionUUID      null.String       `boil:"transaction_uuid" json:"transaction_uuid,omitempty" toml:"transaction_uuid" yaml:"transaction_uuid,omitempty"`
+	ContractBytecodeHash null.String       `boil:"contract_bytecode_hash" json:"contract_bytecode_hash,omitempty" toml:"contract_bytecode_hash" yaml:"contract_bytecode_hash,omitempty"`
+	SignedTX             null.String       `boil:"signed_tx" json:"signed_tx,omitempty" toml:"signed_tx" yaml:"signed_tx,omitempty"`
 
 	R *transactionR `boil:"-" json:"-" toml:"-" yaml:"-"`
 	L transactionL  `boil:"-" json:"-" toml:"-" yaml:"-"`
 }
 
 var TransactionColumns = struct {
-	ID                string
-	TRXHash           string
-	ChainID           string
-	NetworkType       string
-	State             string
-	TransferType      string
-	SenderAddress     string
-	RecipientAddress  string
-	Amount            string
-	Nonce             string
-	MaxFee            string
-	MaxPriorityFee    string
-	IsSenderPayingGas string
-	Created           string
-	Updated           string
+	ID                   string
+	TRXHash              string
+	ChainID              string
+	NetworkType          string
+	State                string
+	TransferType         string
+	SenderAddress        string
+	RecipientAddress     string
+	Amount               string
+	Nonce                string
+	MaxFee               string
+	MaxPriorityFee       string
+	IsSenderPayingGas    string
+	Created              string
+	Updated              string
+	TransactionUUID      string
+	ContractBytecodeHash string
+	SignedTX             string
 }{
-	ID:                "id",
-	TRXHash:           "trx_hash",
-	ChainID:           "chain_id",
-	NetworkType:       "network_type",
-	State:             "state",
-	TransferType:      "transfer_type",
-	SenderAddress:     "sender_address",
-	RecipientAddress:  "recipient_address",
-	Amount:            "amount",
-	Nonce:             "nonce",
-	MaxFee:            "max_fee",
-	MaxPriorityFee:    "max_priority_fee",
-	IsSenderPayingGas: "is_sender_paying_gas",
-	Created:           "created",
-	Updated:           "updated",
+	ID:                   "id",
+	TRXHash:              "trx_hash",
+	ChainID:              "chain_id",
+	NetworkType:          "network_type",
+	State:                "state",
+	TransferType:         "transfer_type",
+	SenderAddress:        "sender_address",
+	RecipientAddress:     "recipient_address",
+	Amount:               "amount",
+	Nonce:                "nonce",
+	MaxFee:               "max_fee",
+	MaxPriorityFee:       "max_priority_fee",
+	IsSenderPayingGas:    "is_sender_paying_gas",
+	Created:              "created",
+	Updated:              "updated",
+	TransactionUUID:      "transaction_uuid",
+	ContractBytecodeHash: "contract_bytecode_hash",
+	SignedTX:             "signed_tx",
 }
 
 var TransactionTableColumns = struct {
-	ID                string
-	TRXHash           string
-	ChainID           string
-	NetworkType       string
-	State             string
-	TransferType      string
-	SenderAddress     string
-	RecipientAddress  string
-	Amount            string
-	Nonce             string
-	MaxFee            string
-	MaxPriorityFee    string
-	IsSenderPayingGas string
-	Created           string
-	Updated           string
+	ID                   string
+	TRXHash              string
+	ChainID              string
+	NetworkType          string
+	State                string
+	TransferType         string
+	SenderAddress        string
+	RecipientAddress     string
+	Amount               string
+	Nonce                string
+	MaxFee               string
+	MaxPriorityFee       string
+	IsSenderPayingGas    string
+	Created              string
+	Updated              string
+	TransactionUUID      string
+	ContractBytecodeHash string
+	SignedTX             string
 }{
-	ID:                "transactions.id",
-	TRXHash:           "transactions.trx_hash",
-	ChainID:           "transactions.chain_id",
-	NetworkType:       "transactions.network_type",
-	State:             "transactions.state",
-	TransferType:      "transactions.transfer_type",
-	SenderAddress:     "transactions.sender_address",
-	RecipientAddress:  "transactions.recipient_address",
-	Amount:            "transactions.amount",
-	Nonce:             "transactions.nonce",
-	MaxFee:            "transactions.max_fee",
-	MaxPriorityFee:    "transactions.max_priority_fee",
-	IsSenderPayingGas: "transactions.is_sender_paying_gas",
-	Created:           "transactions.created",
-	Updated:           "transactions.updated",
+	ID:                   "transactions.id",
+	TRXHash:              "transactions.trx_hash",
+	ChainID:              "transactions.chain_id",
+	NetworkType:          "transactions.network_type",
+	State:                "transactions.state",
+	TransferType:         "transactions.transfer_type",
+	SenderAddress:        "transactions.sender_address",
+	RecipientAddress:     "transactions.recipient_address",
+	Amount:               "transactions.amount",
+	Nonce:                "transactions.nonce",
+	MaxFee:               "transactions.max_fee",
+	MaxPriorityFee:       "transactions.max_priority_fee",
+	IsSenderPayingGas:    "transactions.is_sender_paying_gas",
+	Created:              "transactions.created",
+	Updated:              "transactions.updated",
+	TransactionUUID:      "transactions.transaction_uuid",
+	ContractBytecodeHash: "transactions.contract_bytecode_hash",
+	SignedTX:             "transactions.signed_tx",
 }
 
 // Generated where
@@ -330,38 +346,82 @@ func (w whereHelpertime_Time) GTE(x time.Time) qm.QueryMod {
 	return qmhelper.Where(w.field, qmhelper.GTE, x)
 }
 
+type whereHelpernull_String struct{ field string }
+
+func (w whereHelpernull_String) EQ(x null.String) qm.QueryMod {
+	return qmhelper.WhereNullEQ(w.field, false, x)
+}
+func (w whereHelpernull_String) NEQ(x null.String) qm.QueryMod {
+	return qmhelper.WhereNullEQ(w.field, true, x)
+}
+func (w whereHelpernull_String) LT(x null.String) qm.QueryMod {
+	return qmhelper.Where(w.field, qmhelper.LT, x)
+}
+func (w whereHelpernull_String) LTE(x null.String) qm.QueryMod {
+	return qmhelper.Where(w.field, qmhelper.LTE, x)
+}
+func (w whereHelpernull_String) GT(x null.String) qm.QueryMod {
+	return qmhelper.Where(w.field, qmhelper.GT, x)
+}
+func (w whereHelpernull_String) GTE(x null.String) qm.QueryMod {
+	return qmhelper.Where(w.field, qmhelper.GTE, x)
+}
+func (w whereHelpernull_String) IN(slice []string) qm.QueryMod {
+	values := make([]interface{}, 0, len(slice))
+	for _, value := range slice {
+		values = append(values, value)
+	}
+	return qm.WhereIn(fmt.Sprintf("%s IN ?", w.field), values...)
+}
+func (w whereHelpernull_String) NIN(slice []string) qm.QueryMod {
+	values := make([]interface{}, 0, len(slice))
+	for _, value := range slice {
+		values = append(values, value)
+	}
+	return qm.WhereNotIn(fmt.Sprintf("%s NOT IN ?", w.field), values...)
+}
+
+func (w whereHelpernull_String) IsNull() qm.QueryMod    { return qmhelper.WhereIsNull(w.field) }
+func (w whereHelpernull_String) IsNotNull() qm.QueryMod { return qmhelper.WhereIsNotNull(w.field) }
+
 var TransactionWhere = struct {
-	ID                whereHelperint
-	TRXHash           whereHelperstring
-	ChainID           whereHelperint
-	NetworkType       whereHelperNetworkType
-	State             whereHelperState
-	TransferType      whereHelperTransferType
-	SenderAddress     whereHelperstring
-	RecipientAddress  whereHelperstring
-	Amount            whereHelpertypes_Decimal
-	Nonce             whereHelperint
-	MaxFee            whereHelpertypes_NullDecimal
-	MaxPriorityFee    whereHelpertypes_NullDecimal
-	IsSenderPayingGas whereHelperbool
-	Created           whereHelpertime_Time
-	Updated           whereHelpertime_Time
+	ID                   whereHelperint
+	TRXHash              whereHelperstring
+	ChainID              whereHelperint
+	NetworkType          whereHelperNetworkType
+	State                whereHelperState
+	TransferType         whereHelperTransferType
+	SenderAddress        whereHelperstring
+	RecipientAddress     whereHelperstring
+	Amount               whereHelpertypes_Decimal
+	Nonce                whereHelperint
+	MaxFee               whereHelpertypes_NullDecimal
+	MaxPriorityFee       whereHelpertypes_NullDecimal
+	IsSenderPayingGas    whereHelperbool
+	Created              whereHelpertime_Time
+	Updated              whereHelpertime_Time
+	TransactionUUID      whereHelpernull_String
+	ContractBytecodeHash whereHelpernull_String
+	SignedTX             whereHelpernull_String
 }{
-	ID:                whereHelperint{field: "\"transactions\".\"id\""},
-	TRXHash:           whereHelperstring{field: "\"transactions\".\"trx_hash\""},
-	ChainID:           whereHelperint{field: "\"transactions\".\"chain_id\""},
-	NetworkType:       whereHelperNetworkType{field: "\"transactions\".\"network_type\""},
-	State:             whereHelperState{field: "\"transactions\".\"state\""},
-	TransferType:      whereHelperTransferType{field: "\"transactions\".\"transfer_type\""},
-	SenderAddress:     whereHelperstring{field: "\"transactions\".\"sender_address\""},
-	RecipientAddress:  whereHelperstring{field: "\"transactions\".\"recipient_address\""},
-	Amount:            whereHelpertypes_Decimal{field: "\"transactions\".\"amount\""},
-	Nonce:             whereHelperint{field: "\"transactions\".\"nonce\""},
-	MaxFee:            whereHelpertypes_NullDecimal{field: "\"transactions\".\"max_fee\""},
-	MaxPriorityFee:    whereHelpertypes_NullDecimal{field: "\"transactions\".\"max_priority_fee\""},
-	IsSenderPayingGas: whereHelperbool{field: "\"transactions\".\"is_sender_paying_gas\""},
-	Created:           whereHelpertime_Time{field: "\"transactions\".\"created\""},
-	Updated:           whereHelpertime_Time{field: "\"transactions\".\"updated\""},
+	ID:                   whereHelperint{field: "\"transactions\".\"id\""},
+	TRXHash:              whereHelperstring{field: "\"transactions\".\"trx_hash\""},
+	ChainID:              whereHelperint{field: "\"transactions\".\"chain_id\""},
+	NetworkType:          whereHelperNetworkType{field: "\"transactions\".\"network_type\""},
+	State:                whereHelperState{field: "\"transactions\".\"state\""},
+	TransferType:         whereHelperTransferType{field: "\"transactions\".\"transfer_type\""},
+	SenderAddress:        whereHelperstring{field: "\"transactions\".\"sender_address\""},
+	RecipientAddress:     whereHelperstring{field: "\"transactions\".\"recipient_address\""},
+	Amount:               whereHelpertypes_Decimal{field: "\"transactions\".\"amount\""},
+	Nonce:                whereHelperint{field: "\"transactions\".\"nonce\""},
+	MaxFee:               whereHelpertypes_NullDecimal{field: "\"transactions\".\"max_fee\""},
+	MaxPriorityFee:       whereHelpertypes_NullDecimal{field: "\"transactions\".\"max_priority_fee\""},
+	IsSenderPayingGas:    whereHelperbool{field: "\"transactions\".\"is_sender_paying_gas\""},
+	Created:              whereHelpertime_Time{field: "\"transactions\".\"created\""},
+	Updated:              whereHelpertime_Time{field: "\"transactions\".\"updated\""},
+	TransactionUUID:      whereHelpernull_String{field: "\"transactions\".\"transaction_uuid\""},
+	ContractBytecodeHash: whereHelpernull_String{field: "\"transactions\".\"contract_bytecode_hash\""},
+	SignedTX:             whereHelpernull_String{field: "\"transactions\".\"signed_tx\""},
 }
 
 // TransactionRels is where relationship names are stored.
@@ -381,9 +441,9 @@ func (*transactionR) NewStruct() *transactionR {
 type transactionL struct{}
 
 var (
-	transactionAllColumns            = []string{"id", "trx_hash", "chain_id", "network_type", "state", "transfer_type", "sender_address", "recipient_address", "amount", "nonce", "max_fee", "max_priority_fee", "is_sender_paying_gas", "created", "updated"}
+	transactionAllColumns            = []string{"id", "trx_hash", "chain_id", "network_type", "state", "transfer_type", "sender_address", "recipient_address", "amount", "nonce", "max_fee", "max_priority_fee", "is_sender_paying_gas", "created", "updated", "transaction_uuid", "contract_bytecode_hash", "signed_tx"}
 	transactionColumnsWithoutDefault = []string{"trx_hash", "chain_id", "network_type", "state", "transfer_type", "sender_address", "recipient_address", "amount", "nonce"}
-	transactionColumnsWithDefault    = []string{"id", "max_fee", "max_priority_fee", "is_sender_paying_gas", "created", "updated"}
+	transactionColumnsWithDefault    = []string{"id", "max_fee", "max_priority_fee", "is_sender_paying_gas", "created", "updated", "transaction_uuid", "contract_bytecode_hash", "signed_tx"}
 	transactionPrimaryKeyColumns     = []string{"id"}
 	transactionGeneratedColumns      = []string{}
 )
@@ -36,6 +36,7 @@ type SenderWallet struct {
 	Created           time.Time   `boil:"created" json:"created" toml:"created" yaml:"created"`
 	Updated           time.Time   `boil:"updated" json:"updated" toml:"updated" yaml:"updated"`
 	AddressIndex      int         `boil:"address_index" json:"address_index" toml:"address_index" yaml:"address_index"`
+	SignerBackend     null.String `boil:"signer_backend" json:"signer_backend,omitempty" toml:"signer_backend" yaml:"signer_backend,omitempty"`
 
 	R *senderWalletR `boil:"-" json:"-" toml:"-" yaml:"-"`
 	L senderWalletL  `boil:"-" json:"-" toml:"-" yaml:"-"`
@@ -54,6 +55,7 @@ var SenderWalletColumns = struct {
 	Created           string
 	Updated           string
 	AddressIndex      string
+	SignerBackend     string
 }{
 	ID:                "id",
 	UserID:            "user_id",
@@ -67,6 +69,7 @@ var SenderWalletColumns = struct {
 	Created:           "created",
 	Updated:           "updated",
 	AddressIndex:      "address_index",
+	SignerBackend:     "signer_backend",
 }
 
 var SenderWalletTableColumns = struct {
@@ -82,6 +85,7 @@ var SenderWalletTableColumns = struct {
 	Created           string
 	Updated           string
 	AddressIndex      string
+	SignerBackend     string
 }{
 	ID:                "sender_wallets.id",
 	UserID:            "sender_wallets.user_id",
@@ -95,6 +99,7 @@ var SenderWalletTableColumns = struct {
 	Created:           "sender_wallets.created",
 	Updated:           "sender_wallets.updated",
 	AddressIndex:      "sender_wallets.address_index",
+	SignerBackend:     "sender_wallets.signer_backend",
 }
 
 // Generated where
@@ -214,6 +219,7 @@ var SenderWalletWhere = struct {
 	Created           whereHelpertime_Time
 	Updated           whereHelpertime_Time
 	AddressIndex      whereHelperint
+	SignerBackend     whereHelpernull_String
 }{
 	ID:                whereHelperint{field: "\"sender_wallets\".\"id\""},
 	UserID:            whereHelpernull_Int{field: "\"sender_wallets\".\"user_id\""},
@@ -227,6 +233,7 @@ var SenderWalletWhere = struct {
 	Created:           whereHelpertime_Time{field: "\"sender_wallets\".\"created\""},
 	Updated:           whereHelpertime_Time{field: "\"sender_wallets\".\"updated\""},
 	AddressIndex:      whereHelperint{field: "\"sender_wallets\".\"address_index\""},
+	SignerBackend:     whereHelpernull_String{field: "\"sender_wallets\".\"signer_backend\""},
 }
 
 // SenderWalletRels is where relationship names are stored.
@@ -267,9 +274,9 @@ func (r *senderWalletR) GetWalletDerivationPaths() DerivationPathSlice {
 type senderWalletL struct{}
 
 var (
-	senderWalletAllColumns            = []string{"id", "user_id", "address", "address_type", "chain_id", "network_type", "key_id", "is_multisig", "multisig_threshold", "created", "updated", "address_index"}
+	senderWalletAllColumns            = []string{"id", "user_id", "address", "address_type", "chain_id", "network_type", "key_id", "is_multisig", "multisig_threshold", "created", "updated", "address_index", "signer_backend"}
 	senderWalletColumnsWithoutDefault = []string{"address", "address_type", "chain_id", "network_type", "key_id", "address_index"}
-	senderWalletColumnsWithDefault    = []string{"id", "user_id", "is_multisig", "multisig_threshold", "created", "updated"}
+	senderWalletColumnsWithDefault    = []string{"id", "user_id", "is_multisig", "multisig_threshold", "created", "updated", "signer_backend"}
 	senderWalletPrimaryKeyColumns     = []string{"id"}
 	senderWalletGeneratedColumns      = []string{}
 )
@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/volatiletech/null/v8"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/queries/qm"
+
+	dbmodels "github.com/mara-labs/transactionsigner/datastore/postgres/models/wallets"
+	"github.com/mara-labs/transactionsigner/models"
+)
+
+// provisioningLockID is the first half of the advisory lock serializing the
+// provisioning of wallets under the same key, the second half is the hash of
+// the key ID
+const provisioningLockID = 0x77616c6c
+
+// CreateWallet inserts a wallet and its derivation path at the next free
+// address index of the key. Concurrent calls for the same key are serialized
+// so no index is handed out twice
+func (s *Store) CreateWallet(ctx context.Context, opts models.CreateWalletOptions, address models.AddressFunc) (*models.SenderWallet, error) {
+	tx, err := s.walletsDB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback() //nolint: errcheck
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1, hashtext($2))", provisioningLockID, opts.KeyID); err != nil {
+		return nil, err
+	}
+
+	userExists, err := dbmodels.Users(qm.Where("id = ?", opts.UserID)).Exists(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !userExists {
+		return nil, fmt.Errorf("%w: %d", models.ErrUserNotFound, opts.UserID)
+	}
+
+	var lastIndex sql.NullInt64
+
+	err = tx.QueryRowContext(ctx, "SELECT max(address_index) FROM sender_wallets WHERE key_id = $1", opts.KeyID).
+		Scan(&lastIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	addressIndex := 0
+	if lastIndex.Valid {
+		addressIndex = int(lastIndex.Int64) + 1
+	}
+
+	derivationPath := models.DerivationPath{
+		Purpose:      opts.Purpose,
+		CoinType:     opts.CoinType,
+		Account:      opts.Account,
+		Change:       opts.Change,
+		AddressIndex: uint32(addressIndex),
+	}
+
+	walletAddress, err := address(ctx, derivationPath.Path(derivationPath.AddressIndex))
+	if err != nil {
+		return nil, err
+	}
+
+	walletExists, err := dbmodels.SenderWallets(
+		qm.Where("lower(trim(address)) = lower(?)", strings.TrimSpace(walletAddress)),
+		qm.Where("chain_id = ?", opts.ChainID)).
+		Exists(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if walletExists {
+		return nil, fmt.Errorf("%w: %s on chain %d", models.ErrWalletExists, walletAddress, opts.ChainID)
+	}
+
+	wallet := &dbmodels.SenderWallet{
+		UserID:       null.IntFrom(int(opts.UserID)),
+		Address:      walletAddress,
+		AddressType:  dbmodels.AddressTypeEoa,
+		ChainID:      int(opts.ChainID),
+		NetworkType:  dbmodels.NetworkType(opts.NetworkType),
+		KeyID:        opts.KeyID,
+		AddressIndex: addressIndex,
+	}
+
+	if len(opts.SignerBackend) != 0 {
+		wallet.SignerBackend = null.StringFrom(opts.SignerBackend)
+	}
+
+	if err := wallet.Insert(ctx, tx, boil.Infer()); err != nil {
+		return nil, err
+	}
+
+	path := &dbmodels.DerivationPath{
+		WalletID:     null.IntFrom(wallet.ID),
+		Purpose:      int(derivationPath.Purpose),
+		CoinType:     int(derivationPath.CoinType),
+		Account:      int(derivationPath.Account),
+		Change:       int(derivationPath.Change),
+		AddressIndex: addressIndex,
+	}
+
+	if err := path.Insert(ctx, tx, boil.Infer()); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return toSenderWallet(wallet), nil
+}
@@ -0,0 +1,139 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ericlagergren/decimal"
+	"github.com/volatiletech/null/v8"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/types"
+
+	"github.com/mara-labs/transactionsigner/datastore/postgres/models/transactions"
+	"github.com/mara-labs/transactionsigner/models"
+)
+
+// defaultActor is recorded with state changes when no service name is set
+const defaultActor = "transaction-signer"
+
+// TransitionTransaction moves the transaction from the state it was read in to
+// opts.To, storing its hash, nonce, fees and signed transaction along, as well
+// as the contract address and bytecode hash of deployments, and records the
+// change in the state history. The update only applies while the state and the
+// updated timestamp are the ones trans was read with, so a row changed by
+// another consumer in the meantime is left alone
+func (s *Store) TransitionTransaction(ctx context.Context, trans *models.Transaction, opts models.TransitionOptions) error {
+	if !models.CanTransition(trans.State, opts.To) {
+		return fmt.Errorf("%w from %s to %s", models.ErrIllegalTransition, trans.State, opts.To)
+	}
+
+	// postgres keeps microseconds, the timestamp copied back must match the
+	// stored one for the next transition
+	updated := time.Now().UTC().Truncate(time.Microsecond)
+
+	tx, err := s.transactionsDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback() //nolint: errcheck
+
+	cols := transactions.M{
+		transactions.TransactionColumns.State:          transactions.State(opts.To),
+		transactions.TransactionColumns.TRXHash:        trans.TRXHash,
+		transactions.TransactionColumns.Nonce:          int(trans.Nonce),
+		transactions.TransactionColumns.MaxFee:         types.NewNullDecimal(decimal.New(trans.MaxFee, 0)),
+		transactions.TransactionColumns.MaxPriorityFee: types.NewNullDecimal(decimal.New(trans.MaxPriorityFee, 0)),
+		transactions.TransactionColumns.Updated:        updated,
+	}
+
+	// the address of a deployed contract is only known once the nonce of
+	// the deployment is
+	if len(trans.BytecodeHash) != 0 {
+		cols[transactions.TransactionColumns.TransferType] = transactions.TransferType(trans.TransferType)
+		cols[transactions.TransactionColumns.RecipientAddress] = trans.RecipientAddress
+		cols[transactions.TransactionColumns.ContractBytecodeHash] = null.StringFrom(trans.BytecodeHash)
+	}
+
+	if len(trans.SignedTX) != 0 {
+		cols[transactions.TransactionColumns.SignedTX] = null.StringFrom(trans.SignedTX)
+	}
+
+	affected, err := transactions.Transactions(
+		transactions.TransactionWhere.ID.EQ(trans.ID),
+		transactions.TransactionWhere.Updated.EQ(trans.Updated),
+		transactions.TransactionWhere.State.EQ(transactions.State(trans.State))).
+		UpdateAll(ctx, tx, cols)
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return models.ErrTransactionConflict
+	}
+
+	if err := s.recordTransition(ctx, tx, trans.ID, trans.State, opts); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	trans.State = opts.To
+	trans.Updated = updated
+
+	return nil
+}
+
+// recordTransition appends a state change to the history of the transaction
+func (s *Store) recordTransition(ctx context.Context, exec boil.ContextExecutor,
+	transactionID int, from models.State, opts models.TransitionOptions,
+) error {
+	actor := opts.Actor
+	if len(actor) == 0 {
+		actor = s.actor
+	}
+
+	_, err := exec.ExecContext(ctx, `INSERT INTO transaction_state_history
+(transaction_id, from_state, to_state, actor, reason)
+VALUES ($1, $2, $3, $4, $5)`,
+		transactionID, string(from), string(opts.To), actor, opts.Reason)
+
+	return err
+}
+
+// ListTransactionStates returns the state history of the transaction, oldest
+// first
+func (s *Store) ListTransactionStates(ctx context.Context, transactionID int) ([]models.StateTransition, error) {
+	rows, err := s.transactionsDB.QueryContext(ctx, `SELECT
+id, transaction_id, from_state, to_state, actor, reason, created
+FROM transaction_state_history WHERE transaction_id = $1 ORDER BY id`, transactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var history []models.StateTransition
+
+	for rows.Next() {
+		var (
+			transition models.StateTransition
+			from, to   string
+		)
+
+		if err := rows.Scan(&transition.ID, &transition.TransactionID, &from, &to,
+			&transition.Actor, &transition.Reason, &transition.Created); err != nil {
+			return nil, err
+		}
+
+		transition.From = models.State(from)
+		transition.To = models.State(to)
+
+		history = append(history, transition)
+	}
+
+	return history, rows.Err()
+}
@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mara-labs/transactionsigner/models"
+)
+
+// RecordUserOperation stores the signed user operation. An operation signed
+// again under the same hash keeps the stored row, op is set to it so the
+// signature stored first is the one sent on. Operations that moved past
+// signed return ErrUserOperationProcessed
+func (s *Store) RecordUserOperation(ctx context.Context, op *models.UserOperationRecord) error {
+	operation, err := json.Marshal(op.Operation)
+	if err != nil {
+		return err
+	}
+
+	nonce := "0"
+	if op.Nonce != nil {
+		nonce = op.Nonce.String()
+	}
+
+	transactionUUID := sql.NullString{String: op.TransactionUUID, Valid: len(op.TransactionUUID) != 0}
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	err = s.transactionsDB.QueryRowContext(ctx, `INSERT INTO user_operations
+(user_op_hash, chain_id, entry_point, sender, owner, nonce, wallet_id, transaction_uuid, state, operation, created, updated)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $11)
+ON CONFLICT (user_op_hash) DO NOTHING
+RETURNING id, created, updated`,
+		op.UserOpHash, op.ChainID, op.EntryPoint, op.Sender, op.Owner, nonce,
+		op.WalletRowID, transactionUUID, string(op.State), operation, now).
+		Scan(&op.ID, &op.Created, &op.Updated)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	var (
+		state  string
+		stored []byte
+	)
+
+	err = s.transactionsDB.QueryRowContext(ctx, `SELECT id, owner, state, operation, created, updated
+FROM user_operations WHERE user_op_hash = $1`, op.UserOpHash).
+		Scan(&op.ID, &op.Owner, &state, &stored, &op.Created, &op.Updated)
+	if err != nil {
+		return err
+	}
+
+	if models.State(state) != models.StateSigned {
+		return fmt.Errorf("%w: %s is %s", models.ErrUserOperationProcessed, op.UserOpHash, state)
+	}
+
+	op.State = models.StateSigned
+
+	return json.Unmarshal(stored, &op.Operation)
+}
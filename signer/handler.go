@@ -2,17 +2,20 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math/big"
 	"strings"
+	"time"
 
+	ddlambda "github.com/DataDog/datadog-lambda-go"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/crypto"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 
@@ -20,10 +23,21 @@ import (
 
 	"github.com/mara-labs/transactionsigner/config"
 	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/chains"
+	"github.com/mara-labs/transactionsigner/pkg/ethtx"
+	"github.com/mara-labs/transactionsigner/pkg/msgauth"
+	"github.com/mara-labs/transactionsigner/pkg/tracing"
+	"github.com/mara-labs/transactionsigner/pkg/userop"
 )
 
-// LambdaHandler is a type that denotes a valid lambda function for our lambdas integration
-type LambdaHandler func(context.Context, events.SQSEvent) error
+// LambdaHandler is a type that denotes a valid lambda function for our lambdas integration.
+// Messages that failed are listed in the response, the event source mapping
+// must report batch item failures so the others are deleted
+type LambdaHandler func(context.Context, events.SQSEvent) (events.SQSEventResponse, error)
+
+// messageGroupAttribute is the system attribute holding the group of a
+// message read from a FIFO queue
+const messageGroupAttribute = "MessageGroupId"
 
 func getItemFromQueueBody(record events.SQSMessage,
 ) (*models.CreatedTxQueueItem, error) {
@@ -42,24 +56,355 @@ func getItemFromQueueBody(record events.SQSMessage,
 	return item, nil
 }
 
+const (
+	notEnoughTimeMetric   = "transaction_signer.deadline.not_enough_time"
+	messageRejectedMetric = "transaction_signer.message_auth.rejected"
+)
+
+// errNotEnoughTime is returned when a message is handed back for retry
+// because the remaining time would not be enough to sign it safely
+var errNotEnoughTime = errors.New("not enough time left to sign the transaction")
+
+// errWrongOwner is returned when the signature of a user operation does not
+// recover to the address of the wallet, the smart account would reject it
+var errWrongOwner = errors.New("signature does not recover to the wallet address")
+
+// errAlreadySigned is returned for messages whose transaction row was signed
+// before the signed transaction was stored on it, there is nothing to queue
+// again and the transaction is not signed a second time
+var errAlreadySigned = errors.New("transaction was signed already")
+
+// errUpstreamMismatch is returned when the row the upstream service created
+// describes another transfer than the transaction of the message
+var errUpstreamMismatch = errors.New("upstream transaction does not match the message")
+
+// withSafetyDeadline shortens the deadline of ctx, if any, by the safety margin
+// so there is time left to report failures before lambda kills the process
+func withSafetyDeadline(ctx context.Context, margin time.Duration) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok || margin <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithDeadline(ctx, deadline.Add(-margin))
+}
+
+// hasTimeToSign checks if the signature, its audit entry, the transaction
+// record and the queue item can all be written before the deadline of ctx
+func hasTimeToSign(ctx context.Context, minSigningTime time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return true
+	}
+
+	return time.Until(deadline) >= minSigningTime
+}
+
+// walletDerivationPath returns the validated path the wallet signs with
+func walletDerivationPath(configValues config.Configuration,
+	wallet *models.SenderWallet, derivationPath *models.DerivationPath,
+) ([]uint32, error) {
+	path, err := derivationPath.WalletPath(wallet)
+	if err != nil {
+		return nil, err
+	}
+
+	coinType := config.BIP44CoinType(configValues, int64(wallet.ChainID))
+
+	if err := models.ValidateDerivationPath(path, coinType); err != nil {
+		return nil, err
+	}
+
+	return path, nil
+}
+
+// newSignedItem builds the queue item of a signed transaction in the payload
+// version set by SIGNED_TX_QUEUE_ITEM_VERSION
+func newSignedItem(configValues config.Configuration, record events.SQSMessage,
+	item *models.CreatedTxQueueItem, wallet *models.SenderWallet,
+	dbTransaction *models.Transaction, signedTX *types.Transaction,
+) models.SignedTXQueueItem {
+	signedItem := models.SignedTXQueueItem{
+		Version:          configValues.SignedTXQueueItemVersion,
+		ID:               record.MessageId,
+		SignedTX:         ethtx.Encode(signedTX),
+		TransactionID:    item.TransactionID,
+		TxHash:           signedTX.Hash().Hex(),
+		ChainID:          signedTX.ChainId().Int64(),
+		TxType:           signedTX.Type(),
+		Sender:           strings.TrimSpace(wallet.Address),
+		Nonce:            signedTX.Nonce(),
+		Gas:              signedTX.Gas(),
+		GasPrice:         signedTX.GasPrice().String(),
+		GasTipCap:        signedTX.GasTipCap().String(),
+		GasFeeCap:        signedTX.GasFeeCap().String(),
+		WalletRowID:      wallet.ID,
+		TransactionRowID: int64(dbTransaction.ID),
+		Priority:         item.Priority,
+	}
+
+	if to := signedTX.To(); to != nil {
+		signedItem.Recipient = to.Hex()
+	} else {
+		signedItem.ContractAddress = contractAddress(wallet, signedTX)
+	}
+
+	return signedItem
+}
+
+// networkType returns the network of a transaction the signer inserts. Chains
+// the chain registry calls testnets are testnets whatever the wallet says,
+// other chains take the network type of the wallet
+func networkType(chainRegistry *chains.Registry, wallet *models.SenderWallet, chainID int64) models.NetworkType {
+	if chainRegistry.IsTestnet(chainID) {
+		return models.NetworkTypeTestnet
+	}
+
+	if len(wallet.NetworkType) == 0 {
+		return models.NetworkTypeMainnet
+	}
+
+	return wallet.NetworkType
+}
+
+// transferType tells plain value transfers from contract calls, which carry
+// call data, and contract deployments, which have no recipient
+func transferType(tx *types.Transaction) models.TransferType {
+	if tx.To() == nil {
+		return models.TransferTypeContractDeployment
+	}
+
+	if len(tx.Data()) == 0 {
+		return models.TransferTypeEoa
+	}
+
+	return models.TransferTypeSmartContract
+}
+
+// contractAddress returns the address the contract deployed by tx is created
+// at, empty for transactions that are not deployments
+func contractAddress(wallet *models.SenderWallet, tx *types.Transaction) string {
+	if tx.To() != nil {
+		return ""
+	}
+
+	sender := common.HexToAddress(strings.TrimSpace(wallet.Address))
+
+	return crypto.CreateAddress(sender, tx.Nonce()).Hex()
+}
+
+// bytecodeHash returns the keccak256 hash of the creation bytecode of
+// contract deployments, empty for other transactions
+func bytecodeHash(tx *types.Transaction) string {
+	if tx.To() != nil {
+		return ""
+	}
+
+	return crypto.Keccak256Hash(tx.Data()).Hex()
+}
+
+// policyDecision returns the decision recorded in the audit log for a
+// transaction that passed the checks of the chain registry
+func policyDecision(tx *types.Transaction) models.PolicyDecision {
+	if tx.To() == nil {
+		return models.PolicyDecisionContractDeployment
+	}
+
+	return models.PolicyDecisionAllowed
+}
+
+// isSenderPayingGas uses the gas payer set on the queue item. Without one an
+// EOA wallet pays for its own gas, while smart contract and multisig wallets
+// are executed by a relayer that pays for it
+func isSenderPayingGas(item *models.CreatedTxQueueItem, wallet *models.SenderWallet) bool {
+	if item.IsSenderPayingGas != nil {
+		return *item.IsSenderPayingGas
+	}
+
+	return wallet.AddressType == models.AddressTypeEoa || len(wallet.AddressType) == 0
+}
+
+// upstreamTransaction loads the row the upstream service created the
+// transaction with and checks it describes the transaction of the message.
+// It returns nil when the row is missing and inserting transactions is
+// allowed by TRANSACTION_INSERT_FALLBACK. A signed row is returned as it is,
+// its stored transaction is queued again instead of signing a new one
+func upstreamTransaction(ctx context.Context, configValues config.Configuration,
+	datastore models.Datastore, chainRegistry *chains.Registry, transactionID string,
+	wallet *models.SenderWallet, tx *types.Transaction,
+) (*models.Transaction, error) {
+	if len(transactionID) == 0 {
+		if configValues.TransactionInsertFallback {
+			return nil, nil
+		}
+
+		return nil, models.ErrTransactionNotFound
+	}
+
+	trans, err := datastore.GetTransactionByUUID(ctx, transactionID)
+	if errors.Is(err, models.ErrTransactionNotFound) && configValues.TransactionInsertFallback {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// a signed row is a message delivered again, e.g. after the signed item
+	// could not be queued. Signing it again would replace the hash of a
+	// transaction that may be broadcast already
+	if trans.State != models.StateSigned && !models.CanTransition(trans.State, models.StateSigned) {
+		return nil, fmt.Errorf("%w from %s to %s", models.ErrIllegalTransition, trans.State, models.StateSigned)
+	}
+
+	if err := matchUpstream(trans, wallet, tx); err != nil {
+		return nil, err
+	}
+
+	// the network of the row is kept as upstream recorded it, a testnet
+	// transfer recorded as mainnet is not signed
+	if chainRegistry.IsTestnet(trans.ChainID) && trans.NetworkType != models.NetworkTypeTestnet {
+		return nil, fmt.Errorf("%w: network is %s on testnet chain %d", errUpstreamMismatch, trans.NetworkType, trans.ChainID)
+	}
+
+	return trans, nil
+}
+
+// storedTransaction decodes the signed transaction stored on a signed row.
+// Rows signed before the transaction was stored can not be queued again
+func storedTransaction(trans *models.Transaction) (*types.Transaction, error) {
+	if len(trans.SignedTX) == 0 {
+		return nil, fmt.Errorf("%w: hash %s, nonce %d", errAlreadySigned, trans.TRXHash, trans.Nonce)
+	}
+
+	signedTX, err := ethtx.Decode(trans.SignedTX)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(signedTX.Hash().Hex(), trans.TRXHash) {
+		return nil, fmt.Errorf("stored transaction has hash %s instead of %s", signedTX.Hash().Hex(), trans.TRXHash)
+	}
+
+	return signedTX, nil
+}
+
+// matchUpstream checks that the upstream row is a transfer of the wallet on
+// its chain, to the recipient and of the amount of the transaction
+func matchUpstream(trans *models.Transaction, wallet *models.SenderWallet, tx *types.Transaction) error {
+	if !strings.EqualFold(strings.TrimSpace(trans.SenderAddress), strings.TrimSpace(wallet.Address)) {
+		return fmt.Errorf("%w: sender is %s instead of %s", errUpstreamMismatch, trans.SenderAddress, wallet.Address)
+	}
+
+	if trans.ChainID != int64(wallet.ChainID) {
+		return fmt.Errorf("%w: chain is %d instead of %d", errUpstreamMismatch, trans.ChainID, wallet.ChainID)
+	}
+
+	recipient := contractAddress(wallet, tx)
+	if to := tx.To(); to != nil {
+		recipient = to.Hex()
+	}
+
+	// deployments may be recorded before the address of the contract is known
+	if !strings.EqualFold(trans.RecipientAddress, recipient) && (tx.To() != nil || len(trans.RecipientAddress) != 0) {
+		return fmt.Errorf("%w: recipient is %s instead of %s", errUpstreamMismatch, trans.RecipientAddress, recipient)
+	}
+
+	amount, err := chainutil.BigIntToFloat64(tx.Value())
+	if err != nil {
+		return err
+	}
+
+	recorded := trans.Amount
+	if recorded == nil {
+		recorded = new(big.Float)
+	}
+
+	if recorded.Cmp(amount) != 0 {
+		return fmt.Errorf("%w: amount is %s instead of %s", errUpstreamMismatch, recorded.String(), amount.String())
+	}
+
+	return nil
+}
+
+// RecordHandler processes a single message retrieved from the queue. It is
+// shared by the lambda handler and the standalone worker
+type RecordHandler func(ctx context.Context, requestID string, record events.SQSMessage) error
+
 func newHandler(configValues config.Configuration,
 	signer models.Signer, queue models.Queue,
-	datastore models.Datastore,
+	datastore models.Datastore, verifier *msgauth.Verifier,
+	chainRegistry *chains.Registry,
 ) LambdaHandler {
-	return func(ctx context.Context, event events.SQSEvent) error {
+	handleRecord := newRecordHandler(configValues, signer, queue, datastore, verifier, chainRegistry)
+
+	return func(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+		var response events.SQSEventResponse
+
 		if len(event.Records) == 0 {
-			return nil
+			return response, nil
 		}
 
-		record := event.Records[0]
-
 		lambdaContext, ok := lambdacontext.FromContext(ctx)
 		if !ok {
-			return errors.New("context is invalid")
+			return response, errors.New("context is invalid")
 		}
 
+		tracer.Start(
+			tracer.WithService(configValues.ServiceName),
+			tracer.WithEnv(configValues.Environment),
+		)
+
+		// groups of a FIFO queue with a failed message, the later messages of
+		// the group must not overtake it
+		failedGroups := map[string]bool{}
+
+		for _, record := range event.Records {
+			group := record.Attributes[messageGroupAttribute]
+
+			if len(group) != 0 && failedGroups[group] {
+				response.BatchItemFailures = append(response.BatchItemFailures,
+					events.SQSBatchItemFailure{ItemIdentifier: record.MessageId})
+
+				continue
+			}
+
+			if err := handleRecord(ctx, lambdaContext.AwsRequestID, record); err != nil {
+				response.BatchItemFailures = append(response.BatchItemFailures,
+					events.SQSBatchItemFailure{ItemIdentifier: record.MessageId})
+
+				if len(group) != 0 {
+					failedGroups[group] = true
+				}
+			}
+		}
+
+		return response, nil
+	}
+}
+
+func newRecordHandler(configValues config.Configuration,
+	signer models.Signer, queue models.Queue,
+	datastore models.Datastore, verifier *msgauth.Verifier,
+	chainRegistry *chains.Registry,
+) RecordHandler {
+	signUserOperation := newUserOperationHandler(configValues, signer, queue, datastore, chainRegistry)
+
+	return func(ctx context.Context, requestID string, record events.SQSMessage) error {
 		log.SetFormatter(&log.JSONFormatter{})
 
+		// nothing in a message is trusted before its producer is verified
+		if err := verifier.Verify(ctx, record.Body, record.MessageAttributes); err != nil {
+			log.WithField("request_id", requestID).
+				WithField("message_id", record.MessageId).
+				WithError(err).
+				Error("rejecting message that failed authentication")
+
+			ddlambda.Metric(messageRejectedMetric, 1)
+
+			return err
+		}
+
 		item, err := getItemFromQueueBody(record)
 		if err != nil {
 			log.WithError(err).
@@ -67,7 +412,7 @@ func newHandler(configValues config.Configuration,
 			return err
 		}
 
-		logger := log.WithField("request_id", lambdaContext.AwsRequestID).
+		logger := log.WithField("request_id", requestID).
 			WithField("transaction_id", item.TransactionID)
 
 		level, err := getLevel(configValues)
@@ -78,39 +423,38 @@ func newHandler(configValues config.Configuration,
 
 		logger.Logger.SetLevel(level)
 
-		tracer.Start(
-			tracer.WithService(configValues.ServiceName),
-			tracer.WithEnv(configValues.Environment),
-		)
+		ctx, cancel := withSafetyDeadline(ctx, configValues.DeadlineSafetyMargin)
+		defer cancel()
+
+		spanOpts := []tracer.StartSpanOption{}
+
+		// continue the trace of the service that queued the transaction
+		if upstream, ok := tracing.Extract(record.MessageAttributes); ok {
+			spanOpts = append(spanOpts, tracer.ChildOf(upstream))
+		}
 
-		span, spanCtx := tracer.StartSpanFromContext(ctx, "Transaction.SignTransaction")
+		span, spanCtx := tracer.StartSpanFromContext(ctx, "Transaction.SignTransaction", spanOpts...)
 
-		span.SetTag("request_id", lambdaContext.AwsRequestID)
+		span.SetTag("request_id", requestID)
 		span.SetTag("transaction_id", item.TransactionID)
 		span.SetTag("request_message_id", record.MessageId)
 		span.SetTag("request_message_receipt_handle", record.ReceiptHandle)
 
 		defer span.Finish()
 
-		tx := &types.Transaction{}
+		if item.Type == models.RequestTypeUserOperation {
+			span.SetTag("request_type", item.Type)
 
-		rawTxBytes, err := hex.DecodeString(item.RawTX)
-		if err != nil {
-			logger.WithField("message_id", record.MessageId).
-				WithField("receipt_handle", record.ReceiptHandle).
-				WithError(err).
-				WithField("raw_tx", item.RawTX).
-				Error("could not hex decode raw TX string")
-			return err
+			return signUserOperation(spanCtx, logger, requestID, record, item)
 		}
 
-		err = rlp.DecodeBytes(rawTxBytes, tx)
+		tx, err := ethtx.Decode(item.RawTX)
 		if err != nil {
 			logger.WithField("message_id", record.MessageId).
 				WithField("receipt_handle", record.ReceiptHandle).
 				WithError(err).
 				WithField("raw_tx", item.RawTX).
-				Error("could not unmarshal raw tx bytes")
+				Error("could not decode raw TX")
 			return err
 		}
 
@@ -125,7 +469,7 @@ func newHandler(configValues config.Configuration,
 		}
 
 		derivationPath, err := datastore.GetDerivationPath(spanCtx, models.FindDerivationPathOptions{
-			KeyID: wallet.KeyID,
+			WalletID: wallet.ID,
 		})
 		if err != nil {
 			logger.WithField("message_id", record.MessageId).
@@ -137,13 +481,82 @@ func newHandler(configValues config.Configuration,
 			return err
 		}
 
+		path, err := walletDerivationPath(configValues, wallet, derivationPath)
+		if err != nil {
+			logger.WithField("message_id", record.MessageId).
+				WithError(err).
+				WithField("wallet_id", wallet.ID).
+				WithField("key_id", wallet.KeyID).
+				Error("invalid derivation path")
+			return err
+		}
+
+		if err := chainRegistry.Validate(wallet, tx); err != nil {
+			logger.WithField("message_id", record.MessageId).
+				WithError(err).
+				WithField("wallet_id", wallet.ID).
+				WithField("chain_id", wallet.ChainID).
+				Error("transaction is not allowed on the chain of the wallet")
+			return err
+		}
+
+		upstream, err := upstreamTransaction(spanCtx, configValues, datastore, chainRegistry, item.TransactionID, wallet, tx)
+		if err != nil {
+			logger.WithField("message_id", record.MessageId).
+				WithError(err).
+				Error("could not load upstream transaction")
+			return err
+		}
+
+		if upstream != nil && upstream.State == models.StateSigned {
+			signedTX, err := storedTransaction(upstream)
+			if err != nil {
+				logger.WithField("message_id", record.MessageId).
+					WithError(err).
+					WithField("transaction_row_id", upstream.ID).
+					Error("could not load the signed transaction of the row")
+				return err
+			}
+
+			signedItem := newSignedItem(configValues, record, item, wallet, upstream, signedTX)
+			signedItem.SignedAt = upstream.Updated
+
+			if err := queue.Add(spanCtx, signedItem); err != nil {
+				logger.WithError(err).
+					Error("could not add signed item to the queue")
+				return err
+			}
+
+			logger.WithField("message_id", record.MessageId).
+				WithField("transaction_row_id", upstream.ID).
+				WithField("hash", upstream.TRXHash).
+				Warn("queued the stored transaction of a signed row again")
+
+			return nil
+		}
+
+		if !hasTimeToSign(spanCtx, configValues.MinSigningTime) {
+			deadline, _ := spanCtx.Deadline()
+
+			logger.WithField("message_id", record.MessageId).
+				WithField("remaining", time.Until(deadline).String()).
+				Warn("returning message for retry, not enough time left to sign it")
+
+			ddlambda.Metric(notEnoughTimeMetric, 1)
+
+			return errNotEnoughTime
+		}
+
 		signedTX, err := signer.Sign(spanCtx, models.SignOptions{
-			KeyID: wallet.KeyID,
-			TX:    tx,
-			DerivationPath: []uint32{
-				derivationPath.Purpose, derivationPath.CoinType, derivationPath.Account,
-				derivationPath.Change, uint32(wallet.AddressIndex),
-			},
+			KeyID:          wallet.KeyID,
+			TX:             tx,
+			DerivationPath: path,
+			Backend:        wallet.SignerBackend,
+			ChainID:        int64(wallet.ChainID),
+			Signer:         chainRegistry.Signer(int64(wallet.ChainID)),
+			RequestID:      requestID,
+			MessageID:      record.MessageId,
+			PolicyDecision: policyDecision(tx),
 		})
 		if err != nil {
 			logger.WithError(err).
@@ -154,55 +567,251 @@ func newHandler(configValues config.Configuration,
 			return err
 		}
 
-		ts := types.Transactions{signedTX}
-		b := new(bytes.Buffer)
-		ts.EncodeIndex(0, b)
+		signedAt := time.Now().UTC()
+
+		dbTransaction := upstream
+		if dbTransaction != nil {
+			dbTransaction.TRXHash = signedTX.Hash().Hex()
+			dbTransaction.Nonce = int64(signedTX.Nonce())
+			dbTransaction.MaxFee = signedTX.GasFeeCap().Int64()
+			dbTransaction.MaxPriorityFee = signedTX.GasTipCap().Int64()
+			dbTransaction.SignedTX = ethtx.Encode(signedTX)
+
+			if address := contractAddress(wallet, signedTX); len(address) != 0 {
+				dbTransaction.TransferType = models.TransferTypeContractDeployment
+				dbTransaction.RecipientAddress = address
+				dbTransaction.BytecodeHash = bytecodeHash(signedTX)
+			}
+
+			err := datastore.TransitionTransaction(ctx, dbTransaction, models.TransitionOptions{
+				To:     models.StateSigned,
+				Reason: "signed in request " + requestID,
+			})
+			if err != nil {
+				logger.WithError(err).
+					WithField("transaction_row_id", dbTransaction.ID).
+					Error("could not mark transaction as signed")
+				return err
+			}
+		} else {
+			amount := tx.Value()
+
+			amountToAdd, err := chainutil.BigIntToFloat64(amount)
+			if err != nil {
+				logger.WithField("amount", amount).
+					WithError(err).
+					WithField("message_id", amount).
+					Error("could not parse amount")
+
+				return err
+			}
+
+			recipient := contractAddress(wallet, signedTX)
+			if to := signedTX.To(); to != nil {
+				recipient = to.Hex()
+			}
+
+			dbTransaction = &models.Transaction{
+				TRXHash:           signedTX.Hash().Hex(),
+				ChainID:           signedTX.ChainId().Int64(),
+				SenderAddress:     wallet.Address,
+				Nonce:             int64(signedTX.Nonce()),
+				RecipientAddress:  recipient,
+				State:             models.StateSigned,
+				NetworkType:       networkType(chainRegistry, wallet, signedTX.ChainId().Int64()),
+				TransferType:      transferType(signedTX),
+				IsSenderPayingGas: isSenderPayingGas(item, wallet),
+				Amount:            amountToAdd,
+				MaxFee:            signedTX.GasFeeCap().Int64(),
+				MaxPriorityFee:    signedTX.GasTipCap().Int64(),
+				TransactionUUID:   item.TransactionID,
+				BytecodeHash:      bytecodeHash(signedTX),
+				SignedTX:          ethtx.Encode(signedTX),
+			}
+
+			if err := datastore.CreateTransaction(ctx, dbTransaction); err != nil {
+				logger.WithError(err).Error("could not create transaction")
+				return err
+			}
+		}
 
-		amount := tx.Value()
+		signedItem := newSignedItem(configValues, record, item, wallet, dbTransaction, signedTX)
+		signedItem.SignedAt = signedAt
 
-		amountToAdd, err := chainutil.BigIntToFloat64(amount)
+		if err := queue.Add(spanCtx, signedItem); err != nil {
+			logger.WithError(err).
+				Error("could not add signed item to the queue")
+			return err
+		}
+
+		return nil
+	}
+}
+
+// userOperationHandler signs the user operation of a decoded and verified
+// message
+type userOperationHandler func(ctx context.Context, logger *log.Entry,
+	requestID string, record events.SQSMessage, item *models.CreatedTxQueueItem) error
+
+// newUserOperationHandler signs ERC-4337 user operations for the smart
+// accounts the wallets own. The wallet signs the userOpHash of the operation
+// for its EntryPoint and chain, the signed operation is recorded and written to
+// the user operation queue of the chain
+func newUserOperationHandler(configValues config.Configuration,
+	signer models.Signer, queue models.Queue,
+	datastore models.Datastore, chainRegistry *chains.Registry,
+) userOperationHandler {
+	return func(ctx context.Context, logger *log.Entry,
+		requestID string, record events.SQSMessage, item *models.CreatedTxQueueItem,
+	) error {
+		logger = logger.WithField("message_id", record.MessageId)
+
+		op := item.UserOperation
+
+		if err := userop.Validate(op); err != nil {
+			logger.WithError(err).Error("invalid user operation")
+			return err
+		}
+
+		if !common.IsHexAddress(item.EntryPoint) {
+			err := fmt.Errorf("%w: invalid entry_point %q", userop.ErrInvalidUserOperation, item.EntryPoint)
+			logger.WithError(err).Error("invalid user operation")
+			return err
+		}
+
+		wallet, err := datastore.GetWallet(ctx, item.WalletRowID)
 		if err != nil {
-			logger.WithField("amount", amount).
-				WithError(err).
-				WithField("message_id", amount).
-				Error("could not parse amount")
+			logger.WithError(err).
+				WithField("wallet_row_id", item.WalletRowID).
+				Error("could not fetch wallet address")
+			return err
+		}
 
+		derivationPath, err := datastore.GetDerivationPath(ctx, models.FindDerivationPathOptions{
+			WalletID: wallet.ID,
+		})
+		if err != nil {
+			logger.WithError(err).
+				WithField("key_id", wallet.KeyID).
+				Error("could not fetch derivation path")
 			return err
 		}
 
-		dbTransaction := &models.Transaction{
-			TRXHash:           signedTX.Hash().Hex(),
-			ChainID:           signedTX.ChainId().Int64(),
-			IsSenderPayingGas: false,
-			SenderAddress:     wallet.Address,
-			Nonce:             int64(signedTX.Nonce()),
-			RecipientAddress:  signedTX.To().Hex(),
-			State:             models.StateSigned,
-			NetworkType:       models.NetworkTypeMainnet,
-			TransferType:      models.TransferTypeEoa,
-			Amount:            amountToAdd,
+		path, err := walletDerivationPath(configValues, wallet, derivationPath)
+		if err != nil {
+			logger.WithError(err).
+				WithField("wallet_id", wallet.ID).
+				WithField("key_id", wallet.KeyID).
+				Error("invalid derivation path")
+			return err
 		}
 
-		if err := datastore.CreateTransaction(ctx, dbTransaction); err != nil {
-			logger.WithError(err).Error("could not create transaction")
+		chainID := int64(wallet.ChainID)
+
+		if err := chainRegistry.ValidateUserOperation(wallet, item.ChainID, item.EntryPoint, op); err != nil {
+			logger.WithError(err).
+				WithField("wallet_id", wallet.ID).
+				WithField("chain_id", chainID).
+				WithField("entry_point", item.EntryPoint).
+				Error("user operation is not allowed on the chain of the wallet")
 			return err
 		}
 
-		err = queue.Add(spanCtx, models.SignedTXQueueItem{
-			ID:            record.MessageId,
-			SignedTX:      hex.EncodeToString(b.Bytes()),
-			TransactionID: item.TransactionID,
+		hashSigner, ok := signer.(models.HashSigner)
+		if !ok {
+			logger.Error("signer can not sign user operations")
+			return models.ErrHashSigningUnsupported
+		}
+
+		if !hasTimeToSign(ctx, configValues.MinSigningTime) {
+			deadline, _ := ctx.Deadline()
+
+			logger.WithField("remaining", time.Until(deadline).String()).
+				Warn("returning message for retry, not enough time left to sign it")
+
+			ddlambda.Metric(notEnoughTimeMetric, 1)
+
+			return errNotEnoughTime
+		}
+
+		entryPoint := common.HexToAddress(item.EntryPoint)
+		userOpHash := userop.Hash(op, entryPoint, big.NewInt(chainID))
+
+		logger = logger.WithField("user_op_hash", userOpHash.Hex())
+
+		sig, err := hashSigner.SignHash(ctx, models.SignOptions{
+			KeyID:          wallet.KeyID,
+			Digest:         userop.Digest(userOpHash),
+			DerivationPath: path,
+			Backend:        wallet.SignerBackend,
+			ChainID:        chainID,
+			RequestID:      requestID,
+			MessageID:      record.MessageId,
+			PolicyDecision: models.PolicyDecisionUserOperation,
 		})
+		if err != nil {
+			logger.WithError(err).
+				WithField("key_id", wallet.KeyID).
+				Error("could not sign user operation")
+			return err
+		}
 
+		signature, err := userop.Signature(sig)
 		if err != nil {
+			logger.WithError(err).Error("signer returned an invalid signature")
+			return err
+		}
+
+		// a key or path mixup would only surface once the bundler simulates
+		// the operation
+		owner, err := userop.Recover(userOpHash, signature)
+		if err != nil || !strings.EqualFold(owner.Hex(), strings.TrimSpace(wallet.Address)) {
 			logger.WithError(err).
-				Error("could not add signed item to the queue")
+				WithField("key_id", wallet.KeyID).
+				WithField("owner", owner.Hex()).
+				Error("user operation was signed by another key than the one of the wallet")
+			return errWrongOwner
+		}
+
+		signedAt := time.Now().UTC()
+
+		signed := *op
+		signed.Signature = signature
+
+		userOperation := &models.UserOperationRecord{
+			UserOpHash:      userOpHash.Hex(),
+			ChainID:         chainID,
+			EntryPoint:      entryPoint.Hex(),
+			Sender:          op.Sender.Hex(),
+			Owner:           owner.Hex(),
+			Nonce:           (*big.Int)(op.Nonce),
+			WalletRowID:     wallet.ID,
+			TransactionUUID: item.TransactionID,
+			State:           models.StateSigned,
+			Operation:       signed,
+		}
+
+		if err := datastore.RecordUserOperation(ctx, userOperation); err != nil {
+			logger.WithError(err).Error("could not record user operation")
 			return err
 		}
 
-		if err := datastore.Close(); err != nil {
-			logger.WithError(err).Error("could not close database connection")
-			return nil
+		// an operation signed before is sent on as it was stored
+		err = queue.AddUserOperation(ctx, models.SignedUserOperationQueueItem{
+			ID:                 record.MessageId,
+			TransactionID:      item.TransactionID,
+			UserOperation:      userOperation.Operation,
+			UserOpHash:         userOpHash.Hex(),
+			EntryPoint:         entryPoint.Hex(),
+			ChainID:            chainID,
+			WalletRowID:        wallet.ID,
+			UserOperationRowID: userOperation.ID,
+			SignedAt:           signedAt,
+		})
+		if err != nil {
+			logger.WithError(err).
+				Error("could not add signed user operation to the queue")
+			return err
 		}
 
 		return nil
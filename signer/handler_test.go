@@ -4,22 +4,47 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"math/big"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/google/uuid"
 	"github.com/mara-labs/transactionsigner/config"
 	"github.com/mara-labs/transactionsigner/mocks"
 	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/chains"
+	"github.com/mara-labs/transactionsigner/pkg/ethtx"
+	"github.com/mara-labs/transactionsigner/pkg/msgauth"
+	"github.com/mara-labs/transactionsigner/pkg/tracing"
+	"github.com/mara-labs/transactionsigner/pkg/userop"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
 
+// upstreamRow is the row the upstream service created for the transaction of
+// testdata/event.json, sent by the mara.eth wallet
+func upstreamRow() *models.Transaction {
+	amount, _ := new(big.Float).SetString("10000000000000000000")
+
+	return &models.Transaction{
+		ID:               7,
+		State:            models.StateCreated,
+		SenderAddress:    "mara.eth",
+		RecipientAddress: "0xe004bb7a6cd6e00d3dabf717d809e665bdeaa671",
+		Amount:           amount,
+	}
+}
+
 func TestNewHandler(t *testing.T) {
 	f, err := os.Open("testdata/event.json")
 	require.NoError(t, err)
@@ -39,6 +64,9 @@ func TestNewHandler(t *testing.T) {
 		hasError bool
 		event    events.SQSEvent
 		mockFn   func(*mocks.Store, *mocks.MockQueue, *mocks.MockSigner)
+		// timeout sets a deadline on the invocation context when non zero
+		timeout        time.Duration
+		insertFallback bool
 	}{
 		{
 			name: "no error because lambda has zero items",
@@ -82,6 +110,47 @@ func TestNewHandler(t *testing.T) {
 			hasError: true,
 			event:    eventData,
 		},
+		{
+			name: "derivation path is not a bip44 path",
+			mockFn: func(s *mocks.Store, _ *mocks.MockQueue, _ *mocks.MockSigner) {
+				s.EXPECT().GetWallet(gomock.Any(), gomock.Any()).Times(1).
+					Return(&models.SenderWallet{
+						ID:           1,
+						Address:      "mara.eth",
+						AddressIndex: 3,
+					}, nil)
+
+				s.EXPECT().GetDerivationPath(gomock.Any(), models.FindDerivationPathOptions{WalletID: 1}).Times(1).
+					Return(&models.DerivationPath{
+						WalletID:     1,
+						Purpose:      49,
+						AddressIndex: 3,
+					}, nil)
+			},
+			hasError: true,
+			event:    eventData,
+		},
+		{
+			name: "coin type of a chain that is not listed is not the default one",
+			mockFn: func(s *mocks.Store, _ *mocks.MockQueue, _ *mocks.MockSigner) {
+				s.EXPECT().GetWallet(gomock.Any(), gomock.Any()).Times(1).
+					Return(&models.SenderWallet{
+						ID:           1,
+						Address:      "mara.eth",
+						AddressIndex: 3,
+					}, nil)
+
+				s.EXPECT().GetDerivationPath(gomock.Any(), models.FindDerivationPathOptions{WalletID: 1}).Times(1).
+					Return(&models.DerivationPath{
+						WalletID:     1,
+						Purpose:      44,
+						CoinType:     614,
+						AddressIndex: 3,
+					}, nil)
+			},
+			hasError: true,
+			event:    eventData,
+		},
 		{
 			name: "could not sign tx",
 			mockFn: func(s *mocks.Store, _ *mocks.MockQueue, signer *mocks.MockSigner) {
@@ -92,9 +161,14 @@ func TestNewHandler(t *testing.T) {
 
 				s.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
 					Return(&models.DerivationPath{
-						Account: 614,
+						Purpose:  44,
+						CoinType: 60,
+						Account:  614,
 					}, nil)
 
+				s.EXPECT().GetTransactionByUUID(gomock.Any(), gomock.Any()).Times(1).
+					Return(upstreamRow(), nil)
+
 				signer.EXPECT().Sign(gomock.Any(), gomock.Any()).Times(1).
 					Return(nil, errors.New("failed to sign TX"))
 			},
@@ -102,7 +176,7 @@ func TestNewHandler(t *testing.T) {
 			event:    eventData,
 		},
 		{
-			name: "signed TX but could not create tx",
+			name: "signed TX but could not mark the transaction as signed",
 			mockFn: func(s *mocks.Store, _ *mocks.MockQueue, signer *mocks.MockSigner) {
 				s.EXPECT().GetWallet(gomock.Any(), gomock.Any()).Times(1).
 					Return(&models.SenderWallet{
@@ -111,16 +185,21 @@ func TestNewHandler(t *testing.T) {
 
 				s.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
 					Return(&models.DerivationPath{
-						Account: 614,
+						Purpose:  44,
+						CoinType: 60,
+						Account:  614,
 					}, nil)
 
+				s.EXPECT().GetTransactionByUUID(gomock.Any(), "bc26bc00-a919-46ef-9ee1-88c22e9de7fb").Times(1).
+					Return(upstreamRow(), nil)
+
 				signer.EXPECT().Sign(gomock.Any(), gomock.Any()).Times(1).
 					Return(types.
 						NewTransaction(0, common.HexToAddress("0x0000000000000000000000000000000000000000"), big.NewInt(0), 0, big.NewInt(0), nil),
 						nil)
 
-				s.EXPECT().CreateTransaction(gomock.Any(), gomock.Any()).Times(1).
-					Return(errors.New("could not create TX"))
+				s.EXPECT().TransitionTransaction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					Return(models.ErrTransactionConflict)
 			},
 			hasError: true,
 			event:    eventData,
@@ -135,15 +214,20 @@ func TestNewHandler(t *testing.T) {
 
 				s.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
 					Return(&models.DerivationPath{
-						Account: 614,
+						Purpose:  44,
+						CoinType: 60,
+						Account:  614,
 					}, nil)
 
+				s.EXPECT().GetTransactionByUUID(gomock.Any(), "bc26bc00-a919-46ef-9ee1-88c22e9de7fb").Times(1).
+					Return(upstreamRow(), nil)
+
 				signer.EXPECT().Sign(gomock.Any(), gomock.Any()).Times(1).
 					Return(types.
 						NewTransaction(0, common.HexToAddress("0x0000000000000000000000000000000000000000"), big.NewInt(0), 0, big.NewInt(0), nil),
 						nil)
 
-				s.EXPECT().CreateTransaction(gomock.Any(), gomock.Any()).Times(1).
+				s.EXPECT().TransitionTransaction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
 					Return(nil)
 
 				queue.EXPECT().Add(gomock.Any(), gomock.Any()).Times(1).
@@ -153,7 +237,7 @@ func TestNewHandler(t *testing.T) {
 			event:    eventData,
 		},
 		{
-			name: "TX was added to the queue but the db store could not be closed",
+			name: "datastore is left open for the next invocation",
 			mockFn: func(s *mocks.Store, queue *mocks.MockQueue, signer *mocks.MockSigner) {
 				s.EXPECT().GetWallet(gomock.Any(), gomock.Any()).Times(1).
 					Return(&models.SenderWallet{
@@ -162,21 +246,26 @@ func TestNewHandler(t *testing.T) {
 
 				s.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
 					Return(&models.DerivationPath{
-						Account: 614,
+						Purpose:  44,
+						CoinType: 60,
+						Account:  614,
 					}, nil)
 
+				s.EXPECT().GetTransactionByUUID(gomock.Any(), "bc26bc00-a919-46ef-9ee1-88c22e9de7fb").Times(1).
+					Return(upstreamRow(), nil)
+
 				signer.EXPECT().Sign(gomock.Any(), gomock.Any()).Times(1).
 					Return(types.
 						NewTransaction(0, common.HexToAddress("0x0000000000000000000000000000000000000000"), big.NewInt(0), 0, big.NewInt(0), nil),
 						nil)
 
-				s.EXPECT().CreateTransaction(gomock.Any(), gomock.Any()).Times(1).
+				s.EXPECT().TransitionTransaction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
 					Return(nil)
 
 				queue.EXPECT().Add(gomock.Any(), gomock.Any()).Times(1).
 					Return(nil)
 
-				s.EXPECT().Close().Times(1).Return(nil)
+				s.EXPECT().Close().Times(0)
 			},
 			event: eventData,
 		},
@@ -190,25 +279,193 @@ func TestNewHandler(t *testing.T) {
 
 				s.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
 					Return(&models.DerivationPath{
-						Account: 614,
+						Purpose:  44,
+						CoinType: 60,
+						Account:  614,
 					}, nil)
 
+				s.EXPECT().GetTransactionByUUID(gomock.Any(), "bc26bc00-a919-46ef-9ee1-88c22e9de7fb").Times(1).
+					Return(upstreamRow(), nil)
+
 				signer.EXPECT().Sign(gomock.Any(), gomock.Any()).Times(1).
 					Return(types.
 						NewTransaction(0, common.HexToAddress("0x0000000000000000000000000000000000000000"), big.NewInt(0), 0, big.NewInt(0), nil),
 						nil)
 
-				s.EXPECT().CreateTransaction(gomock.Any(), gomock.Any()).Times(1).
+				s.EXPECT().TransitionTransaction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
 					Return(nil)
 
 				queue.EXPECT().Add(gomock.Any(), gomock.Any()).Times(1).
 					Return(nil)
-
-				s.EXPECT().Close().Times(1).Return(nil)
 			},
 			hasError: false,
 			event:    eventData,
 		},
+		{
+			name: "transaction that was submitted already is not signed again",
+			mockFn: func(s *mocks.Store, _ *mocks.MockQueue, _ *mocks.MockSigner) {
+				s.EXPECT().GetWallet(gomock.Any(), gomock.Any()).Times(1).
+					Return(&models.SenderWallet{
+						Address: "mara.eth",
+					}, nil)
+
+				s.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
+					Return(&models.DerivationPath{
+						Purpose:  44,
+						CoinType: 60,
+						Account:  614,
+					}, nil)
+
+				s.EXPECT().GetTransactionByUUID(gomock.Any(), gomock.Any()).Times(1).
+					Return(&models.Transaction{ID: 7, State: models.StateSubmitted}, nil)
+			},
+			hasError: true,
+			event:    eventData,
+		},
+		{
+			name: "signed transaction row queues its stored transaction again",
+			mockFn: func(s *mocks.Store, queue *mocks.MockQueue, _ *mocks.MockSigner) {
+				s.EXPECT().GetWallet(gomock.Any(), gomock.Any()).Times(1).
+					Return(&models.SenderWallet{
+						Address: "mara.eth",
+					}, nil)
+
+				s.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
+					Return(&models.DerivationPath{
+						Purpose:  44,
+						CoinType: 60,
+						Account:  614,
+					}, nil)
+
+				stored := types.NewTransaction(3, common.HexToAddress("0xe004bb7a6cd6e00d3dabf717d809e665bdeaa671"),
+					big.NewInt(0), 21000, big.NewInt(1), nil)
+
+				signed := upstreamRow()
+				signed.State = models.StateSigned
+				signed.TRXHash = stored.Hash().Hex()
+				signed.Nonce = 3
+				signed.SignedTX = ethtx.Encode(stored)
+
+				s.EXPECT().GetTransactionByUUID(gomock.Any(), gomock.Any()).Times(1).
+					Return(signed, nil)
+
+				queue.EXPECT().Add(gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(_ context.Context, item models.SignedTXQueueItem) error {
+						if item.SignedTX != signed.SignedTX || item.TransactionRowID != int64(signed.ID) {
+							return fmt.Errorf("queued %s for row %d", item.SignedTX, item.TransactionRowID)
+						}
+
+						return nil
+					})
+			},
+			event: eventData,
+		},
+		{
+			name: "signed transaction row without a stored transaction is not signed again",
+			mockFn: func(s *mocks.Store, _ *mocks.MockQueue, _ *mocks.MockSigner) {
+				s.EXPECT().GetWallet(gomock.Any(), gomock.Any()).Times(1).
+					Return(&models.SenderWallet{
+						Address: "mara.eth",
+					}, nil)
+
+				s.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
+					Return(&models.DerivationPath{
+						Purpose:  44,
+						CoinType: 60,
+						Account:  614,
+					}, nil)
+
+				signed := upstreamRow()
+				signed.State = models.StateSigned
+				signed.TRXHash = "0x5e1d3a76fbf824220eafc8c79ad578ad2b67d01b0c2425eb1f1347e8f50882ab"
+
+				s.EXPECT().GetTransactionByUUID(gomock.Any(), gomock.Any()).Times(1).
+					Return(signed, nil)
+			},
+			hasError: true,
+			event:    eventData,
+		},
+		{
+			name: "transaction that upstream did not create is rejected",
+			mockFn: func(s *mocks.Store, _ *mocks.MockQueue, _ *mocks.MockSigner) {
+				s.EXPECT().GetWallet(gomock.Any(), gomock.Any()).Times(1).
+					Return(&models.SenderWallet{
+						Address: "mara.eth",
+					}, nil)
+
+				s.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
+					Return(&models.DerivationPath{
+						Purpose:  44,
+						CoinType: 60,
+						Account:  614,
+					}, nil)
+
+				s.EXPECT().GetTransactionByUUID(gomock.Any(), gomock.Any()).Times(1).
+					Return(nil, models.ErrTransactionNotFound)
+			},
+			hasError: true,
+			event:    eventData,
+		},
+		{
+			name:           "transaction that upstream did not create is inserted when the fallback is enabled",
+			insertFallback: true,
+			mockFn: func(s *mocks.Store, queue *mocks.MockQueue, signer *mocks.MockSigner) {
+				s.EXPECT().GetWallet(gomock.Any(), gomock.Any()).Times(1).
+					Return(&models.SenderWallet{
+						Address: "mara.eth",
+					}, nil)
+
+				s.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
+					Return(&models.DerivationPath{
+						Purpose:  44,
+						CoinType: 60,
+						Account:  614,
+					}, nil)
+
+				s.EXPECT().GetTransactionByUUID(gomock.Any(), gomock.Any()).Times(1).
+					Return(nil, models.ErrTransactionNotFound)
+
+				signer.EXPECT().Sign(gomock.Any(), gomock.Any()).Times(1).
+					Return(types.
+						NewTransaction(0, common.HexToAddress("0x0000000000000000000000000000000000000000"), big.NewInt(0), 0, big.NewInt(0), nil),
+						nil)
+
+				s.EXPECT().CreateTransaction(gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(_ context.Context, trans *models.Transaction) error {
+						if trans.TransactionUUID != "bc26bc00-a919-46ef-9ee1-88c22e9de7fb" {
+							return errors.New("transaction uuid is not set")
+						}
+
+						return nil
+					})
+
+				queue.EXPECT().Add(gomock.Any(), gomock.Any()).Times(1).
+					Return(nil)
+			},
+			event: eventData,
+		},
+		{
+			name: "message is returned for retry without signing when the deadline is too close",
+			mockFn: func(s *mocks.Store, _ *mocks.MockQueue, _ *mocks.MockSigner) {
+				s.EXPECT().GetWallet(gomock.Any(), gomock.Any()).Times(1).
+					Return(&models.SenderWallet{
+						Address: "0x0000000000000000000000000000000000000000",
+					}, nil)
+
+				s.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
+					Return(&models.DerivationPath{
+						Purpose:  44,
+						CoinType: 60,
+						Account:  614,
+					}, nil)
+
+				s.EXPECT().GetTransactionByUUID(gomock.Any(), gomock.Any()).Times(1).
+					Return(upstreamRow(), nil)
+			},
+			hasError: true,
+			event:    eventData,
+			timeout:  3 * time.Second,
+		},
 	}
 
 	for _, v := range tt {
@@ -221,25 +478,614 @@ func TestNewHandler(t *testing.T) {
 			signer := mocks.NewMockSigner(ctrl)
 
 			cfg := config.Configuration{
-				LogLevel: "DEBUG",
+				LogLevel:             "DEBUG",
+				DeadlineSafetyMargin: time.Second,
+				MinSigningTime:       5 * time.Second,
+
+				TransactionInsertFallback: v.insertFallback,
 			}
 
 			v.mockFn(store, queue, signer)
 
-			handler := newHandler(cfg, signer, queue, store)
+			handler := newHandler(cfg, signer, queue, store, nil, nil)
 
 			ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{
 				AwsRequestID: uuid.New().String(),
 			})
 
-			err := handler(ctx, v.event)
+			if v.timeout != 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, v.timeout)
+				defer cancel()
+			}
+
+			response, err := handler(ctx, v.event)
+			require.NoError(t, err)
 
 			if v.hasError {
-				require.Error(t, err)
+				require.Equal(t, []events.SQSBatchItemFailure{{ItemIdentifier: v.event.Records[0].MessageId}},
+					response.BatchItemFailures)
 				return
 			}
 
-			require.NoError(t, err)
+			require.Empty(t, response.BatchItemFailures)
+		})
+	}
+}
+
+func TestNewHandler_Batch(t *testing.T) {
+	f, err := os.ReadFile("testdata/event.json")
+	require.NoError(t, err)
+
+	var eventData events.SQSEvent
+	require.NoError(t, json.Unmarshal(f, &eventData))
+
+	valid := eventData.Records[0]
+
+	message := func(id, group, body string) events.SQSMessage {
+		record := valid
+		record.MessageId = id
+		record.Body = body
+		record.Attributes = map[string]string{messageGroupAttribute: group}
+
+		return record
+	}
+
+	event := events.SQSEvent{Records: []events.SQSMessage{
+		message("a-1", "a", "not json"),
+		message("a-2", "a", valid.Body),
+		message("b-1", "b", valid.Body),
+	}}
+
+	ctrl := gomock.NewController(t)
+	store := mocks.NewStore(ctrl)
+	queue := mocks.NewMockQueue(ctrl)
+	signer := mocks.NewMockSigner(ctrl)
+
+	// only b-1 is signed, a-2 must not overtake the message of its group that
+	// failed
+	store.EXPECT().GetWallet(gomock.Any(), gomock.Any()).Times(1).
+		Return(&models.SenderWallet{Address: "mara.eth"}, nil)
+	store.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
+		Return(&models.DerivationPath{Purpose: 44, CoinType: 60, Account: 614}, nil)
+	store.EXPECT().GetTransactionByUUID(gomock.Any(), gomock.Any()).Times(1).
+		Return(upstreamRow(), nil)
+	signer.EXPECT().Sign(gomock.Any(), gomock.Any()).Times(1).
+		Return(types.NewTransaction(0, common.Address{}, big.NewInt(0), 0, big.NewInt(0), nil), nil)
+	store.EXPECT().TransitionTransaction(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil)
+	queue.EXPECT().Add(gomock.Any(), gomock.Any()).Times(1).Return(nil)
+
+	handler := newHandler(config.Configuration{LogLevel: "DEBUG"}, signer, queue, store, nil, nil)
+
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{
+		AwsRequestID: uuid.New().String(),
+	})
+
+	response, err := handler(ctx, event)
+	require.NoError(t, err)
+	require.Equal(t, []events.SQSBatchItemFailure{{ItemIdentifier: "a-1"}, {ItemIdentifier: "a-2"}},
+		response.BatchItemFailures)
+}
+
+func TestNewRecordHandler_TraceContext(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	f, err := os.ReadFile("testdata/event.json")
+	require.NoError(t, err)
+
+	var eventData events.SQSEvent
+	require.NoError(t, json.Unmarshal(f, &eventData))
+
+	upstream, upstreamCtx := tracer.StartSpanFromContext(context.Background(), "Transaction.Create")
+	traceContext, ok := tracing.Inject(upstreamCtx)
+	require.True(t, ok)
+	upstream.Finish()
+
+	record := eventData.Records[0]
+	record.MessageAttributes = map[string]events.SQSMessageAttribute{
+		tracing.Attribute: {DataType: "String", StringValue: &traceContext},
+	}
+
+	ctrl := gomock.NewController(t)
+	store := mocks.NewStore(ctrl)
+	store.EXPECT().GetWallet(gomock.Any(), gomock.Any()).Times(1).
+		Return(nil, errors.New("could not fetch wallet"))
+
+	handleRecord := newRecordHandler(config.Configuration{LogLevel: "DEBUG"},
+		mocks.NewMockSigner(ctrl), mocks.NewMockQueue(ctrl), store, nil, nil)
+
+	require.Error(t, handleRecord(context.Background(), "request", record))
+
+	var span mocktracer.Span
+
+	for _, s := range mt.FinishedSpans() {
+		if s.OperationName() == "Transaction.SignTransaction" {
+			span = s
+		}
+	}
+
+	require.NotNil(t, span)
+	require.Equal(t, upstream.Context().TraceID(), span.TraceID())
+	require.Equal(t, upstream.Context().SpanID(), span.ParentID())
+}
+
+func TestNewSignedItem(t *testing.T) {
+	to := common.HexToAddress("0xe004bb7a6cd6e00d3dabf717d809e665bdeaa671")
+
+	signedTX := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   big.NewInt(614),
+		Nonce:     7,
+		GasTipCap: big.NewInt(2),
+		GasFeeCap: big.NewInt(30),
+		Gas:       21000,
+		To:        &to,
+	})
+
+	item := newSignedItem(config.Configuration{SignedTXQueueItemVersion: models.SignedTXQueueItemV2},
+		events.SQSMessage{MessageId: "message"},
+		&models.CreatedTxQueueItem{TransactionID: "transaction"},
+		&models.SenderWallet{ID: 3, Address: "0x00000000000000000000000000000000000000aa "},
+		&models.Transaction{ID: 12},
+		signedTX)
+
+	require.Equal(t, models.SignedTXQueueItem{
+		Version:          models.SignedTXQueueItemV2,
+		ID:               "message",
+		SignedTX:         ethtx.Encode(signedTX),
+		TransactionID:    "transaction",
+		TxHash:           signedTX.Hash().Hex(),
+		ChainID:          614,
+		TxType:           types.DynamicFeeTxType,
+		Sender:           "0x00000000000000000000000000000000000000aa",
+		Recipient:        to.Hex(),
+		Nonce:            7,
+		Gas:              21000,
+		GasPrice:         "30",
+		GasTipCap:        "2",
+		GasFeeCap:        "30",
+		WalletRowID:      3,
+		TransactionRowID: 12,
+	}, item)
+}
+
+func TestNewSignedItem_ContractDeployment(t *testing.T) {
+	signedTX := types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(614), Nonce: 1, Data: common.FromHex("0x6080604052")})
+
+	item := newSignedItem(config.Configuration{SignedTXQueueItemVersion: models.SignedTXQueueItemV2},
+		events.SQSMessage{MessageId: "message"},
+		&models.CreatedTxQueueItem{TransactionID: "transaction"},
+		&models.SenderWallet{Address: "0x6ac7ea33f8831ea9dcc53393aaa88b25a785dbf0"},
+		&models.Transaction{ID: 12},
+		signedTX)
+
+	require.Empty(t, item.Recipient)
+	require.Equal(t, "0x343c43A37D37dfF08AE8C4A11544c718AbB4fCF8", item.ContractAddress)
+}
+
+func TestNetworkType(t *testing.T) {
+	// 614 is a testnet of the registry, 5 is only listed in TESTNET_CHAIN_IDS
+	chainRegistry, err := chains.New(config.Configuration{
+		ChainRegistry:   `[{"chain_id":1,"network_type":"mainnet"},{"chain_id":614,"network_type":"testnet"}]`,
+		TestnetChainIDs: []int64{5},
+	})
+	require.NoError(t, err)
+
+	tt := []struct {
+		name     string
+		chainID  int64
+		wallet   models.NetworkType
+		expected models.NetworkType
+	}{
+		{name: "mainnet wallet on a mainnet chain", chainID: 1, wallet: models.NetworkTypeMainnet, expected: models.NetworkTypeMainnet},
+		{name: "testnet wallet on a mainnet chain", chainID: 1, wallet: models.NetworkTypeTestnet, expected: models.NetworkTypeTestnet},
+		{name: "testnet wallet on a testnet chain", chainID: 5, wallet: models.NetworkTypeTestnet, expected: models.NetworkTypeTestnet},
+		{name: "mainnet wallet on a testnet chain", chainID: 614, wallet: models.NetworkTypeMainnet, expected: models.NetworkTypeTestnet},
+		{name: "wallet without network type on a testnet chain", chainID: 5, expected: models.NetworkTypeTestnet},
+		{name: "wallet without network type on a mainnet chain", chainID: 1, expected: models.NetworkTypeMainnet},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			wallet := &models.SenderWallet{NetworkType: v.wallet}
+			require.Equal(t, v.expected, networkType(chainRegistry, wallet, v.chainID))
 		})
 	}
 }
+
+func TestTransferType(t *testing.T) {
+	to := common.HexToAddress("0xe004bb7a6cd6e00d3dabf717d809e665bdeaa671")
+
+	transfer := types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(614), To: &to, Value: big.NewInt(1)})
+	require.Equal(t, models.TransferTypeEoa, transferType(transfer))
+
+	// transfer(address,uint256) of an ERC-20 token
+	call := types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(614), To: &to, Data: common.FromHex("0xa9059cbb")})
+	require.Equal(t, models.TransferTypeSmartContract, transferType(call))
+
+	deployment := types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(614), Data: common.FromHex("0x6080604052")})
+	require.Equal(t, models.TransferTypeContractDeployment, transferType(deployment))
+}
+
+func TestContractDeployment(t *testing.T) {
+	wallet := &models.SenderWallet{Address: "0x6ac7ea33f8831ea9dcc53393aaa88b25a785dbf0 "}
+	to := common.HexToAddress("0xe004bb7a6cd6e00d3dabf717d809e665bdeaa671")
+
+	call := types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(614), Nonce: 1, To: &to, Data: common.FromHex("0xa9059cbb")})
+	require.Empty(t, contractAddress(wallet, call))
+	require.Empty(t, bytecodeHash(call))
+	require.Equal(t, models.PolicyDecisionAllowed, policyDecision(call))
+
+	// the addresses created by the first nonces of the sender are well known
+	deployment := types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(614), Nonce: 1, Data: common.FromHex("0x6080604052")})
+	require.Equal(t, "0x343c43A37D37dfF08AE8C4A11544c718AbB4fCF8", contractAddress(wallet, deployment))
+	require.Equal(t, "0x1c3374235d773b2189aed115aa13143020fcdbbe86e38f358cf3e4771b2f0244", bytecodeHash(deployment))
+	require.Equal(t, models.PolicyDecisionContractDeployment, policyDecision(deployment))
+}
+
+func TestIsSenderPayingGas(t *testing.T) {
+	yes, no := true, false
+
+	tt := []struct {
+		name        string
+		addressType models.AddressType
+		itemPays    *bool
+		expected    bool
+	}{
+		{name: "eoa wallet", addressType: models.AddressTypeEoa, expected: true},
+		{name: "smart contract wallet", addressType: models.AddressTypeSmartContract, expected: false},
+		{name: "multisig wallet", addressType: models.AddressTypeMultisig, expected: false},
+		{name: "eoa wallet sponsored by the producer", addressType: models.AddressTypeEoa, itemPays: &no, expected: false},
+		{name: "multisig wallet paying as set by the producer", addressType: models.AddressTypeMultisig, itemPays: &yes, expected: true},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			item := &models.CreatedTxQueueItem{IsSenderPayingGas: v.itemPays}
+			wallet := &models.SenderWallet{AddressType: v.addressType}
+
+			require.Equal(t, v.expected, isSenderPayingGas(item, wallet))
+		})
+	}
+}
+
+func TestNewRecordHandler_MessageAuth(t *testing.T) {
+	f, err := os.ReadFile("testdata/event.json")
+	require.NoError(t, err)
+
+	var eventData events.SQSEvent
+	require.NoError(t, json.Unmarshal(f, &eventData))
+
+	verifier, err := msgauth.NewVerifier(config.Configuration{
+		MessageAuthInboundKeys: `[{"id":"producer-1","algorithm":"hmac-sha256","key":"MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="}]`,
+		MessageAuthRequired:    true,
+	})
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+
+	// the wallet is never looked up for messages that fail authentication
+	handleRecord := newRecordHandler(config.Configuration{LogLevel: "DEBUG"},
+		mocks.NewMockSigner(ctrl), mocks.NewMockQueue(ctrl), mocks.NewStore(ctrl), verifier, nil)
+
+	require.ErrorIs(t, handleRecord(context.Background(), "request", eventData.Records[0]), msgauth.ErrUnsigned)
+}
+
+func TestNewRecordHandler_ChainRegistry(t *testing.T) {
+	f, err := os.ReadFile("testdata/event.json")
+	require.NoError(t, err)
+
+	var eventData events.SQSEvent
+	require.NoError(t, json.Unmarshal(f, &eventData))
+
+	chainRegistry, err := chains.New(config.Configuration{
+		ChainRegistry: `[{"chain_id":1,"network_type":"mainnet"}]`,
+	})
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+
+	store := mocks.NewStore(ctrl)
+	store.EXPECT().GetWallet(gomock.Any(), gomock.Any()).Times(1).
+		Return(&models.SenderWallet{Address: "mara.eth", ChainID: 614}, nil)
+	store.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
+		Return(&models.DerivationPath{Purpose: 44, CoinType: 60, Account: 614}, nil)
+
+	// the transaction is neither looked up nor signed on an unknown chain
+	handleRecord := newRecordHandler(config.Configuration{LogLevel: "DEBUG"},
+		mocks.NewMockSigner(ctrl), mocks.NewMockQueue(ctrl), store, nil, chainRegistry)
+
+	require.ErrorIs(t, handleRecord(context.Background(), "request", eventData.Records[0]), chains.ErrUnknownChain)
+}
+
+func TestNewRecordHandler_UpstreamMismatch(t *testing.T) {
+	f, err := os.ReadFile("testdata/event.json")
+	require.NoError(t, err)
+
+	var eventData events.SQSEvent
+	require.NoError(t, json.Unmarshal(f, &eventData))
+
+	chainRegistry, err := chains.New(config.Configuration{TestnetChainIDs: []int64{5}})
+	require.NoError(t, err)
+
+	tt := []struct {
+		name    string
+		chainID int
+		modify  func(*models.Transaction)
+	}{
+		{name: "sender", modify: func(trans *models.Transaction) { trans.SenderAddress = "other.eth" }},
+		{name: "chain", modify: func(trans *models.Transaction) { trans.ChainID = 614 }},
+		{name: "recipient", modify: func(trans *models.Transaction) { trans.RecipientAddress = "0x00000000000000000000000000000000000000aa" }},
+		{name: "amount", modify: func(trans *models.Transaction) { trans.Amount = big.NewFloat(1) }},
+		{name: "network", chainID: 5, modify: func(trans *models.Transaction) {
+			trans.ChainID = 5
+			trans.NetworkType = models.NetworkTypeMainnet
+		}},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			upstream := upstreamRow()
+			v.modify(upstream)
+
+			store := mocks.NewStore(ctrl)
+			store.EXPECT().GetWallet(gomock.Any(), gomock.Any()).Times(1).
+				Return(&models.SenderWallet{Address: "mara.eth", ChainID: v.chainID}, nil)
+			store.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
+				Return(&models.DerivationPath{Purpose: 44, CoinType: 60, Account: 614}, nil)
+			store.EXPECT().GetTransactionByUUID(gomock.Any(), gomock.Any()).Times(1).
+				Return(upstream, nil)
+
+			// the transaction is not signed for a row that describes another
+			// transfer
+			handleRecord := newRecordHandler(config.Configuration{LogLevel: "DEBUG"},
+				mocks.NewMockSigner(ctrl), mocks.NewMockQueue(ctrl), store, nil, chainRegistry)
+
+			require.ErrorIs(t, handleRecord(context.Background(), "request", eventData.Records[0]), errUpstreamMismatch)
+		})
+	}
+}
+
+func TestNewRecordHandler_ContractDeployment(t *testing.T) {
+	deployment := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   big.NewInt(614),
+		Nonce:     1,
+		GasTipCap: big.NewInt(2),
+		GasFeeCap: big.NewInt(30),
+		Gas:       1000000,
+		Data:      common.FromHex("0x6080604052"),
+	})
+
+	body, err := json.Marshal(models.CreatedTxQueueItem{RawTX: ethtx.Encode(deployment), WalletRowID: 3})
+	require.NoError(t, err)
+
+	chainRegistry, err := chains.New(config.Configuration{
+		MaraChainID:       "614",
+		ContractDeployers: []string{"0x6ac7ea33f8831ea9dcc53393aaa88b25a785dbf0"},
+	})
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+
+	wallet := &models.SenderWallet{ID: 3, Address: "0x6ac7ea33f8831ea9dcc53393aaa88b25a785dbf0", ChainID: 614}
+
+	store := mocks.NewStore(ctrl)
+	store.EXPECT().GetWallet(gomock.Any(), gomock.Any()).Times(1).Return(wallet, nil)
+	store.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
+		Return(&models.DerivationPath{WalletID: 3, Purpose: 44, CoinType: 60, Account: 614}, nil)
+	store.EXPECT().CreateTransaction(gomock.Any(), gomock.Any()).Times(1).
+		DoAndReturn(func(_ context.Context, trans *models.Transaction) error {
+			require.Equal(t, models.TransferTypeContractDeployment, trans.TransferType)
+			require.Equal(t, "0x343c43A37D37dfF08AE8C4A11544c718AbB4fCF8", trans.RecipientAddress)
+			require.Equal(t, bytecodeHash(deployment), trans.BytecodeHash)
+			return nil
+		})
+
+	signer := mocks.NewMockSigner(ctrl)
+	signer.EXPECT().Sign(gomock.Any(), gomock.Any()).Times(1).
+		DoAndReturn(func(_ context.Context, opts models.SignOptions) (*types.Transaction, error) {
+			require.Equal(t, models.PolicyDecisionContractDeployment, opts.PolicyDecision)
+			return opts.TX, nil
+		})
+
+	queue := mocks.NewMockQueue(ctrl)
+	queue.EXPECT().Add(gomock.Any(), gomock.Any()).Times(1).
+		DoAndReturn(func(_ context.Context, item models.SignedTXQueueItem) error {
+			require.Equal(t, "0x343c43A37D37dfF08AE8C4A11544c718AbB4fCF8", item.ContractAddress)
+			return nil
+		})
+
+	handleRecord := newRecordHandler(config.Configuration{LogLevel: "DEBUG", TransactionInsertFallback: true},
+		signer, queue, store, nil, chainRegistry)
+
+	require.NoError(t, handleRecord(context.Background(), "request", events.SQSMessage{Body: string(body)}))
+
+	// wallets that are not contract deployers are stopped before signing
+	store.EXPECT().GetWallet(gomock.Any(), gomock.Any()).Times(1).
+		Return(&models.SenderWallet{ID: 4, Address: "0xe004bb7a6cd6e00d3dabf717d809e665bdeaa671", ChainID: 614}, nil)
+	store.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
+		Return(&models.DerivationPath{WalletID: 4, Purpose: 44, CoinType: 60, Account: 614}, nil)
+
+	require.ErrorIs(t, handleRecord(context.Background(), "request", events.SQSMessage{Body: string(body)}), chains.ErrDeploymentNotAllowed)
+}
+
+func TestNewRecordHandler_UserOperation(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	owner := crypto.PubkeyToAddress(key.PublicKey)
+	entryPoint := "0x5FF137D4b0FDCD49DcA30c7CF57E578a026d2789"
+
+	op := &models.UserOperation{
+		Sender:               common.HexToAddress("0x6ac7ea33f8831ea9dcc53393aaa88b25a785dbf0"),
+		Nonce:                (*hexutil.Big)(big.NewInt(1)),
+		CallData:             common.FromHex("0xb61d27f6"),
+		CallGasLimit:         (*hexutil.Big)(big.NewInt(35000)),
+		VerificationGasLimit: (*hexutil.Big)(big.NewInt(70000)),
+		PreVerificationGas:   (*hexutil.Big)(big.NewInt(21000)),
+		MaxFeePerGas:         (*hexutil.Big)(big.NewInt(30)),
+		MaxPriorityFeePerGas: (*hexutil.Big)(big.NewInt(2)),
+	}
+
+	newBody := func(op *models.UserOperation, chainID int64) string {
+		body, err := json.Marshal(models.CreatedTxQueueItem{
+			Type:          models.RequestTypeUserOperation,
+			TransactionID: "9a3e2d8c-7b6f-4e1a-8c2d-5f4e3b2a1c0d",
+			WalletRowID:   3,
+			UserOperation: op,
+			EntryPoint:    entryPoint,
+			ChainID:       chainID,
+		})
+		require.NoError(t, err)
+
+		return string(body)
+	}
+
+	userOpHash := userop.Hash(op, common.HexToAddress(entryPoint), big.NewInt(614))
+
+	chainRegistry, err := chains.New(config.Configuration{
+		ChainRegistry: `[{"chain_id":614,"network_type":"testnet","entry_points":["` + entryPoint + `"]}]`,
+	})
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+
+	store := mocks.NewStore(ctrl)
+	queue := mocks.NewMockQueue(ctrl)
+	hashSigner := mocks.NewMockHashSigner(ctrl)
+
+	signer := struct {
+		models.Signer
+		models.HashSigner
+	}{Signer: mocks.NewMockSigner(ctrl), HashSigner: hashSigner}
+
+	expectWallet := func() {
+		store.EXPECT().GetWallet(gomock.Any(), int64(3)).Times(1).
+			Return(&models.SenderWallet{ID: 3, Address: owner.Hex(), ChainID: 614}, nil)
+		store.EXPECT().GetDerivationPath(gomock.Any(), gomock.Any()).Times(1).
+			Return(&models.DerivationPath{WalletID: 3, Purpose: 44, CoinType: 60, Account: 614}, nil)
+	}
+
+	handleRecord := newRecordHandler(config.Configuration{LogLevel: "DEBUG"}, signer, queue, store, nil, chainRegistry)
+
+	t.Run("signed operations are recorded and queued", func(t *testing.T) {
+		expectWallet()
+
+		hashSigner.EXPECT().SignHash(gomock.Any(), gomock.Any()).Times(1).
+			DoAndReturn(func(_ context.Context, opts models.SignOptions) ([]byte, error) {
+				require.Equal(t, userop.Digest(userOpHash), opts.Digest)
+				require.Equal(t, models.PolicyDecisionUserOperation, opts.PolicyDecision)
+				require.Nil(t, opts.TX)
+				return crypto.Sign(opts.Digest, key)
+			})
+
+		store.EXPECT().RecordUserOperation(gomock.Any(), gomock.Any()).Times(1).
+			DoAndReturn(func(_ context.Context, record *models.UserOperationRecord) error {
+				require.Equal(t, userOpHash.Hex(), record.UserOpHash)
+				require.Equal(t, owner.Hex(), record.Owner)
+				require.Equal(t, models.StateSigned, record.State)
+				require.Equal(t, "9a3e2d8c-7b6f-4e1a-8c2d-5f4e3b2a1c0d", record.TransactionUUID)
+				record.ID = 7
+				return nil
+			})
+
+		queue.EXPECT().AddUserOperation(gomock.Any(), gomock.Any()).Times(1).
+			DoAndReturn(func(_ context.Context, item models.SignedUserOperationQueueItem) error {
+				require.Equal(t, int64(7), item.UserOperationRowID)
+				require.Equal(t, int64(614), item.ChainID)
+				require.Equal(t, userOpHash.Hex(), item.UserOpHash)
+
+				signer, err := userop.Recover(userOpHash, item.UserOperation.Signature)
+				require.NoError(t, err)
+				require.Equal(t, owner, signer)
+				return nil
+			})
+
+		require.NoError(t, handleRecord(context.Background(), "request", events.SQSMessage{MessageId: "1", Body: newBody(op, 614)}))
+	})
+
+	t.Run("operations signed before are queued as they were stored", func(t *testing.T) {
+		expectWallet()
+
+		hashSigner.EXPECT().SignHash(gomock.Any(), gomock.Any()).Times(1).
+			DoAndReturn(func(_ context.Context, opts models.SignOptions) ([]byte, error) {
+				return crypto.Sign(opts.Digest, key)
+			})
+
+		stored := *op
+		stored.Signature = []byte{1}
+
+		store.EXPECT().RecordUserOperation(gomock.Any(), gomock.Any()).Times(1).
+			DoAndReturn(func(_ context.Context, record *models.UserOperationRecord) error {
+				record.ID = 7
+				record.Operation = stored
+				return nil
+			})
+
+		queue.EXPECT().AddUserOperation(gomock.Any(), gomock.Any()).Times(1).
+			DoAndReturn(func(_ context.Context, item models.SignedUserOperationQueueItem) error {
+				require.Equal(t, int64(7), item.UserOperationRowID)
+				require.Equal(t, stored, item.UserOperation)
+				return nil
+			})
+
+		require.NoError(t, handleRecord(context.Background(), "request", events.SQSMessage{MessageId: "1", Body: newBody(op, 614)}))
+	})
+
+	t.Run("operations past signed are not queued again", func(t *testing.T) {
+		expectWallet()
+
+		hashSigner.EXPECT().SignHash(gomock.Any(), gomock.Any()).Times(1).
+			DoAndReturn(func(_ context.Context, opts models.SignOptions) ([]byte, error) {
+				return crypto.Sign(opts.Digest, key)
+			})
+
+		store.EXPECT().RecordUserOperation(gomock.Any(), gomock.Any()).Times(1).
+			Return(models.ErrUserOperationProcessed)
+
+		err := handleRecord(context.Background(), "request", events.SQSMessage{MessageId: "1", Body: newBody(op, 614)})
+		require.ErrorIs(t, err, models.ErrUserOperationProcessed)
+	})
+
+	t.Run("signatures of another key are not queued", func(t *testing.T) {
+		expectWallet()
+
+		otherKey, err := crypto.GenerateKey()
+		require.NoError(t, err)
+
+		hashSigner.EXPECT().SignHash(gomock.Any(), gomock.Any()).Times(1).
+			DoAndReturn(func(_ context.Context, opts models.SignOptions) ([]byte, error) {
+				return crypto.Sign(opts.Digest, otherKey)
+			})
+
+		err = handleRecord(context.Background(), "request", events.SQSMessage{Body: newBody(op, 0)})
+		require.ErrorIs(t, err, errWrongOwner)
+	})
+
+	t.Run("operations for another chain are not signed", func(t *testing.T) {
+		expectWallet()
+
+		err := handleRecord(context.Background(), "request", events.SQSMessage{Body: newBody(op, 1)})
+		require.ErrorIs(t, err, chains.ErrChainMismatch)
+	})
+
+	t.Run("invalid operations are rejected before the wallet is loaded", func(t *testing.T) {
+		invalid := *op
+		invalid.CallGasLimit = nil
+
+		err := handleRecord(context.Background(), "request", events.SQSMessage{Body: newBody(&invalid, 614)})
+		require.ErrorIs(t, err, userop.ErrInvalidUserOperation)
+	})
+
+	t.Run("signers that can not sign hashes", func(t *testing.T) {
+		expectWallet()
+
+		handleRecord := newRecordHandler(config.Configuration{LogLevel: "DEBUG"},
+			mocks.NewMockSigner(ctrl), queue, store, nil, chainRegistry)
+
+		err := handleRecord(context.Background(), "request", events.SQSMessage{Body: newBody(op, 614)})
+		require.ErrorIs(t, err, models.ErrHashSigningUnsupported)
+	})
+}
@@ -1,18 +1,33 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	ddlambda "github.com/DataDog/datadog-lambda-go"
+	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	log "github.com/sirupsen/logrus"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 
 	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/datastore/cache"
 	"github.com/mara-labs/transactionsigner/datastore/postgres"
+	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/audit"
+	"github.com/mara-labs/transactionsigner/pkg/chains"
+	"github.com/mara-labs/transactionsigner/pkg/kms"
+	"github.com/mara-labs/transactionsigner/pkg/msgauth"
+	"github.com/mara-labs/transactionsigner/pkg/queue"
+	"github.com/mara-labs/transactionsigner/pkg/registry"
+	"github.com/mara-labs/transactionsigner/pkg/resilience"
 	"github.com/mara-labs/transactionsigner/pkg/sepior"
 	"github.com/mara-labs/transactionsigner/pkg/sqs"
+	"github.com/mara-labs/transactionsigner/pkg/worker"
 )
 
 func getLevel(cfg config.Configuration) (log.Level, error) {
@@ -43,15 +58,15 @@ func main() {
 		os.Exit(1)
 	}
 
-	sqsClient, err := sqs.New(configValues)
+	chainRegistry, err := chains.New(configValues)
 	if err != nil {
-		log.WithError(err).Error("could not connect to SQS")
+		log.WithError(err).Error("could not load the chain registry")
 		os.Exit(1)
 	}
 
-	signer, err := sepior.New(configValues)
+	txQueue, err := newQueue(configValues, chainRegistry)
 	if err != nil {
-		log.WithError(err).Error("could not initialize sepior client")
+		log.WithError(err).Error("could not connect to the queue")
 		os.Exit(1)
 	}
 
@@ -61,7 +76,152 @@ func main() {
 		os.Exit(1)
 	}
 
-	handler := newHandler(configValues, signer, sqsClient, store)
+	backends, err := newSigner(configValues)
+	if err != nil {
+		log.WithError(err).Error("could not initialize signer backends")
+		os.Exit(1)
+	}
+
+	signer := audit.NewSigner(backends, store)
+
+	verifier, err := msgauth.NewVerifier(configValues)
+	if err != nil {
+		log.WithError(err).Error("could not load the inbound message keys")
+		os.Exit(1)
+	}
+
+	var datastore models.Datastore = store
+	if configValues.DatastoreCacheEnabled {
+		datastore = cache.New(store, configValues)
+	}
+
+	if config.IsWorker(configValues) {
+		runWorker(configValues, newRecordHandler(configValues, signer, txQueue, datastore, verifier, chainRegistry), txQueue, store)
+		return
+	}
+
+	handler := newHandler(configValues, signer, txQueue, datastore, verifier, chainRegistry)
+
+	go closeOnShutdown(store, txQueue)
 
 	lambda.Start(ddlambda.WrapFunction(handler, nil))
 }
+
+// newSigner initializes every backend listed in SIGNER_BACKENDS and the
+// registry that routes wallets to them. Unhealthy backends are reported but do
+// not prevent the other ones from signing
+func newSigner(configValues config.Configuration) (*registry.Registry, error) {
+	backends := map[string]models.Signer{}
+
+	for _, name := range configValues.SignerBackends {
+		name = strings.TrimSpace(name)
+
+		switch name {
+		case config.SignerBackendSepior:
+			client, err := sepior.New(configValues)
+			if err != nil {
+				return nil, fmt.Errorf("could not initialize sepior client: %w", err)
+			}
+
+			backends[name] = resilience.New(name, client, configValues, sepior.IsRetryable)
+		case config.SignerBackendKMS:
+			client, err := kms.New(configValues)
+			if err != nil {
+				return nil, fmt.Errorf("could not initialize kms client: %w", err)
+			}
+
+			backends[name] = client
+		default:
+			return nil, fmt.Errorf("unknown signer backend %q", name)
+		}
+	}
+
+	signer, err := registry.New(configValues, backends)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := signer.HealthCheck(context.Background()); err != nil {
+		log.WithError(err).Error("signer backends failed their health check")
+	}
+
+	log.WithField("backends", signer.Backends()).Info("signer backends initialized")
+
+	return signer, nil
+}
+
+// queueClient is the queue signed transactions are written to, the worker
+// also reads from it
+type queueClient interface {
+	models.Queue
+	models.Consumer
+}
+
+// newQueue connects to the queue backend selected by QUEUE_BACKEND, signed
+// items are routed by the chains of the registry
+func newQueue(configValues config.Configuration, chainRegistry *chains.Registry) (queueClient, error) {
+	switch strings.TrimSpace(configValues.QueueBackend) {
+	case config.QueueBackendSQS:
+		return sqs.New(configValues, chainRegistry)
+	case config.QueueBackendMemory:
+		return queue.NewMemory(queue.NewMemoryBroker(), configValues, chainRegistry)
+	case config.QueueBackendPostgres:
+		return queue.NewPostgres(configValues, chainRegistry)
+	default:
+		return nil, fmt.Errorf("unknown queue backend %q", configValues.QueueBackend)
+	}
+}
+
+func runWorker(configValues config.Configuration, handleRecord RecordHandler,
+	txQueue queueClient, store *postgres.Store,
+) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	tracer.Start(
+		tracer.WithService(configValues.ServiceName),
+		tracer.WithEnv(configValues.Environment),
+	)
+	defer tracer.Stop()
+
+	w, err := worker.New(configValues, txQueue,
+		func(ctx context.Context, record events.SQSMessage) error {
+			return handleRecord(ctx, record.MessageId, record)
+		})
+	if err != nil {
+		log.WithError(err).Error("could not initialize worker")
+		os.Exit(1)
+	}
+
+	log.WithField("concurrency", configValues.WorkerConcurrency).
+		Info("starting worker")
+
+	w.Run(ctx)
+
+	log.Info("worker stopped, all in-flight messages were processed")
+
+	closeClients(store, txQueue)
+}
+
+// closeOnShutdown closes the connections shared by every invocation once the
+// lambda environment shuts down. Lambda only sends SIGTERM to runtimes with an
+// extension registered, such as the Datadog one
+func closeOnShutdown(store *postgres.Store, txQueue queueClient) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	<-ctx.Done()
+
+	closeClients(store, txQueue)
+	os.Exit(0)
+}
+
+func closeClients(store *postgres.Store, txQueue queueClient) {
+	if err := store.Close(); err != nil {
+		log.WithError(err).Error("could not close database connection")
+	}
+
+	if err := txQueue.Close(); err != nil {
+		log.WithError(err).Error("could not close queue")
+	}
+}
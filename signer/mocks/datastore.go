@@ -12,6 +12,44 @@ import (
 	gomock "go.uber.org/mock/gomock"
 )
 
+// MockWalletProvisioner is a mock of WalletProvisioner interface.
+type MockWalletProvisioner struct {
+	ctrl     *gomock.Controller
+	recorder *MockWalletProvisionerMockRecorder
+}
+
+// MockWalletProvisionerMockRecorder is the mock recorder for MockWalletProvisioner.
+type MockWalletProvisionerMockRecorder struct {
+	mock *MockWalletProvisioner
+}
+
+// NewMockWalletProvisioner creates a new mock instance.
+func NewMockWalletProvisioner(ctrl *gomock.Controller) *MockWalletProvisioner {
+	mock := &MockWalletProvisioner{ctrl: ctrl}
+	mock.recorder = &MockWalletProvisionerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockWalletProvisioner) EXPECT() *MockWalletProvisionerMockRecorder {
+	return m.recorder
+}
+
+// CreateWallet mocks base method.
+func (m *MockWalletProvisioner) CreateWallet(ctx context.Context, opts models.CreateWalletOptions, address models.AddressFunc) (*models.SenderWallet, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateWallet", ctx, opts, address)
+	ret0, _ := ret[0].(*models.SenderWallet)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateWallet indicates an expected call of CreateWallet.
+func (mr *MockWalletProvisionerMockRecorder) CreateWallet(ctx, opts, address interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWallet", reflect.TypeOf((*MockWalletProvisioner)(nil).CreateWallet), ctx, opts, address)
+}
+
 // Store is a mock of Datastore interface.
 type Store struct {
 	ctrl     *gomock.Controller
@@ -63,6 +101,21 @@ func (mr *StoreMockRecorder) CreateTransaction(arg0, arg1 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTransaction", reflect.TypeOf((*Store)(nil).CreateTransaction), arg0, arg1)
 }
 
+// FindWallet mocks base method.
+func (m *Store) FindWallet(arg0 context.Context, arg1 models.FindWalletOptions) (*models.SenderWallet, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindWallet", arg0, arg1)
+	ret0, _ := ret[0].(*models.SenderWallet)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindWallet indicates an expected call of FindWallet.
+func (mr *StoreMockRecorder) FindWallet(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindWallet", reflect.TypeOf((*Store)(nil).FindWallet), arg0, arg1)
+}
+
 // GetDerivationPath mocks base method.
 func (m *Store) GetDerivationPath(arg0 context.Context, arg1 models.FindDerivationPathOptions) (*models.DerivationPath, error) {
 	m.ctrl.T.Helper()
@@ -78,6 +131,21 @@ func (mr *StoreMockRecorder) GetDerivationPath(arg0, arg1 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDerivationPath", reflect.TypeOf((*Store)(nil).GetDerivationPath), arg0, arg1)
 }
 
+// GetTransactionByUUID mocks base method.
+func (m *Store) GetTransactionByUUID(ctx context.Context, transactionUUID string) (*models.Transaction, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTransactionByUUID", ctx, transactionUUID)
+	ret0, _ := ret[0].(*models.Transaction)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTransactionByUUID indicates an expected call of GetTransactionByUUID.
+func (mr *StoreMockRecorder) GetTransactionByUUID(ctx, transactionUUID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTransactionByUUID", reflect.TypeOf((*Store)(nil).GetTransactionByUUID), ctx, transactionUUID)
+}
+
 // GetWallet mocks base method.
 func (m *Store) GetWallet(arg0 context.Context, arg1 int64) (*models.SenderWallet, error) {
 	m.ctrl.T.Helper()
@@ -92,3 +160,114 @@ func (mr *StoreMockRecorder) GetWallet(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWallet", reflect.TypeOf((*Store)(nil).GetWallet), arg0, arg1)
 }
+
+// GetWalletVersion mocks base method.
+func (m *Store) GetWalletVersion(ctx context.Context, walletRowID int64) (models.WalletVersion, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWalletVersion", ctx, walletRowID)
+	ret0, _ := ret[0].(models.WalletVersion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWalletVersion indicates an expected call of GetWalletVersion.
+func (mr *StoreMockRecorder) GetWalletVersion(ctx, walletRowID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWalletVersion", reflect.TypeOf((*Store)(nil).GetWalletVersion), ctx, walletRowID)
+}
+
+// ListTransactionStates mocks base method.
+func (m *Store) ListTransactionStates(ctx context.Context, transactionID int) ([]models.StateTransition, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListTransactionStates", ctx, transactionID)
+	ret0, _ := ret[0].([]models.StateTransition)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListTransactionStates indicates an expected call of ListTransactionStates.
+func (mr *StoreMockRecorder) ListTransactionStates(ctx, transactionID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTransactionStates", reflect.TypeOf((*Store)(nil).ListTransactionStates), ctx, transactionID)
+}
+
+// RecordUserOperation mocks base method.
+func (m *Store) RecordUserOperation(ctx context.Context, op *models.UserOperationRecord) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordUserOperation", ctx, op)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RecordUserOperation indicates an expected call of RecordUserOperation.
+func (mr *StoreMockRecorder) RecordUserOperation(ctx, op interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordUserOperation", reflect.TypeOf((*Store)(nil).RecordUserOperation), ctx, op)
+}
+
+// TransitionTransaction mocks base method.
+func (m *Store) TransitionTransaction(ctx context.Context, trans *models.Transaction, opts models.TransitionOptions) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TransitionTransaction", ctx, trans, opts)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TransitionTransaction indicates an expected call of TransitionTransaction.
+func (mr *StoreMockRecorder) TransitionTransaction(ctx, trans, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TransitionTransaction", reflect.TypeOf((*Store)(nil).TransitionTransaction), ctx, trans, opts)
+}
+
+// MockWalletInventory is a mock of WalletInventory interface.
+type MockWalletInventory struct {
+	ctrl     *gomock.Controller
+	recorder *MockWalletInventoryMockRecorder
+}
+
+// MockWalletInventoryMockRecorder is the mock recorder for MockWalletInventory.
+type MockWalletInventoryMockRecorder struct {
+	mock *MockWalletInventory
+}
+
+// NewMockWalletInventory creates a new mock instance.
+func NewMockWalletInventory(ctrl *gomock.Controller) *MockWalletInventory {
+	mock := &MockWalletInventory{ctrl: ctrl}
+	mock.recorder = &MockWalletInventoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockWalletInventory) EXPECT() *MockWalletInventoryMockRecorder {
+	return m.recorder
+}
+
+// ListDerivationPaths mocks base method.
+func (m *MockWalletInventory) ListDerivationPaths(ctx context.Context, afterID int64, limit int) ([]models.DerivationPath, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListDerivationPaths", ctx, afterID, limit)
+	ret0, _ := ret[0].([]models.DerivationPath)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListDerivationPaths indicates an expected call of ListDerivationPaths.
+func (mr *MockWalletInventoryMockRecorder) ListDerivationPaths(ctx, afterID, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListDerivationPaths", reflect.TypeOf((*MockWalletInventory)(nil).ListDerivationPaths), ctx, afterID, limit)
+}
+
+// ListWallets mocks base method.
+func (m *MockWalletInventory) ListWallets(ctx context.Context, afterID int64, limit int) ([]models.SenderWallet, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListWallets", ctx, afterID, limit)
+	ret0, _ := ret[0].([]models.SenderWallet)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListWallets indicates an expected call of ListWallets.
+func (mr *MockWalletInventoryMockRecorder) ListWallets(ctx, afterID, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListWallets", reflect.TypeOf((*MockWalletInventory)(nil).ListWallets), ctx, afterID, limit)
+}
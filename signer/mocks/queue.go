@@ -7,7 +7,9 @@ package mocks
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
+	events "github.com/aws/aws-lambda-go/events"
 	models "github.com/mara-labs/transactionsigner/models"
 	gomock "go.uber.org/mock/gomock"
 )
@@ -49,6 +51,20 @@ func (mr *MockQueueMockRecorder) Add(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockQueue)(nil).Add), arg0, arg1)
 }
 
+// AddUserOperation mocks base method.
+func (m *MockQueue) AddUserOperation(arg0 context.Context, arg1 models.SignedUserOperationQueueItem) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddUserOperation", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddUserOperation indicates an expected call of AddUserOperation.
+func (mr *MockQueueMockRecorder) AddUserOperation(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddUserOperation", reflect.TypeOf((*MockQueue)(nil).AddUserOperation), arg0, arg1)
+}
+
 // Close mocks base method.
 func (m *MockQueue) Close() error {
 	m.ctrl.T.Helper()
@@ -62,3 +78,69 @@ func (mr *MockQueueMockRecorder) Close() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockQueue)(nil).Close))
 }
+
+// MockConsumer is a mock of Consumer interface.
+type MockConsumer struct {
+	ctrl     *gomock.Controller
+	recorder *MockConsumerMockRecorder
+}
+
+// MockConsumerMockRecorder is the mock recorder for MockConsumer.
+type MockConsumerMockRecorder struct {
+	mock *MockConsumer
+}
+
+// NewMockConsumer creates a new mock instance.
+func NewMockConsumer(ctrl *gomock.Controller) *MockConsumer {
+	mock := &MockConsumer{ctrl: ctrl}
+	mock.recorder = &MockConsumerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockConsumer) EXPECT() *MockConsumerMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockConsumer) Delete(ctx context.Context, receiptHandle string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, receiptHandle)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockConsumerMockRecorder) Delete(ctx, receiptHandle interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockConsumer)(nil).Delete), ctx, receiptHandle)
+}
+
+// ExtendVisibility mocks base method.
+func (m *MockConsumer) ExtendVisibility(ctx context.Context, receiptHandle string, timeout time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExtendVisibility", ctx, receiptHandle, timeout)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExtendVisibility indicates an expected call of ExtendVisibility.
+func (mr *MockConsumerMockRecorder) ExtendVisibility(ctx, receiptHandle, timeout interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExtendVisibility", reflect.TypeOf((*MockConsumer)(nil).ExtendVisibility), ctx, receiptHandle, timeout)
+}
+
+// Receive mocks base method.
+func (m *MockConsumer) Receive(ctx context.Context, maxMessages int) ([]events.SQSMessage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Receive", ctx, maxMessages)
+	ret0, _ := ret[0].([]events.SQSMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Receive indicates an expected call of Receive.
+func (mr *MockConsumerMockRecorder) Receive(ctx, maxMessages interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Receive", reflect.TypeOf((*MockConsumer)(nil).Receive), ctx, maxMessages)
+}
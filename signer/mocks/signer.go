@@ -6,6 +6,7 @@ package mocks
 
 import (
 	context "context"
+	ecdsa "crypto/ecdsa"
 	reflect "reflect"
 
 	types "github.com/ethereum/go-ethereum/core/types"
@@ -50,3 +51,154 @@ func (mr *MockSignerMockRecorder) Sign(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Sign", reflect.TypeOf((*MockSigner)(nil).Sign), arg0, arg1)
 }
+
+// MockHashSigner is a mock of HashSigner interface.
+type MockHashSigner struct {
+	ctrl     *gomock.Controller
+	recorder *MockHashSignerMockRecorder
+}
+
+// MockHashSignerMockRecorder is the mock recorder for MockHashSigner.
+type MockHashSignerMockRecorder struct {
+	mock *MockHashSigner
+}
+
+// NewMockHashSigner creates a new mock instance.
+func NewMockHashSigner(ctrl *gomock.Controller) *MockHashSigner {
+	mock := &MockHashSigner{ctrl: ctrl}
+	mock.recorder = &MockHashSignerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockHashSigner) EXPECT() *MockHashSignerMockRecorder {
+	return m.recorder
+}
+
+// SignHash mocks base method.
+func (m *MockHashSigner) SignHash(ctx context.Context, opts models.SignOptions) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SignHash", ctx, opts)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SignHash indicates an expected call of SignHash.
+func (mr *MockHashSignerMockRecorder) SignHash(ctx, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SignHash", reflect.TypeOf((*MockHashSigner)(nil).SignHash), ctx, opts)
+}
+
+// MockPublicKeyDeriver is a mock of PublicKeyDeriver interface.
+type MockPublicKeyDeriver struct {
+	ctrl     *gomock.Controller
+	recorder *MockPublicKeyDeriverMockRecorder
+}
+
+// MockPublicKeyDeriverMockRecorder is the mock recorder for MockPublicKeyDeriver.
+type MockPublicKeyDeriverMockRecorder struct {
+	mock *MockPublicKeyDeriver
+}
+
+// NewMockPublicKeyDeriver creates a new mock instance.
+func NewMockPublicKeyDeriver(ctrl *gomock.Controller) *MockPublicKeyDeriver {
+	mock := &MockPublicKeyDeriver{ctrl: ctrl}
+	mock.recorder = &MockPublicKeyDeriverMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPublicKeyDeriver) EXPECT() *MockPublicKeyDeriverMockRecorder {
+	return m.recorder
+}
+
+// PublicKey mocks base method.
+func (m *MockPublicKeyDeriver) PublicKey(ctx context.Context, keyID string, derivationPath []uint32) (*ecdsa.PublicKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PublicKey", ctx, keyID, derivationPath)
+	ret0, _ := ret[0].(*ecdsa.PublicKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PublicKey indicates an expected call of PublicKey.
+func (mr *MockPublicKeyDeriverMockRecorder) PublicKey(ctx, keyID, derivationPath interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PublicKey", reflect.TypeOf((*MockPublicKeyDeriver)(nil).PublicKey), ctx, keyID, derivationPath)
+}
+
+// MockKeyGenerator is a mock of KeyGenerator interface.
+type MockKeyGenerator struct {
+	ctrl     *gomock.Controller
+	recorder *MockKeyGeneratorMockRecorder
+}
+
+// MockKeyGeneratorMockRecorder is the mock recorder for MockKeyGenerator.
+type MockKeyGeneratorMockRecorder struct {
+	mock *MockKeyGenerator
+}
+
+// NewMockKeyGenerator creates a new mock instance.
+func NewMockKeyGenerator(ctrl *gomock.Controller) *MockKeyGenerator {
+	mock := &MockKeyGenerator{ctrl: ctrl}
+	mock.recorder = &MockKeyGeneratorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockKeyGenerator) EXPECT() *MockKeyGeneratorMockRecorder {
+	return m.recorder
+}
+
+// GenerateKey mocks base method.
+func (m *MockKeyGenerator) GenerateKey(ctx context.Context) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GenerateKey", ctx)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GenerateKey indicates an expected call of GenerateKey.
+func (mr *MockKeyGeneratorMockRecorder) GenerateKey(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GenerateKey", reflect.TypeOf((*MockKeyGenerator)(nil).GenerateKey), ctx)
+}
+
+// MockHealthChecker is a mock of HealthChecker interface.
+type MockHealthChecker struct {
+	ctrl     *gomock.Controller
+	recorder *MockHealthCheckerMockRecorder
+}
+
+// MockHealthCheckerMockRecorder is the mock recorder for MockHealthChecker.
+type MockHealthCheckerMockRecorder struct {
+	mock *MockHealthChecker
+}
+
+// NewMockHealthChecker creates a new mock instance.
+func NewMockHealthChecker(ctrl *gomock.Controller) *MockHealthChecker {
+	mock := &MockHealthChecker{ctrl: ctrl}
+	mock.recorder = &MockHealthCheckerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockHealthChecker) EXPECT() *MockHealthCheckerMockRecorder {
+	return m.recorder
+}
+
+// HealthCheck mocks base method.
+func (m *MockHealthChecker) HealthCheck(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HealthCheck", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// HealthCheck indicates an expected call of HealthCheck.
+func (mr *MockHealthCheckerMockRecorder) HealthCheck(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HealthCheck", reflect.TypeOf((*MockHealthChecker)(nil).HealthCheck), arg0)
+}
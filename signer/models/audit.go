@@ -0,0 +1,54 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// AuditGenesisHash is the previous hash of the first entry of the audit log
+var AuditGenesisHash = strings.Repeat("0", sha256.Size*2)
+
+// AuditEntry is a single record of the signing audit log. Every entry embeds
+// the hash of the one before it so modified or missing entries break the chain
+type AuditEntry struct {
+	Seq            int64          `json:"seq"`
+	KeyID          string         `json:"key_id"`
+	DerivationPath string         `json:"derivation_path"`
+	UnsignedHash   string         `json:"unsigned_hash"`
+	SignedHash     string         `json:"signed_hash"`
+	RequestID      string         `json:"request_id"`
+	MessageID      string         `json:"message_id"`
+	PolicyDecision PolicyDecision `json:"policy_decision"`
+	Error          string         `json:"error"`
+	Created        time.Time      `json:"created"`
+	PrevHash       string         `json:"prev_hash"`
+	Hash           string         `json:"hash"`
+}
+
+// ComputeHash returns the hex encoded sha256 of every field of the entry but
+// Hash itself. Created is hashed at microsecond precision in UTC, the way
+// postgres stores it
+func (e AuditEntry) ComputeHash() string {
+	e.Hash = ""
+	e.Created = e.Created.UTC().Truncate(time.Microsecond)
+
+	// marshalling a struct of strings, ints and a time can not fail
+	b, _ := json.Marshal(e)
+
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditLog persists audit entries. Append assigns the next sequence number,
+// the previous hash, the creation time and the hash of the entry
+type AuditLog interface {
+	AppendAuditEntry(context.Context, *AuditEntry) error
+	// ListAuditEntries returns at most limit entries with a sequence number
+	// greater than afterSeq, in order
+	ListAuditEntries(ctx context.Context, afterSeq int64, limit int) ([]AuditEntry, error)
+}
@@ -3,8 +3,11 @@ package models
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"math/big"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -14,6 +17,37 @@ var (
 	// ErrDerivationPathNotFound is a custom error that can be used instead of
 	// datastore specific errors
 	ErrDerivationPathNotFound = errors.New("derivation path not found")
+	// ErrAmbiguousDerivationPath is returned when a wallet has more than one
+	// derivation path
+	ErrAmbiguousDerivationPath = errors.New("wallet has more than one derivation path")
+	// ErrAddressIndexMismatch is returned when the address index of a wallet
+	// and the one of its derivation path differ
+	ErrAddressIndexMismatch = errors.New("address index of the wallet and its derivation path differ")
+	// ErrInvalidDerivationPath is returned for paths that are not valid bip44
+	// paths
+	ErrInvalidDerivationPath = errors.New("invalid derivation path")
+	// ErrUserNotFound is returned when a wallet is provisioned for a user
+	// that does not exist
+	ErrUserNotFound = errors.New("user not found")
+	// ErrWalletExists is returned when a provisioned address already belongs
+	// to a wallet on the same chain
+	ErrWalletExists = errors.New("a wallet with this address already exists")
+	// ErrTransactionNotFound is returned when no transaction row has the
+	// upstream transaction ID
+	ErrTransactionNotFound = errors.New("transaction not found")
+	// ErrTransactionConflict is returned when a transaction row changed since
+	// it was read, or is in a state it can not be signed from
+	ErrTransactionConflict = errors.New("transaction was changed concurrently")
+	// ErrUserOperationProcessed is returned for user operations that were
+	// recorded already and moved past signed since
+	ErrUserOperationProcessed = errors.New("user operation was processed already")
+)
+
+const (
+	// BIP44Purpose is the purpose of bip44 paths
+	BIP44Purpose = 44
+	// HardenedOffset is added to hardened bip32 indexes
+	HardenedOffset = 0x80000000
 )
 
 const (
@@ -55,6 +89,9 @@ type TransferType string
 const (
 	TransferTypeEoa           TransferType = "eoa"
 	TransferTypeSmartContract TransferType = "smart_contract"
+	// TransferTypeContractDeployment is used for contract creations, which
+	// have no recipient
+	TransferTypeContractDeployment TransferType = "contract_deployment"
 )
 
 // NetworkType denotes the network we are on
@@ -77,23 +114,161 @@ type DerivationPath struct {
 	AddressIndex uint32 `json:"address_index,omitempty"`
 }
 
+// Path returns the full bip32 path used to sign for the given address index
+func (d DerivationPath) Path(addressIndex uint32) []uint32 {
+	return []uint32{d.Purpose, d.CoinType, d.Account, d.Change, addressIndex}
+}
+
+// WalletPath returns the full bip32 path of the wallet. The address index is
+// stored on both the wallet and its derivation path, they have to agree
+func (d DerivationPath) WalletPath(wallet *SenderWallet) ([]uint32, error) {
+	if int64(d.WalletID) != wallet.ID {
+		return nil, fmt.Errorf("derivation path %d belongs to wallet %d, not %d", d.ID, d.WalletID, wallet.ID)
+	}
+
+	if wallet.AddressIndex < 0 || uint32(wallet.AddressIndex) != d.AddressIndex {
+		return nil, fmt.Errorf("%w: wallet %d has %d, derivation path %d has %d",
+			ErrAddressIndexMismatch, wallet.ID, wallet.AddressIndex, d.ID, d.AddressIndex)
+	}
+
+	return d.Path(d.AddressIndex), nil
+}
+
+// ValidateDerivationPath checks that path is a bip44 path,
+// purpose/coin_type/account/change/address_index. TSM keys are derived without
+// hardening so indexes with the hardened bit set are rejected. coinTypes lists
+// the coin types allowed for the chain, an empty list allows any
+func ValidateDerivationPath(path []uint32, coinTypes ...uint32) error {
+	if len(path) != 5 {
+		return fmt.Errorf("%w: %s has %d levels instead of 5", ErrInvalidDerivationPath, FormatDerivationPath(path), len(path))
+	}
+
+	for i, index := range path {
+		if index >= HardenedOffset {
+			return fmt.Errorf("%w: index %d of %s is hardened", ErrInvalidDerivationPath, i, FormatDerivationPath(path))
+		}
+	}
+
+	if path[0] != BIP44Purpose {
+		return fmt.Errorf("%w: purpose is %d instead of %d", ErrInvalidDerivationPath, path[0], BIP44Purpose)
+	}
+
+	if len(coinTypes) == 0 {
+		return nil
+	}
+
+	for _, coinType := range coinTypes {
+		if path[1] == coinType {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: coin type %d is not allowed for the chain", ErrInvalidDerivationPath, path[1])
+}
+
+// FormatDerivationPath renders a bip32 path as slash separated indexes,
+// e.g. 44/60/0/0/1
+func FormatDerivationPath(path []uint32) string {
+	parts := make([]string, 0, len(path))
+
+	for _, v := range path {
+		parts = append(parts, strconv.FormatUint(uint64(v), 10))
+	}
+
+	return strings.Join(parts, "/")
+}
+
+// ParseDerivationPath parses a path in the format produced by
+// FormatDerivationPath. A leading "m/" is accepted
+func ParseDerivationPath(path string) ([]uint32, error) {
+	path = strings.TrimPrefix(strings.TrimSpace(path), "m/")
+	if len(path) == 0 {
+		return nil, errors.New("derivation path is empty")
+	}
+
+	parts := strings.Split(path, "/")
+	indexes := make([]uint32, 0, len(parts))
+
+	for _, part := range parts {
+		v, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid derivation path index %q: %w", part, err)
+		}
+
+		indexes = append(indexes, uint32(v))
+	}
+
+	return indexes, nil
+}
+
 // SenderWallet is an object representing the wallets table.
 type SenderWallet struct {
-	ID                int64     `json:"id,omitempty"`
-	UserID            int       `json:"user_id,omitempty"`
-	Address           string    `json:"address,omitempty"`
-	ChainID           int       `json:"chain_id,omitempty"`
-	KeyID             string    `json:"key_id,omitempty"`
-	IsMultisig        bool      `json:"is_multisig,omitempty"`
-	AddressIndex      int       `json:"address_index,omitempty"`
-	MultisigThreshold int64     `json:"multisig_threshold,omitempty"`
-	Created           time.Time `json:"created,omitempty"`
-	Updated           time.Time `json:"updated,omitempty"`
+	ID                int64       `json:"id,omitempty"`
+	UserID            int         `json:"user_id,omitempty"`
+	Address           string      `json:"address,omitempty"`
+	ChainID           int         `json:"chain_id,omitempty"`
+	KeyID             string      `json:"key_id,omitempty"`
+	IsMultisig        bool        `json:"is_multisig,omitempty"`
+	AddressIndex      int         `json:"address_index,omitempty"`
+	MultisigThreshold int64       `json:"multisig_threshold,omitempty"`
+	SignerBackend     string      `json:"signer_backend,omitempty"`
+	AddressType       AddressType `json:"address_type,omitempty"`
+	NetworkType       NetworkType `json:"network_type,omitempty"`
+	Created           time.Time   `json:"created,omitempty"`
+	Updated           time.Time   `json:"updated,omitempty"`
 }
 
 // FindDerivationPathOptions defines properties that can be used to retrieve a bip32 path
 type FindDerivationPathOptions struct {
-	KeyID string
+	WalletID int64
+}
+
+// WalletVersion tells whether a wallet or its derivation paths changed since
+// they were read
+type WalletVersion struct {
+	WalletUpdated         time.Time
+	DerivationPathUpdated time.Time
+	DerivationPaths       int
+}
+
+// Equal checks if both versions are the same
+func (v WalletVersion) Equal(other WalletVersion) bool {
+	return v.WalletUpdated.Equal(other.WalletUpdated) &&
+		v.DerivationPathUpdated.Equal(other.DerivationPathUpdated) &&
+		v.DerivationPaths == other.DerivationPaths
+}
+
+// FindWalletOptions defines properties that can be used to look up a wallet
+// by its address. A zero ChainID matches wallets on every chain
+type FindWalletOptions struct {
+	Address string
+	ChainID int64
+}
+
+// CreateWalletOptions defines the wallet inserted by CreateWallet. The address
+// index is picked by the datastore
+type CreateWalletOptions struct {
+	UserID        int64
+	ChainID       int64
+	NetworkType   NetworkType
+	KeyID         string
+	SignerBackend string
+	Purpose       uint32
+	CoinType      uint32
+	Account       uint32
+	Change        uint32
+}
+
+// AddressFunc computes the address controlled by the key at the derivation
+// path
+type AddressFunc func(ctx context.Context, derivationPath []uint32) (string, error)
+
+// WalletProvisioner persists newly provisioned wallets
+type WalletProvisioner interface {
+	// CreateWallet inserts a wallet and its derivation path in one
+	// transaction. The wallet gets the next free address index of the key,
+	// address is called with the resulting path to compute its address
+	CreateWallet(ctx context.Context, opts CreateWalletOptions, address AddressFunc) (*SenderWallet, error)
 }
 
 // Transaction is an object representing the tx table
@@ -111,8 +286,17 @@ type Transaction struct {
 	MaxFee            int64        `json:"max_fee"`
 	MaxPriorityFee    int64        `json:"max_priority_fee"`
 	IsSenderPayingGas bool         `json:"is_sender_paying_gas"`
-	Created           time.Time    `json:"created"`
-	Updated           time.Time    `json:"updated"`
+	// TransactionUUID is the ID the upstream service created the
+	// transaction with
+	TransactionUUID string `json:"transaction_uuid,omitempty"`
+	// BytecodeHash is the keccak256 hash of the creation bytecode of contract
+	// deployments, their RecipientAddress is the address of the contract
+	BytecodeHash string `json:"contract_bytecode_hash,omitempty"`
+	// SignedTX is the encoded transaction the signer signed for the row, it
+	// is queued again when the message of a signed row is delivered again
+	SignedTX string    `json:"signed_tx,omitempty"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
 }
 
 // Datastore is an interface for persisting and retriveing data
@@ -120,5 +304,34 @@ type Datastore interface {
 	io.Closer
 	GetDerivationPath(context.Context, FindDerivationPathOptions) (*DerivationPath, error)
 	GetWallet(context.Context, int64) (*SenderWallet, error)
+	// GetWalletVersion returns the version of the wallet row and its
+	// derivation paths, ErrWalletNotFound when the wallet does not exist.
+	// It is cheap enough to run before every cached read
+	GetWalletVersion(ctx context.Context, walletRowID int64) (WalletVersion, error)
+	FindWallet(context.Context, FindWalletOptions) (*SenderWallet, error)
 	CreateTransaction(context.Context, *Transaction) error
+	GetTransactionByUUID(ctx context.Context, transactionUUID string) (*Transaction, error)
+	// TransitionTransaction moves trans to opts.To with its hash, nonce, fees
+	// and signed transaction and records the change. Transitions
+	// CanTransition does not allow return ErrIllegalTransition, rows changed
+	// since trans was read return ErrTransactionConflict
+	TransitionTransaction(ctx context.Context, trans *Transaction, opts TransitionOptions) error
+	// ListTransactionStates returns the state history of a transaction row,
+	// oldest first
+	ListTransactionStates(ctx context.Context, transactionID int) ([]StateTransition, error)
+	// RecordUserOperation stores a signed user operation and sets its ID. A
+	// user operation signed again is set to the stored one, operations past
+	// signed return ErrUserOperationProcessed
+	RecordUserOperation(ctx context.Context, op *UserOperationRecord) error
+}
+
+// WalletInventory walks every wallet and derivation path, it is used by the
+// integrity checks rather than by the signing path
+type WalletInventory interface {
+	// ListWallets returns at most limit wallets with an id greater than
+	// afterID, in order
+	ListWallets(ctx context.Context, afterID int64, limit int) ([]SenderWallet, error)
+	// ListDerivationPaths returns at most limit derivation paths with an id
+	// greater than afterID, in order
+	ListDerivationPaths(ctx context.Context, afterID int64, limit int) ([]DerivationPath, error)
 }
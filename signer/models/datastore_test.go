@@ -0,0 +1,50 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateDerivationPath(t *testing.T) {
+	tt := []struct {
+		name      string
+		path      []uint32
+		coinTypes []uint32
+		valid     bool
+	}{
+		{name: "bip44 path", path: []uint32{44, 614, 4, 0, 3}, valid: true},
+		{name: "allowed coin type", path: []uint32{44, 60, 0, 0, 1}, coinTypes: []uint32{60}, valid: true},
+		{name: "coin type of another chain", path: []uint32{44, 614, 0, 0, 1}, coinTypes: []uint32{60}},
+		{name: "bip49 purpose", path: []uint32{49, 60, 0, 0, 1}},
+		{name: "missing address index", path: []uint32{44, 60, 0, 0}},
+		{name: "hardened account", path: []uint32{44, 60, HardenedOffset, 0, 1}},
+		{name: "negative address index read from the database", path: []uint32{44, 60, 0, 0, 1<<32 - 1}},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			err := ValidateDerivationPath(v.path, v.coinTypes...)
+			if v.valid {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorIs(t, err, ErrInvalidDerivationPath)
+		})
+	}
+}
+
+func TestDerivationPath_WalletPath(t *testing.T) {
+	derivationPath := DerivationPath{ID: 7, WalletID: 1, Purpose: 44, CoinType: 614, Account: 4, AddressIndex: 3}
+
+	path, err := derivationPath.WalletPath(&SenderWallet{ID: 1, AddressIndex: 3})
+	require.NoError(t, err)
+	require.Equal(t, []uint32{44, 614, 4, 0, 3}, path)
+
+	_, err = derivationPath.WalletPath(&SenderWallet{ID: 1, AddressIndex: 1})
+	require.ErrorIs(t, err, ErrAddressIndexMismatch)
+
+	_, err = derivationPath.WalletPath(&SenderWallet{ID: 2, AddressIndex: 3})
+	require.Error(t, err)
+}
@@ -2,7 +2,11 @@ package models
 
 import (
 	"context"
+	"encoding/json"
 	"io"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
 )
 
 // CreatedTxQueueItem models the data structure received from the queue
@@ -11,17 +15,107 @@ type CreatedTxQueueItem struct {
 	RawTX         string `json:"raw_tx,omitempty"`
 	TransactionID string `json:"transaction_id,omitempty"`
 	WalletRowID   int64  `json:"wallet_row_id,omitempty"`
+	// IsSenderPayingGas is set by producers that know who pays for the gas,
+	// it is derived from the wallet otherwise
+	IsSenderPayingGas *bool `json:"is_sender_paying_gas,omitempty"`
+	// Priority selects the output queue of the chain in OUTPUT_QUEUE_ROUTES
+	Priority string `json:"priority,omitempty"`
+
+	// Type is RequestTypeTransaction, the default, or
+	// RequestTypeUserOperation
+	Type string `json:"type,omitempty"`
+	// UserOperation is signed for EntryPoint instead of RawTX for user
+	// operation requests. ChainID is optional, it must match the chain of
+	// the wallet when set
+	UserOperation *UserOperation `json:"user_operation,omitempty"`
+	EntryPoint    string         `json:"entry_point,omitempty"`
+	ChainID       int64          `json:"chain_id,omitempty"`
 }
 
+// Versions of the SignedTXQueueItem payload
+const (
+	// SignedTXQueueItemV1 only carries the ID, the signed transaction and the
+	// transaction ID
+	SignedTXQueueItemV1 = 1
+	// SignedTXQueueItemV2 also carries the details of the signed transaction
+	// so broadcasters do not need to decode it
+	SignedTXQueueItemV2 = 2
+)
+
 // SignedTXQueueItem models the data structure for transactions to be broadcasted onchain
 type SignedTXQueueItem struct {
+	// Version selects the payload written to the queue, items below
+	// SignedTXQueueItemV2 are encoded without the transaction details
+	Version       int    `json:"version,omitempty"`
 	ID            string `json:"id"`
 	SignedTX      string `json:"signed_tx"`
 	TransactionID string `json:"transaction_id,omitempty"`
+
+	TxHash  string `json:"tx_hash"`
+	ChainID int64  `json:"chain_id"`
+	TxType  uint8  `json:"tx_type"`
+	Sender  string `json:"sender"`
+	// Recipient is empty for contract creations, ContractAddress is the
+	// address the contract is created at
+	Recipient       string `json:"recipient"`
+	ContractAddress string `json:"contract_address,omitempty"`
+	Nonce           uint64 `json:"nonce"`
+	Gas             uint64 `json:"gas"`
+	// fees are decimal strings in wei, GasPrice is the fee cap of dynamic
+	// fee transactions
+	GasPrice  string `json:"gas_price"`
+	GasTipCap string `json:"gas_tip_cap"`
+	GasFeeCap string `json:"gas_fee_cap"`
+	// WalletRowID and TransactionRowID are the sender_wallets and
+	// transactions rows of the signature
+	WalletRowID      int64     `json:"wallet_row_id"`
+	TransactionRowID int64     `json:"transaction_row_id"`
+	SignedAt         time.Time `json:"signed_at"`
+
+	// GroupID overrides the message group of FIFO queues, by default the
+	// sender and chain of the transaction keep its nonces in order
+	GroupID string `json:"-"`
+	// Priority selects the output queue of the chain in OUTPUT_QUEUE_ROUTES
+	Priority string `json:"-"`
+}
+
+// signedTXQueueItemV1 is the payload consumers that predate versioning expect
+type signedTXQueueItemV1 struct {
+	ID            string `json:"id"`
+	SignedTX      string `json:"signed_tx"`
+	TransactionID string `json:"transaction_id,omitempty"`
+}
+
+// MarshalJSON encodes the payload of the item version
+func (i SignedTXQueueItem) MarshalJSON() ([]byte, error) {
+	if i.Version < SignedTXQueueItemV2 {
+		return json.Marshal(signedTXQueueItemV1{
+			ID:            i.ID,
+			SignedTX:      i.SignedTX,
+			TransactionID: i.TransactionID,
+		})
+	}
+
+	// the alias drops the method so encoding does not recurse
+	type item SignedTXQueueItem
+
+	return json.Marshal(item(i))
 }
 
 // Queue implements a set of methods to add new items to a queue
 type Queue interface {
 	io.Closer
 	Add(context.Context, SignedTXQueueItem) error
+	// AddUserOperation writes a signed user operation to the bundler queue
+	// of its chain
+	AddUserOperation(context.Context, SignedUserOperationQueueItem) error
+}
+
+// Consumer implements a set of methods to retrieve and acknowledge items from
+// a queue. Messages are surfaced in the same shape lambda delivers them so
+// both run modes share a single handler
+type Consumer interface {
+	Receive(ctx context.Context, maxMessages int) ([]events.SQSMessage, error)
+	Delete(ctx context.Context, receiptHandle string) error
+	ExtendVisibility(ctx context.Context, receiptHandle string, timeout time.Duration) error
 }
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignedTXQueueItem_MarshalJSON(t *testing.T) {
+	item := SignedTXQueueItem{
+		ID:               "message",
+		SignedTX:         "f86b",
+		TransactionID:    "transaction",
+		TxHash:           "0x01",
+		ChainID:          614,
+		Sender:           "0xe004bb7a6cd6e00d3dabf717d809e665bdeaa671",
+		Nonce:            0,
+		GasPrice:         "1",
+		TransactionRowID: 12,
+		SignedAt:         time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC),
+		GroupID:          "group",
+	}
+
+	tt := []struct {
+		name     string
+		version  int
+		expected string
+	}{
+		{
+			name:     "unversioned items keep the original payload",
+			expected: `{"id":"message","signed_tx":"f86b","transaction_id":"transaction"}`,
+		},
+		{
+			name:     "version 1",
+			version:  SignedTXQueueItemV1,
+			expected: `{"id":"message","signed_tx":"f86b","transaction_id":"transaction"}`,
+		},
+		{
+			name:    "version 2",
+			version: SignedTXQueueItemV2,
+			expected: `{"version":2,"id":"message","signed_tx":"f86b","transaction_id":"transaction",` +
+				`"tx_hash":"0x01","chain_id":614,"tx_type":0,"sender":"0xe004bb7a6cd6e00d3dabf717d809e665bdeaa671",` +
+				`"recipient":"","nonce":0,"gas":0,"gas_price":"1","gas_tip_cap":"","gas_fee_cap":"",` +
+				`"wallet_row_id":0,"transaction_row_id":12,"signed_at":"2023-07-01T12:00:00Z"}`,
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			item := item
+			item.Version = v.version
+
+			b, err := json.Marshal(item)
+			require.NoError(t, err)
+			require.JSONEq(t, v.expected, string(b))
+
+			// both payloads decode into the item
+			var decoded SignedTXQueueItem
+			require.NoError(t, json.Unmarshal(b, &decoded))
+			require.Equal(t, item.SignedTX, decoded.SignedTX)
+		})
+	}
+}
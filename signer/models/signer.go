@@ -3,18 +3,88 @@ package models
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"errors"
 
 	"github.com/ethereum/go-ethereum/core/types"
 )
 
+var (
+	// ErrPublicKeyUnsupported is returned by signers that can not derive
+	// public keys
+	ErrPublicKeyUnsupported = errors.New("signer can not derive public keys")
+	// ErrKeyGenerationUnsupported is returned by signers that can not create
+	// keys
+	ErrKeyGenerationUnsupported = errors.New("signer can not create keys")
+	// ErrHashSigningUnsupported is returned by signers that can only sign
+	// transactions
+	ErrHashSigningUnsupported = errors.New("signer can not sign hashes")
+)
+
+// PolicyDecision records why a signature was allowed to go ahead
+type PolicyDecision string
+
+// Enum values for PolicyDecision
+const (
+	// PolicyDecisionAllowed is used when the wallet was found and every
+	// check on the transaction passed
+	PolicyDecisionAllowed PolicyDecision = "allowed"
+	// PolicyDecisionContractDeployment is used for contract creations the
+	// wallet is allowed to make
+	PolicyDecisionContractDeployment PolicyDecision = "contract_deployment"
+	// PolicyDecisionUserOperation is used for ERC-4337 user operations the
+	// wallet is allowed to sign on the chain
+	PolicyDecisionUserOperation PolicyDecision = "user_operation"
+)
+
 // SignOptions defines a set of properties that can be used to retrieve the right signing details
 type SignOptions struct {
 	KeyID          string
 	TX             *types.Transaction
 	DerivationPath []uint32
+	// Digest is the 32 byte hash signed by SignHash, TX is not used then
+	Digest []byte
+	// Backend is the signer backend the wallet is assigned to, empty lets
+	// the registry pick one from its routing rules
+	Backend string
+	// ChainID is the chain of the wallet the transaction is signed for
+	ChainID int64
+	// Signer is the transaction signer of the chain from the chain
+	// registry, nil signs for the chain of MARA_CHAIN_ID
+	Signer types.Signer
+
+	// RequestID, MessageID and PolicyDecision are recorded in the audit log
+	RequestID      string
+	MessageID      string
+	PolicyDecision PolicyDecision
 }
 
-// Signer models a way to sign a given transaction. Right now we only provide a Sepior implementation
+// Signer models a way to sign a given transaction
 type Signer interface {
 	Sign(context.Context, SignOptions) (*types.Transaction, error)
 }
+
+// HashSigner is implemented by signers that can sign a digest that is not the
+// hash of a transaction, such as the hash of an ERC-4337 user operation. The
+// signature is returned in the 65 bytes [R || S || V] form with V 0 or 1
+type HashSigner interface {
+	SignHash(ctx context.Context, opts SignOptions) ([]byte, error)
+}
+
+// PublicKeyDeriver is implemented by signers that can derive the public key
+// of a key and derivation path without signing anything
+type PublicKeyDeriver interface {
+	PublicKey(ctx context.Context, keyID string, derivationPath []uint32) (*ecdsa.PublicKey, error)
+}
+
+// KeyGenerator is implemented by signers that can create new keys
+type KeyGenerator interface {
+	// GenerateKey creates a new secp256k1 key and returns its ID
+	GenerateKey(ctx context.Context) (string, error)
+}
+
+// HealthChecker is implemented by dependencies that can report whether they
+// are able to serve requests
+type HealthChecker interface {
+	HealthCheck(context.Context) error
+}
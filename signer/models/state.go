@@ -0,0 +1,57 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrIllegalTransition is returned for state changes the transaction state
+// machine does not allow
+var ErrIllegalTransition = errors.New("illegal transaction state transition")
+
+// transitions lists the states each state can move to. A transaction is
+// signed once, its hash is never replaced. Finalized and erred transactions
+// are done
+var transitions = map[State][]State{
+	StateInitiated: {StateCreated, StateErred},
+	StateCreated:   {StateSigned, StateErred},
+	StateSigned:    {StateSubmitted, StateErred},
+	StateSubmitted: {StateSettled, StateErred},
+	StateSettled:   {StateFinalized, StateErred},
+}
+
+// CanTransition reports whether a transaction in state from may move to state
+// to. Rows are inserted in any state, an empty from is always allowed
+func CanTransition(from, to State) bool {
+	if len(from) == 0 {
+		return true
+	}
+
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TransitionOptions describes a state change of a transaction
+type TransitionOptions struct {
+	To State
+	// Actor is who moved the transaction, the service name when empty
+	Actor  string
+	Reason string
+}
+
+// StateTransition is a single entry of the state history of a transaction.
+// From is empty for the state the row was inserted with
+type StateTransition struct {
+	ID            int64     `json:"id"`
+	TransactionID int       `json:"transaction_id"`
+	From          State     `json:"from"`
+	To            State     `json:"to"`
+	Actor         string    `json:"actor"`
+	Reason        string    `json:"reason"`
+	Created       time.Time `json:"created"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanTransition(t *testing.T) {
+	tt := []struct {
+		from  State
+		to    State
+		legal bool
+	}{
+		{from: "", to: StateSigned, legal: true},
+		{from: StateInitiated, to: StateCreated, legal: true},
+		{from: StateCreated, to: StateSigned, legal: true},
+		{from: StateSigned, to: StateSigned},
+		{from: StateSigned, to: StateSubmitted, legal: true},
+		{from: StateSubmitted, to: StateSettled, legal: true},
+		{from: StateSettled, to: StateFinalized, legal: true},
+		{from: StateCreated, to: StateErred, legal: true},
+		{from: StateCreated, to: StateCreated},
+		{from: StateCreated, to: StateSubmitted},
+		{from: StateSubmitted, to: StateSigned},
+		{from: StateFinalized, to: StateErred},
+		{from: StateErred, to: StateCreated},
+	}
+
+	for _, v := range tt {
+		t.Run(string(v.from)+" to "+string(v.to), func(t *testing.T) {
+			require.Equal(t, v.legal, CanTransition(v.from, v.to))
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Types of signing requests
+const (
+	// RequestTypeTransaction requests are raw transactions, the default
+	RequestTypeTransaction = "transaction"
+	// RequestTypeUserOperation requests are ERC-4337 user operations of a
+	// smart account owned by the wallet
+	RequestTypeUserOperation = "user_operation"
+)
+
+// UserOperation is an ERC-4337 user operation of the v0.6 EntryPoint. It is
+// encoded the way bundlers take it in eth_sendUserOperation
+type UserOperation struct {
+	Sender               common.Address `json:"sender"`
+	Nonce                *hexutil.Big   `json:"nonce"`
+	InitCode             hexutil.Bytes  `json:"initCode"`
+	CallData             hexutil.Bytes  `json:"callData"`
+	CallGasLimit         *hexutil.Big   `json:"callGasLimit"`
+	VerificationGasLimit *hexutil.Big   `json:"verificationGasLimit"`
+	PreVerificationGas   *hexutil.Big   `json:"preVerificationGas"`
+	MaxFeePerGas         *hexutil.Big   `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big   `json:"maxPriorityFeePerGas"`
+	PaymasterAndData     hexutil.Bytes  `json:"paymasterAndData"`
+	Signature            hexutil.Bytes  `json:"signature"`
+}
+
+// SignedUserOperationQueueItem models the data structure for user operations
+// to be sent to a bundler
+type SignedUserOperationQueueItem struct {
+	ID            string        `json:"id"`
+	TransactionID string        `json:"transaction_id,omitempty"`
+	UserOperation UserOperation `json:"user_operation"`
+	UserOpHash    string        `json:"user_op_hash"`
+	EntryPoint    string        `json:"entry_point"`
+	ChainID       int64         `json:"chain_id"`
+	// WalletRowID and UserOperationRowID are the sender_wallets and
+	// user_operations rows of the signature
+	WalletRowID        int64     `json:"wallet_row_id"`
+	UserOperationRowID int64     `json:"user_operation_row_id"`
+	SignedAt           time.Time `json:"signed_at"`
+}
+
+// UserOperationRecord is a signed user operation as kept in the
+// user_operations table
+type UserOperationRecord struct {
+	ID         int64
+	UserOpHash string
+	ChainID    int64
+	EntryPoint string
+	// Sender is the smart account, Owner the address of the wallet that
+	// signed for it
+	Sender      string
+	Owner       string
+	Nonce       *big.Int
+	WalletRowID int64
+	// TransactionUUID is the ID the upstream service sent the request with
+	TransactionUUID string
+	State           State
+	Operation       UserOperation
+	Created         time.Time
+	Updated         time.Time
+}
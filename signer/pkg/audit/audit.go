@@ -0,0 +1,186 @@
+// Package audit keeps a tamper evident record of every signature request
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mara-labs/transactionsigner/models"
+)
+
+const defaultBatchSize = 500
+
+// Signer records every call to the wrapped signer in the audit log, failed
+// ones included. A signature that could not be recorded is not returned
+type Signer struct {
+	next     models.Signer
+	auditLog models.AuditLog
+}
+
+// NewSigner wraps next so its signatures are written to the audit log
+func NewSigner(next models.Signer, auditLog models.AuditLog) *Signer {
+	return &Signer{next: next, auditLog: auditLog}
+}
+
+// Sign signs the transaction with the wrapped signer and appends the outcome
+// to the audit log
+func (s *Signer) Sign(ctx context.Context, opts models.SignOptions) (*types.Transaction, error) {
+	signedTX, signErr := s.next.Sign(ctx, opts)
+
+	entry := newEntry(opts, signErr)
+
+	if opts.TX != nil {
+		entry.UnsignedHash = opts.TX.Hash().Hex()
+	}
+
+	if signErr == nil && signedTX != nil {
+		entry.SignedHash = signedTX.Hash().Hex()
+	}
+
+	if err := s.append(ctx, opts, entry); err != nil {
+		return nil, errors.Join(signErr, err)
+	}
+
+	return signedTX, signErr
+}
+
+// SignHash signs the digest with the wrapped signer and appends the outcome
+// to the audit log. The signed hash of the entry is the keccak256 hash of the
+// signature
+func (s *Signer) SignHash(ctx context.Context, opts models.SignOptions) ([]byte, error) {
+	hashSigner, ok := s.next.(models.HashSigner)
+	if !ok {
+		return nil, models.ErrHashSigningUnsupported
+	}
+
+	sig, signErr := hashSigner.SignHash(ctx, opts)
+
+	entry := newEntry(opts, signErr)
+	entry.UnsignedHash = hexutil.Encode(opts.Digest)
+
+	if signErr == nil && len(sig) != 0 {
+		entry.SignedHash = crypto.Keccak256Hash(sig).Hex()
+	}
+
+	if err := s.append(ctx, opts, entry); err != nil {
+		return nil, errors.Join(signErr, err)
+	}
+
+	return sig, signErr
+}
+
+func newEntry(opts models.SignOptions, signErr error) *models.AuditEntry {
+	entry := &models.AuditEntry{
+		KeyID:          opts.KeyID,
+		DerivationPath: models.FormatDerivationPath(opts.DerivationPath),
+		RequestID:      opts.RequestID,
+		MessageID:      opts.MessageID,
+		PolicyDecision: opts.PolicyDecision,
+	}
+
+	if signErr != nil {
+		entry.Error = signErr.Error()
+	}
+
+	return entry
+}
+
+func (s *Signer) append(ctx context.Context, opts models.SignOptions, entry *models.AuditEntry) error {
+	if err := s.auditLog.AppendAuditEntry(ctx, entry); err != nil {
+		log.WithError(err).
+			WithField("key_id", opts.KeyID).
+			WithField("message_id", opts.MessageID).
+			Error("could not write audit entry")
+
+		return fmt.Errorf("could not write audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// Problem describes an entry that breaks the hash chain
+type Problem struct {
+	Seq    int64
+	Reason string
+}
+
+// Options tunes Verify
+type Options struct {
+	// BatchSize is the amount of entries fetched per query
+	BatchSize int
+	// ExpectHash is the last hash reported by a previous run. Entries removed
+	// from the end of the log can only be detected against it
+	ExpectHash string
+}
+
+// Report is the outcome of Verify
+type Report struct {
+	Entries  int64
+	LastSeq  int64
+	LastHash string
+	Problems []Problem
+	// ExpectedHashFound is true when Options.ExpectHash is part of the log
+	ExpectedHashFound bool
+}
+
+// Verify walks the whole audit log and reports gaps in the sequence numbers,
+// entries whose content does not match their hash and entries that are not
+// linked to the one before them
+func Verify(ctx context.Context, auditLog models.AuditLog, opts Options) (Report, error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	report := Report{LastHash: models.AuditGenesisHash}
+
+	for {
+		entries, err := auditLog.ListAuditEntries(ctx, report.LastSeq, batchSize)
+		if err != nil {
+			return report, err
+		}
+
+		for _, entry := range entries {
+			report.check(entry)
+
+			if len(opts.ExpectHash) != 0 && entry.Hash == opts.ExpectHash {
+				report.ExpectedHashFound = true
+			}
+		}
+
+		if len(entries) < batchSize {
+			return report, nil
+		}
+	}
+}
+
+func (r *Report) check(entry models.AuditEntry) {
+	if entry.Seq != r.LastSeq+1 {
+		r.Problems = append(r.Problems, Problem{
+			Seq:    entry.Seq,
+			Reason: fmt.Sprintf("entries %d to %d are missing", r.LastSeq+1, entry.Seq-1),
+		})
+	} else if entry.PrevHash != r.LastHash {
+		r.Problems = append(r.Problems, Problem{
+			Seq:    entry.Seq,
+			Reason: "previous hash does not match the hash of the previous entry",
+		})
+	}
+
+	if hash := entry.ComputeHash(); hash != entry.Hash {
+		r.Problems = append(r.Problems, Problem{
+			Seq:    entry.Seq,
+			Reason: fmt.Sprintf("entry was modified, its content hashes to %s instead of %s", hash, entry.Hash),
+		})
+	}
+
+	r.Entries++
+	r.LastSeq = entry.Seq
+	r.LastHash = entry.Hash
+}
@@ -0,0 +1,251 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/mara-labs/transactionsigner/mocks"
+	"github.com/mara-labs/transactionsigner/models"
+)
+
+// memoryLog chains entries the same way the postgres store does
+type memoryLog struct {
+	entries   []models.AuditEntry
+	appendErr error
+}
+
+func (m *memoryLog) AppendAuditEntry(_ context.Context, entry *models.AuditEntry) error {
+	if m.appendErr != nil {
+		return m.appendErr
+	}
+
+	entry.Seq = 1
+	entry.PrevHash = models.AuditGenesisHash
+
+	if len(m.entries) != 0 {
+		last := m.entries[len(m.entries)-1]
+		entry.Seq = last.Seq + 1
+		entry.PrevHash = last.Hash
+	}
+
+	entry.Created = time.Now()
+	entry.Hash = entry.ComputeHash()
+
+	m.entries = append(m.entries, *entry)
+
+	return nil
+}
+
+func (m *memoryLog) ListAuditEntries(_ context.Context, afterSeq int64, limit int) ([]models.AuditEntry, error) {
+	var entries []models.AuditEntry
+
+	for _, entry := range m.entries {
+		if entry.Seq > afterSeq && len(entries) < limit {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+func signTimes(t *testing.T, auditLog *memoryLog, n int) {
+	ctrl := gomock.NewController(t)
+	next := mocks.NewMockSigner(ctrl)
+
+	tx := types.NewTx(&types.LegacyTx{Nonce: 1, GasPrice: big.NewInt(1)})
+	signedTX := types.NewTx(&types.LegacyTx{Nonce: 1, GasPrice: big.NewInt(1), V: big.NewInt(27), R: big.NewInt(1), S: big.NewInt(1)})
+
+	next.EXPECT().Sign(gomock.Any(), gomock.Any()).Times(n).Return(signedTX, nil)
+
+	s := NewSigner(next, auditLog)
+
+	for i := 0; i < n; i++ {
+		_, err := s.Sign(context.Background(), models.SignOptions{
+			KeyID:          "MizBEqdhZ160syGCPFxYo6Lkxbiw",
+			TX:             tx,
+			DerivationPath: []uint32{44, 60, 0, 0, 3},
+			RequestID:      "request",
+			MessageID:      "message",
+			PolicyDecision: models.PolicyDecisionAllowed,
+		})
+		require.NoError(t, err)
+	}
+}
+
+func TestSigner_Sign(t *testing.T) {
+	t.Run("successful signatures are chained", func(t *testing.T) {
+		auditLog := &memoryLog{}
+		signTimes(t, auditLog, 2)
+
+		require.Len(t, auditLog.entries, 2)
+
+		first := auditLog.entries[0]
+		require.Equal(t, "44/60/0/0/3", first.DerivationPath)
+		require.Equal(t, "message", first.MessageID)
+		require.Equal(t, models.PolicyDecisionAllowed, first.PolicyDecision)
+		require.NotEmpty(t, first.UnsignedHash)
+		require.NotEqual(t, first.UnsignedHash, first.SignedHash)
+		require.Equal(t, first.Hash, auditLog.entries[1].PrevHash)
+	})
+
+	t.Run("failed signatures are recorded", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		next := mocks.NewMockSigner(ctrl)
+		next.EXPECT().Sign(gomock.Any(), gomock.Any()).Return(nil, errors.New("tsm unavailable"))
+
+		auditLog := &memoryLog{}
+
+		_, err := NewSigner(next, auditLog).Sign(context.Background(), models.SignOptions{KeyID: "key"})
+		require.EqualError(t, err, "tsm unavailable")
+		require.Len(t, auditLog.entries, 1)
+		require.Equal(t, "tsm unavailable", auditLog.entries[0].Error)
+		require.Empty(t, auditLog.entries[0].SignedHash)
+	})
+
+	t.Run("signatures are withheld when they can not be recorded", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		next := mocks.NewMockSigner(ctrl)
+		next.EXPECT().Sign(gomock.Any(), gomock.Any()).Return(types.NewTx(&types.LegacyTx{}), nil)
+
+		auditLog := &memoryLog{appendErr: errors.New("connection refused")}
+
+		signedTX, err := NewSigner(next, auditLog).Sign(context.Background(), models.SignOptions{KeyID: "key"})
+		require.ErrorContains(t, err, "could not write audit entry")
+		require.Nil(t, signedTX)
+	})
+}
+
+func TestSigner_SignHash(t *testing.T) {
+	digest := crypto.Keccak256([]byte("user operation"))
+	signature := make([]byte, crypto.SignatureLength)
+
+	newSigner := func(t *testing.T, auditLog *memoryLog, sig []byte, signErr error) *Signer {
+		ctrl := gomock.NewController(t)
+		next := mocks.NewMockHashSigner(ctrl)
+		next.EXPECT().SignHash(gomock.Any(), gomock.Any()).Return(sig, signErr)
+
+		return NewSigner(struct {
+			models.Signer
+			models.HashSigner
+		}{HashSigner: next}, auditLog)
+	}
+
+	t.Run("signatures are recorded", func(t *testing.T) {
+		auditLog := &memoryLog{}
+
+		sig, err := newSigner(t, auditLog, signature, nil).SignHash(context.Background(), models.SignOptions{
+			KeyID:          "key",
+			Digest:         digest,
+			PolicyDecision: models.PolicyDecisionUserOperation,
+		})
+		require.NoError(t, err)
+		require.Equal(t, signature, sig)
+
+		require.Len(t, auditLog.entries, 1)
+		require.Equal(t, hexutil.Encode(digest), auditLog.entries[0].UnsignedHash)
+		require.Equal(t, crypto.Keccak256Hash(signature).Hex(), auditLog.entries[0].SignedHash)
+		require.Equal(t, models.PolicyDecisionUserOperation, auditLog.entries[0].PolicyDecision)
+	})
+
+	t.Run("failed signatures are recorded", func(t *testing.T) {
+		auditLog := &memoryLog{}
+
+		_, err := newSigner(t, auditLog, nil, errors.New("tsm unavailable")).
+			SignHash(context.Background(), models.SignOptions{KeyID: "key", Digest: digest})
+		require.EqualError(t, err, "tsm unavailable")
+		require.Equal(t, "tsm unavailable", auditLog.entries[0].Error)
+		require.Empty(t, auditLog.entries[0].SignedHash)
+	})
+
+	t.Run("signatures are withheld when they can not be recorded", func(t *testing.T) {
+		auditLog := &memoryLog{appendErr: errors.New("connection refused")}
+
+		sig, err := newSigner(t, auditLog, signature, nil).
+			SignHash(context.Background(), models.SignOptions{KeyID: "key", Digest: digest})
+		require.ErrorContains(t, err, "could not write audit entry")
+		require.Nil(t, sig)
+	})
+
+	t.Run("signers that can not sign hashes", func(t *testing.T) {
+		_, err := NewSigner(mocks.NewMockSigner(gomock.NewController(t)), &memoryLog{}).
+			SignHash(context.Background(), models.SignOptions{Digest: digest})
+		require.ErrorIs(t, err, models.ErrHashSigningUnsupported)
+	})
+}
+
+func TestVerify(t *testing.T) {
+	tt := []struct {
+		name     string
+		tamper   func(entries []models.AuditEntry) []models.AuditEntry
+		problems []int64
+	}{
+		{
+			name:   "intact log",
+			tamper: func(entries []models.AuditEntry) []models.AuditEntry { return entries },
+		},
+		{
+			name: "modified entry",
+			tamper: func(entries []models.AuditEntry) []models.AuditEntry {
+				entries[2].KeyID = "another key"
+				return entries
+			},
+			problems: []int64{3},
+		},
+		{
+			name: "modified entry with a recomputed hash",
+			tamper: func(entries []models.AuditEntry) []models.AuditEntry {
+				entries[2].KeyID = "another key"
+				entries[2].Hash = entries[2].ComputeHash()
+				return entries
+			},
+			problems: []int64{4},
+		},
+		{
+			name: "deleted entry",
+			tamper: func(entries []models.AuditEntry) []models.AuditEntry {
+				return append(entries[:1], entries[2:]...)
+			},
+			problems: []int64{3},
+		},
+		{
+			name: "deleted first entry",
+			tamper: func(entries []models.AuditEntry) []models.AuditEntry {
+				return entries[1:]
+			},
+			problems: []int64{2},
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			auditLog := &memoryLog{}
+			signTimes(t, auditLog, 5)
+
+			firstHash := auditLog.entries[0].Hash
+			auditLog.entries = v.tamper(auditLog.entries)
+
+			// a small batch size makes sure the chain is followed across pages
+			report, err := Verify(context.Background(), auditLog, Options{BatchSize: 2, ExpectHash: firstHash})
+			require.NoError(t, err)
+			require.Equal(t, int64(5), report.LastSeq)
+			require.Equal(t, auditLog.entries[len(auditLog.entries)-1].Hash, report.LastHash)
+			require.Equal(t, v.name != "deleted first entry", report.ExpectedHashFound)
+
+			var problems []int64
+			for _, p := range report.Problems {
+				problems = append(problems, p.Seq)
+			}
+
+			require.Equal(t, v.problems, problems)
+		})
+	}
+}
@@ -0,0 +1,429 @@
+// Package chains holds what the signer knows about the EVM chains it serves,
+// so one deployment can sign for several of them without mixing them up
+package chains
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/models"
+)
+
+// signer types, the transaction types a chain accepts
+const (
+	// SignerLegacy chains only accept EIP-155 legacy transactions
+	SignerLegacy = "legacy"
+	// SignerLondon chains also accept access list and dynamic fee
+	// transactions
+	SignerLondon = "london"
+)
+
+var (
+	// ErrUnknownChain is returned for wallets on chains that are not in the
+	// registry
+	ErrUnknownChain = errors.New("chain is not in the chain registry")
+	// ErrWalletNotAllowed is returned for wallets the chain does not list
+	ErrWalletNotAllowed = errors.New("wallet is not allowed on the chain")
+	// ErrChainMismatch is returned for transactions built for another chain
+	// than the one of their wallet
+	ErrChainMismatch = errors.New("transaction is for another chain than its wallet")
+	// ErrUnsupportedTxType is returned for transaction types the signer of
+	// the chain does not support
+	ErrUnsupportedTxType = errors.New("transaction type is not supported by the chain")
+	// ErrFeeCapExceeded is returned for transactions paying more than the
+	// caps of the chain
+	ErrFeeCapExceeded = errors.New("transaction fees exceed the caps of the chain")
+	// ErrDeploymentNotAllowed is returned for contract creations of wallets
+	// the chain does not list as contract deployers
+	ErrDeploymentNotAllowed = errors.New("wallet may not deploy contracts on the chain")
+	// ErrInitCodeTooLarge is returned for contract creations above the init
+	// code limit of EIP-3860
+	ErrInitCodeTooLarge = errors.New("contract creation code exceeds the init code limit")
+	// ErrEntryPointNotAllowed is returned for user operations sent to an
+	// EntryPoint the chain does not list
+	ErrEntryPointNotAllowed = errors.New("entry point is not allowed on the chain")
+)
+
+// Chain is the configuration of a single chain
+type Chain struct {
+	ID           int64
+	Name         string
+	NetworkType  models.NetworkType
+	RPCEndpoints []string
+	// SignerType is SignerLegacy or SignerLondon, empty leaves the choice
+	// to the signer backend
+	SignerType string
+	// MaxFeePerGas and MaxPriorityFeePerGas cap the fees of signed
+	// transactions in wei, nil does not cap them
+	MaxFeePerGas         *big.Int
+	MaxPriorityFeePerGas *big.Int
+	// WriteQueue is the queue signed transactions of the chain are written
+	// to, empty uses SQS_WRITE_QUEUE_NAME
+	WriteQueue string
+	// AllowedWallets lists the addresses that may sign on the chain in lower
+	// case, empty allows every wallet
+	AllowedWallets map[string]bool
+	// ContractDeployers lists the addresses that may create contracts on the
+	// chain in lower case, empty denies contract creations
+	ContractDeployers map[string]bool
+	// EntryPoints lists the ERC-4337 EntryPoint contracts user operations
+	// may be signed for in lower case, empty allows every EntryPoint
+	EntryPoints map[string]bool
+	// UserOperationQueue is the queue signed user operations of the chain
+	// are written to, empty uses USER_OPERATION_QUEUE_NAME
+	UserOperationQueue string
+}
+
+// Signer returns the transaction signer of the chain, nil when the choice is
+// left to the signer backend
+func (c Chain) Signer() types.Signer {
+	switch c.SignerType {
+	case SignerLegacy:
+		return types.NewEIP155Signer(big.NewInt(c.ID))
+	case SignerLondon:
+		return types.NewLondonSigner(big.NewInt(c.ID))
+	default:
+		return nil
+	}
+}
+
+// chainConfig is a chain as written in CHAIN_REGISTRY
+type chainConfig struct {
+	ChainID      int64    `json:"chain_id"`
+	Name         string   `json:"name"`
+	NetworkType  string   `json:"network_type"`
+	RPCEndpoints []string `json:"rpc_endpoints"`
+	Signer       string   `json:"signer"`
+	// the fee caps are decimal strings in wei, they do not fit JSON numbers
+	MaxFeePerGas         string   `json:"max_fee_per_gas"`
+	MaxPriorityFeePerGas string   `json:"max_priority_fee_per_gas"`
+	WriteQueue           string   `json:"write_queue"`
+	AllowedWallets       []string `json:"allowed_wallets"`
+	ContractDeployers    []string `json:"contract_deployers"`
+	EntryPoints          []string `json:"entry_points"`
+	UserOperationQueue   string   `json:"user_operation_queue"`
+}
+
+// Registry holds the configured chains. A registry built from CHAIN_REGISTRY
+// or MARA_CHAIN_ID rejects every other chain, one without any chain lets
+// every chain through the way the signer did before chains were configured
+type Registry struct {
+	chains map[int64]Chain
+	strict bool
+	// testnets are the chains of TESTNET_CHAIN_IDS, they tell the network
+	// of chains the registry does not list
+	testnets map[int64]bool
+}
+
+// New loads the chains of CHAIN_REGISTRY. Without it MARA_CHAIN_ID and
+// MARA_CHAIN_RPC describe the only known chain
+func New(cfg config.Configuration) (*Registry, error) {
+	r := &Registry{chains: map[int64]Chain{}, testnets: map[int64]bool{}}
+
+	for _, chainID := range cfg.TestnetChainIDs {
+		r.testnets[chainID] = true
+	}
+
+	if len(strings.TrimSpace(cfg.ChainRegistry)) == 0 {
+		if len(cfg.MaraChainID) == 0 {
+			return r, nil
+		}
+
+		chainID, err := strconv.ParseInt(cfg.MaraChainID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MARA_CHAIN_ID: %w", err)
+		}
+
+		chain := Chain{ID: chainID, Name: "mara", NetworkType: models.NetworkTypeMainnet}
+
+		if config.IsTestnetChain(cfg, chainID) {
+			chain.NetworkType = models.NetworkTypeTestnet
+		}
+
+		if len(cfg.MaraChainRPC) != 0 {
+			chain.RPCEndpoints = []string{cfg.MaraChainRPC}
+		}
+
+		chain.ContractDeployers = addressSet(cfg.ContractDeployers)
+
+		r.chains[chainID] = chain
+		r.strict = true
+
+		return r, nil
+	}
+
+	var configs []chainConfig
+
+	if err := json.Unmarshal([]byte(cfg.ChainRegistry), &configs); err != nil {
+		return nil, fmt.Errorf("could not decode CHAIN_REGISTRY: %w", err)
+	}
+
+	r.strict = true
+
+	for _, c := range configs {
+		chain, err := parseChain(cfg, c)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := r.chains[chain.ID]; ok {
+			return nil, fmt.Errorf("chain %d is listed twice", chain.ID)
+		}
+
+		r.chains[chain.ID] = chain
+	}
+
+	return r, nil
+}
+
+func parseChain(cfg config.Configuration, c chainConfig) (Chain, error) {
+	if c.ChainID <= 0 {
+		return Chain{}, errors.New("chains need a positive chain_id")
+	}
+
+	chain := Chain{
+		ID:                 c.ChainID,
+		Name:               c.Name,
+		NetworkType:        models.NetworkType(strings.ToLower(c.NetworkType)),
+		RPCEndpoints:       c.RPCEndpoints,
+		SignerType:         strings.ToLower(c.Signer),
+		WriteQueue:         c.WriteQueue,
+		UserOperationQueue: c.UserOperationQueue,
+	}
+
+	switch chain.NetworkType {
+	case models.NetworkTypeMainnet, models.NetworkTypeTestnet:
+	default:
+		return Chain{}, fmt.Errorf("chain %d has an unknown network type %q", c.ChainID, c.NetworkType)
+	}
+
+	if chain.NetworkType == models.NetworkTypeMainnet && config.IsTestnetChain(cfg, c.ChainID) {
+		return Chain{}, fmt.Errorf("chain %d is listed in TESTNET_CHAIN_IDS but configured as mainnet", c.ChainID)
+	}
+
+	switch chain.SignerType {
+	case "":
+		chain.SignerType = SignerLondon
+	case SignerLegacy, SignerLondon:
+	default:
+		return Chain{}, fmt.Errorf("chain %d has an unknown signer %q", c.ChainID, c.Signer)
+	}
+
+	var err error
+
+	if chain.MaxFeePerGas, err = parseWei(c.MaxFeePerGas); err != nil {
+		return Chain{}, fmt.Errorf("chain %d max_fee_per_gas: %w", c.ChainID, err)
+	}
+
+	if chain.MaxPriorityFeePerGas, err = parseWei(c.MaxPriorityFeePerGas); err != nil {
+		return Chain{}, fmt.Errorf("chain %d max_priority_fee_per_gas: %w", c.ChainID, err)
+	}
+
+	chain.AllowedWallets = addressSet(c.AllowedWallets)
+	chain.ContractDeployers = addressSet(c.ContractDeployers)
+	chain.EntryPoints = addressSet(c.EntryPoints)
+
+	return chain, nil
+}
+
+// addressSet returns the addresses in lower case, nil when there are none
+func addressSet(addresses []string) map[string]bool {
+	if len(addresses) == 0 {
+		return nil
+	}
+
+	set := make(map[string]bool, len(addresses))
+
+	for _, address := range addresses {
+		set[strings.ToLower(strings.TrimSpace(address))] = true
+	}
+
+	return set
+}
+
+func parseWei(value string) (*big.Int, error) {
+	if len(value) == 0 {
+		return nil, nil
+	}
+
+	wei, ok := new(big.Int).SetString(value, 10)
+	if !ok || wei.Sign() < 0 {
+		return nil, fmt.Errorf("%q is not an amount of wei", value)
+	}
+
+	return wei, nil
+}
+
+// Lookup returns the chain with the given ID
+func (r *Registry) Lookup(chainID int64) (Chain, bool) {
+	if r == nil {
+		return Chain{}, false
+	}
+
+	chain, ok := r.chains[chainID]
+
+	return chain, ok
+}
+
+// IDs returns the IDs of the known chains in order
+func (r *Registry) IDs() []int64 {
+	if r == nil {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(r.chains))
+
+	for id := range r.chains {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids
+}
+
+// IsTestnet checks if the chain is configured as a testnet. Chains the
+// registry does not list are testnets when TESTNET_CHAIN_IDS lists them
+func (r *Registry) IsTestnet(chainID int64) bool {
+	if r == nil {
+		return false
+	}
+
+	if chain, ok := r.chains[chainID]; ok {
+		return chain.NetworkType == models.NetworkTypeTestnet
+	}
+
+	return r.testnets[chainID]
+}
+
+// Signer returns the transaction signer of the chain, nil when the chain is
+// unknown or leaves the choice to the signer backend
+func (r *Registry) Signer(chainID int64) types.Signer {
+	chain, ok := r.Lookup(chainID)
+	if !ok {
+		return nil
+	}
+
+	return chain.Signer()
+}
+
+// Validate checks that the wallet may sign tx on its chain: the chain is
+// known, lists the wallet, supports the transaction type and caps its fees.
+// Contract creations also need the wallet to be a contract deployer of the
+// chain. A nil registry accepts everything
+func (r *Registry) Validate(wallet *models.SenderWallet, tx *types.Transaction) error {
+	if r == nil {
+		return nil
+	}
+
+	chainID := int64(wallet.ChainID)
+	address := strings.ToLower(strings.TrimSpace(wallet.Address))
+
+	chain, ok := r.chains[chainID]
+	if !ok {
+		if r.strict {
+			return fmt.Errorf("%w: %d", ErrUnknownChain, chainID)
+		}
+
+		// without any chain configured nobody deploys, the signer knows
+		// nothing about the chain
+		if tx.To() == nil {
+			return fmt.Errorf("%w: %s on chain %d", ErrDeploymentNotAllowed, address, chainID)
+		}
+
+		return nil
+	}
+
+	if len(chain.AllowedWallets) != 0 && !chain.AllowedWallets[address] {
+		return fmt.Errorf("%w: %s on chain %d", ErrWalletNotAllowed, address, chainID)
+	}
+
+	if tx.To() == nil {
+		if !chain.ContractDeployers[address] {
+			return fmt.Errorf("%w: %s on chain %d", ErrDeploymentNotAllowed, address, chainID)
+		}
+
+		if len(tx.Data()) > params.MaxInitCodeSize {
+			return fmt.Errorf("%w: %d bytes, at most %d", ErrInitCodeTooLarge, len(tx.Data()), params.MaxInitCodeSize)
+		}
+	}
+
+	// the chain ID of an unsigned legacy transaction is not known until it
+	// is signed
+	if tx.Type() != types.LegacyTxType {
+		if chain.SignerType == SignerLegacy {
+			return fmt.Errorf("%w: type %d on chain %d", ErrUnsupportedTxType, tx.Type(), chainID)
+		}
+
+		if tx.ChainId().Cmp(big.NewInt(chainID)) != 0 {
+			return fmt.Errorf("%w: transaction is for chain %s, wallet is on chain %d", ErrChainMismatch, tx.ChainId(), chainID)
+		}
+	}
+
+	if chain.MaxFeePerGas != nil && tx.GasFeeCap().Cmp(chain.MaxFeePerGas) > 0 {
+		return fmt.Errorf("%w: fee cap %s is above %s on chain %d", ErrFeeCapExceeded, tx.GasFeeCap(), chain.MaxFeePerGas, chainID)
+	}
+
+	if chain.MaxPriorityFeePerGas != nil && tx.GasTipCap().Cmp(chain.MaxPriorityFeePerGas) > 0 {
+		return fmt.Errorf("%w: tip cap %s is above %s on chain %d", ErrFeeCapExceeded, tx.GasTipCap(), chain.MaxPriorityFeePerGas, chainID)
+	}
+
+	return nil
+}
+
+// ValidateUserOperation checks that the wallet may sign op as the owner of a
+// smart account: the chain is known, lists the wallet and the EntryPoint and
+// caps the fees of the operation. A chainID of 0 is the chain of the wallet.
+// A nil registry accepts everything
+func (r *Registry) ValidateUserOperation(wallet *models.SenderWallet, chainID int64, entryPoint string, op *models.UserOperation) error {
+	if r == nil {
+		return nil
+	}
+
+	walletChainID := int64(wallet.ChainID)
+	address := strings.ToLower(strings.TrimSpace(wallet.Address))
+
+	if chainID != 0 && chainID != walletChainID {
+		return fmt.Errorf("%w: user operation is for chain %d, wallet is on chain %d", ErrChainMismatch, chainID, walletChainID)
+	}
+
+	chain, ok := r.chains[walletChainID]
+	if !ok {
+		if r.strict {
+			return fmt.Errorf("%w: %d", ErrUnknownChain, walletChainID)
+		}
+
+		return nil
+	}
+
+	if len(chain.AllowedWallets) != 0 && !chain.AllowedWallets[address] {
+		return fmt.Errorf("%w: %s on chain %d", ErrWalletNotAllowed, address, walletChainID)
+	}
+
+	entryPoint = strings.ToLower(strings.TrimSpace(entryPoint))
+
+	if len(chain.EntryPoints) != 0 && !chain.EntryPoints[entryPoint] {
+		return fmt.Errorf("%w: %s on chain %d", ErrEntryPointNotAllowed, entryPoint, walletChainID)
+	}
+
+	feeCap, tipCap := (*big.Int)(op.MaxFeePerGas), (*big.Int)(op.MaxPriorityFeePerGas)
+
+	if chain.MaxFeePerGas != nil && feeCap.Cmp(chain.MaxFeePerGas) > 0 {
+		return fmt.Errorf("%w: fee cap %s is above %s on chain %d", ErrFeeCapExceeded, feeCap, chain.MaxFeePerGas, walletChainID)
+	}
+
+	if chain.MaxPriorityFeePerGas != nil && tipCap.Cmp(chain.MaxPriorityFeePerGas) > 0 {
+		return fmt.Errorf("%w: tip cap %s is above %s on chain %d", ErrFeeCapExceeded, tipCap, chain.MaxPriorityFeePerGas, walletChainID)
+	}
+
+	return nil
+}
@@ -0,0 +1,243 @@
+package chains
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/models"
+)
+
+const registry = `[
+	{
+		"chain_id": 1,
+		"name": "ethereum",
+		"network_type": "mainnet",
+		"rpc_endpoints": ["https://eth.example.com"],
+		"signer": "london",
+		"max_fee_per_gas": "200000000000",
+		"max_priority_fee_per_gas": "3000000000",
+		"write_queue": "signed_transactions_ethereum",
+		"allowed_wallets": ["0xE004bb7a6cd6e00d3dabf717d809e665bdeaa671"],
+		"contract_deployers": ["0xE004bb7a6cd6e00d3dabf717d809e665bdeaa671"],
+		"entry_points": ["0x5FF137D4b0FDCD49DcA30c7CF57E578a026d2789"],
+		"user_operation_queue": "user_operations_ethereum"
+	},
+	{
+		"chain_id": 614,
+		"name": "mara",
+		"network_type": "testnet",
+		"signer": "legacy"
+	}
+]`
+
+func TestNew(t *testing.T) {
+	r, err := New(config.Configuration{ChainRegistry: registry})
+	require.NoError(t, err)
+	require.Equal(t, []int64{1, 614}, r.IDs())
+
+	chain, ok := r.Lookup(1)
+	require.True(t, ok)
+	require.Equal(t, "ethereum", chain.Name)
+	require.Equal(t, []string{"https://eth.example.com"}, chain.RPCEndpoints)
+	require.Equal(t, big.NewInt(200000000000), chain.MaxFeePerGas)
+	require.Equal(t, "signed_transactions_ethereum", chain.WriteQueue)
+	require.True(t, chain.AllowedWallets["0xe004bb7a6cd6e00d3dabf717d809e665bdeaa671"])
+	require.True(t, chain.ContractDeployers["0xe004bb7a6cd6e00d3dabf717d809e665bdeaa671"])
+	require.True(t, chain.EntryPoints["0x5ff137d4b0fdcd49dca30c7cf57e578a026d2789"])
+	require.Equal(t, "user_operations_ethereum", chain.UserOperationQueue)
+
+	require.False(t, r.IsTestnet(1))
+	require.True(t, r.IsTestnet(614))
+	require.Equal(t, types.NewLondonSigner(big.NewInt(1)), r.Signer(1))
+	require.Equal(t, types.NewEIP155Signer(big.NewInt(614)), r.Signer(614))
+	require.Nil(t, r.Signer(5))
+}
+
+func TestNew_MaraChain(t *testing.T) {
+	r, err := New(config.Configuration{
+		MaraChainID:       "614",
+		MaraChainRPC:      "https://rpc.mara.example.com",
+		TestnetChainIDs:   []int64{614},
+		ContractDeployers: []string{"0xE004bb7a6cd6e00d3dabf717d809e665bdeaa671"},
+	})
+	require.NoError(t, err)
+
+	chain, ok := r.Lookup(614)
+	require.True(t, ok)
+	require.Equal(t, models.NetworkTypeTestnet, chain.NetworkType)
+	require.Equal(t, []string{"https://rpc.mara.example.com"}, chain.RPCEndpoints)
+
+	// the signer backend keeps choosing the transaction signer
+	require.Nil(t, r.Signer(614))
+
+	// other chains would be signed with the signer of MARA_CHAIN_ID
+	to := common.HexToAddress("0xe004bb7a6cd6e00d3dabf717d809e665bdeaa671")
+	require.ErrorIs(t, r.Validate(&models.SenderWallet{ChainID: 1}, types.NewTx(&types.LegacyTx{To: &to})), ErrUnknownChain)
+	require.ErrorIs(t, r.ValidateUserOperation(&models.SenderWallet{ChainID: 1}, 0, "", &models.UserOperation{}), ErrUnknownChain)
+	require.NoError(t, r.Validate(&models.SenderWallet{ChainID: 614}, types.NewTx(&types.LegacyTx{To: &to})))
+
+	deployer := &models.SenderWallet{ChainID: 614, Address: "0xe004bb7a6cd6e00d3dabf717d809e665bdeaa671"}
+	require.NoError(t, r.Validate(deployer, types.NewTx(&types.LegacyTx{Data: []byte{0x60, 0x80}})))
+	require.ErrorIs(t, r.Validate(&models.SenderWallet{ChainID: 614}, types.NewTx(&types.LegacyTx{})), ErrDeploymentNotAllowed)
+}
+
+func TestNew_Invalid(t *testing.T) {
+	tt := []struct {
+		name string
+		cfg  config.Configuration
+	}{
+		{name: "not json", cfg: config.Configuration{ChainRegistry: "1=mainnet"}},
+		{name: "missing chain id", cfg: config.Configuration{ChainRegistry: `[{"network_type":"mainnet"}]`}},
+		{name: "listed twice", cfg: config.Configuration{ChainRegistry: `[{"chain_id":1,"network_type":"mainnet"},{"chain_id":1,"network_type":"mainnet"}]`}},
+		{name: "unknown network type", cfg: config.Configuration{ChainRegistry: `[{"chain_id":1,"network_type":"devnet"}]`}},
+		{name: "unknown signer", cfg: config.Configuration{ChainRegistry: `[{"chain_id":1,"network_type":"mainnet","signer":"berlin"}]`}},
+		{name: "invalid fee cap", cfg: config.Configuration{ChainRegistry: `[{"chain_id":1,"network_type":"mainnet","max_fee_per_gas":"1e9"}]`}},
+		{
+			name: "testnet configured as mainnet",
+			cfg:  config.Configuration{ChainRegistry: `[{"chain_id":5,"network_type":"mainnet"}]`, TestnetChainIDs: []int64{5}},
+		},
+		{name: "invalid mara chain id", cfg: config.Configuration{MaraChainID: "mara"}},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			_, err := New(v.cfg)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestRegistry_Validate(t *testing.T) {
+	r, err := New(config.Configuration{ChainRegistry: registry})
+	require.NoError(t, err)
+
+	allowed := &models.SenderWallet{ChainID: 1, Address: "0xe004bb7a6cd6e00d3dabf717d809e665bdeaa671 "}
+	to := common.HexToAddress("0xe004bb7a6cd6e00d3dabf717d809e665bdeaa671")
+
+	dynamicFee := func(chainID int64, feeCap, tipCap int64) *types.Transaction {
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:   big.NewInt(chainID),
+			GasFeeCap: big.NewInt(feeCap),
+			GasTipCap: big.NewInt(tipCap),
+			Gas:       21000,
+			To:        &to,
+		})
+	}
+
+	deployment := func(chainID int64, size int) *types.Transaction {
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:   big.NewInt(chainID),
+			GasFeeCap: big.NewInt(1),
+			GasTipCap: big.NewInt(1),
+			Gas:       1000000,
+			Data:      make([]byte, size),
+		})
+	}
+
+	tt := []struct {
+		name   string
+		wallet *models.SenderWallet
+		tx     *types.Transaction
+		err    error
+	}{
+		{name: "allowed wallet", wallet: allowed, tx: dynamicFee(1, 100e9, 2e9)},
+		{
+			name:   "legacy transaction on a legacy chain",
+			wallet: &models.SenderWallet{ChainID: 614},
+			tx:     types.NewTx(&types.LegacyTx{GasPrice: big.NewInt(1), Gas: 21000, To: &to}),
+		},
+		{name: "unknown chain", wallet: &models.SenderWallet{ChainID: 5}, tx: dynamicFee(5, 1, 1), err: ErrUnknownChain},
+		{
+			name:   "wallet that is not allowed",
+			wallet: &models.SenderWallet{ChainID: 1, Address: "0x0000000000000000000000000000000000000001"},
+			tx:     dynamicFee(1, 1, 1),
+			err:    ErrWalletNotAllowed,
+		},
+		{name: "transaction for another chain", wallet: allowed, tx: dynamicFee(614, 1, 1), err: ErrChainMismatch},
+		{name: "dynamic fee transaction on a legacy chain", wallet: &models.SenderWallet{ChainID: 614}, tx: dynamicFee(614, 1, 1), err: ErrUnsupportedTxType},
+		{name: "fee cap above the cap of the chain", wallet: allowed, tx: dynamicFee(1, 300e9, 2e9), err: ErrFeeCapExceeded},
+		{name: "tip cap above the cap of the chain", wallet: allowed, tx: dynamicFee(1, 100e9, 5e9), err: ErrFeeCapExceeded},
+		{name: "deployment of a contract deployer", wallet: allowed, tx: deployment(1, 1024)},
+		{name: "deployment on a chain without deployers", wallet: &models.SenderWallet{ChainID: 614}, tx: types.NewTx(&types.LegacyTx{Gas: 1000000}), err: ErrDeploymentNotAllowed},
+		{name: "deployment above the init code limit", wallet: allowed, tx: deployment(1, 49153), err: ErrInitCodeTooLarge},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			err := r.Validate(v.wallet, v.tx)
+			if v.err == nil {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorIs(t, err, v.err)
+		})
+	}
+
+	var nilRegistry *Registry
+	require.NoError(t, nilRegistry.Validate(&models.SenderWallet{ChainID: 5}, dynamicFee(1, 1, 1)))
+}
+
+func TestRegistry_ValidateUserOperation(t *testing.T) {
+	r, err := New(config.Configuration{ChainRegistry: registry})
+	require.NoError(t, err)
+
+	allowed := &models.SenderWallet{ChainID: 1, Address: "0xe004bb7a6cd6e00d3dabf717d809e665bdeaa671"}
+	entryPoint := "0x5FF137D4b0FDCD49DcA30c7CF57E578a026d2789"
+
+	userOperation := func(feeCap, tipCap int64) *models.UserOperation {
+		return &models.UserOperation{
+			Sender:               common.HexToAddress("0x6ac7ea33f8831ea9dcc53393aaa88b25a785dbf0"),
+			MaxFeePerGas:         (*hexutil.Big)(big.NewInt(feeCap)),
+			MaxPriorityFeePerGas: (*hexutil.Big)(big.NewInt(tipCap)),
+		}
+	}
+
+	tt := []struct {
+		name       string
+		wallet     *models.SenderWallet
+		chainID    int64
+		entryPoint string
+		err        error
+	}{
+		{name: "allowed wallet and entry point", wallet: allowed, chainID: 1, entryPoint: entryPoint},
+		{name: "chain of the wallet", wallet: allowed, entryPoint: entryPoint},
+		{name: "any entry point on a chain without entry points", wallet: &models.SenderWallet{ChainID: 614}, entryPoint: "0x0000000000000000000000000000000000000001"},
+		{name: "unknown chain", wallet: &models.SenderWallet{ChainID: 5}, entryPoint: entryPoint, err: ErrUnknownChain},
+		{name: "operation for another chain", wallet: allowed, chainID: 614, entryPoint: entryPoint, err: ErrChainMismatch},
+		{
+			name:       "wallet that is not allowed",
+			wallet:     &models.SenderWallet{ChainID: 1, Address: "0x0000000000000000000000000000000000000001"},
+			entryPoint: entryPoint,
+			err:        ErrWalletNotAllowed,
+		},
+		{name: "entry point that is not allowed", wallet: allowed, entryPoint: "0x0000000000000000000000000000000000000001", err: ErrEntryPointNotAllowed},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			err := r.ValidateUserOperation(v.wallet, v.chainID, v.entryPoint, userOperation(100e9, 2e9))
+			if v.err == nil {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorIs(t, err, v.err)
+		})
+	}
+
+	err = r.ValidateUserOperation(allowed, 1, entryPoint, userOperation(300e9, 2e9))
+	require.ErrorIs(t, err, ErrFeeCapExceeded)
+
+	err = r.ValidateUserOperation(allowed, 1, entryPoint, userOperation(100e9, 5e9))
+	require.ErrorIs(t, err, ErrFeeCapExceeded)
+
+	var nilRegistry *Registry
+	require.NoError(t, nilRegistry.ValidateUserOperation(&models.SenderWallet{ChainID: 5}, 0, entryPoint, userOperation(1, 1)))
+}
@@ -0,0 +1,187 @@
+// Package ethtx implements helpers to decode, encode and inspect ethereum
+// transactions as they travel through the queues
+package ethtx
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// ErrNotERC20Call is returned when the calldata is not a known ERC-20 method
+var ErrNotERC20Call = errors.New("calldata is not an ERC-20 call")
+
+// ErrNoSigner is returned by Signer when neither the chain registry nor
+// MARA_CHAIN_ID give a chain to sign for
+var ErrNoSigner = errors.New("no signer, please configure the chain in CHAIN_REGISTRY or MARA_CHAIN_ID")
+
+const erc20ABI = `[
+	{"name":"transfer","type":"function","inputs":[{"name":"to","type":"address"},{"name":"amount","type":"uint256"}]},
+	{"name":"approve","type":"function","inputs":[{"name":"spender","type":"address"},{"name":"amount","type":"uint256"}]},
+	{"name":"transferFrom","type":"function","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"amount","type":"uint256"}]}
+]`
+
+var parsedERC20ABI = mustParseABI(erc20ABI)
+
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(err)
+	}
+
+	return parsed
+}
+
+// ERC20Call is a decoded ERC-20 method call
+type ERC20Call struct {
+	Method  string
+	From    common.Address
+	To      common.Address
+	Spender common.Address
+	Amount  *big.Int
+}
+
+// Decode hex decodes the given raw transaction. Both legacy and typed
+// transactions are supported, with or without a 0x prefix
+func Decode(rawTX string) (*types.Transaction, error) {
+	rawTxBytes, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(rawTX), "0x"))
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &types.Transaction{}
+
+	if err := tx.UnmarshalBinary(rawTxBytes); err == nil {
+		return tx, nil
+	}
+
+	// typed transactions wrapped in an rlp string are still accepted
+	if err := rlp.DecodeBytes(rawTxBytes, tx); err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// Encode hex encodes the transaction the way broadcasters expect it
+func Encode(tx *types.Transaction) string {
+	ts := types.Transactions{tx}
+	b := new(bytes.Buffer)
+	ts.EncodeIndex(0, b)
+
+	return hex.EncodeToString(b.Bytes())
+}
+
+// IsSigned checks if the transaction carries a signature
+func IsSigned(tx *types.Transaction) bool {
+	v, r, s := tx.RawSignatureValues()
+
+	return v != nil && r != nil && s != nil && (r.Sign() != 0 || s.Sign() != 0)
+}
+
+// Sender recovers the address that signed the transaction
+func Sender(tx *types.Transaction) (common.Address, error) {
+	if !IsSigned(tx) {
+		return common.Address{}, errors.New("transaction is not signed")
+	}
+
+	return types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+}
+
+// Signer returns the signer the chain registry chose for a transaction. When
+// the registry leaves the choice to the backend, every backend signs with the
+// latest signer of chainID, which signs legacy transactions with EIP-155
+func Signer(signer types.Signer, chainID *big.Int) (types.Signer, error) {
+	if signer != nil {
+		return signer, nil
+	}
+
+	if chainID == nil {
+		return nil, ErrNoSigner
+	}
+
+	return types.LatestSignerForChainID(chainID), nil
+}
+
+var (
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidSecp256k1      = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+)
+
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// ParsePublicKey parses a DER encoded SubjectPublicKeyInfo as returned by
+// KMS and the TSM. The standard library does not support secp256k1 so the
+// point is extracted by hand
+func ParsePublicKey(der []byte) (*ecdsa.PublicKey, error) {
+	var info subjectPublicKeyInfo
+
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("could not parse public key: %w", err)
+	}
+
+	return crypto.UnmarshalPubkey(info.PublicKey.Bytes)
+}
+
+// MarshalPublicKey encodes a secp256k1 public key as a DER encoded
+// SubjectPublicKeyInfo, the inverse of ParsePublicKey
+func MarshalPublicKey(publicKey *ecdsa.PublicKey) ([]byte, error) {
+	params, err := asn1.Marshal(oidSecp256k1)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(subjectPublicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidPublicKeyECDSA, Parameters: asn1.RawValue{FullBytes: params}},
+		PublicKey: asn1.BitString{Bytes: crypto.FromECDSAPub(publicKey), BitLength: 65 * 8},
+	})
+}
+
+// DecodeERC20Call decodes transfer, approve and transferFrom calldata
+func DecodeERC20Call(data []byte) (*ERC20Call, error) {
+	if len(data) < 4 {
+		return nil, ErrNotERC20Call
+	}
+
+	method, err := parsedERC20ABI.MethodById(data[:4])
+	if err != nil {
+		return nil, ErrNotERC20Call
+	}
+
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, err
+	}
+
+	call := &ERC20Call{Method: method.Name}
+
+	switch method.Name {
+	case "transfer":
+		call.To = args[0].(common.Address)
+		call.Amount = args[1].(*big.Int)
+	case "approve":
+		call.Spender = args[0].(common.Address)
+		call.Amount = args[1].(*big.Int)
+	case "transferFrom":
+		call.From = args[0].(common.Address)
+		call.To = args[1].(common.Address)
+		call.Amount = args[2].(*big.Int)
+	}
+
+	return call, nil
+}
@@ -0,0 +1,162 @@
+package ethtx
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+// raw_tx from testdata/event.json
+const unsignedLegacyTX = "eb80830f424082791894e004bb7a6cd6e00d3dabf717d809e665bdeaa6718902b5e3af16b188000080808080"
+
+func TestDecode(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	chainID := big.NewInt(123456)
+	to := common.HexToAddress("0xe004bb7a6cd6e00d3dabf717d809e665bdeaa671")
+
+	legacy, err := types.SignNewTx(key, types.NewEIP155Signer(chainID), &types.LegacyTx{
+		Nonce: 1, To: &to, Value: big.NewInt(10), Gas: 21000, GasPrice: big.NewInt(1),
+	})
+	require.NoError(t, err)
+
+	dynamic, err := types.SignNewTx(key, types.NewLondonSigner(chainID), &types.DynamicFeeTx{
+		ChainID: chainID, Nonce: 2, To: &to, Value: big.NewInt(10), Gas: 21000,
+		GasFeeCap: big.NewInt(10), GasTipCap: big.NewInt(1),
+	})
+	require.NoError(t, err)
+
+	tt := []struct {
+		name     string
+		raw      string
+		hasError bool
+		signed   bool
+		txType   uint8
+	}{
+		{
+			name:   "unsigned legacy transaction",
+			raw:    unsignedLegacyTX,
+			txType: types.LegacyTxType,
+		},
+		{
+			name:   "signed legacy transaction with 0x prefix",
+			raw:    "0x" + Encode(legacy),
+			signed: true,
+			txType: types.LegacyTxType,
+		},
+		{
+			name:   "signed dynamic fee transaction",
+			raw:    Encode(dynamic),
+			signed: true,
+			txType: types.DynamicFeeTxType,
+		},
+		{
+			name:     "invalid hex",
+			raw:      "zz",
+			hasError: true,
+		},
+		{
+			name:     "invalid rlp",
+			raw:      "c0",
+			hasError: true,
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			tx, err := Decode(v.raw)
+			if v.hasError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, v.txType, tx.Type())
+			require.Equal(t, v.signed, IsSigned(tx))
+
+			if !v.signed {
+				_, err := Sender(tx)
+				require.Error(t, err)
+				return
+			}
+
+			sender, err := Sender(tx)
+			require.NoError(t, err)
+			require.Equal(t, crypto.PubkeyToAddress(key.PublicKey), sender)
+		})
+	}
+}
+
+func TestDecodeERC20Call(t *testing.T) {
+	to := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	from := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+
+	transfer, err := parsedERC20ABI.Pack("transfer", to, big.NewInt(100))
+	require.NoError(t, err)
+
+	transferFrom, err := parsedERC20ABI.Pack("transferFrom", from, to, big.NewInt(5))
+	require.NoError(t, err)
+
+	call, err := DecodeERC20Call(transfer)
+	require.NoError(t, err)
+	require.Equal(t, "transfer", call.Method)
+	require.Equal(t, to, call.To)
+	require.Equal(t, big.NewInt(100), call.Amount)
+
+	call, err = DecodeERC20Call(transferFrom)
+	require.NoError(t, err)
+	require.Equal(t, "transferFrom", call.Method)
+	require.Equal(t, from, call.From)
+	require.Equal(t, to, call.To)
+
+	_, err = DecodeERC20Call(nil)
+	require.ErrorIs(t, err, ErrNotERC20Call)
+
+	_, err = DecodeERC20Call([]byte{0xde, 0xad, 0xbe, 0xef})
+	require.ErrorIs(t, err, ErrNotERC20Call)
+}
+
+func TestParsePublicKey(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	der, err := MarshalPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	publicKey, err := ParsePublicKey(der)
+	require.NoError(t, err)
+	require.Equal(t, crypto.PubkeyToAddress(key.PublicKey), crypto.PubkeyToAddress(*publicKey))
+
+	_, err = ParsePublicKey([]byte{0x30, 0x01})
+	require.Error(t, err)
+}
+
+func TestSigner(t *testing.T) {
+	chainID := big.NewInt(614)
+
+	signer, err := Signer(types.NewEIP155Signer(chainID), chainID)
+	require.NoError(t, err)
+	require.Equal(t, types.NewEIP155Signer(chainID), signer)
+
+	// without a signer of the registry legacy transactions are signed with
+	// EIP-155 and typed transactions can be signed as well
+	signer, err = Signer(nil, chainID)
+	require.NoError(t, err)
+
+	legacy := types.NewTx(&types.LegacyTx{Nonce: 1, GasPrice: big.NewInt(1000), Gas: 21000})
+	require.Equal(t, types.NewEIP155Signer(chainID).Hash(legacy), signer.Hash(legacy))
+
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	_, err = types.SignTx(types.NewTx(&types.DynamicFeeTx{ChainID: chainID, Nonce: 2}), signer, key)
+	require.NoError(t, err)
+
+	_, err = Signer(nil, nil)
+	require.ErrorIs(t, err, ErrNoSigner)
+}
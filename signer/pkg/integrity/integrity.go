@@ -0,0 +1,228 @@
+// Package integrity checks that the wallets database agrees with the keys held
+// by the signer backends. A wallet whose stored address is not the one its key
+// and derivation path derive to would sign from the wrong account
+package integrity
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/mara-labs/transactionsigner/models"
+)
+
+const defaultBatchSize = 500
+
+// ProblemKind classifies the problems found by Check
+type ProblemKind string
+
+// Enum values for ProblemKind
+const (
+	// ProblemAddressMismatch is reported when the derived address is not the
+	// stored one
+	ProblemAddressMismatch ProblemKind = "address_mismatch"
+	// ProblemInvalidAddress is reported when the stored address can not be
+	// parsed
+	ProblemInvalidAddress ProblemKind = "invalid_address"
+	// ProblemMissingDerivationPath is reported for wallets without a
+	// derivation path
+	ProblemMissingDerivationPath ProblemKind = "missing_derivation_path"
+	// ProblemAmbiguousDerivationPath is reported for wallets with more than
+	// one derivation path
+	ProblemAmbiguousDerivationPath ProblemKind = "ambiguous_derivation_path"
+	// ProblemInvalidDerivationPath is reported when the derivation path does
+	// not agree with its wallet
+	ProblemInvalidDerivationPath ProblemKind = "invalid_derivation_path"
+	// ProblemOrphanDerivationPath is reported for derivation paths that do
+	// not belong to any wallet
+	ProblemOrphanDerivationPath ProblemKind = "orphan_derivation_path"
+	// ProblemDerivationFailed is reported when the backend could not derive
+	// the public key
+	ProblemDerivationFailed ProblemKind = "derivation_failed"
+)
+
+// AddressDeriver derives the address a wallet signs with, see
+// registry.Registry
+type AddressDeriver interface {
+	DeriveAddress(context.Context, models.SignOptions) (common.Address, error)
+}
+
+// Problem describes a wallet or derivation path that failed a check
+type Problem struct {
+	Kind             ProblemKind
+	WalletID         int64
+	DerivationPathID int64
+	Detail           string
+}
+
+// Options tunes Check
+type Options struct {
+	// BatchSize is the amount of rows fetched per query
+	BatchSize int
+}
+
+// Report is the outcome of Check
+type Report struct {
+	Wallets         int
+	DerivationPaths int
+	// Verified counts the wallets whose derived address matched
+	Verified int
+	// Skipped counts multisig wallets, their address is a contract and is
+	// not derived from a key
+	Skipped  int
+	Problems []Problem
+}
+
+// Check derives the address of every wallet through the signer backends and
+// compares it with the stored one. Derivation paths that do not belong to any
+// wallet are reported as well
+func Check(ctx context.Context, inventory models.WalletInventory, deriver AddressDeriver, opts Options) (Report, error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	var report Report
+
+	pathsByWallet := map[int64][]models.DerivationPath{}
+
+	for afterID := int64(0); ; {
+		paths, err := inventory.ListDerivationPaths(ctx, afterID, batchSize)
+		if err != nil {
+			return report, fmt.Errorf("could not list derivation paths: %w", err)
+		}
+
+		for _, path := range paths {
+			pathsByWallet[int64(path.WalletID)] = append(pathsByWallet[int64(path.WalletID)], path)
+			afterID = path.ID
+		}
+
+		report.DerivationPaths += len(paths)
+
+		if len(paths) < batchSize {
+			break
+		}
+	}
+
+	seen := map[int64]bool{}
+
+	for afterID := int64(0); ; {
+		wallets, err := inventory.ListWallets(ctx, afterID, batchSize)
+		if err != nil {
+			return report, fmt.Errorf("could not list wallets: %w", err)
+		}
+
+		for i := range wallets {
+			wallet := &wallets[i]
+			seen[wallet.ID] = true
+			afterID = wallet.ID
+
+			report.check(ctx, deriver, wallet, pathsByWallet[wallet.ID])
+		}
+
+		report.Wallets += len(wallets)
+
+		if len(wallets) < batchSize {
+			break
+		}
+	}
+
+	var orphans []Problem
+
+	for walletID, paths := range pathsByWallet {
+		if seen[walletID] {
+			continue
+		}
+
+		detail := fmt.Sprintf("wallet %d does not exist", walletID)
+		if walletID == 0 {
+			detail = "derivation path has no wallet"
+		}
+
+		for _, path := range paths {
+			orphans = append(orphans, Problem{
+				Kind:             ProblemOrphanDerivationPath,
+				WalletID:         walletID,
+				DerivationPathID: path.ID,
+				Detail:           detail,
+			})
+		}
+	}
+
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].DerivationPathID < orphans[j].DerivationPathID })
+
+	report.Problems = append(report.Problems, orphans...)
+
+	return report, nil
+}
+
+func (r *Report) check(ctx context.Context, deriver AddressDeriver, wallet *models.SenderWallet, paths []models.DerivationPath) {
+	if wallet.IsMultisig {
+		r.Skipped++
+		return
+	}
+
+	switch len(paths) {
+	case 0:
+		r.problem(ProblemMissingDerivationPath, wallet.ID, 0, "wallet has no derivation path")
+		return
+	case 1:
+	default:
+		ids := make([]string, 0, len(paths))
+		for _, path := range paths {
+			ids = append(ids, fmt.Sprint(path.ID))
+		}
+
+		r.problem(ProblemAmbiguousDerivationPath, wallet.ID, paths[0].ID,
+			"wallet has derivation paths "+strings.Join(ids, ", "))
+
+		return
+	}
+
+	path := paths[0]
+
+	bip32Path, err := path.WalletPath(wallet)
+	if err != nil {
+		r.problem(ProblemInvalidDerivationPath, wallet.ID, path.ID, err.Error())
+		return
+	}
+
+	stored := strings.TrimSpace(wallet.Address)
+	if !common.IsHexAddress(stored) {
+		r.problem(ProblemInvalidAddress, wallet.ID, path.ID, fmt.Sprintf("%q is not an address", wallet.Address))
+		return
+	}
+
+	derived, err := deriver.DeriveAddress(ctx, models.SignOptions{
+		KeyID:          wallet.KeyID,
+		DerivationPath: bip32Path,
+		Backend:        wallet.SignerBackend,
+		ChainID:        int64(wallet.ChainID),
+	})
+	if err != nil {
+		r.problem(ProblemDerivationFailed, wallet.ID, path.ID, err.Error())
+		return
+	}
+
+	if derived != common.HexToAddress(stored) {
+		r.problem(ProblemAddressMismatch, wallet.ID, path.ID,
+			fmt.Sprintf("stored %s, key %s at %s derives %s",
+				stored, wallet.KeyID, models.FormatDerivationPath(bip32Path), derived.Hex()))
+
+		return
+	}
+
+	r.Verified++
+}
+
+func (r *Report) problem(kind ProblemKind, walletID, derivationPathID int64, detail string) {
+	r.Problems = append(r.Problems, Problem{
+		Kind:             kind,
+		WalletID:         walletID,
+		DerivationPathID: derivationPathID,
+		Detail:           detail,
+	})
+}
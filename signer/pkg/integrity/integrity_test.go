@@ -0,0 +1,119 @@
+package integrity
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mara-labs/transactionsigner/models"
+)
+
+type memoryInventory struct {
+	wallets []models.SenderWallet
+	paths   []models.DerivationPath
+}
+
+func (m *memoryInventory) ListWallets(_ context.Context, afterID int64, limit int) ([]models.SenderWallet, error) {
+	var wallets []models.SenderWallet
+
+	for _, wallet := range m.wallets {
+		if wallet.ID > afterID && len(wallets) < limit {
+			wallets = append(wallets, wallet)
+		}
+	}
+
+	return wallets, nil
+}
+
+func (m *memoryInventory) ListDerivationPaths(_ context.Context, afterID int64, limit int) ([]models.DerivationPath, error) {
+	var paths []models.DerivationPath
+
+	for _, path := range m.paths {
+		if path.ID > afterID && len(paths) < limit {
+			paths = append(paths, path)
+		}
+	}
+
+	return paths, nil
+}
+
+// fakeDeriver derives addresses from a table keyed by key ID and path
+type fakeDeriver map[string]common.Address
+
+func (f fakeDeriver) DeriveAddress(_ context.Context, opts models.SignOptions) (common.Address, error) {
+	address, ok := f[opts.KeyID+"@"+models.FormatDerivationPath(opts.DerivationPath)]
+	if !ok {
+		return common.Address{}, errors.New("key not found")
+	}
+
+	return address, nil
+}
+
+func TestCheck(t *testing.T) {
+	good := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	other := common.HexToAddress("0x2222222222222222222222222222222222222222")
+
+	inventory := &memoryInventory{
+		wallets: []models.SenderWallet{
+			{ID: 1, KeyID: "key", Address: good.Hex(), AddressIndex: 1},
+			// stored in lower case, still matches
+			{ID: 2, KeyID: "key", Address: "0x2222222222222222222222222222222222222222", AddressIndex: 2},
+			{ID: 3, KeyID: "key", Address: good.Hex(), AddressIndex: 3},
+			{ID: 4, KeyID: "key", Address: good.Hex(), AddressIndex: 4},
+			{ID: 5, KeyID: "key", Address: good.Hex(), AddressIndex: 5},
+			{ID: 6, KeyID: "key", Address: good.Hex(), AddressIndex: 6},
+			{ID: 7, KeyID: "unknown", Address: good.Hex(), AddressIndex: 7},
+			{ID: 8, Address: other.Hex(), IsMultisig: true},
+		},
+		paths: []models.DerivationPath{
+			{ID: 1, WalletID: 1, Purpose: 44, CoinType: 60, AddressIndex: 1},
+			{ID: 2, WalletID: 2, Purpose: 44, CoinType: 60, AddressIndex: 2},
+			{ID: 3, WalletID: 3, Purpose: 44, CoinType: 60, AddressIndex: 3},
+			{ID: 4, WalletID: 5, Purpose: 44, CoinType: 60, AddressIndex: 5},
+			{ID: 5, WalletID: 5, Purpose: 44, CoinType: 60, AddressIndex: 5},
+			{ID: 6, WalletID: 6, Purpose: 44, CoinType: 60, AddressIndex: 9},
+			{ID: 7, WalletID: 7, Purpose: 44, CoinType: 60, AddressIndex: 7},
+			{ID: 8, WalletID: 42, Purpose: 44, CoinType: 60},
+			{ID: 9, Purpose: 44, CoinType: 60},
+		},
+	}
+
+	deriver := fakeDeriver{
+		"key@44/60/0/0/1": good,
+		"key@44/60/0/0/2": other,
+		"key@44/60/0/0/3": other,
+	}
+
+	// a small batch size makes sure every page is read
+	report, err := Check(context.Background(), inventory, deriver, Options{BatchSize: 2})
+	require.NoError(t, err)
+
+	require.Equal(t, 8, report.Wallets)
+	require.Equal(t, 9, report.DerivationPaths)
+	require.Equal(t, 2, report.Verified)
+	require.Equal(t, 1, report.Skipped)
+
+	type problem struct {
+		kind     ProblemKind
+		walletID int64
+		pathID   int64
+	}
+
+	var problems []problem
+	for _, p := range report.Problems {
+		problems = append(problems, problem{kind: p.Kind, walletID: p.WalletID, pathID: p.DerivationPathID})
+	}
+
+	require.Equal(t, []problem{
+		{kind: ProblemAddressMismatch, walletID: 3, pathID: 3},
+		{kind: ProblemMissingDerivationPath, walletID: 4},
+		{kind: ProblemAmbiguousDerivationPath, walletID: 5, pathID: 4},
+		{kind: ProblemInvalidDerivationPath, walletID: 6, pathID: 6},
+		{kind: ProblemDerivationFailed, walletID: 7, pathID: 7},
+		{kind: ProblemOrphanDerivationPath, walletID: 42, pathID: 8},
+		{kind: ProblemOrphanDerivationPath, pathID: 9},
+	}, problems)
+}
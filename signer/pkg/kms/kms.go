@@ -0,0 +1,290 @@
+// Package kms implements a signer backed by AWS KMS ECC_SECG_P256K1 keys
+package kms
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	log "github.com/sirupsen/logrus"
+	awstrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/aws/aws-sdk-go-v2/aws"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/ethtx"
+)
+
+const defaultRegion = "eu-west-2"
+
+var (
+	// ErrUnsupportedKey is returned for KMS keys that are not secp256k1
+	// signing keys
+	ErrUnsupportedKey = errors.New("kms key is not an ECC_SECG_P256K1 key")
+	// ErrInvalidSignature is returned when the signature returned by KMS
+	// does not recover to the public key of the key
+	ErrInvalidSignature = errors.New("kms signature does not match the public key")
+)
+
+var (
+	secp256k1N     = crypto.S256().Params().N
+	secp256k1HalfN = new(big.Int).Rsh(secp256k1N, 1)
+)
+
+// API is the subset of the KMS client used by the signer
+type API interface {
+	Sign(context.Context, *kms.SignInput, ...func(*kms.Options)) (*kms.SignOutput, error)
+	GetPublicKey(context.Context, *kms.GetPublicKeyInput, ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error)
+	ListKeys(context.Context, *kms.ListKeysInput, ...func(*kms.Options)) (*kms.ListKeysOutput, error)
+	CreateKey(context.Context, *kms.CreateKeyInput, ...func(*kms.Options)) (*kms.CreateKeyOutput, error)
+}
+
+// Client signs transactions with KMS keys. KMS keys are not hierarchical so
+// the derivation path of the wallet is ignored, the key ID alone identifies
+// the address
+type Client struct {
+	api     API
+	chainID *big.Int
+
+	mu         sync.RWMutex
+	publicKeys map[string]*ecdsa.PublicKey
+}
+
+func getRegion(cfg config.Configuration) string {
+	if len(strings.TrimSpace(cfg.KMSRegion)) == 0 {
+		return defaultRegion
+	}
+
+	return cfg.KMSRegion
+}
+
+func getLocalstackEndpoint(cfg config.Configuration) string {
+	if (len(cfg.KMSLocalstackEndpoint)) == 0 {
+		return "http://host.docker.internal:4566"
+	}
+
+	return cfg.KMSLocalstackEndpoint
+}
+
+// New creates a KMS signer, local environments use localstack
+func New(cfg config.Configuration) (*Client, error) {
+	// chains of the chain registry bring their own signer, MARA_CHAIN_ID is
+	// only needed for the others
+	var chainID *big.Int
+
+	if len(cfg.MaraChainID) != 0 {
+		var ok bool
+
+		chainID, ok = big.NewInt(0).SetString(cfg.MaraChainID, 10)
+		if !ok {
+			return nil, errors.New("invalid chain id")
+		}
+	}
+
+	opts := []func(*awsConfig.LoadOptions) error{}
+
+	opts = append(opts, awsConfig.WithRegion(getRegion(cfg)))
+
+	if config.IsLocal(cfg) {
+		opts = append(opts, awsConfig.WithEndpointResolver(aws.EndpointResolverFunc(func(_, region string) (aws.Endpoint, error) { //nolint: staticcheck
+			return aws.Endpoint{
+				URL:               getLocalstackEndpoint(cfg),
+				SigningRegion:     region,
+				Source:            aws.EndpointSourceCustom,
+				HostnameImmutable: true,
+				PartitionID:       "aws",
+			}, nil
+		})))
+	}
+
+	conf, err := awsConfig.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		log.WithError(err).Error("could not set up AWS configuration")
+		return nil, err
+	}
+
+	awstrace.AppendMiddleware(&conf)
+
+	return newClient(kms.NewFromConfig(conf), chainID), nil
+}
+
+func newClient(api API, chainID *big.Int) *Client {
+	return &Client{
+		api:        api,
+		chainID:    chainID,
+		publicKeys: map[string]*ecdsa.PublicKey{},
+	}
+}
+
+// Sign signs the hash of the transaction with the KMS key in opts.KeyID
+func (c *Client) Sign(ctx context.Context, opts models.SignOptions) (*types.Transaction, error) {
+	signer, err := ethtx.Signer(opts.Signer, c.chainID)
+	if err != nil {
+		return nil, fmt.Errorf("chain %d: %w", opts.ChainID, err)
+	}
+
+	sig, err := c.signDigest(ctx, opts.KeyID, signer.Hash(opts.TX).Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	return opts.TX.WithSignature(signer, sig)
+}
+
+// SignHash signs opts.Digest with the KMS key in opts.KeyID
+func (c *Client) SignHash(ctx context.Context, opts models.SignOptions) ([]byte, error) {
+	if len(opts.Digest) != 32 {
+		return nil, fmt.Errorf("can not sign a digest of %d bytes", len(opts.Digest))
+	}
+
+	return c.signDigest(ctx, opts.KeyID, opts.Digest)
+}
+
+// signDigest signs the digest and returns the signature in the
+// [R || S || V] form
+func (c *Client) signDigest(ctx context.Context, keyID string, digest []byte) ([]byte, error) {
+	publicKey, err := c.publicKey(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := c.api.Sign(ctx, &kms.SignInput{
+		KeyId:            aws.String(keyID),
+		Message:          digest,
+		MessageType:      kmstypes.MessageTypeDigest,
+		SigningAlgorithm: kmstypes.SigningAlgorithmSpecEcdsaSha256,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not sign with kms key %s: %w", keyID, err)
+	}
+
+	sig, err := ethereumSignature(out.Signature, digest, publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("kms key %s: %w", keyID, err)
+	}
+
+	return sig, nil
+}
+
+// Address returns the ethereum address controlled by the KMS key
+func (c *Client) Address(ctx context.Context, keyID string) (common.Address, error) {
+	publicKey, err := c.publicKey(ctx, keyID)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	return crypto.PubkeyToAddress(*publicKey), nil
+}
+
+// PublicKey returns the public key of the KMS key. KMS keys are not
+// hierarchical so the derivation path is ignored
+func (c *Client) PublicKey(ctx context.Context, keyID string, _ []uint32) (*ecdsa.PublicKey, error) {
+	return c.publicKey(ctx, keyID)
+}
+
+// GenerateKey creates a new ECC_SECG_P256K1 signing key and returns its ID
+func (c *Client) GenerateKey(ctx context.Context) (string, error) {
+	out, err := c.api.CreateKey(ctx, &kms.CreateKeyInput{
+		KeySpec:     kmstypes.KeySpecEccSecgP256k1,
+		KeyUsage:    kmstypes.KeyUsageTypeSignVerify,
+		Description: aws.String("transaction signer wallet key"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not create kms key: %w", err)
+	}
+
+	return aws.ToString(out.KeyMetadata.KeyId), nil
+}
+
+// HealthCheck makes sure KMS is reachable with the current credentials
+func (c *Client) HealthCheck(ctx context.Context) error {
+	_, err := c.api.ListKeys(ctx, &kms.ListKeysInput{Limit: aws.Int32(1)})
+	return err
+}
+
+// publicKey fetches the public key of the KMS key. Public keys never change
+// so they are cached for the lifetime of the client
+func (c *Client) publicKey(ctx context.Context, keyID string) (*ecdsa.PublicKey, error) {
+	c.mu.RLock()
+	publicKey, ok := c.publicKeys[keyID]
+	c.mu.RUnlock()
+
+	if ok {
+		return publicKey, nil
+	}
+
+	out, err := c.api.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: aws.String(keyID)})
+	if err != nil {
+		return nil, fmt.Errorf("could not get public key of kms key %s: %w", keyID, err)
+	}
+
+	if out.KeySpec != kmstypes.KeySpecEccSecgP256k1 {
+		return nil, fmt.Errorf("%w: %s is %s", ErrUnsupportedKey, keyID, out.KeySpec)
+	}
+
+	publicKey, err = ethtx.ParsePublicKey(out.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("kms key %s: %w", keyID, err)
+	}
+
+	c.mu.Lock()
+	c.publicKeys[keyID] = publicKey
+	c.mu.Unlock()
+
+	return publicKey, nil
+}
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// ethereumSignature converts a DER encoded ECDSA signature to the 65 bytes
+// [R || S || V] form. S is normalized to the lower half of the curve order as
+// required since homestead and V is found by recovering the public key
+func ethereumSignature(der, hash []byte, publicKey *ecdsa.PublicKey) ([]byte, error) {
+	var sig ecdsaSignature
+
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, fmt.Errorf("could not parse signature: %w", err)
+	}
+
+	if sig.R.Sign() <= 0 || sig.S.Sign() <= 0 || sig.R.Cmp(secp256k1N) >= 0 || sig.S.Cmp(secp256k1N) >= 0 {
+		return nil, ErrInvalidSignature
+	}
+
+	if sig.S.Cmp(secp256k1HalfN) > 0 {
+		sig.S = new(big.Int).Sub(secp256k1N, sig.S)
+	}
+
+	raw := make([]byte, crypto.SignatureLength)
+	sig.R.FillBytes(raw[:32])
+	sig.S.FillBytes(raw[32:64])
+
+	expected := crypto.FromECDSAPub(publicKey)
+
+	for v := byte(0); v < 2; v++ {
+		raw[64] = v
+
+		recovered, err := crypto.Ecrecover(hash, raw)
+		if err != nil {
+			continue
+		}
+
+		if string(recovered) == string(expected) {
+			return raw, nil
+		}
+	}
+
+	return nil, ErrInvalidSignature
+}
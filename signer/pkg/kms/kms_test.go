@@ -0,0 +1,215 @@
+package kms
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/ethtx"
+)
+
+// fakeKMS stands in for KMS with a local secp256k1 key
+type fakeKMS struct {
+	key     *ecdsa.PrivateKey
+	keySpec kmstypes.KeySpec
+	// highS returns the complement of the signature s value, KMS does not
+	// normalize it
+	highS bool
+
+	publicKeyCalls int
+}
+
+func newFakeKMS(t *testing.T) *fakeKMS {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	return &fakeKMS{key: key, keySpec: kmstypes.KeySpecEccSecgP256k1}
+}
+
+func (f *fakeKMS) Sign(_ context.Context, in *kms.SignInput, _ ...func(*kms.Options)) (*kms.SignOutput, error) {
+	sig, err := crypto.Sign(in.Message, f.key)
+	if err != nil {
+		return nil, err
+	}
+
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:64])
+
+	if f.highS {
+		s.Sub(secp256k1N, s)
+	}
+
+	der, err := asn1.Marshal(ecdsaSignature{R: r, S: s})
+	if err != nil {
+		return nil, err
+	}
+
+	return &kms.SignOutput{KeyId: in.KeyId, Signature: der}, nil
+}
+
+func (f *fakeKMS) GetPublicKey(_ context.Context, in *kms.GetPublicKeyInput, _ ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error) {
+	f.publicKeyCalls++
+
+	der, err := ethtx.MarshalPublicKey(&f.key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kms.GetPublicKeyOutput{KeyId: in.KeyId, KeySpec: f.keySpec, PublicKey: der}, nil
+}
+
+func (f *fakeKMS) ListKeys(context.Context, *kms.ListKeysInput, ...func(*kms.Options)) (*kms.ListKeysOutput, error) {
+	return &kms.ListKeysOutput{}, nil
+}
+
+func (f *fakeKMS) CreateKey(_ context.Context, in *kms.CreateKeyInput, _ ...func(*kms.Options)) (*kms.CreateKeyOutput, error) {
+	if in.KeySpec != kmstypes.KeySpecEccSecgP256k1 || in.KeyUsage != kmstypes.KeyUsageTypeSignVerify {
+		return nil, fmt.Errorf("unexpected key spec %s and usage %s", in.KeySpec, in.KeyUsage)
+	}
+
+	return &kms.CreateKeyOutput{KeyMetadata: &kmstypes.KeyMetadata{KeyId: aws.String("1234abcd-12ab-34cd-56ef-1234567890ab")}}, nil
+}
+
+func TestClient_GenerateKey(t *testing.T) {
+	c := newClient(&fakeKMS{}, big.NewInt(1))
+
+	keyID, err := c.GenerateKey(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "1234abcd-12ab-34cd-56ef-1234567890ab", keyID)
+}
+
+func TestClient_Sign(t *testing.T) {
+	to := common.HexToAddress("0xe004bb7a6cd6e00d3dabf717d809e665bdeaa671")
+	chainID := big.NewInt(614)
+
+	txs := map[string]*types.Transaction{
+		"legacy": types.NewTx(&types.LegacyTx{Nonce: 1, GasPrice: big.NewInt(1000), Gas: 21000, To: &to, Value: big.NewInt(10)}),
+		"dynamic fee": types.NewTx(&types.DynamicFeeTx{
+			ChainID: chainID, Nonce: 2, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(1000), Gas: 21000, To: &to, Value: big.NewInt(10),
+		}),
+	}
+
+	for _, highS := range []bool{false, true} {
+		for name, tx := range txs {
+			t.Run(fmt.Sprintf("%s high s %t", name, highS), func(t *testing.T) {
+				fake := newFakeKMS(t)
+				fake.highS = highS
+
+				c := newClient(fake, chainID)
+
+				signedTX, err := c.Sign(context.Background(), models.SignOptions{KeyID: "alias/hot-wallet", TX: tx})
+				require.NoError(t, err)
+
+				_, _, s := signedTX.RawSignatureValues()
+				require.True(t, s.Cmp(secp256k1HalfN) <= 0, "s must be in the lower half of the curve order")
+
+				sender, err := types.LatestSignerForChainID(chainID).Sender(signedTX)
+				require.NoError(t, err)
+				require.Equal(t, crypto.PubkeyToAddress(fake.key.PublicKey), sender)
+				require.Equal(t, chainID, signedTX.ChainId())
+			})
+		}
+	}
+}
+
+func TestClient_Sign_ChainSigner(t *testing.T) {
+	to := common.HexToAddress("0xe004bb7a6cd6e00d3dabf717d809e665bdeaa671")
+	chainID := big.NewInt(5)
+
+	tx := types.NewTx(&types.LegacyTx{Nonce: 1, GasPrice: big.NewInt(1000), Gas: 21000, To: &to, Value: big.NewInt(10)})
+
+	fake := newFakeKMS(t)
+
+	// no MARA_CHAIN_ID, the chain registry provides the signer
+	c := newClient(fake, nil)
+
+	_, err := c.Sign(context.Background(), models.SignOptions{KeyID: "alias/hot-wallet", TX: tx, ChainID: 5})
+	require.Error(t, err)
+
+	signedTX, err := c.Sign(context.Background(), models.SignOptions{
+		KeyID:   "alias/hot-wallet",
+		TX:      tx,
+		ChainID: 5,
+		Signer:  types.NewLondonSigner(chainID),
+	})
+	require.NoError(t, err)
+	require.Equal(t, chainID, signedTX.ChainId())
+
+	sender, err := types.LatestSignerForChainID(chainID).Sender(signedTX)
+	require.NoError(t, err)
+	require.Equal(t, crypto.PubkeyToAddress(fake.key.PublicKey), sender)
+}
+
+func TestClient_SignHash(t *testing.T) {
+	fake := newFakeKMS(t)
+	fake.highS = true
+
+	// no chain is needed to sign a digest
+	c := newClient(fake, nil)
+
+	digest := crypto.Keccak256([]byte("user operation"))
+
+	sig, err := c.SignHash(context.Background(), models.SignOptions{KeyID: "alias/hot-wallet", Digest: digest})
+	require.NoError(t, err)
+
+	publicKey, err := crypto.SigToPub(digest, sig)
+	require.NoError(t, err)
+	require.Equal(t, crypto.PubkeyToAddress(fake.key.PublicKey), crypto.PubkeyToAddress(*publicKey))
+
+	_, err = c.SignHash(context.Background(), models.SignOptions{KeyID: "alias/hot-wallet", Digest: digest[:20]})
+	require.Error(t, err)
+}
+
+func TestClient_Address(t *testing.T) {
+	fake := newFakeKMS(t)
+	c := newClient(fake, big.NewInt(1))
+
+	for i := 0; i < 2; i++ {
+		address, err := c.Address(context.Background(), "alias/hot-wallet")
+		require.NoError(t, err)
+		require.Equal(t, crypto.PubkeyToAddress(fake.key.PublicKey), address)
+	}
+
+	require.Equal(t, 1, fake.publicKeyCalls, "public keys are cached")
+
+	fake.keySpec = kmstypes.KeySpecEccNistP256
+
+	_, err := c.Address(context.Background(), "alias/other")
+	require.ErrorIs(t, err, ErrUnsupportedKey)
+}
+
+func TestEthereumSignature(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	other, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	hash := crypto.Keccak256([]byte("transaction"))
+
+	fake := &fakeKMS{key: key}
+	out, err := fake.Sign(context.Background(), &kms.SignInput{KeyId: aws.String("key"), Message: hash})
+	require.NoError(t, err)
+
+	sig, err := ethereumSignature(out.Signature, hash, &key.PublicKey)
+	require.NoError(t, err)
+	require.Len(t, sig, crypto.SignatureLength)
+
+	_, err = ethereumSignature(out.Signature, hash, &other.PublicKey)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	_, err = ethereumSignature([]byte{0x30, 0x01}, hash, &key.PublicKey)
+	require.Error(t, err)
+}
@@ -0,0 +1,346 @@
+// Package msgauth signs and verifies queue message bodies so consumers can tell
+// where a message came from. Keys are HMAC-SHA256 secrets or Ed25519 keys,
+// several of them can be active at once so they can be rotated
+package msgauth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	ddlambda "github.com/DataDog/datadog-lambda-go"
+	"github.com/aws/aws-lambda-go/events"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mara-labs/transactionsigner/config"
+)
+
+// message attributes carrying the signature of the body
+const (
+	KeyIDAttribute     = "signature_key_id"
+	SignatureAttribute = "signature"
+)
+
+// supported key algorithms
+const (
+	AlgorithmHMACSHA256 = "hmac-sha256"
+	AlgorithmEd25519    = "ed25519"
+)
+
+const unsignedMetric = "transaction_signer.message_auth.unsigned"
+
+// env variables the key lists are read from
+const (
+	inboundKeysEnv  = "MESSAGE_AUTH_INBOUND_KEYS"
+	outboundKeysEnv = "MESSAGE_AUTH_OUTBOUND_KEYS"
+)
+
+var (
+	// ErrUnsigned is returned for messages without a signature when
+	// signatures are required
+	ErrUnsigned = errors.New("message is not signed")
+	// ErrUnknownKey is returned for messages signed with a key that is not
+	// active
+	ErrUnknownKey = errors.New("message is signed with an unknown key")
+	// ErrInvalidSignature is returned when the signature does not match the
+	// body
+	ErrInvalidSignature = errors.New("message signature is invalid")
+)
+
+// keyConfig is a key as written in the key list
+type keyConfig struct {
+	ID        string `json:"id"`
+	Algorithm string `json:"algorithm"`
+	// Key is base64 encoded. HMAC keys are the shared secret, Ed25519 keys
+	// are the public key for verifying and the private key or its seed for
+	// signing
+	Key string `json:"key"`
+}
+
+type key struct {
+	id        string
+	algorithm string
+
+	secret  []byte
+	public  ed25519.PublicKey
+	private ed25519.PrivateKey
+}
+
+// parseKeys decodes a JSON list of keys. private selects whether Ed25519 keys
+// are private signing keys or public verification keys
+func parseKeys(raw string, private bool) ([]key, error) {
+	var configs []keyConfig
+
+	if err := json.Unmarshal([]byte(raw), &configs); err != nil {
+		return nil, fmt.Errorf("could not decode message keys: %w", err)
+	}
+
+	keys := make([]key, 0, len(configs))
+	seen := map[string]bool{}
+
+	for _, c := range configs {
+		if len(c.ID) == 0 {
+			return nil, errors.New("message keys need an id")
+		}
+
+		if seen[c.ID] {
+			return nil, fmt.Errorf("message key %s is listed twice", c.ID)
+		}
+
+		seen[c.ID] = true
+
+		material, err := base64.StdEncoding.DecodeString(c.Key)
+		if err != nil {
+			return nil, fmt.Errorf("message key %s is not base64 encoded: %w", c.ID, err)
+		}
+
+		k := key{id: c.ID, algorithm: strings.ToLower(c.Algorithm)}
+
+		switch {
+		case k.algorithm == AlgorithmHMACSHA256:
+			if len(material) < sha256.Size {
+				return nil, fmt.Errorf("hmac key %s must be at least %d bytes", c.ID, sha256.Size)
+			}
+
+			k.secret = material
+		case k.algorithm == AlgorithmEd25519 && private:
+			switch len(material) {
+			case ed25519.SeedSize:
+				k.private = ed25519.NewKeyFromSeed(material)
+			case ed25519.PrivateKeySize:
+				k.private = ed25519.PrivateKey(material)
+			default:
+				return nil, fmt.Errorf("ed25519 private key %s has an invalid size", c.ID)
+			}
+		case k.algorithm == AlgorithmEd25519:
+			if len(material) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("ed25519 public key %s has an invalid size", c.ID)
+			}
+
+			k.public = ed25519.PublicKey(material)
+		default:
+			return nil, fmt.Errorf("message key %s has an unsupported algorithm %q", c.ID, c.Algorithm)
+		}
+
+		keys = append(keys, k)
+	}
+
+	return keys, nil
+}
+
+func (k key) sign(body string) []byte {
+	if k.algorithm == AlgorithmEd25519 {
+		return ed25519.Sign(k.private, []byte(body))
+	}
+
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write([]byte(body))
+
+	return mac.Sum(nil)
+}
+
+func (k key) verify(body string, signature []byte) bool {
+	if k.algorithm == AlgorithmEd25519 {
+		return ed25519.Verify(k.public, []byte(body), signature)
+	}
+
+	return hmac.Equal(k.sign(body), signature)
+}
+
+// refreshRetryInterval is how long the keys in use are kept after their list
+// could not be reloaded before it is tried again
+const refreshRetryInterval = 30 * time.Second
+
+// keySource holds the keys parsed from a key list of the configuration. The
+// list is resolved again before the keys are used, secret references come
+// from the resolver cache until SECRETS_CACHE_TTL passed, and only parsed
+// again when it changed. The keys in use are kept when the list can not be
+// reloaded
+type keySource[T any] struct {
+	cfg   config.Configuration
+	name  string
+	parse func(raw string) (T, error)
+	now   func() time.Time
+
+	mu      sync.Mutex
+	raw     string
+	value   T
+	retryAt time.Time
+}
+
+func newKeySource[T any](cfg config.Configuration, name, raw string, parse func(string) (T, error)) (*keySource[T], error) {
+	value, err := parse(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return &keySource[T]{cfg: cfg, name: name, parse: parse, now: time.Now, raw: raw, value: value}, nil
+}
+
+// current returns the keys of the latest version of the list
+func (s *keySource[T]) current(ctx context.Context) T {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.now().Before(s.retryAt) {
+		return s.value
+	}
+
+	raw, err := config.SecretValue(ctx, s.cfg, s.name)
+	if err == nil && raw != s.raw {
+		var value T
+
+		if value, err = s.parse(raw); err == nil {
+			s.raw, s.value = raw, value
+
+			log.WithField("keys", s.name).Info("reloaded message keys")
+		}
+	}
+
+	if err != nil {
+		s.retryAt = s.now().Add(refreshRetryInterval)
+
+		log.WithField("keys", s.name).
+			WithError(err).
+			Error("could not reload message keys, the current ones are kept")
+	}
+
+	return s.value
+}
+
+// Verifier checks the signature of inbound messages
+type Verifier struct {
+	keys     *keySource[map[string]key]
+	required bool
+}
+
+// NewVerifier creates a verifier with the keys of MESSAGE_AUTH_INBOUND_KEYS.
+// It returns nil when there are no keys and signatures are not required
+func NewVerifier(cfg config.Configuration) (*Verifier, error) {
+	if len(strings.TrimSpace(cfg.MessageAuthInboundKeys)) == 0 {
+		if cfg.MessageAuthRequired {
+			return nil, errors.New("please provide the keys inbound messages are signed with")
+		}
+
+		return nil, nil
+	}
+
+	keys, err := newKeySource(cfg, inboundKeysEnv, cfg.MessageAuthInboundKeys, func(raw string) (map[string]key, error) {
+		keys, err := parseKeys(raw, false)
+		if err != nil {
+			return nil, err
+		}
+
+		byID := map[string]key{}
+		for _, k := range keys {
+			byID[k.id] = k
+		}
+
+		return byID, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Verifier{keys: keys, required: cfg.MessageAuthRequired}, nil
+}
+
+// Verify checks the signature of the body against the key named in the
+// attributes. Unsigned messages are only accepted while signatures are not
+// required, a nil verifier accepts every message
+func (v *Verifier) Verify(ctx context.Context, body string, attributes map[string]events.SQSMessageAttribute) error {
+	if v == nil {
+		return nil
+	}
+
+	keyID, signature := stringValue(attributes, KeyIDAttribute), stringValue(attributes, SignatureAttribute)
+
+	if len(keyID) == 0 && len(signature) == 0 {
+		if v.required {
+			return ErrUnsigned
+		}
+
+		ddlambda.Metric(unsignedMetric, 1)
+
+		return nil
+	}
+
+	k, ok := v.keys.current(ctx)[keyID]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || !k.verify(body, decoded) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// Signer signs outbound messages
+type Signer struct {
+	key *keySource[key]
+}
+
+// NewSigner creates a signer with the MESSAGE_AUTH_OUTBOUND_KEY_ID key of
+// MESSAGE_AUTH_OUTBOUND_KEYS, the first one when no ID is set. It returns nil
+// when there are no keys
+func NewSigner(cfg config.Configuration) (*Signer, error) {
+	if len(strings.TrimSpace(cfg.MessageAuthOutboundKeys)) == 0 {
+		return nil, nil
+	}
+
+	k, err := newKeySource(cfg, outboundKeysEnv, cfg.MessageAuthOutboundKeys, func(raw string) (key, error) {
+		keys, err := parseKeys(raw, true)
+		if err != nil {
+			return key{}, err
+		}
+
+		for _, k := range keys {
+			if len(cfg.MessageAuthOutboundKeyID) == 0 || k.id == cfg.MessageAuthOutboundKeyID {
+				return k, nil
+			}
+		}
+
+		return key{}, fmt.Errorf("outbound message key %q is not listed", cfg.MessageAuthOutboundKeyID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Signer{key: k}, nil
+}
+
+// Sign adds the signature of the body to the attributes. A nil signer leaves
+// them untouched
+func (s *Signer) Sign(ctx context.Context, body string, attributes map[string]events.SQSMessageAttribute) {
+	if s == nil {
+		return
+	}
+
+	k := s.key.current(ctx)
+
+	keyID := k.id
+	signature := base64.StdEncoding.EncodeToString(k.sign(body))
+
+	attributes[KeyIDAttribute] = events.SQSMessageAttribute{DataType: "String", StringValue: &keyID}
+	attributes[SignatureAttribute] = events.SQSMessageAttribute{DataType: "String", StringValue: &signature}
+}
+
+func stringValue(attributes map[string]events.SQSMessageAttribute, name string) string {
+	attribute, ok := attributes[name]
+	if !ok || attribute.StringValue == nil {
+		return ""
+	}
+
+	return *attribute.StringValue
+}
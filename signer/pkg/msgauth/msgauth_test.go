@@ -0,0 +1,272 @@
+package msgauth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/pkg/secrets"
+)
+
+func keyList(keys ...string) string { return "[" + strings.Join(keys, ",") + "]" }
+
+func keyEntry(id, algorithm string, material []byte) string {
+	return fmt.Sprintf(`{"id":%q,"algorithm":%q,"key":%q}`, id, algorithm, base64.StdEncoding.EncodeToString(material))
+}
+
+func TestSignVerify(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	rotated := []byte("fedcba9876543210fedcba9876543210")
+
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	verifier, err := NewVerifier(config.Configuration{
+		MessageAuthInboundKeys: keyList(
+			keyEntry("hmac-1", AlgorithmHMACSHA256, secret),
+			keyEntry("hmac-2", AlgorithmHMACSHA256, rotated),
+			keyEntry("ed25519-1", AlgorithmEd25519, public),
+		),
+		MessageAuthRequired: true,
+	})
+	require.NoError(t, err)
+
+	signed := func(keys, keyID string) map[string]events.SQSMessageAttribute {
+		signer, err := NewSigner(config.Configuration{MessageAuthOutboundKeys: keys, MessageAuthOutboundKeyID: keyID})
+		require.NoError(t, err)
+
+		attributes := map[string]events.SQSMessageAttribute{}
+		signer.Sign(context.Background(), `{"raw_tx":"eb80"}`, attributes)
+
+		return attributes
+	}
+
+	tt := []struct {
+		name       string
+		body       string
+		attributes map[string]events.SQSMessageAttribute
+		err        error
+	}{
+		{
+			name:       "hmac signature",
+			body:       `{"raw_tx":"eb80"}`,
+			attributes: signed(keyList(keyEntry("hmac-1", AlgorithmHMACSHA256, secret)), ""),
+		},
+		{
+			name: "rotated hmac key is active alongside the previous one",
+			body: `{"raw_tx":"eb80"}`,
+			attributes: signed(keyList(
+				keyEntry("hmac-1", AlgorithmHMACSHA256, secret),
+				keyEntry("hmac-2", AlgorithmHMACSHA256, rotated),
+			), "hmac-2"),
+		},
+		{
+			name:       "ed25519 signature",
+			body:       `{"raw_tx":"eb80"}`,
+			attributes: signed(keyList(keyEntry("ed25519-1", AlgorithmEd25519, private.Seed())), ""),
+		},
+		{
+			name:       "body was modified",
+			body:       `{"raw_tx":"eb81"}`,
+			attributes: signed(keyList(keyEntry("hmac-1", AlgorithmHMACSHA256, secret)), ""),
+			err:        ErrInvalidSignature,
+		},
+		{
+			name:       "key is not active",
+			body:       `{"raw_tx":"eb80"}`,
+			attributes: signed(keyList(keyEntry("hmac-3", AlgorithmHMACSHA256, secret)), ""),
+			err:        ErrUnknownKey,
+		},
+		{
+			name:       "key id of another key",
+			body:       `{"raw_tx":"eb80"}`,
+			attributes: signed(keyList(keyEntry("hmac-2", AlgorithmHMACSHA256, secret)), ""),
+			err:        ErrInvalidSignature,
+		},
+		{
+			name: "unsigned message",
+			body: `{"raw_tx":"eb80"}`,
+			err:  ErrUnsigned,
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			err := verifier.Verify(context.Background(), v.body, v.attributes)
+			if v.err != nil {
+				require.ErrorIs(t, err, v.err)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestNewVerifier(t *testing.T) {
+	// unsigned messages are accepted during rollout, signed ones are still
+	// checked
+	verifier, err := NewVerifier(config.Configuration{
+		MessageAuthInboundKeys: keyList(keyEntry("hmac-1", AlgorithmHMACSHA256, []byte("0123456789abcdef0123456789abcdef"))),
+	})
+	require.NoError(t, err)
+	require.NoError(t, verifier.Verify(context.Background(), "{}", nil))
+
+	keyID, signature := "hmac-1", "c2lnbmF0dXJl"
+	require.ErrorIs(t, verifier.Verify(context.Background(), "{}", map[string]events.SQSMessageAttribute{
+		KeyIDAttribute:     {DataType: "String", StringValue: &keyID},
+		SignatureAttribute: {DataType: "String", StringValue: &signature},
+	}), ErrInvalidSignature)
+
+	verifier, err = NewVerifier(config.Configuration{})
+	require.NoError(t, err)
+	require.Nil(t, verifier)
+	require.NoError(t, verifier.Verify(context.Background(), "{}", nil))
+
+	_, err = NewVerifier(config.Configuration{MessageAuthRequired: true})
+	require.Error(t, err)
+}
+
+func TestParseKeys(t *testing.T) {
+	tt := []struct {
+		name     string
+		keys     string
+		private  bool
+		hasError bool
+	}{
+		{
+			name: "valid keys",
+			keys: keyList(keyEntry("a", AlgorithmHMACSHA256, make([]byte, 32)), keyEntry("b", AlgorithmEd25519, make([]byte, 32))),
+		},
+		{
+			name:    "ed25519 private key",
+			keys:    keyList(keyEntry("a", AlgorithmEd25519, make([]byte, 64))),
+			private: true,
+		},
+		{
+			name:     "hmac key is too short",
+			keys:     keyList(keyEntry("a", AlgorithmHMACSHA256, make([]byte, 16))),
+			hasError: true,
+		},
+		{
+			name:     "ed25519 public key has the wrong size",
+			keys:     keyList(keyEntry("a", AlgorithmEd25519, make([]byte, 64))),
+			hasError: true,
+		},
+		{
+			name:     "duplicate key id",
+			keys:     keyList(keyEntry("a", AlgorithmHMACSHA256, make([]byte, 32)), keyEntry("a", AlgorithmHMACSHA256, make([]byte, 32))),
+			hasError: true,
+		},
+		{
+			name:     "unsupported algorithm",
+			keys:     keyList(keyEntry("a", "rsa", make([]byte, 32))),
+			hasError: true,
+		},
+		{
+			name:     "not base64",
+			keys:     `[{"id":"a","algorithm":"hmac-sha256","key":"%%%"}]`,
+			hasError: true,
+		},
+		{
+			name:     "not a list",
+			keys:     `{"id":"a"}`,
+			hasError: true,
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			_, err := parseKeys(v.keys, v.private)
+			if v.hasError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	rotated := []byte("fedcba9876543210fedcba9876543210")
+
+	path := filepath.Join(t.TempDir(), "keys")
+	writeKeys := func(keys string) {
+		require.NoError(t, os.WriteFile(path, []byte(keys), 0o600))
+	}
+
+	writeKeys(keyList(keyEntry("hmac-1", AlgorithmHMACSHA256, secret)))
+
+	// a resolver without cache, the list is read again on every message
+	resolver := secrets.NewResolver(0)
+	resolver.Register(secrets.SchemeFile, secrets.File{})
+
+	cfg := config.Configuration{
+		MessageAuthRequired: true,
+		Secrets:             resolver,
+		SecretReferences: map[string]string{
+			inboundKeysEnv:  "file://" + path,
+			outboundKeysEnv: "file://" + path,
+		},
+	}
+
+	cfg.MessageAuthInboundKeys, _ = resolver.Resolve(context.Background(), "file://"+path)
+	cfg.MessageAuthOutboundKeys = cfg.MessageAuthInboundKeys
+
+	verifier, err := NewVerifier(cfg)
+	require.NoError(t, err)
+
+	signer, err := NewSigner(cfg)
+	require.NoError(t, err)
+
+	signedWith := func(keyID string, secret []byte) map[string]events.SQSMessageAttribute {
+		s, err := NewSigner(config.Configuration{
+			MessageAuthOutboundKeys: keyList(keyEntry(keyID, AlgorithmHMACSHA256, secret)),
+		})
+		require.NoError(t, err)
+
+		attributes := map[string]events.SQSMessageAttribute{}
+		s.Sign(context.Background(), "{}", attributes)
+
+		return attributes
+	}
+
+	require.NoError(t, verifier.Verify(context.Background(), "{}", signedWith("hmac-1", secret)))
+	require.ErrorIs(t, verifier.Verify(context.Background(), "{}", signedWith("hmac-2", rotated)), ErrUnknownKey)
+
+	t.Run("rotated keys are picked up without a restart", func(t *testing.T) {
+		writeKeys(keyList(keyEntry("hmac-2", AlgorithmHMACSHA256, rotated)))
+
+		require.NoError(t, verifier.Verify(context.Background(), "{}", signedWith("hmac-2", rotated)))
+		require.ErrorIs(t, verifier.Verify(context.Background(), "{}", signedWith("hmac-1", secret)), ErrUnknownKey)
+
+		attributes := map[string]events.SQSMessageAttribute{}
+		signer.Sign(context.Background(), "{}", attributes)
+		require.Equal(t, "hmac-2", *attributes[KeyIDAttribute].StringValue)
+	})
+
+	t.Run("keys in use are kept when the list can not be reloaded", func(t *testing.T) {
+		writeKeys("not json")
+
+		require.NoError(t, verifier.Verify(context.Background(), "{}", signedWith("hmac-2", rotated)))
+
+		// the list is not read again until the retry interval passed
+		writeKeys(keyList(keyEntry("hmac-3", AlgorithmHMACSHA256, secret)))
+		require.ErrorIs(t, verifier.Verify(context.Background(), "{}", signedWith("hmac-3", secret)), ErrUnknownKey)
+
+		verifier.keys.retryAt = time.Time{}
+		require.NoError(t, verifier.Verify(context.Background(), "{}", signedWith("hmac-3", secret)))
+	})
+}
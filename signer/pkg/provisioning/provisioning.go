@@ -0,0 +1,136 @@
+// Package provisioning creates wallets. Keys are created in, and addresses
+// derived from, the same signer backends that sign for the wallets so the
+// stored address always matches the signing key
+package provisioning
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/chains"
+)
+
+// Backends creates keys and derives addresses, see registry.Registry
+type Backends interface {
+	GenerateKey(context.Context, models.SignOptions) (backend string, keyID string, err error)
+	DeriveAddress(context.Context, models.SignOptions) (common.Address, error)
+}
+
+// Request describes the wallet to provision
+type Request struct {
+	UserID      int64
+	ChainID     int64
+	NetworkType models.NetworkType
+	// KeyID derives the wallet at the next address index of an existing
+	// key, a new key is created when it is empty
+	KeyID string
+	// Backend selects the signer backend, empty uses the routing rules of
+	// the registry
+	Backend string
+	Account uint32
+}
+
+// Provisioner creates keys and wallets
+type Provisioner struct {
+	store         models.WalletProvisioner
+	backends      Backends
+	cfg           config.Configuration
+	chainRegistry *chains.Registry
+}
+
+// New creates a Provisioner storing wallets in store. The chain registry
+// tells which chains are testnets
+func New(cfg config.Configuration, store models.WalletProvisioner, backends Backends,
+	chainRegistry *chains.Registry,
+) *Provisioner {
+	return &Provisioner{
+		store:         store,
+		backends:      backends,
+		cfg:           cfg,
+		chainRegistry: chainRegistry,
+	}
+}
+
+// Provision creates the key when needed, derives the address of the next
+// address index of the key and stores the wallet with its derivation path
+func (p *Provisioner) Provision(ctx context.Context, req Request) (*models.SenderWallet, error) {
+	if req.UserID <= 0 {
+		return nil, errors.New("please provide the user the wallet belongs to")
+	}
+
+	switch req.NetworkType {
+	case models.NetworkTypeMainnet, models.NetworkTypeTestnet:
+	default:
+		return nil, fmt.Errorf("unknown network type %q", req.NetworkType)
+	}
+
+	if req.NetworkType == models.NetworkTypeMainnet && p.chainRegistry.IsTestnet(req.ChainID) {
+		return nil, fmt.Errorf("chain %d is a testnet, its wallets can not be mainnet wallets", req.ChainID)
+	}
+
+	coinType := config.BIP44CoinType(p.cfg, req.ChainID)
+
+	keyID := strings.TrimSpace(req.KeyID)
+	backend := req.Backend
+
+	if len(keyID) == 0 {
+		var err error
+
+		backend, keyID, err = p.backends.GenerateKey(ctx, models.SignOptions{
+			Backend: req.Backend,
+			ChainID: req.ChainID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not create key: %w", err)
+		}
+
+		log.WithField("backend", backend).
+			WithField("key_id", keyID).
+			Info("created key")
+	}
+
+	wallet, err := p.store.CreateWallet(ctx, models.CreateWalletOptions{
+		UserID:        req.UserID,
+		ChainID:       req.ChainID,
+		NetworkType:   req.NetworkType,
+		KeyID:         keyID,
+		SignerBackend: backend,
+		Purpose:       models.BIP44Purpose,
+		CoinType:      coinType,
+		Account:       req.Account,
+	}, func(ctx context.Context, derivationPath []uint32) (string, error) {
+		if err := models.ValidateDerivationPath(derivationPath, coinType); err != nil {
+			return "", err
+		}
+
+		address, err := p.backends.DeriveAddress(ctx, models.SignOptions{
+			KeyID:          keyID,
+			DerivationPath: derivationPath,
+			Backend:        backend,
+			ChainID:        req.ChainID,
+		})
+		if err != nil {
+			return "", fmt.Errorf("could not derive address: %w", err)
+		}
+
+		return address.Hex(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithField("wallet_id", wallet.ID).
+		WithField("address", wallet.Address).
+		WithField("key_id", wallet.KeyID).
+		WithField("address_index", wallet.AddressIndex).
+		Info("provisioned wallet")
+
+	return wallet, nil
+}
@@ -0,0 +1,136 @@
+package provisioning
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/chains"
+)
+
+// memoryStore hands out address indexes per key like the postgres store
+type memoryStore struct {
+	wallets []models.SenderWallet
+	options []models.CreateWalletOptions
+}
+
+func (m *memoryStore) CreateWallet(ctx context.Context, opts models.CreateWalletOptions, address models.AddressFunc) (*models.SenderWallet, error) {
+	addressIndex := 0
+
+	for _, wallet := range m.wallets {
+		if wallet.KeyID == opts.KeyID && wallet.AddressIndex >= addressIndex {
+			addressIndex = wallet.AddressIndex + 1
+		}
+	}
+
+	path := models.DerivationPath{
+		Purpose:      opts.Purpose,
+		CoinType:     opts.CoinType,
+		Account:      opts.Account,
+		Change:       opts.Change,
+		AddressIndex: uint32(addressIndex),
+	}
+
+	walletAddress, err := address(ctx, path.Path(path.AddressIndex))
+	if err != nil {
+		return nil, err
+	}
+
+	wallet := models.SenderWallet{
+		ID:            int64(len(m.wallets) + 1),
+		Address:       walletAddress,
+		ChainID:       int(opts.ChainID),
+		KeyID:         opts.KeyID,
+		AddressIndex:  addressIndex,
+		SignerBackend: opts.SignerBackend,
+	}
+
+	m.wallets = append(m.wallets, wallet)
+	m.options = append(m.options, opts)
+
+	return &wallet, nil
+}
+
+type fakeBackends struct {
+	generated int
+	paths     [][]uint32
+}
+
+func (f *fakeBackends) GenerateKey(_ context.Context, opts models.SignOptions) (string, string, error) {
+	f.generated++
+
+	backend := opts.Backend
+	if len(backend) == 0 {
+		backend = "sepior"
+	}
+
+	return backend, "new-key", nil
+}
+
+func (f *fakeBackends) DeriveAddress(_ context.Context, opts models.SignOptions) (common.Address, error) {
+	if opts.KeyID == "unknown" {
+		return common.Address{}, errors.New("key not found")
+	}
+
+	f.paths = append(f.paths, opts.DerivationPath)
+
+	return common.BigToAddress(common.Big1), nil
+}
+
+func TestProvisioner_Provision(t *testing.T) {
+	ctx := context.Background()
+
+	store := &memoryStore{}
+	backends := &fakeBackends{}
+
+	cfg := config.Configuration{
+		BIP44CoinTypes:  map[int64]uint32{614: 614},
+		TestnetChainIDs: []int64{5},
+	}
+
+	chainRegistry, err := chains.New(cfg)
+	require.NoError(t, err)
+
+	p := New(cfg, store, backends, chainRegistry)
+
+	t.Run("a new key is created when none is given", func(t *testing.T) {
+		wallet, err := p.Provision(ctx, Request{UserID: 12, ChainID: 614, NetworkType: models.NetworkTypeMainnet})
+		require.NoError(t, err)
+		require.Equal(t, "new-key", wallet.KeyID)
+		require.Equal(t, "sepior", wallet.SignerBackend)
+		require.Equal(t, 0, wallet.AddressIndex)
+		require.Equal(t, common.BigToAddress(common.Big1).Hex(), wallet.Address)
+		require.Equal(t, 1, backends.generated)
+		require.Equal(t, []uint32{44, 614, 0, 0, 0}, backends.paths[0])
+	})
+
+	t.Run("existing keys get the next address index", func(t *testing.T) {
+		wallet, err := p.Provision(ctx, Request{UserID: 12, ChainID: 1, NetworkType: models.NetworkTypeMainnet, KeyID: "new-key", Account: 2})
+		require.NoError(t, err)
+		require.Equal(t, 1, wallet.AddressIndex)
+		require.Equal(t, 1, backends.generated)
+		require.Equal(t, []uint32{44, 60, 2, 0, 1}, backends.paths[1])
+	})
+
+	t.Run("nothing is stored when the address can not be derived", func(t *testing.T) {
+		_, err := p.Provision(ctx, Request{UserID: 12, ChainID: 1, NetworkType: models.NetworkTypeMainnet, KeyID: "unknown"})
+		require.ErrorContains(t, err, "key not found")
+		require.Len(t, store.wallets, 2)
+	})
+
+	t.Run("requests are validated", func(t *testing.T) {
+		_, err := p.Provision(ctx, Request{ChainID: 1, NetworkType: models.NetworkTypeMainnet})
+		require.Error(t, err)
+
+		_, err = p.Provision(ctx, Request{UserID: 12, ChainID: 1, NetworkType: "devnet"})
+		require.Error(t, err)
+
+		_, err = p.Provision(ctx, Request{UserID: 12, ChainID: 5, NetworkType: models.NetworkTypeMainnet})
+		require.ErrorContains(t, err, "testnet")
+	})
+}
@@ -0,0 +1,301 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/chains"
+	"github.com/mara-labs/transactionsigner/pkg/ethtx"
+	"github.com/mara-labs/transactionsigner/pkg/msgauth"
+)
+
+// MemoryBroker holds in memory queues by name. Clients of the same broker
+// share its queues, so a test can feed the read queue of the signer
+type MemoryBroker struct {
+	mu       sync.Mutex
+	queues   map[string]*memoryQueue
+	sequence int64
+
+	now func() time.Time
+}
+
+type memoryQueue struct {
+	messages []*memoryMessage
+	// added is closed and replaced whenever a message is added, so long
+	// polls wake up
+	added chan struct{}
+}
+
+type memoryMessage struct {
+	id           string
+	body         string
+	attributes   map[string]events.SQSMessageAttribute
+	sent         time.Time
+	visibleAt    time.Time
+	receiveCount int
+}
+
+// NewMemoryBroker creates a broker without any queue
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		queues: map[string]*memoryQueue{},
+		now:    time.Now,
+	}
+}
+
+// queue returns the named queue, creating it on first use. The caller holds
+// the lock
+func (b *MemoryBroker) queue(name string) *memoryQueue {
+	q, ok := b.queues[name]
+	if !ok {
+		q = &memoryQueue{added: make(chan struct{})}
+		b.queues[name] = q
+	}
+
+	return q
+}
+
+// Memory is a queue client of a MemoryBroker
+type Memory struct {
+	broker *MemoryBroker
+
+	router        *Router
+	readQueueName string
+
+	visibilityTimeout time.Duration
+	waitTime          time.Duration
+
+	auth *msgauth.Signer
+}
+
+// NewMemory creates a client writing to and reading from the queues of the
+// broker named in the configuration
+func NewMemory(broker *MemoryBroker, cfg config.Configuration, chainRegistry *chains.Registry) (*Memory, error) {
+	router, err := NewRouter(cfg, chainRegistry)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := msgauth.NewSigner(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Memory{
+		broker:            broker,
+		router:            router,
+		readQueueName:     cfg.SQSReadQueueName,
+		visibilityTimeout: visibilityTimeout(cfg.WorkerVisibilityTimeout),
+		waitTime:          cfg.WorkerWaitTime,
+		auth:              auth,
+	}, nil
+}
+
+// Close is a no-op, the messages live as long as the broker
+func (m *Memory) Close() error { return nil }
+
+// Add appends the item to the output queue of its chain
+func (m *Memory) Add(ctx context.Context, item models.SignedTXQueueItem) error {
+	body, err := Encode(item)
+	if err != nil {
+		return err
+	}
+
+	tx, _ := ethtx.Decode(item.SignedTX)
+
+	queueName, err := m.router.RouteItem(item, tx)
+	if err != nil {
+		return err
+	}
+
+	return m.send(ctx, queueName, body, Attributes(ctx, item, tx))
+}
+
+// AddUserOperation appends the signed user operation to the user operation
+// queue of its chain
+func (m *Memory) AddUserOperation(ctx context.Context, item models.SignedUserOperationQueueItem) error {
+	body, err := Encode(item)
+	if err != nil {
+		return err
+	}
+
+	queueName, err := m.router.RouteUserOperation(item.ChainID)
+	if err != nil {
+		return err
+	}
+
+	return m.send(ctx, queueName, body, UserOperationAttributes(ctx, item))
+}
+
+func (m *Memory) send(ctx context.Context, queueName string, body string, attributes map[string]events.SQSMessageAttribute) error {
+	m.auth.Sign(ctx, body, attributes)
+
+	b := m.broker
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sequence++
+	now := b.now()
+
+	q := b.queue(queueName)
+	q.messages = append(q.messages, &memoryMessage{
+		id:         strconv.FormatInt(b.sequence, 10),
+		body:       body,
+		attributes: attributes,
+		sent:       now,
+		visibleAt:  now,
+	})
+
+	close(q.added)
+	q.added = make(chan struct{})
+
+	return nil
+}
+
+// Receive returns up to maxMessages visible messages in the order they were
+// added, waiting for the configured wait time when there are none
+func (m *Memory) Receive(ctx context.Context, maxMessages int) ([]events.SQSMessage, error) {
+	if len(m.readQueueName) == 0 {
+		return nil, errors.New("please provide the name of the queue to read from")
+	}
+
+	timer := time.NewTimer(m.waitTime)
+	defer timer.Stop()
+
+	for {
+		messages, added := m.receive(maxMessages)
+		if len(messages) != 0 {
+			return messages, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+			messages, _ = m.receive(maxMessages)
+			return messages, nil
+		case <-added:
+		}
+	}
+}
+
+// receive hides and returns the visible messages of the read queue. When
+// there are none it returns the channel closed by the next Add
+func (m *Memory) receive(maxMessages int) ([]events.SQSMessage, <-chan struct{}) {
+	b := m.broker
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	q := b.queue(m.readQueueName)
+
+	var messages []events.SQSMessage
+
+	for _, msg := range q.messages {
+		if len(messages) == maxMessages {
+			break
+		}
+
+		if msg.visibleAt.After(now) {
+			continue
+		}
+
+		msg.receiveCount++
+		msg.visibleAt = now.Add(m.visibilityTimeout)
+
+		messages = append(messages, events.SQSMessage{
+			MessageId:         msg.id,
+			ReceiptHandle:     receiptHandle(msg.id, msg.receiveCount),
+			Body:              msg.body,
+			Attributes:        receivedAttributes(msg.sent, msg.receiveCount),
+			MessageAttributes: msg.attributes,
+			EventSource:       "memory",
+		})
+	}
+
+	return messages, q.added
+}
+
+// Delete removes the message from the read queue
+func (m *Memory) Delete(_ context.Context, receiptHandle string) error {
+	return m.find(receiptHandle, func(q *memoryQueue, i int) {
+		q.messages = append(q.messages[:i], q.messages[i+1:]...)
+	})
+}
+
+// ExtendVisibility hides the message from other consumers for the given
+// timeout. A zero timeout makes the message visible again right away
+func (m *Memory) ExtendVisibility(_ context.Context, receiptHandle string, timeout time.Duration) error {
+	return m.find(receiptHandle, func(q *memoryQueue, i int) {
+		q.messages[i].visibleAt = m.broker.now().Add(timeout)
+
+		if timeout == 0 {
+			close(q.added)
+			q.added = make(chan struct{})
+		}
+	})
+}
+
+// find calls fn with the message the receipt handle was issued for, as long
+// as it was not received again since
+func (m *Memory) find(handle string, fn func(q *memoryQueue, i int)) error {
+	id, receiveCount, err := parseReceiptHandle(handle)
+	if err != nil {
+		return err
+	}
+
+	b := m.broker
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q := b.queue(m.readQueueName)
+
+	for i, msg := range q.messages {
+		if msg.id == id && msg.receiveCount == receiveCount {
+			fn(q, i)
+			return nil
+		}
+	}
+
+	return ErrInvalidReceiptHandle
+}
+
+// receiptHandle identifies a single receive of a message, so a consumer whose
+// visibility timeout expired can not delete the message from under the next
+// one
+func receiptHandle(id string, receiveCount int) string {
+	return fmt.Sprintf("%s.%d", id, receiveCount)
+}
+
+func parseReceiptHandle(handle string) (string, int, error) {
+	id, count, ok := strings.Cut(handle, ".")
+	if !ok {
+		return "", 0, ErrInvalidReceiptHandle
+	}
+
+	receiveCount, err := strconv.Atoi(count)
+	if err != nil {
+		return "", 0, ErrInvalidReceiptHandle
+	}
+
+	return id, receiveCount, nil
+}
+
+func receivedAttributes(sent time.Time, receiveCount int) map[string]string {
+	return map[string]string{
+		receiveCountAttribute:  strconv.Itoa(receiveCount),
+		sentTimestampAttribute: strconv.FormatInt(sent.UnixMilli(), 10),
+	}
+}
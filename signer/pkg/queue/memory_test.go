@@ -0,0 +1,110 @@
+package queue_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/msgauth"
+	"github.com/mara-labs/transactionsigner/pkg/queue"
+	"github.com/mara-labs/transactionsigner/pkg/queue/queuetest"
+)
+
+func TestMemory(t *testing.T) {
+	queuetest.Run(t, func(t *testing.T) queuetest.Queue {
+		q, err := queue.NewMemory(queue.NewMemoryBroker(), config.Configuration{
+			SQSWriteQueueName:       "signed-transactions",
+			SQSReadQueueName:        "signed-transactions",
+			UserOperationQueueName:  "signed-transactions",
+			WorkerWaitTime:          100 * time.Millisecond,
+			WorkerVisibilityTimeout: time.Minute,
+		}, nil)
+		require.NoError(t, err)
+
+		return q
+	})
+}
+
+func TestMemory_SharedBroker(t *testing.T) {
+	broker := queue.NewMemoryBroker()
+
+	producer, err := queue.NewMemory(broker, config.Configuration{SQSWriteQueueName: "created-transactions"}, nil)
+	require.NoError(t, err)
+
+	signer, err := queue.NewMemory(broker, config.Configuration{
+		SQSWriteQueueName: "signed-transactions",
+		SQSReadQueueName:  "created-transactions",
+		WorkerWaitTime:    time.Minute,
+	}, nil)
+	require.NoError(t, err)
+
+	received := make(chan []events.SQSMessage, 1)
+
+	go func() {
+		messages, _ := signer.Receive(context.Background(), 10)
+		received <- messages
+	}()
+
+	// the long poll wakes up as soon as the item is added
+	require.NoError(t, producer.Add(context.Background(), models.SignedTXQueueItem{ID: "1"}))
+
+	select {
+	case messages := <-received:
+		require.Len(t, messages, 1)
+	case <-time.After(5 * time.Second):
+		t.Fatal("long poll did not return")
+	}
+
+	// a stale receipt handle is rejected
+	require.ErrorIs(t, signer.Delete(context.Background(), "1.2"), queue.ErrInvalidReceiptHandle)
+	require.NoError(t, signer.Delete(context.Background(), "1.1"))
+}
+
+func TestMemory_SignsMessages(t *testing.T) {
+	keys := `[{"id":"signer-1","algorithm":"hmac-sha256","key":"MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="}]`
+
+	q, err := queue.NewMemory(queue.NewMemoryBroker(), config.Configuration{
+		SQSWriteQueueName:       "signed-transactions",
+		SQSReadQueueName:        "signed-transactions",
+		MessageAuthOutboundKeys: keys,
+	}, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, q.Add(context.Background(), models.SignedTXQueueItem{ID: "1"}))
+
+	messages, err := q.Receive(context.Background(), 1)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+
+	verifier, err := msgauth.NewVerifier(config.Configuration{MessageAuthInboundKeys: keys, MessageAuthRequired: true})
+	require.NoError(t, err)
+
+	require.NoError(t, verifier.Verify(context.Background(), messages[0].Body, messages[0].MessageAttributes))
+}
+
+func TestMemory_RoutesByChain(t *testing.T) {
+	broker := queue.NewMemoryBroker()
+
+	signer, err := queue.NewMemory(broker, config.Configuration{OutputQueueRoutes: "1=signed_eth,614=signed_mara"}, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, signer.Add(context.Background(), models.SignedTXQueueItem{ID: "1", ChainID: 614}))
+	require.ErrorIs(t, signer.Add(context.Background(), models.SignedTXQueueItem{ID: "2", ChainID: 5}), queue.ErrNoRoute)
+
+	for queueName, expected := range map[string]int{"signed_eth": 0, "signed_mara": 1} {
+		broadcaster, err := queue.NewMemory(broker, config.Configuration{
+			SQSWriteQueueName: "unused",
+			SQSReadQueueName:  queueName,
+		}, nil)
+		require.NoError(t, err)
+
+		messages, err := broadcaster.Receive(context.Background(), 10)
+		require.NoError(t, err)
+		require.Len(t, messages, expected, queueName)
+	}
+}
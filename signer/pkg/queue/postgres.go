@@ -0,0 +1,257 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/lib/pq"
+	sqltrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/database/sql"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/chains"
+	"github.com/mara-labs/transactionsigner/pkg/ethtx"
+	"github.com/mara-labs/transactionsigner/pkg/msgauth"
+)
+
+// pollInterval is how often an empty queue is checked again while long
+// polling
+const pollInterval = 250 * time.Millisecond
+
+// Postgres is a queue kept in the queue_messages table. Consumers lock the
+// rows they receive with SKIP LOCKED so several of them can share a queue
+type Postgres struct {
+	db *sql.DB
+
+	router        *Router
+	readQueueName string
+
+	visibilityTimeout time.Duration
+	waitTime          time.Duration
+
+	auth *msgauth.Signer
+}
+
+// NewPostgres connects to the queue database, the transactions database
+// unless QUEUE_POSTGRES_DSN is set
+func NewPostgres(cfg config.Configuration, chainRegistry *chains.Registry) (*Postgres, error) {
+	dsn := cfg.QueuePostgresDSN
+	if len(dsn) == 0 {
+		dsn = cfg.TransactionsPostgresDSN
+	}
+
+	sqltrace.Register("pq", &pq.Driver{})
+
+	db, err := sqltrace.Open("pq", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("could not ping queue db...%v", err)
+	}
+
+	return NewPostgresWithDB(db, cfg, chainRegistry)
+}
+
+// NewPostgresWithDB creates a queue on top of an open connection
+func NewPostgresWithDB(db *sql.DB, cfg config.Configuration, chainRegistry *chains.Registry) (*Postgres, error) {
+	router, err := NewRouter(cfg, chainRegistry)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := msgauth.NewSigner(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Postgres{
+		db:                db,
+		router:            router,
+		readQueueName:     cfg.SQSReadQueueName,
+		visibilityTimeout: visibilityTimeout(cfg.WorkerVisibilityTimeout),
+		waitTime:          cfg.WorkerWaitTime,
+		auth:              auth,
+	}, nil
+}
+
+// Close shuts down the underlying db connection
+func (p *Postgres) Close() error { return p.db.Close() }
+
+// Add inserts the item into the output queue of its chain
+func (p *Postgres) Add(ctx context.Context, item models.SignedTXQueueItem) error {
+	body, err := Encode(item)
+	if err != nil {
+		return err
+	}
+
+	tx, _ := ethtx.Decode(item.SignedTX)
+
+	queueName, err := p.router.RouteItem(item, tx)
+	if err != nil {
+		return err
+	}
+
+	return p.send(ctx, queueName, body, Attributes(ctx, item, tx))
+}
+
+// AddUserOperation inserts the signed user operation into the user operation
+// queue of its chain
+func (p *Postgres) AddUserOperation(ctx context.Context, item models.SignedUserOperationQueueItem) error {
+	body, err := Encode(item)
+	if err != nil {
+		return err
+	}
+
+	queueName, err := p.router.RouteUserOperation(item.ChainID)
+	if err != nil {
+		return err
+	}
+
+	return p.send(ctx, queueName, body, UserOperationAttributes(ctx, item))
+}
+
+func (p *Postgres) send(ctx context.Context, queueName string, body string, attributes map[string]events.SQSMessageAttribute) error {
+	p.auth.Sign(ctx, body, attributes)
+
+	encoded, err := json.Marshal(attributes)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.ExecContext(ctx,
+		`INSERT INTO queue_messages (queue, body, attributes) VALUES ($1, $2, $3)`,
+		queueName, body, encoded)
+
+	return err
+}
+
+// Receive returns up to maxMessages visible messages in the order they were
+// added, polling for the configured wait time when there are none
+func (p *Postgres) Receive(ctx context.Context, maxMessages int) ([]events.SQSMessage, error) {
+	if len(p.readQueueName) == 0 {
+		return nil, errors.New("please provide the name of the queue to read from")
+	}
+
+	deadline := time.Now().Add(p.waitTime)
+
+	for {
+		messages, err := p.receive(ctx, maxMessages)
+		if err != nil || len(messages) != 0 || !time.Now().Before(deadline) {
+			return messages, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func (p *Postgres) receive(ctx context.Context, maxMessages int) ([]events.SQSMessage, error) {
+	// RETURNING does not keep the order of the subquery, hence the outer
+	// select
+	rows, err := p.db.QueryContext(ctx, `
+		WITH received AS (
+			UPDATE queue_messages
+			SET receive_count = receive_count + 1,
+				visible_at = now() + $3 * interval '1 millisecond'
+			WHERE id IN (
+				SELECT id FROM queue_messages
+				WHERE queue = $1 AND visible_at <= now()
+				ORDER BY id
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, body, attributes, receive_count, created_at
+		)
+		SELECT id, body, attributes, receive_count, created_at FROM received ORDER BY id`,
+		p.readQueueName, maxMessages, p.visibilityTimeout.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var messages []events.SQSMessage
+
+	for rows.Next() {
+		var (
+			id           int64
+			body         string
+			attributes   []byte
+			receiveCount int
+			created      time.Time
+		)
+
+		if err := rows.Scan(&id, &body, &attributes, &receiveCount, &created); err != nil {
+			return nil, err
+		}
+
+		msg := events.SQSMessage{
+			MessageId:     strconv.FormatInt(id, 10),
+			ReceiptHandle: receiptHandle(strconv.FormatInt(id, 10), receiveCount),
+			Body:          body,
+			Attributes:    receivedAttributes(created, receiveCount),
+			EventSource:   "postgres",
+		}
+
+		if err := json.Unmarshal(attributes, &msg.MessageAttributes); err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// Delete removes the message from the read queue
+func (p *Postgres) Delete(ctx context.Context, receiptHandle string) error {
+	return p.exec(ctx, receiptHandle, `DELETE FROM queue_messages WHERE id = $1 AND receive_count = $2`)
+}
+
+// ExtendVisibility hides the message from other consumers for the given
+// timeout. A zero timeout makes the message visible again right away
+func (p *Postgres) ExtendVisibility(ctx context.Context, receiptHandle string, timeout time.Duration) error {
+	return p.exec(ctx, receiptHandle,
+		`UPDATE queue_messages SET visible_at = now() + $3 * interval '1 millisecond' WHERE id = $1 AND receive_count = $2`,
+		timeout.Milliseconds())
+}
+
+// exec runs a statement on the message the receipt handle was issued for, as
+// long as it was not received again since
+func (p *Postgres) exec(ctx context.Context, handle, query string, args ...any) error {
+	id, receiveCount, err := parseReceiptHandle(handle)
+	if err != nil {
+		return err
+	}
+
+	result, err := p.db.ExecContext(ctx, query, append([]any{id, receiveCount}, args...)...)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrInvalidReceiptHandle
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+// Package queue implements queues that do not depend on AWS, one kept in
+// memory for tests and local runs and one backed by a postgres table. Messages
+// are shaped like the SQS ones so the worker and the handler can not tell them
+// apart
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/tracing"
+)
+
+// message attributes set on signed transactions and user operations
+const (
+	TransactionIDAttribute = "transaction_id"
+	ChainIDAttribute       = "chain_id"
+	TxHashAttribute        = "tx_hash"
+	UserOpHashAttribute    = "user_op_hash"
+)
+
+// attributes of received messages, named like the SQS ones
+const (
+	receiveCountAttribute  = "ApproximateReceiveCount"
+	sentTimestampAttribute = "SentTimestamp"
+)
+
+// defaultVisibilityTimeout matches the default of SQS queues
+const defaultVisibilityTimeout = 30 * time.Second
+
+// ErrInvalidReceiptHandle is returned for receipt handles of messages that were
+// deleted or received again since
+var ErrInvalidReceiptHandle = errors.New("receipt handle is no longer valid")
+
+// Encode marshals the queue item into a message body
+func Encode(item any) (string, error) {
+	var b bytes.Buffer
+
+	if err := json.NewEncoder(&b).Encode(item); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// Attributes builds the message attributes of a signed transaction. The
+// current trace context and the transaction ID, chain ID and hash travel with
+// the message so consumers can continue the trace and filter without decoding
+// the body. A nil tx only leaves out the attributes derived from it
+func Attributes(ctx context.Context, item models.SignedTXQueueItem, tx *ethtypes.Transaction) map[string]events.SQSMessageAttribute {
+	attributes := map[string]events.SQSMessageAttribute{}
+
+	if traceContext, ok := tracing.Inject(ctx); ok {
+		attributes[tracing.Attribute] = stringAttribute(traceContext)
+	}
+
+	if len(item.TransactionID) != 0 {
+		attributes[TransactionIDAttribute] = stringAttribute(item.TransactionID)
+	}
+
+	if tx != nil {
+		chainID := tx.ChainId().String()
+
+		attributes[ChainIDAttribute] = events.SQSMessageAttribute{DataType: "Number", StringValue: &chainID}
+		attributes[TxHashAttribute] = stringAttribute(tx.Hash().Hex())
+	}
+
+	return attributes
+}
+
+// UserOperationAttributes builds the message attributes of a signed user
+// operation, the trace context, transaction ID, chain ID and user operation
+// hash
+func UserOperationAttributes(ctx context.Context, item models.SignedUserOperationQueueItem) map[string]events.SQSMessageAttribute {
+	attributes := map[string]events.SQSMessageAttribute{}
+
+	if traceContext, ok := tracing.Inject(ctx); ok {
+		attributes[tracing.Attribute] = stringAttribute(traceContext)
+	}
+
+	if len(item.TransactionID) != 0 {
+		attributes[TransactionIDAttribute] = stringAttribute(item.TransactionID)
+	}
+
+	chainID := strconv.FormatInt(item.ChainID, 10)
+
+	attributes[ChainIDAttribute] = events.SQSMessageAttribute{DataType: "Number", StringValue: &chainID}
+	attributes[UserOpHashAttribute] = stringAttribute(item.UserOpHash)
+
+	return attributes
+}
+
+func stringAttribute(value string) events.SQSMessageAttribute {
+	return events.SQSMessageAttribute{DataType: "String", StringValue: &value}
+}
+
+func visibilityTimeout(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return defaultVisibilityTimeout
+	}
+
+	return timeout
+}
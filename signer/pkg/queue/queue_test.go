@@ -0,0 +1,47 @@
+package queue
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/tracing"
+)
+
+func TestAttributes(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	tx, err := types.SignNewTx(key, types.LatestSignerForChainID(big.NewInt(614)), &types.LegacyTx{Nonce: 1, GasPrice: big.NewInt(1), Gas: 21000})
+	require.NoError(t, err)
+
+	span, ctx := tracer.StartSpanFromContext(context.Background(), "Transaction.SignTransaction")
+	defer span.Finish()
+
+	attributes := Attributes(ctx, models.SignedTXQueueItem{TransactionID: "transaction"}, tx)
+
+	require.Equal(t, "transaction", *attributes[TransactionIDAttribute].StringValue)
+	require.Equal(t, "614", *attributes[ChainIDAttribute].StringValue)
+	require.Equal(t, "Number", attributes[ChainIDAttribute].DataType)
+	require.Equal(t, tx.Hash().Hex(), *attributes[TxHashAttribute].StringValue)
+
+	spanContext, ok := tracing.Extract(map[string]events.SQSMessageAttribute{
+		tracing.Attribute: attributes[tracing.Attribute],
+	})
+	require.True(t, ok)
+	require.Equal(t, span.Context().TraceID(), spanContext.TraceID())
+
+	// nothing is derived from items without a span or a transaction
+	require.Empty(t, Attributes(context.Background(), models.SignedTXQueueItem{}, nil))
+}
@@ -0,0 +1,231 @@
+// Package queuetest is the conformance suite every queue implementation is
+// run against, so the worker and the handler can rely on the same behavior
+// whichever backend is configured
+package queuetest
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/ethtx"
+)
+
+// Queue is a queue written to and read from by the same client
+type Queue interface {
+	models.Queue
+	models.Consumer
+}
+
+// Factory creates an empty queue whose write, user operation and read queue
+// are the same.
+// Received messages must stay hidden for longer than the suite runs and
+// receives must not wait more than a few seconds
+type Factory func(t *testing.T) Queue
+
+// Run runs the conformance suite against the queues created by newQueue
+func Run(t *testing.T, newQueue Factory) {
+	t.Run("added items are received with their attributes", func(t *testing.T) {
+		q := newQueue(t)
+		item := signedItem(t, 1)
+
+		require.NoError(t, q.Add(context.Background(), item))
+
+		messages := receive(t, q, 1)
+		msg := messages[0]
+
+		require.NotEmpty(t, msg.MessageId)
+		require.NotEmpty(t, msg.ReceiptHandle)
+
+		var received models.SignedTXQueueItem
+		require.NoError(t, json.Unmarshal([]byte(msg.Body), &received))
+		require.Equal(t, item, received)
+
+		tx, err := ethtx.Decode(item.SignedTX)
+		require.NoError(t, err)
+
+		require.Equal(t, item.TransactionID, *msg.MessageAttributes["transaction_id"].StringValue)
+		require.Equal(t, "614", *msg.MessageAttributes["chain_id"].StringValue)
+		require.Equal(t, tx.Hash().Hex(), *msg.MessageAttributes["tx_hash"].StringValue)
+
+		deleteAll(t, q, messages)
+	})
+
+	t.Run("added user operations are received with their attributes", func(t *testing.T) {
+		q := newQueue(t)
+		item := userOperationItem()
+
+		require.NoError(t, q.AddUserOperation(context.Background(), item))
+
+		messages := receive(t, q, 1)
+		msg := messages[0]
+
+		var received models.SignedUserOperationQueueItem
+		require.NoError(t, json.Unmarshal([]byte(msg.Body), &received))
+		require.Equal(t, item, received)
+
+		require.Equal(t, item.TransactionID, *msg.MessageAttributes["transaction_id"].StringValue)
+		require.Equal(t, "614", *msg.MessageAttributes["chain_id"].StringValue)
+		require.Equal(t, item.UserOpHash, *msg.MessageAttributes["user_op_hash"].StringValue)
+
+		deleteAll(t, q, messages)
+	})
+
+	t.Run("received messages are hidden until they are released", func(t *testing.T) {
+		q := newQueue(t)
+
+		require.NoError(t, q.Add(context.Background(), signedItem(t, 1)))
+
+		msg := receive(t, q, 1)[0]
+
+		require.Empty(t, receiveNow(t, q))
+
+		require.NoError(t, q.ExtendVisibility(context.Background(), msg.ReceiptHandle, 0))
+
+		again := receive(t, q, 1)[0]
+		require.Equal(t, msg.MessageId, again.MessageId)
+		require.Equal(t, msg.Body, again.Body)
+
+		deleteAll(t, q, []events.SQSMessage{again})
+	})
+
+	t.Run("deleted messages are not received again", func(t *testing.T) {
+		q := newQueue(t)
+
+		require.NoError(t, q.Add(context.Background(), signedItem(t, 1)))
+		require.NoError(t, q.Add(context.Background(), signedItem(t, 2)))
+
+		messages := receive(t, q, 2)
+
+		require.NoError(t, q.Delete(context.Background(), messages[0].ReceiptHandle))
+		require.NoError(t, q.ExtendVisibility(context.Background(), messages[1].ReceiptHandle, 0))
+
+		again := receive(t, q, 1)
+		require.Equal(t, messages[1].MessageId, again[0].MessageId)
+
+		deleteAll(t, q, again)
+	})
+
+	t.Run("receive respects the batch size", func(t *testing.T) {
+		q := newQueue(t)
+
+		for i := uint64(1); i <= 3; i++ {
+			require.NoError(t, q.Add(context.Background(), signedItem(t, i)))
+		}
+
+		messages, err := q.Receive(context.Background(), 2)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(messages), 2)
+
+		messages = append(messages, receive(t, q, 3-len(messages))...)
+		require.Len(t, messages, 3)
+
+		deleteAll(t, q, messages)
+	})
+}
+
+// receive collects n messages, standard SQS queues may hand them out over
+// several receives
+func receive(t *testing.T, q Queue, n int) []events.SQSMessage {
+	t.Helper()
+
+	var messages []events.SQSMessage
+
+	deadline := time.Now().Add(30 * time.Second)
+
+	for len(messages) < n && time.Now().Before(deadline) {
+		received, err := q.Receive(context.Background(), n-len(messages))
+		require.NoError(t, err)
+
+		messages = append(messages, received...)
+	}
+
+	require.Len(t, messages, n)
+
+	return messages
+}
+
+// deleteAll leaves nothing behind for queues that are shared between tests
+func deleteAll(t *testing.T, q Queue, messages []events.SQSMessage) {
+	t.Helper()
+
+	for _, msg := range messages {
+		require.NoError(t, q.Delete(context.Background(), msg.ReceiptHandle))
+	}
+}
+
+// receiveNow receives without waiting for the configured wait time
+func receiveNow(t *testing.T, q Queue) []events.SQSMessage {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	messages, err := q.Receive(ctx, 10)
+	if ctx.Err() == nil {
+		require.NoError(t, err)
+	}
+
+	return messages
+}
+
+func signedItem(t *testing.T, nonce uint64) models.SignedTXQueueItem {
+	t.Helper()
+
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	to := common.HexToAddress("0xe004bb7a6cd6e00d3dabf717d809e665bdeaa671")
+
+	tx, err := types.SignNewTx(key, types.LatestSignerForChainID(big.NewInt(614)), &types.DynamicFeeTx{
+		ChainID:   big.NewInt(614),
+		Nonce:     nonce,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(1),
+		Gas:       21000,
+		To:        &to,
+	})
+	require.NoError(t, err)
+
+	return models.SignedTXQueueItem{
+		ID:            tx.Hash().Hex(),
+		SignedTX:      ethtx.Encode(tx),
+		TransactionID: "transaction-" + tx.Hash().Hex()[2:10],
+	}
+}
+
+func userOperationItem() models.SignedUserOperationQueueItem {
+	return models.SignedUserOperationQueueItem{
+		ID:            "0x8f2d1e5ab1b4b6e0b3c8d1e8a7f0c2b3d4e5f60718293a4b5c6d7e8f90a1b2c3",
+		TransactionID: "transaction-user-operation",
+		UserOperation: models.UserOperation{
+			Sender:               common.HexToAddress("0x6ac7ea33f8831ea9dcc53393aaa88b25a785dbf0"),
+			Nonce:                (*hexutil.Big)(big.NewInt(1)),
+			InitCode:             hexutil.Bytes{},
+			CallData:             hexutil.Bytes{0xb6, 0x1d, 0x27, 0xf6},
+			CallGasLimit:         (*hexutil.Big)(big.NewInt(35000)),
+			VerificationGasLimit: (*hexutil.Big)(big.NewInt(70000)),
+			PreVerificationGas:   (*hexutil.Big)(big.NewInt(21000)),
+			MaxFeePerGas:         (*hexutil.Big)(big.NewInt(1)),
+			MaxPriorityFeePerGas: (*hexutil.Big)(big.NewInt(1)),
+			PaymasterAndData:     hexutil.Bytes{},
+			Signature:            make(hexutil.Bytes, crypto.SignatureLength),
+		},
+		UserOpHash:         "0x8f2d1e5ab1b4b6e0b3c8d1e8a7f0c2b3d4e5f60718293a4b5c6d7e8f90a1b2c3",
+		EntryPoint:         "0x5FF137D4b0FDCD49DcA30c7CF57E578a026d2789",
+		ChainID:            614,
+		WalletRowID:        1,
+		UserOperationRowID: 1,
+		SignedAt:           time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
@@ -0,0 +1,134 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/chains"
+)
+
+// ErrNoRoute is returned for signed transactions of chains without an output
+// queue when there is no fallback queue
+var ErrNoRoute = errors.New("no output queue for the chain")
+
+// Router picks the queue a signed transaction is written to. The queue of the
+// chain and priority in OUTPUT_QUEUE_ROUTES wins, then the queue of the chain,
+// the write_queue of the chain in the chain registry and finally the fallback
+// queue SQS_WRITE_QUEUE_NAME. Signed user operations go to the
+// user_operation_queue of their chain or USER_OPERATION_QUEUE_NAME
+type Router struct {
+	routes   map[string]string
+	fallback string
+
+	userOperations        map[int64]string
+	userOperationFallback string
+}
+
+// NewRouter loads the routes of OUTPUT_QUEUE_ROUTES and the write queues of
+// the chain registry
+func NewRouter(cfg config.Configuration, chainRegistry *chains.Registry) (*Router, error) {
+	r := &Router{
+		routes:   map[string]string{},
+		fallback: strings.TrimSpace(cfg.SQSWriteQueueName),
+
+		userOperations:        map[int64]string{},
+		userOperationFallback: strings.TrimSpace(cfg.UserOperationQueueName),
+	}
+
+	for _, chainID := range chainRegistry.IDs() {
+		chain, _ := chainRegistry.Lookup(chainID)
+
+		if len(chain.WriteQueue) != 0 {
+			r.routes[routeKey(chainID, "")] = chain.WriteQueue
+		}
+
+		if len(chain.UserOperationQueue) != 0 {
+			r.userOperations[chainID] = chain.UserOperationQueue
+		}
+	}
+
+	for _, route := range strings.Split(cfg.OutputQueueRoutes, ",") {
+		route = strings.TrimSpace(route)
+		if len(route) == 0 {
+			continue
+		}
+
+		key, queueName, ok := strings.Cut(route, "=")
+		if !ok || len(strings.TrimSpace(queueName)) == 0 {
+			return nil, fmt.Errorf("invalid OUTPUT_QUEUE_ROUTES route %q, expected chain_id[:priority]=queue", route)
+		}
+
+		chain, priority, _ := strings.Cut(strings.TrimSpace(key), ":")
+
+		chainID, err := strconv.ParseInt(chain, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OUTPUT_QUEUE_ROUTES chain id %q: %w", chain, err)
+		}
+
+		r.routes[routeKey(chainID, priority)] = strings.TrimSpace(queueName)
+	}
+
+	if len(r.routes) == 0 && len(r.fallback) == 0 {
+		return nil, errors.New("please provide the name of the queue to write to")
+	}
+
+	return r, nil
+}
+
+// Route returns the queue of a signed transaction on the chain with the given
+// priority, an empty priority is the default one
+func (r *Router) Route(chainID int64, priority string) (string, error) {
+	if len(priority) != 0 {
+		if queueName, ok := r.routes[routeKey(chainID, priority)]; ok {
+			return queueName, nil
+		}
+	}
+
+	if queueName, ok := r.routes[routeKey(chainID, "")]; ok {
+		return queueName, nil
+	}
+
+	if len(r.fallback) != 0 {
+		return r.fallback, nil
+	}
+
+	return "", fmt.Errorf("%w: %d", ErrNoRoute, chainID)
+}
+
+// RouteItem routes the signed transaction by the chain of the item, or of the
+// transaction for items without one
+func (r *Router) RouteItem(item models.SignedTXQueueItem, tx *ethtypes.Transaction) (string, error) {
+	chainID := item.ChainID
+	if chainID == 0 && tx != nil {
+		chainID = tx.ChainId().Int64()
+	}
+
+	return r.Route(chainID, item.Priority)
+}
+
+// RouteUserOperation returns the queue of a signed user operation on the chain
+func (r *Router) RouteUserOperation(chainID int64) (string, error) {
+	if queueName, ok := r.userOperations[chainID]; ok {
+		return queueName, nil
+	}
+
+	if len(r.userOperationFallback) != 0 {
+		return r.userOperationFallback, nil
+	}
+
+	return "", fmt.Errorf("%w: user operations of %d", ErrNoRoute, chainID)
+}
+
+func routeKey(chainID int64, priority string) string {
+	if len(priority) == 0 {
+		return strconv.FormatInt(chainID, 10)
+	}
+
+	return strconv.FormatInt(chainID, 10) + ":" + strings.ToLower(priority)
+}
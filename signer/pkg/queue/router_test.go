@@ -0,0 +1,103 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/chains"
+)
+
+func newChainRegistry(t *testing.T, cfg config.Configuration) *chains.Registry {
+	t.Helper()
+
+	chainRegistry, err := chains.New(cfg)
+	require.NoError(t, err)
+
+	return chainRegistry
+}
+
+func TestRouter_Route(t *testing.T) {
+	cfg := config.Configuration{
+		SQSWriteQueueName: "signed_transactions",
+		OutputQueueRoutes: "1=signed_eth, 1:high=signed_eth_fast,5=signed_goerli",
+		ChainRegistry:     `[{"chain_id":5,"network_type":"testnet","write_queue":"signed_goerli_registry"},{"chain_id":614,"network_type":"mainnet","write_queue":"signed_mara"}]`,
+	}
+
+	r, err := NewRouter(cfg, newChainRegistry(t, cfg))
+	require.NoError(t, err)
+
+	tt := []struct {
+		name     string
+		chainID  int64
+		priority string
+		expected string
+	}{
+		{name: "chain", chainID: 1, expected: "signed_eth"},
+		{name: "chain and priority", chainID: 1, priority: "HIGH", expected: "signed_eth_fast"},
+		{name: "priority without a queue of its own", chainID: 1, priority: "low", expected: "signed_eth"},
+		{name: "route wins over the chain registry", chainID: 5, expected: "signed_goerli"},
+		{name: "write queue of the chain registry", chainID: 614, expected: "signed_mara"},
+		{name: "fallback", chainID: 137, expected: "signed_transactions"},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			queueName, err := r.Route(v.chainID, v.priority)
+			require.NoError(t, err)
+			require.Equal(t, v.expected, queueName)
+		})
+	}
+}
+
+func TestRouter_WithoutFallback(t *testing.T) {
+	r, err := NewRouter(config.Configuration{OutputQueueRoutes: "1=signed_eth"}, nil)
+	require.NoError(t, err)
+
+	queueName, err := r.RouteItem(models.SignedTXQueueItem{ChainID: 1}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "signed_eth", queueName)
+
+	_, err = r.RouteItem(models.SignedTXQueueItem{ChainID: 137}, nil)
+	require.ErrorIs(t, err, ErrNoRoute)
+}
+
+func TestNewRouter_Invalid(t *testing.T) {
+	for _, cfg := range []config.Configuration{
+		{},
+		{OutputQueueRoutes: "1"},
+		{OutputQueueRoutes: "1="},
+		{OutputQueueRoutes: "mainnet=signed_eth"},
+	} {
+		_, err := NewRouter(cfg, nil)
+		require.Error(t, err, cfg.OutputQueueRoutes)
+	}
+}
+
+func TestRouter_RouteUserOperation(t *testing.T) {
+	cfg := config.Configuration{
+		SQSWriteQueueName:      "signed_transactions",
+		UserOperationQueueName: "user_operations",
+		ChainRegistry:          `[{"chain_id":1,"network_type":"mainnet","user_operation_queue":"user_operations_eth"},{"chain_id":614,"network_type":"mainnet"}]`,
+	}
+
+	r, err := NewRouter(cfg, newChainRegistry(t, cfg))
+	require.NoError(t, err)
+
+	queueName, err := r.RouteUserOperation(1)
+	require.NoError(t, err)
+	require.Equal(t, "user_operations_eth", queueName)
+
+	queueName, err = r.RouteUserOperation(614)
+	require.NoError(t, err)
+	require.Equal(t, "user_operations", queueName)
+
+	// signed transactions never fall back to the user operation queue
+	r, err = NewRouter(config.Configuration{SQSWriteQueueName: "signed_transactions"}, nil)
+	require.NoError(t, err)
+
+	_, err = r.RouteUserOperation(1)
+	require.ErrorIs(t, err, ErrNoRoute)
+}
@@ -0,0 +1,288 @@
+// Package registry routes signatures to the backend that holds the key of a
+// wallet so several custody backends can be used side by side
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/models"
+)
+
+var (
+	// ErrBackendNotConfigured is returned when a wallet or a route points to
+	// a backend that was not initialized
+	ErrBackendNotConfigured = errors.New("signer backend is not configured")
+	// ErrNoRoute is returned when no rule selects a backend for the wallet
+	ErrNoRoute = errors.New("no signer backend matches the wallet")
+	// ErrMisroutedKey is returned when the backend assigned to a wallet
+	// disagrees with the backend its key ID is routed to
+	ErrMisroutedKey = errors.New("key is routed to a different signer backend")
+)
+
+type prefixRoute struct {
+	prefix  string
+	backend string
+}
+
+// Registry implements models.Signer by delegating to one of several backends.
+// The backend is selected, in order, by the signer_backend of the wallet, the
+// prefix of its key ID, its chain ID and finally the default backend
+type Registry struct {
+	backends       map[string]models.Signer
+	defaultBackend string
+	prefixes       []prefixRoute
+	chains         map[int64]string
+}
+
+// New creates a registry from the routing rules in the configuration. Every
+// backend a rule points to must be part of backends
+func New(cfg config.Configuration, backends map[string]models.Signer) (*Registry, error) {
+	if len(backends) == 0 {
+		return nil, errors.New("please configure at least one signer backend")
+	}
+
+	r := &Registry{
+		backends:       backends,
+		defaultBackend: strings.TrimSpace(cfg.SignerDefaultBackend),
+		chains:         map[int64]string{},
+	}
+
+	if len(r.defaultBackend) != 0 {
+		if _, ok := backends[r.defaultBackend]; !ok {
+			return nil, fmt.Errorf("SIGNER_DEFAULT_BACKEND %s: %w", r.defaultBackend, ErrBackendNotConfigured)
+		}
+	}
+
+	prefixes, err := parseRoutes(cfg.SignerKeyPrefixRoutes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SIGNER_KEY_PREFIX_ROUTES: %w", err)
+	}
+
+	for prefix, backend := range prefixes {
+		if _, ok := backends[backend]; !ok {
+			return nil, fmt.Errorf("SIGNER_KEY_PREFIX_ROUTES %s=%s: %w", prefix, backend, ErrBackendNotConfigured)
+		}
+
+		r.prefixes = append(r.prefixes, prefixRoute{prefix: prefix, backend: backend})
+	}
+
+	// the longest prefix wins when several of them match
+	sort.Slice(r.prefixes, func(i, j int) bool {
+		return len(r.prefixes[i].prefix) > len(r.prefixes[j].prefix)
+	})
+
+	chains, err := parseRoutes(cfg.SignerChainRoutes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SIGNER_CHAIN_ROUTES: %w", err)
+	}
+
+	for chain, backend := range chains {
+		chainID, err := strconv.ParseInt(chain, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SIGNER_CHAIN_ROUTES chain id %q: %w", chain, err)
+		}
+
+		if _, ok := backends[backend]; !ok {
+			return nil, fmt.Errorf("SIGNER_CHAIN_ROUTES %s=%s: %w", chain, backend, ErrBackendNotConfigured)
+		}
+
+		r.chains[chainID] = backend
+	}
+
+	return r, nil
+}
+
+// Sign signs the transaction with the backend selected for the wallet
+func (r *Registry) Sign(ctx context.Context, opts models.SignOptions) (*types.Transaction, error) {
+	name, signer, err := r.Resolve(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	signedTX, err := signer.Sign(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return signedTX, nil
+}
+
+// SignHash signs the digest of opts with the backend selected for the wallet
+func (r *Registry) SignHash(ctx context.Context, opts models.SignOptions) ([]byte, error) {
+	name, signer, err := r.Resolve(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	hashSigner, ok := signer.(models.HashSigner)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, models.ErrHashSigningUnsupported)
+	}
+
+	sig, err := hashSigner.SignHash(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return sig, nil
+}
+
+// DeriveAddress derives the address of the key and derivation path of opts
+// with the backend selected for the wallet
+func (r *Registry) DeriveAddress(ctx context.Context, opts models.SignOptions) (common.Address, error) {
+	name, signer, err := r.Resolve(opts)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	deriver, ok := signer.(models.PublicKeyDeriver)
+	if !ok {
+		return common.Address{}, fmt.Errorf("%s: %w", name, models.ErrPublicKeyUnsupported)
+	}
+
+	publicKey, err := deriver.PublicKey(ctx, opts.KeyID, opts.DerivationPath)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return crypto.PubkeyToAddress(*publicKey), nil
+}
+
+// GenerateKey creates a key with the backend selected by opts, only its
+// Backend and ChainID are used as the key does not exist yet. It returns the
+// name of the backend along with the key ID
+func (r *Registry) GenerateKey(ctx context.Context, opts models.SignOptions) (string, string, error) {
+	name, signer, err := r.Resolve(opts)
+	if err != nil {
+		return "", "", err
+	}
+
+	generator, ok := signer.(models.KeyGenerator)
+	if !ok {
+		return "", "", fmt.Errorf("%s: %w", name, models.ErrKeyGenerationUnsupported)
+	}
+
+	keyID, err := generator.GenerateKey(ctx)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", name, err)
+	}
+
+	return name, keyID, nil
+}
+
+// Resolve returns the name of the backend selected for the wallet and the
+// backend itself
+func (r *Registry) Resolve(opts models.SignOptions) (string, models.Signer, error) {
+	name, err := r.route(opts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	signer, ok := r.backends[name]
+	if !ok {
+		return "", nil, fmt.Errorf("key %s is assigned to %s: %w", opts.KeyID, name, ErrBackendNotConfigured)
+	}
+
+	return name, signer, nil
+}
+
+func (r *Registry) route(opts models.SignOptions) (string, error) {
+	prefixBackend, prefix, hasPrefix := r.matchPrefix(opts.KeyID)
+
+	if len(opts.Backend) != 0 {
+		if hasPrefix && prefixBackend != opts.Backend {
+			return "", fmt.Errorf("key %s matches prefix %q of %s but its wallet is assigned to %s: %w",
+				opts.KeyID, prefix, prefixBackend, opts.Backend, ErrMisroutedKey)
+		}
+
+		return opts.Backend, nil
+	}
+
+	if hasPrefix {
+		return prefixBackend, nil
+	}
+
+	if backend, ok := r.chains[opts.ChainID]; ok {
+		return backend, nil
+	}
+
+	if len(r.defaultBackend) != 0 {
+		return r.defaultBackend, nil
+	}
+
+	return "", fmt.Errorf("key %s on chain %d: %w", opts.KeyID, opts.ChainID, ErrNoRoute)
+}
+
+func (r *Registry) matchPrefix(keyID string) (backend, prefix string, ok bool) {
+	for _, route := range r.prefixes {
+		if strings.HasPrefix(keyID, route.prefix) {
+			return route.backend, route.prefix, true
+		}
+	}
+
+	return "", "", false
+}
+
+// Backends returns the names of the configured backends
+func (r *Registry) Backends() []string {
+	names := make([]string, 0, len(r.backends))
+
+	for name := range r.backends {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// HealthCheck checks every backend that supports it. The returned error
+// names each unhealthy backend
+func (r *Registry) HealthCheck(ctx context.Context) error {
+	var errs []error
+
+	for _, name := range r.Backends() {
+		checker, ok := r.backends[name].(models.HealthChecker)
+		if !ok {
+			continue
+		}
+
+		if err := checker.HealthCheck(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("signer backend %s is unhealthy: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// parseRoutes parses comma separated key=backend pairs. The last = splits
+// the pair as key ID prefixes may contain one
+func parseRoutes(value string) (map[string]string, error) {
+	routes := map[string]string{}
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
+			continue
+		}
+
+		i := strings.LastIndex(part, "=")
+		if i <= 0 || i == len(part)-1 {
+			return nil, fmt.Errorf("%q should be in key=backend format", part)
+		}
+
+		routes[part[:i]] = strings.TrimSpace(part[i+1:])
+	}
+
+	return routes, nil
+}
@@ -0,0 +1,226 @@
+package registry
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/models"
+)
+
+type fakeBackend struct {
+	healthErr error
+	signed    int
+}
+
+func (f *fakeBackend) Sign(_ context.Context, opts models.SignOptions) (*types.Transaction, error) {
+	f.signed++
+	return opts.TX, nil
+}
+
+func (f *fakeBackend) HealthCheck(context.Context) error { return f.healthErr }
+
+func TestRegistry_Resolve(t *testing.T) {
+	backends := map[string]models.Signer{
+		"sepior": &fakeBackend{},
+		"kms":    &fakeBackend{},
+	}
+
+	cfg := config.Configuration{
+		SignerDefaultBackend:  "sepior",
+		SignerKeyPrefixRoutes: "arn:aws:kms:=kms, arn:aws:kms:eu-west-2:123:key/legacy-=sepior",
+		SignerChainRoutes:     "5=kms",
+	}
+
+	r, err := New(cfg, backends)
+	require.NoError(t, err)
+
+	tt := []struct {
+		name     string
+		opts     models.SignOptions
+		expected string
+		err      error
+	}{
+		{
+			name:     "wallet backend",
+			opts:     models.SignOptions{KeyID: "MizBEqdhZ160syGCPFxYo6Lkxbiw", Backend: "kms"},
+			expected: "kms",
+		},
+		{
+			name:     "key prefix",
+			opts:     models.SignOptions{KeyID: "arn:aws:kms:eu-west-2:123:key/abc"},
+			expected: "kms",
+		},
+		{
+			name:     "longest key prefix",
+			opts:     models.SignOptions{KeyID: "arn:aws:kms:eu-west-2:123:key/legacy-abc"},
+			expected: "sepior",
+		},
+		{
+			name:     "chain id",
+			opts:     models.SignOptions{KeyID: "MizBEqdhZ160syGCPFxYo6Lkxbiw", ChainID: 5},
+			expected: "kms",
+		},
+		{
+			name:     "default",
+			opts:     models.SignOptions{KeyID: "MizBEqdhZ160syGCPFxYo6Lkxbiw", ChainID: 1},
+			expected: "sepior",
+		},
+		{
+			name: "wallet backend disagrees with key prefix",
+			opts: models.SignOptions{KeyID: "arn:aws:kms:eu-west-2:123:key/abc", Backend: "sepior"},
+			err:  ErrMisroutedKey,
+		},
+		{
+			name: "wallet backend is not configured",
+			opts: models.SignOptions{KeyID: "MizBEqdhZ160syGCPFxYo6Lkxbiw", Backend: "hsm"},
+			err:  ErrBackendNotConfigured,
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			name, signer, err := r.Resolve(v.opts)
+			if v.err != nil {
+				require.ErrorIs(t, err, v.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, v.expected, name)
+			require.Same(t, backends[v.expected], signer)
+		})
+	}
+}
+
+func TestRegistry_Sign(t *testing.T) {
+	kms := &fakeBackend{}
+
+	r, err := New(config.Configuration{}, map[string]models.Signer{"kms": kms})
+	require.NoError(t, err)
+
+	tx := types.NewTx(&types.LegacyTx{})
+
+	_, err = r.Sign(context.Background(), models.SignOptions{TX: tx})
+	require.ErrorIs(t, err, ErrNoRoute)
+
+	signedTX, err := r.Sign(context.Background(), models.SignOptions{TX: tx, Backend: "kms"})
+	require.NoError(t, err)
+	require.Equal(t, tx, signedTX)
+	require.Equal(t, 1, kms.signed)
+}
+
+// fakeHashSigner is a backend that signs digests with a local key
+type fakeHashSigner struct {
+	fakeBackend
+	key *ecdsa.PrivateKey
+}
+
+func (f *fakeHashSigner) SignHash(_ context.Context, opts models.SignOptions) ([]byte, error) {
+	return crypto.Sign(opts.Digest, f.key)
+}
+
+func TestRegistry_SignHash(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	r, err := New(config.Configuration{}, map[string]models.Signer{
+		"sepior": &fakeHashSigner{key: key},
+		"kms":    &fakeBackend{},
+	})
+	require.NoError(t, err)
+
+	digest := crypto.Keccak256([]byte("user operation"))
+
+	sig, err := r.SignHash(context.Background(), models.SignOptions{Backend: "sepior", Digest: digest})
+	require.NoError(t, err)
+
+	publicKey, err := crypto.SigToPub(digest, sig)
+	require.NoError(t, err)
+	require.Equal(t, key.PublicKey, *publicKey)
+
+	_, err = r.SignHash(context.Background(), models.SignOptions{Backend: "kms", Digest: digest})
+	require.ErrorIs(t, err, models.ErrHashSigningUnsupported)
+
+	_, err = r.SignHash(context.Background(), models.SignOptions{Digest: digest})
+	require.ErrorIs(t, err, ErrNoRoute)
+}
+
+// fakeDeriver is a backend that derives a fixed key
+type fakeDeriver struct {
+	fakeBackend
+	key *ecdsa.PrivateKey
+}
+
+func (f *fakeDeriver) PublicKey(context.Context, string, []uint32) (*ecdsa.PublicKey, error) {
+	return &f.key.PublicKey, nil
+}
+
+func TestRegistry_DeriveAddress(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	r, err := New(config.Configuration{}, map[string]models.Signer{
+		"sepior": &fakeDeriver{key: key},
+		"kms":    &fakeBackend{},
+	})
+	require.NoError(t, err)
+
+	address, err := r.DeriveAddress(context.Background(), models.SignOptions{Backend: "sepior"})
+	require.NoError(t, err)
+	require.Equal(t, crypto.PubkeyToAddress(key.PublicKey), address)
+
+	_, err = r.DeriveAddress(context.Background(), models.SignOptions{Backend: "kms"})
+	require.ErrorIs(t, err, models.ErrPublicKeyUnsupported)
+}
+
+func TestNew(t *testing.T) {
+	backends := map[string]models.Signer{"sepior": &fakeBackend{}}
+
+	tt := []struct {
+		name string
+		cfg  config.Configuration
+	}{
+		{
+			name: "unknown default backend",
+			cfg:  config.Configuration{SignerDefaultBackend: "kms"},
+		},
+		{
+			name: "prefix routed to an unknown backend",
+			cfg:  config.Configuration{SignerKeyPrefixRoutes: "arn:aws:kms:=kms"},
+		},
+		{
+			name: "invalid chain id",
+			cfg:  config.Configuration{SignerChainRoutes: "mainnet=sepior"},
+		},
+		{
+			name: "missing backend",
+			cfg:  config.Configuration{SignerChainRoutes: "1="},
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			_, err := New(v.cfg, backends)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestRegistry_HealthCheck(t *testing.T) {
+	r, err := New(config.Configuration{}, map[string]models.Signer{
+		"sepior": &fakeBackend{},
+		"kms":    &fakeBackend{healthErr: errors.New("access denied")},
+	})
+	require.NoError(t, err)
+
+	err = r.HealthCheck(context.Background())
+	require.ErrorContains(t, err, "signer backend kms is unhealthy: access denied")
+	require.NotContains(t, err.Error(), "sepior")
+}
@@ -0,0 +1,224 @@
+// Package resilience wraps signers with retries and a circuit breaker so
+// transient outages of a signing backend are absorbed instead of failing every
+// message
+package resilience
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"time"
+
+	ddlambda "github.com/DataDog/datadog-lambda-go"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/ethereum/go-ethereum/core/types"
+	log "github.com/sirupsen/logrus"
+	"github.com/sony/gobreaker"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/models"
+)
+
+const (
+	retryMetric        = "transaction_signer.signer.retry"
+	rejectedMetric     = "transaction_signer.signer.breaker_rejected"
+	breakerStateMetric = "transaction_signer.signer.breaker_state"
+)
+
+// ErrCircuitOpen is returned without contacting the backend while it is
+// considered unhealthy
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Signer retries the wrapped signer with exponential backoff and jitter and
+// stops calling it while its circuit breaker is open
+type Signer struct {
+	name        string
+	next        models.Signer
+	isRetryable func(error) bool
+	breaker     *gobreaker.CircuitBreaker
+
+	maxAttempts     int
+	initialInterval time.Duration
+	maxInterval     time.Duration
+}
+
+// New wraps next. isRetryable classifies the errors of next, errors that are
+// not retryable are returned straight away and, unless the backend did not
+// answer before the deadline, do not count against its health
+func New(name string, next models.Signer, cfg config.Configuration, isRetryable func(error) bool) *Signer {
+	s := &Signer{
+		name:            name,
+		next:            next,
+		isRetryable:     isRetryable,
+		maxAttempts:     cfg.SignerRetryMaxAttempts,
+		initialInterval: cfg.SignerRetryInitialInterval,
+		maxInterval:     cfg.SignerRetryMaxInterval,
+	}
+
+	if s.maxAttempts <= 0 {
+		s.maxAttempts = 1
+	}
+
+	threshold := cfg.SignerBreakerFailureThreshold
+
+	s.breaker = gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		Name:        name,
+		MaxRequests: cfg.SignerBreakerHalfOpenRequests,
+		Timeout:     cfg.SignerBreakerOpenTimeout,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return threshold > 0 && counts.ConsecutiveFailures >= threshold
+		},
+		IsSuccessful: func(err error) bool {
+			return err == nil || (!isRetryable(err) && !errors.Is(err, context.DeadlineExceeded))
+		},
+		OnStateChange: onStateChange,
+	})
+
+	return s
+}
+
+// Sign signs the transaction, retrying retryable failures until the attempts
+// or the deadline of ctx run out
+func (s *Signer) Sign(ctx context.Context, opts models.SignOptions) (*types.Transaction, error) {
+	result, err := s.retry(ctx, opts, func() (interface{}, error) {
+		return s.next.Sign(ctx, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*types.Transaction), nil
+}
+
+// SignHash signs the digest through the wrapped signer, retried like
+// transactions
+func (s *Signer) SignHash(ctx context.Context, opts models.SignOptions) ([]byte, error) {
+	hashSigner, ok := s.next.(models.HashSigner)
+	if !ok {
+		return nil, models.ErrHashSigningUnsupported
+	}
+
+	result, err := s.retry(ctx, opts, func() (interface{}, error) {
+		return hashSigner.SignHash(ctx, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.([]byte), nil
+}
+
+// retry calls sign through the circuit breaker until it succeeds, fails with
+// an error that is not retryable or the attempts or the deadline of ctx run
+// out
+func (s *Signer) retry(ctx context.Context, opts models.SignOptions,
+	sign func() (interface{}, error),
+) (interface{}, error) {
+	var signed interface{}
+
+	attempt := 0
+
+	operation := func() error {
+		attempt++
+
+		result, err := s.breaker.Execute(sign)
+		if errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests) {
+			ddlambda.Metric(rejectedMetric, 1, "backend:"+s.name)
+			return backoff.Permanent(fmt.Errorf("%w: %s", ErrCircuitOpen, s.name))
+		}
+
+		if err != nil {
+			if !s.isRetryable(err) {
+				return backoff.Permanent(err)
+			}
+
+			return err
+		}
+
+		signed = result
+
+		return nil
+	}
+
+	notify := func(err error, wait time.Duration) {
+		log.WithError(err).
+			WithField("backend", s.name).
+			WithField("key_id", opts.KeyID).
+			WithField("attempt", attempt).
+			WithField("retry_in", wait.String()).
+			Warn("signing failed, retrying")
+
+		ddlambda.Metric(retryMetric, 1, "backend:"+s.name)
+	}
+
+	if err := backoff.RetryNotify(operation, s.backoff(ctx), notify); err != nil {
+		return nil, err
+	}
+
+	return signed, nil
+}
+
+// PublicKey derives the public key through the wrapped signer. Lookups are
+// not retried, they are only used by integrity checks
+func (s *Signer) PublicKey(ctx context.Context, keyID string, derivationPath []uint32) (*ecdsa.PublicKey, error) {
+	deriver, ok := s.next.(models.PublicKeyDeriver)
+	if !ok {
+		return nil, models.ErrPublicKeyUnsupported
+	}
+
+	return deriver.PublicKey(ctx, keyID, derivationPath)
+}
+
+// GenerateKey creates a key through the wrapped signer. Key generation is not
+// retried as a retry could leave an unused key behind
+func (s *Signer) GenerateKey(ctx context.Context) (string, error) {
+	generator, ok := s.next.(models.KeyGenerator)
+	if !ok {
+		return "", models.ErrKeyGenerationUnsupported
+	}
+
+	return generator.GenerateKey(ctx)
+}
+
+// HealthCheck fails while the circuit breaker is open and otherwise defers to
+// the wrapped signer
+func (s *Signer) HealthCheck(ctx context.Context) error {
+	if s.breaker.State() == gobreaker.StateOpen {
+		return fmt.Errorf("%w: %s", ErrCircuitOpen, s.name)
+	}
+
+	if checker, ok := s.next.(models.HealthChecker); ok {
+		return checker.HealthCheck(ctx)
+	}
+
+	return nil
+}
+
+// State returns the current state of the circuit breaker
+func (s *Signer) State() gobreaker.State { return s.breaker.State() }
+
+func (s *Signer) backoff(ctx context.Context) backoff.BackOff {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = s.initialInterval
+	b.MaxInterval = s.maxInterval
+	// attempts bound the retries, the deadline of ctx bounds the time
+	b.MaxElapsedTime = 0
+
+	return backoff.WithContext(backoff.WithMaxRetries(b, uint64(s.maxAttempts-1)), ctx)
+}
+
+func onStateChange(name string, from, to gobreaker.State) {
+	logger := log.WithField("backend", name).
+		WithField("from", from.String()).
+		WithField("to", to.String())
+
+	if to == gobreaker.StateOpen {
+		logger.Error("signer circuit breaker opened, failing fast")
+	} else {
+		logger.Info("signer circuit breaker changed state")
+	}
+
+	// closed, half-open and open are reported as 0, 1 and 2
+	ddlambda.Metric(breakerStateMetric, float64(to), "backend:"+name, "state:"+to.String())
+}
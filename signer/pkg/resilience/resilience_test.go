@@ -0,0 +1,159 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sony/gobreaker"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/mocks"
+	"github.com/mara-labs/transactionsigner/models"
+)
+
+var (
+	errUnavailable = errors.New("tsm node unavailable")
+	errInvalidKey  = errors.New("invalid key")
+)
+
+func isRetryable(err error) bool {
+	return !errors.Is(err, errInvalidKey) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+func newTestSigner(next models.Signer) *Signer {
+	return New("sepior", next, config.Configuration{
+		SignerRetryMaxAttempts:        3,
+		SignerRetryInitialInterval:    time.Millisecond,
+		SignerRetryMaxInterval:        time.Millisecond,
+		SignerBreakerFailureThreshold: 3,
+		SignerBreakerOpenTimeout:      time.Hour,
+		SignerBreakerHalfOpenRequests: 1,
+	}, isRetryable)
+}
+
+func TestSigner_Sign(t *testing.T) {
+	tx := types.NewTx(&types.LegacyTx{})
+
+	tt := []struct {
+		name     string
+		results  []error
+		err      error
+		attempts int
+	}{
+		{
+			name:     "transient failures are retried",
+			results:  []error{errUnavailable, errUnavailable, nil},
+			attempts: 3,
+		},
+		{
+			name:     "invalid keys are not retried",
+			results:  []error{errInvalidKey},
+			err:      errInvalidKey,
+			attempts: 1,
+		},
+		{
+			name:     "retries stop after the last attempt",
+			results:  []error{errUnavailable, errUnavailable, errUnavailable},
+			err:      errUnavailable,
+			attempts: 3,
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			next := mocks.NewMockSigner(ctrl)
+
+			for _, result := range v.results {
+				if result != nil {
+					next.EXPECT().Sign(gomock.Any(), gomock.Any()).Return(nil, result)
+					continue
+				}
+
+				next.EXPECT().Sign(gomock.Any(), gomock.Any()).Return(tx, nil)
+			}
+
+			signedTX, err := newTestSigner(next).Sign(context.Background(), models.SignOptions{TX: tx})
+			if v.err != nil {
+				require.ErrorIs(t, err, v.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tx, signedTX)
+		})
+	}
+}
+
+func TestSigner_SignHash(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	next := mocks.NewMockHashSigner(ctrl)
+
+	signature := make([]byte, 65)
+
+	gomock.InOrder(
+		next.EXPECT().SignHash(gomock.Any(), gomock.Any()).Return(nil, errUnavailable),
+		next.EXPECT().SignHash(gomock.Any(), gomock.Any()).Return(signature, nil),
+	)
+
+	// a hash signer that only signs hashes is enough for SignHash
+	s := newTestSigner(struct {
+		models.Signer
+		models.HashSigner
+	}{HashSigner: next})
+
+	sig, err := s.SignHash(context.Background(), models.SignOptions{Digest: make([]byte, 32)})
+	require.NoError(t, err)
+	require.Equal(t, signature, sig)
+
+	_, err = newTestSigner(mocks.NewMockSigner(ctrl)).SignHash(context.Background(), models.SignOptions{})
+	require.ErrorIs(t, err, models.ErrHashSigningUnsupported)
+}
+
+func TestSigner_CircuitBreaker(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	next := mocks.NewMockSigner(ctrl)
+
+	s := newTestSigner(next)
+
+	// invalid keys are the caller's fault and do not trip the breaker
+	next.EXPECT().Sign(gomock.Any(), gomock.Any()).Times(3).Return(nil, errInvalidKey)
+
+	for i := 0; i < 3; i++ {
+		_, err := s.Sign(context.Background(), models.SignOptions{})
+		require.ErrorIs(t, err, errInvalidKey)
+	}
+
+	require.Equal(t, gobreaker.StateClosed, s.State())
+
+	// signatures that time out are not retried but a hung backend trips the
+	// breaker
+	timedOut := newTestSigner(next)
+	next.EXPECT().Sign(gomock.Any(), gomock.Any()).Times(3).Return(nil, fmt.Errorf("sepior did not sign in time: %w", context.DeadlineExceeded))
+
+	for i := 0; i < 3; i++ {
+		_, err := timedOut.Sign(context.Background(), models.SignOptions{})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	}
+
+	require.Equal(t, gobreaker.StateOpen, timedOut.State())
+
+	// three attempts of one message open the breaker
+	next.EXPECT().Sign(gomock.Any(), gomock.Any()).Times(3).Return(nil, errUnavailable)
+
+	_, err := s.Sign(context.Background(), models.SignOptions{})
+	require.ErrorIs(t, err, errUnavailable)
+	require.Equal(t, gobreaker.StateOpen, s.State())
+
+	// the backend is not contacted while the breaker is open
+	_, err = s.Sign(context.Background(), models.SignOptions{})
+	require.ErrorIs(t, err, ErrCircuitOpen)
+
+	require.ErrorIs(t, s.HealthCheck(context.Background()), ErrCircuitOpen)
+}
@@ -0,0 +1,162 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// Options configures the providers registered by NewDefaultResolver
+type Options struct {
+	Region string
+	// LocalstackEndpoint routes AWS calls to localstack when it is set
+	LocalstackEndpoint string
+	TTL                time.Duration
+}
+
+// NewDefaultResolver creates a resolver with the secretsmanager, ssm and file
+// providers registered. AWS clients are only created once a reference needs
+// them
+func NewDefaultResolver(opts Options) *Resolver {
+	r := NewResolver(opts.TTL)
+
+	r.Register(SchemeFile, File{})
+	r.Register(SchemeSecretsManager, newSecretsManager(opts))
+	r.Register(SchemeSSM, newSSM(opts))
+
+	return r
+}
+
+// File reads secrets from the local filesystem, trailing new lines are
+// dropped. It is meant for tests and local runs
+type File struct{}
+
+// Fetch reads the file at name
+func (File) Fetch(_ context.Context, name string) (string, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+type secretsManagerProvider struct {
+	opts Options
+
+	once   sync.Once
+	client *secretsmanager.Client
+	err    error
+}
+
+func newSecretsManager(opts Options) *secretsManagerProvider {
+	return &secretsManagerProvider{opts: opts}
+}
+
+// loadAWSConfig loads the default AWS configuration for the region of the
+// options, pointed at localstack when it is set
+func loadAWSConfig(opts Options) (aws.Config, error) {
+	loadOpts := []func(*awsConfig.LoadOptions) error{
+		awsConfig.WithRegion(opts.Region),
+	}
+
+	if len(opts.LocalstackEndpoint) != 0 {
+		loadOpts = append(loadOpts, awsConfig.WithEndpointResolver(aws.EndpointResolverFunc(func(_, region string) (aws.Endpoint, error) { //nolint: staticcheck
+			return aws.Endpoint{
+				URL:               opts.LocalstackEndpoint,
+				SigningRegion:     region,
+				Source:            aws.EndpointSourceCustom,
+				HostnameImmutable: true,
+				PartitionID:       "aws",
+			}, nil
+		})))
+	}
+
+	return awsConfig.LoadDefaultConfig(context.Background(), loadOpts...)
+}
+
+func (p *secretsManagerProvider) init() {
+	conf, err := loadAWSConfig(p.opts)
+	if err != nil {
+		p.err = err
+		return
+	}
+
+	p.client = secretsmanager.NewFromConfig(conf)
+}
+
+// Fetch retrieves the current version of the secret
+func (p *secretsManagerProvider) Fetch(ctx context.Context, name string) (string, error) {
+	p.once.Do(p.init)
+
+	if p.err != nil {
+		return "", p.err
+	}
+
+	result, err := p.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId:     aws.String(name),
+		VersionStage: aws.String("AWSCURRENT"),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if result.SecretString == nil {
+		return "", errors.New("secret has no string value")
+	}
+
+	return *result.SecretString, nil
+}
+
+type ssmProvider struct {
+	opts Options
+
+	once   sync.Once
+	client *ssm.Client
+	err    error
+}
+
+func newSSM(opts Options) *ssmProvider {
+	return &ssmProvider{opts: opts}
+}
+
+func (p *ssmProvider) init() {
+	conf, err := loadAWSConfig(p.opts)
+	if err != nil {
+		p.err = err
+		return
+	}
+
+	p.client = ssm.NewFromConfig(conf)
+}
+
+// Fetch retrieves the decrypted value of the parameter
+func (p *ssmProvider) Fetch(ctx context.Context, name string) (string, error) {
+	p.once.Do(p.init)
+
+	if p.err != nil {
+		return "", p.err
+	}
+
+	result, err := p.client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if result.Parameter == nil || result.Parameter.Value == nil {
+		return "", errors.New("parameter has no value")
+	}
+
+	return *result.Parameter.Value, nil
+}
@@ -0,0 +1,197 @@
+// Package secrets resolves references to sensitive values that are kept out of
+// the environment, e.g. secretsmanager://name#key, ssm://param or
+// file:///path
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SchemeSecretsManager resolves values from AWS Secrets Manager
+	SchemeSecretsManager = "secretsmanager"
+	// SchemeSSM resolves values from the AWS SSM parameter store
+	SchemeSSM = "ssm"
+	// SchemeFile resolves values from the local filesystem
+	SchemeFile = "file"
+)
+
+// ErrUnknownScheme is returned when no provider is registered for a scheme
+var ErrUnknownScheme = errors.New("no secret provider registered for scheme")
+
+// Reference points to a secret held by a provider. Key selects a single field
+// when the secret is a JSON object
+type Reference struct {
+	Scheme string
+	Name   string
+	Key    string
+}
+
+// String renders the reference without its key
+func (r Reference) String() string { return r.Scheme + "://" + r.Name }
+
+// ParseReference parses values in the form scheme://name#key. The second
+// return value is false when the value is not a reference at all, in which
+// case it should be used verbatim
+func ParseReference(value string) (Reference, bool) {
+	scheme, rest, ok := strings.Cut(strings.TrimSpace(value), "://")
+	if !ok {
+		return Reference{}, false
+	}
+
+	switch scheme {
+	case SchemeSecretsManager, SchemeSSM, SchemeFile:
+	default:
+		return Reference{}, false
+	}
+
+	ref := Reference{Scheme: scheme, Name: rest}
+
+	if i := strings.LastIndex(rest, "#"); i >= 0 {
+		ref.Name = rest[:i]
+		ref.Key = rest[i+1:]
+	}
+
+	return ref, len(ref.Name) != 0
+}
+
+// IsReference checks if the value is a secret reference
+func IsReference(value string) bool {
+	_, ok := ParseReference(value)
+	return ok
+}
+
+// Provider fetches the raw value of a secret
+type Provider interface {
+	Fetch(ctx context.Context, name string) (string, error)
+}
+
+// ProviderFunc adapts a function to the Provider interface
+type ProviderFunc func(ctx context.Context, name string) (string, error)
+
+// Fetch calls f
+func (f ProviderFunc) Fetch(ctx context.Context, name string) (string, error) { return f(ctx, name) }
+
+type cachedValue struct {
+	value     string
+	expiresAt time.Time
+}
+
+// Resolver dispatches references to the provider registered for their scheme
+// and caches the raw values until they expire
+type Resolver struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	providers map[string]Provider
+	cache     map[string]cachedValue
+}
+
+// NewResolver creates a resolver without any provider. A ttl of zero disables
+// caching
+func NewResolver(ttl time.Duration) *Resolver {
+	return &Resolver{
+		ttl:       ttl,
+		now:       time.Now,
+		providers: map[string]Provider{},
+		cache:     map[string]cachedValue{},
+	}
+}
+
+// Register sets the provider used for the given scheme
+func (r *Resolver) Register(scheme string, provider Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.providers[scheme] = provider
+}
+
+// Resolve returns the secret the value refers to. Values that are not
+// references are returned unchanged
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	ref, ok := ParseReference(value)
+	if !ok {
+		return value, nil
+	}
+
+	raw, err := r.fetch(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+
+	if len(ref.Key) == 0 {
+		return raw, nil
+	}
+
+	return extractKey(raw, ref)
+}
+
+// Invalidate drops the cached value of the reference so the next Resolve
+// fetches it again
+func (r *Resolver) Invalidate(value string) {
+	ref, ok := ParseReference(value)
+	if !ok {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.cache, ref.String())
+}
+
+func (r *Resolver) fetch(ctx context.Context, ref Reference) (string, error) {
+	r.mu.Lock()
+	provider, ok := r.providers[ref.Scheme]
+	cached, isCached := r.cache[ref.String()]
+	r.mu.Unlock()
+
+	if !ok {
+		return "", fmt.Errorf("%w %s", ErrUnknownScheme, ref.Scheme)
+	}
+
+	if isCached && r.now().Before(cached.expiresAt) {
+		return cached.value, nil
+	}
+
+	value, err := provider.Fetch(ctx, ref.Name)
+	if err != nil {
+		return "", fmt.Errorf("could not resolve secret %s: %w", ref, err)
+	}
+
+	if r.ttl > 0 {
+		r.mu.Lock()
+		r.cache[ref.String()] = cachedValue{value: value, expiresAt: r.now().Add(r.ttl)}
+		r.mu.Unlock()
+	}
+
+	return value, nil
+}
+
+func extractKey(raw string, ref Reference) (string, error) {
+	fields := map[string]json.RawMessage{}
+
+	if err := json.Unmarshal([]byte(raw), &fields); err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object: %w", ref, err)
+	}
+
+	field, ok := fields[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %s", ref, ref.Key)
+	}
+
+	var value string
+	if err := json.Unmarshal(field, &value); err == nil {
+		return value, nil
+	}
+
+	// numbers and booleans are returned as they are written
+	return string(field), nil
+}
@@ -3,14 +3,26 @@ package sepior
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"encoding/asn1"
 	"errors"
+	"fmt"
 	"math/big"
+	"net"
+	"net/http"
+	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	ddlambda "github.com/DataDog/datadog-lambda-go"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsConfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/mara-labs/sepior/ethwallet"
 	"github.com/mara-labs/sepior/session"
 	log "github.com/sirupsen/logrus"
@@ -18,58 +30,469 @@ import (
 
 	"github.com/mara-labs/transactionsigner/config"
 	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/ethtx"
 )
 
 const (
 	defaultSecretName = "sepior-user"
 	defaultRegion     = "eu-west-2"
+
+	secretRotatedMetric = "transaction_signer.sepior.secret_rotated"
+
+	// defaultRetryInterval holds back ttl refreshes after a failed one, so an
+	// unreachable secret is not fetched again for every signature
+	defaultRetryInterval = 30 * time.Second
+)
+
+var (
+	secp256k1N     = crypto.S256().Params().N
+	secp256k1HalfN = new(big.Int).Rsh(secp256k1N, 1)
 )
 
+// authStatus matches the HTTP status lines and gRPC status codes the TSM nodes
+// reject credentials with, for errors that do not carry their status
+var authStatus = regexp.MustCompile(`(?i)\b(401 unauthorized|403 forbidden|code = (unauthenticated|permissiondenied))\b`)
+
+// statusCoder is implemented by errors carrying the HTTP status of the
+// response they were created from
+type statusCoder interface {
+	StatusCode() int
+}
+
+// httpStatusCoder is the smithy flavour of statusCoder
+type httpStatusCoder interface {
+	HTTPStatusCode() int
+}
+
+// transientStatus matches the status lines, gRPC codes and socket errors of
+// failures that are worth retrying, for errors that do not carry their status
+var transientStatus = regexp.MustCompile(`(?i)(connection refused|connection reset|broken pipe|\b(429 too many requests|502 bad gateway|503 service unavailable|504 gateway timeout)\b|code = (unavailable|resourceexhausted)\b)`)
+
+// errSignTimeout is returned when the TSM did not sign before the deadline.
+// The abandoned call may still complete, so it is never retried
+var errSignTimeout = errors.New("sepior did not sign in time")
+
+// secretFetcher retrieves the current credentials and their version
+type secretFetcher func(context.Context) (secret string, version string, err error)
+
 // Client implements a way to sign transactions with Sepior TSM nodes
 type Client struct {
-	tsmClient tsm.ECDSAClient
+	tsmClient atomic.Pointer[tsm.ECDSAClient]
 	chainID   *big.Int
+
+	fetchSecret secretFetcher
+	newClient   func(secret string) (tsm.ECDSAClient, error)
+	sign        func(tsm.ECDSAClient, types.Signer, models.SignOptions) (*types.Transaction, error)
+	signHash    func(tsm.ECDSAClient, models.SignOptions) ([]byte, error)
+	publicKey   func(tsm.ECDSAClient, string, []uint32) ([]byte, error)
+	keygen      func(tsm.ECDSAClient) (string, error)
+
+	ttl           time.Duration
+	retryInterval time.Duration
+
+	// refreshMu serializes refreshes. mu guards the fields below it and is
+	// only held briefly, so signatures do not wait for a slow secret fetch
+	refreshMu     sync.Mutex
+	mu            sync.Mutex
+	generation    uint64
+	secretVersion string
+	refreshedAt   time.Time
+	// retryAt holds back ttl refreshes after a failed one
+	retryAt time.Time
 }
 
 // New returns a properly initialized Client to connect to Sepior
 func New(configValues config.Configuration) (*Client, error) {
-	chainID, ok := big.NewInt(0).SetString(configValues.MaraChainID, 10)
-	if !ok {
-		return nil, errors.New("invalid chain id")
+	// chains of the chain registry bring their own signer, MARA_CHAIN_ID is
+	// only needed for the others
+	var chainID *big.Int
+
+	if len(configValues.MaraChainID) != 0 {
+		var ok bool
+
+		chainID, ok = big.NewInt(0).SetString(configValues.MaraChainID, 10)
+		if !ok {
+			return nil, errors.New("invalid chain id")
+		}
 	}
 
-	sepiorConfig, err := retrieveSepiorConfig(configValues)
+	fetchSecret, err := newSecretFetcher(configValues)
 	if err != nil {
 		return nil, err
 	}
 
-	cred, err := session.GetPersistedCredentialsFromReader(strings.NewReader(sepiorConfig))
-	if err != nil {
-		return nil, err
+	c := &Client{
+		chainID:     chainID,
+		fetchSecret: fetchSecret,
+		newClient:   newTSMClient,
+		sign:        signWithTSM,
+		signHash:    signHashWithTSM,
+		publicKey:   publicKeyWithTSM,
+		keygen:      keygenWithTSM,
+		ttl:         configValues.SepiorSecretTTL,
+
+		retryInterval: defaultRetryInterval,
 	}
 
-	client, err := session.New(cred)
-	if err != nil {
+	if err := c.refresh(context.Background(), 0); err != nil {
 		return nil, err
 	}
 
-	return &Client{
-		tsmClient: tsm.NewECDSAClient(client),
-		chainID:   chainID,
-	}, nil
+	return c, nil
 }
 
 // Sign signs the given transaction with
-func (c *Client) Sign(_ context.Context, opts models.SignOptions) (
+func (c *Client) Sign(ctx context.Context, opts models.SignOptions) (
 	*types.Transaction, error,
 ) {
-	signer := types.NewEIP155Signer(c.chainID)
+	signer, err := ethtx.Signer(opts.Signer, c.chainID)
+	if err != nil {
+		return nil, fmt.Errorf("chain %d: %w", opts.ChainID, err)
+	}
+
+	return withSession(ctx, c, func(tsmClient tsm.ECDSAClient) (*types.Transaction, error) {
+		return c.sign(tsmClient, signer, opts)
+	})
+}
+
+// SignHash signs opts.Digest with the key at the derivation path and returns
+// the signature in the [R || S || V] form
+func (c *Client) SignHash(ctx context.Context, opts models.SignOptions) ([]byte, error) {
+	if len(opts.Digest) != 32 {
+		return nil, fmt.Errorf("can not sign a digest of %d bytes", len(opts.Digest))
+	}
+
+	return withSession(ctx, c, func(tsmClient tsm.ECDSAClient) ([]byte, error) {
+		return c.signHash(tsmClient, opts)
+	})
+}
+
+// PublicKey derives the public key of the key at the derivation path from the
+// key shares held by the TSM nodes
+func (c *Client) PublicKey(ctx context.Context, keyID string, derivationPath []uint32) (*ecdsa.PublicKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	der, err := c.publicKey(*c.tsmClient.Load(), keyID, derivationPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not derive public key of %s at %s: %w",
+			keyID, models.FormatDerivationPath(derivationPath), err)
+	}
+
+	return ethtx.ParsePublicKey(der)
+}
+
+// GenerateKey creates a new secp256k1 key shared between the TSM nodes and
+// returns its ID
+func (c *Client) GenerateKey(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	keyID, err := c.keygen(*c.tsmClient.Load())
+	if err != nil {
+		return "", fmt.Errorf("could not generate sepior key: %w", err)
+	}
+
+	return keyID, nil
+}
+
+// HealthCheck makes sure a TSM session is available. Expired credentials are
+// refreshed so unreachable secrets are reported straight away
+func (c *Client) HealthCheck(ctx context.Context) error {
+	if c.tsmClient.Load() == nil {
+		return errors.New("no sepior session")
+	}
+
+	if !c.isExpired() {
+		return nil
+	}
+
+	return c.refresh(ctx, c.currentGeneration())
+}
+
+// withSession calls fn with the current TSM session. Expired credentials are
+// refreshed first and credentials the TSM rejects are refreshed once before
+// fn is called again
+func withSession[T any](ctx context.Context, c *Client, fn func(tsm.ECDSAClient) (T, error)) (T, error) {
+	generation := c.currentGeneration()
+
+	if c.isExpired() {
+		// a stale session is still better than failing the signature
+		if err := c.refreshExpired(ctx, generation); err != nil {
+			log.WithError(err).Warn("could not refresh sepior credentials, using the current session")
+		}
+
+		generation = c.currentGeneration()
+	}
+
+	tsmClient := *c.tsmClient.Load()
+
+	result, err := signContext(ctx, func() (T, error) { return fn(tsmClient) })
+	if err == nil || !isAuthError(err) {
+		return result, err
+	}
+
+	log.WithError(err).Warn("sepior rejected the credentials, refreshing them")
+
+	if refreshErr := c.refresh(ctx, generation); refreshErr != nil {
+		log.WithError(refreshErr).Error("could not refresh sepior credentials")
+		return result, err
+	}
+
+	tsmClient = *c.tsmClient.Load()
+
+	return signContext(ctx, func() (T, error) { return fn(tsmClient) })
+}
+
+// signContext signs in the background and gives up once ctx is done. The TSM
+// SDK does not take a context so a hung call is abandoned rather than
+// cancelled, its result is discarded
+func signContext[T any](ctx context.Context, sign func() (T, error)) (T, error) {
+	var zero T
+
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+
+	type result struct {
+		value T
+		err   error
+	}
+
+	done := make(chan result, 1)
+
+	go func() {
+		value, err := sign()
+		done <- result{value: value, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return zero, fmt.Errorf("%w: %w", errSignTimeout, ctx.Err())
+	case r := <-done:
+		return r.value, r.err
+	}
+}
+
+func (c *Client) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generation
+}
+
+// isExpired checks if the credentials are older than the ttl. After a failed
+// refresh they are only reported as expired again once retryAt has passed
+func (c *Client) isExpired() bool {
+	if c.ttl <= 0 {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
 
+	return now.Sub(c.refreshedAt) >= c.ttl && !now.Before(c.retryAt)
+}
+
+// refresh re-fetches the secret and swaps the TSM client. seenGeneration is
+// the generation the caller observed, if another caller refreshed in the
+// meantime there is nothing left to do. In-flight signatures keep using the
+// client they loaded
+func (c *Client) refresh(ctx context.Context, seenGeneration uint64) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	return c.refreshLocked(ctx, seenGeneration)
+}
+
+// refreshExpired refreshes credentials that outlived the ttl. Callers arriving
+// while a refresh is in flight keep the current session instead of queueing
+// behind it
+func (c *Client) refreshExpired(ctx context.Context, seenGeneration uint64) error {
+	if !c.refreshMu.TryLock() {
+		return nil
+	}
+
+	defer c.refreshMu.Unlock()
+
+	return c.refreshLocked(ctx, seenGeneration)
+}
+
+// refreshLocked is refresh with refreshMu held
+func (c *Client) refreshLocked(ctx context.Context, seenGeneration uint64) error {
+	c.mu.Lock()
+	refreshed := c.tsmClient.Load() != nil && c.generation != seenGeneration
+	c.mu.Unlock()
+
+	if refreshed {
+		return nil
+	}
+
+	secret, version, err := c.fetchSecret(ctx)
+	if err == nil {
+		var tsmClient tsm.ECDSAClient
+
+		if tsmClient, err = c.newClient(secret); err == nil {
+			c.swap(tsmClient, version)
+			return nil
+		}
+	}
+
+	c.mu.Lock()
+	c.retryAt = time.Now().Add(c.retryInterval)
+	c.mu.Unlock()
+
+	return err
+}
+
+// swap makes tsmClient the session of new signatures
+func (c *Client) swap(tsmClient tsm.ECDSAClient, version string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previousVersion := c.secretVersion
+
+	c.tsmClient.Store(&tsmClient)
+	c.generation++
+	c.secretVersion = version
+	c.refreshedAt = time.Now()
+	c.retryAt = time.Time{}
+
+	if len(previousVersion) != 0 && previousVersion != version {
+		log.WithField("previous_version", previousVersion).
+			WithField("version", version).
+			Info("picked up a new version of the sepior secret")
+
+		ddlambda.Metric(secretRotatedMetric, 1, "version:"+version)
+	}
+}
+
+// IsRetryable classifies errors returned by Sign. Only failures that are known
+// to be transient are retried: refused or reset connections, network
+// timeouts, unavailable or overloaded TSM nodes. Signatures that did not
+// complete in time are not retried, nor is anything unknown
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, errSignTimeout) || errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) || isAuthError(err) {
+		return false
+	}
+
+	if status, ok := statusOf(err); ok {
+		switch status {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		default:
+			return false
+		}
+	}
+
+	var netErr net.Error
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.As(err, &netErr) {
+		return true
+	}
+
+	return transientStatus.MatchString(err.Error())
+}
+
+// isAuthError checks if the TSM nodes rejected the credentials of the session,
+// by the status of the error or, for errors without one, by the status line
+// or gRPC code in its message
+func isAuthError(err error) bool {
+	status, ok := statusOf(err)
+	if !ok {
+		return authStatus.MatchString(err.Error())
+	}
+
+	return status == http.StatusUnauthorized || status == http.StatusForbidden
+}
+
+// statusOf returns the HTTP status carried by the error, if any
+func statusOf(err error) (int, bool) {
+	var sc statusCoder
+	var hsc httpStatusCoder
+
+	switch {
+	case errors.As(err, &sc):
+		return sc.StatusCode(), true
+	case errors.As(err, &hsc):
+		return hsc.HTTPStatusCode(), true
+	default:
+		return 0, false
+	}
+}
+
+func newTSMClient(secret string) (tsm.ECDSAClient, error) {
+	var tsmClient tsm.ECDSAClient
+
+	cred, err := session.GetPersistedCredentialsFromReader(strings.NewReader(secret))
+	if err != nil {
+		return tsmClient, err
+	}
+
+	client, err := session.New(cred)
+	if err != nil {
+		return tsmClient, err
+	}
+
+	return tsm.NewECDSAClient(client), nil
+}
+
+func signWithTSM(tsmClient tsm.ECDSAClient, signer types.Signer, opts models.SignOptions) (*types.Transaction, error) {
 	return ethwallet.Sign(opts.TX,
-		signer, c.tsmClient,
+		signer, tsmClient,
 		opts.KeyID, opts.DerivationPath)
 }
 
+func signHashWithTSM(tsmClient tsm.ECDSAClient, opts models.SignOptions) ([]byte, error) {
+	der, recoveryID, err := tsmClient.Sign(opts.KeyID, opts.DerivationPath, opts.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	return ethereumSignature(der, recoveryID)
+}
+
+// ethereumSignature converts the DER signature of the TSM nodes to the
+// [R || S || V] form. S is normalized to the lower half of the curve order,
+// which flips the recovery ID
+func ethereumSignature(der []byte, recoveryID int) ([]byte, error) {
+	var sig struct {
+		R, S *big.Int
+	}
+
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, fmt.Errorf("could not parse signature: %w", err)
+	}
+
+	if recoveryID != 0 && recoveryID != 1 {
+		return nil, fmt.Errorf("invalid recovery id %d", recoveryID)
+	}
+
+	if sig.S.Cmp(secp256k1HalfN) > 0 {
+		sig.S = new(big.Int).Sub(secp256k1N, sig.S)
+		recoveryID ^= 1
+	}
+
+	raw := make([]byte, crypto.SignatureLength)
+	sig.R.FillBytes(raw[:32])
+	sig.S.FillBytes(raw[32:64])
+	raw[crypto.RecoveryIDOffset] = byte(recoveryID)
+
+	return raw, nil
+}
+
+func publicKeyWithTSM(tsmClient tsm.ECDSAClient, keyID string, derivationPath []uint32) ([]byte, error) {
+	return tsmClient.PublicKey(keyID, derivationPath)
+}
+
+func keygenWithTSM(tsmClient tsm.ECDSAClient) (string, error) {
+	return tsmClient.Keygen("secp256k1")
+}
+
 func getSecretRegion(cfg config.Configuration) string {
 	if len(strings.TrimSpace(cfg.SepiorSecretAWSRegion)) == 0 {
 		return defaultRegion
@@ -94,10 +517,10 @@ func getLocalstackEndpoint(cfg config.Configuration) string {
 	return cfg.SepiorLocalstackEndpoint
 }
 
-func retrieveSepiorConfig(cfg config.Configuration) (string, error) {
+func newSecretFetcher(cfg config.Configuration) (secretFetcher, error) {
 	sepiorUser, err := getSecretName(cfg)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	opts := []func(*awsConfig.LoadOptions) error{}
@@ -119,26 +542,28 @@ func retrieveSepiorConfig(cfg config.Configuration) (string, error) {
 	conf, err := awsConfig.LoadDefaultConfig(context.Background(), opts...)
 	if err != nil {
 		log.WithError(err).Error("could not set up AWS configuration")
-		return "", err
+		return nil, err
 	}
 
 	secretsManager := secretsmanager.NewFromConfig(conf)
 
-	input := &secretsmanager.GetSecretValueInput{
-		SecretId:     aws.String(sepiorUser),
-		VersionStage: aws.String("AWSCURRENT"),
-	}
+	return func(ctx context.Context) (string, string, error) {
+		input := &secretsmanager.GetSecretValueInput{
+			SecretId:     aws.String(sepiorUser),
+			VersionStage: aws.String("AWSCURRENT"),
+		}
 
-	log.WithField("secret_name", sepiorUser).Debug("getting secret")
+		log.WithField("secret_name", sepiorUser).Debug("getting secret")
 
-	result, err := secretsManager.GetSecretValue(context.Background(), input)
-	if err != nil {
-		log.WithError(err).WithField("secret_name", sepiorUser).
-			WithField("region", getSecretRegion(cfg)).
-			Error("could not fetch secret value")
+		result, err := secretsManager.GetSecretValue(ctx, input)
+		if err != nil {
+			log.WithError(err).WithField("secret_name", sepiorUser).
+				WithField("region", getSecretRegion(cfg)).
+				Error("could not fetch secret value")
 
-		return "", err
-	}
+			return "", "", err
+		}
 
-	return *result.SecretString, nil
+		return aws.ToString(result.SecretString), aws.ToString(result.VersionId), nil
+	}, nil
 }
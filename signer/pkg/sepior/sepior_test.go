@@ -0,0 +1,367 @@
+package sepior
+
+import (
+	"context"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/sepior/go-tsm-sdk/sdk/tsm"
+
+	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/ethtx"
+)
+
+type fakeSecrets struct {
+	mu      sync.Mutex
+	fetches int
+	version string
+	err     error
+	delay   time.Duration
+}
+
+func (f *fakeSecrets) fetch(context.Context) (string, string, error) {
+	time.Sleep(f.delay)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.fetches++
+
+	return "{}", f.version, f.err
+}
+
+func newTestClient(secrets *fakeSecrets, ttl time.Duration,
+	sign func(tsm.ECDSAClient, types.Signer, models.SignOptions) (*types.Transaction, error),
+) (*Client, error) {
+	c := &Client{
+		chainID:     big.NewInt(1),
+		fetchSecret: secrets.fetch,
+		newClient: func(string) (tsm.ECDSAClient, error) {
+			var tsmClient tsm.ECDSAClient
+			return tsmClient, nil
+		},
+		sign: sign,
+		ttl:  ttl,
+
+		retryInterval: time.Minute,
+	}
+
+	return c, c.refresh(context.Background(), 0)
+}
+
+func TestClient_Sign(t *testing.T) {
+	tx := types.NewTx(&types.LegacyTx{})
+
+	t.Run("credentials are refreshed when the TSM rejects them", func(t *testing.T) {
+		secrets := &fakeSecrets{version: "v1"}
+		calls := 0
+
+		c, err := newTestClient(secrets, 0, func(tsm.ECDSAClient, types.Signer, models.SignOptions) (*types.Transaction, error) {
+			calls++
+			if secrets.version == "v1" {
+				secrets.version = "v2"
+				return nil, errors.New("rpc error: 401 Unauthorized")
+			}
+
+			return tx, nil
+		})
+		require.NoError(t, err)
+
+		signedTX, err := c.Sign(context.Background(), models.SignOptions{TX: tx})
+		require.NoError(t, err)
+		require.Equal(t, tx, signedTX)
+		require.Equal(t, 2, calls)
+		require.Equal(t, 2, secrets.fetches)
+		require.Equal(t, "v2", c.secretVersion)
+	})
+
+	t.Run("other errors do not refresh the credentials", func(t *testing.T) {
+		secrets := &fakeSecrets{version: "v1"}
+
+		c, err := newTestClient(secrets, 0, func(tsm.ECDSAClient, types.Signer, models.SignOptions) (*types.Transaction, error) {
+			return nil, errors.New("key not found")
+		})
+		require.NoError(t, err)
+
+		_, err = c.Sign(context.Background(), models.SignOptions{TX: tx})
+		require.Error(t, err)
+		require.Equal(t, 1, secrets.fetches)
+	})
+
+	t.Run("credentials are refreshed once the ttl expires", func(t *testing.T) {
+		secrets := &fakeSecrets{version: "v1"}
+
+		c, err := newTestClient(secrets, time.Hour, func(tsm.ECDSAClient, types.Signer, models.SignOptions) (*types.Transaction, error) {
+			return tx, nil
+		})
+		require.NoError(t, err)
+
+		_, err = c.Sign(context.Background(), models.SignOptions{TX: tx})
+		require.NoError(t, err)
+		require.Equal(t, 1, secrets.fetches)
+
+		c.refreshedAt = time.Now().Add(-2 * time.Hour)
+		secrets.version = "v2"
+
+		_, err = c.Sign(context.Background(), models.SignOptions{TX: tx})
+		require.NoError(t, err)
+		require.Equal(t, 2, secrets.fetches)
+		require.Equal(t, "v2", c.secretVersion)
+	})
+
+	t.Run("signing gives up once the context is done", func(t *testing.T) {
+		secrets := &fakeSecrets{version: "v1"}
+		release := make(chan struct{})
+		defer close(release)
+
+		c, err := newTestClient(secrets, 0, func(tsm.ECDSAClient, types.Signer, models.SignOptions) (*types.Transaction, error) {
+			<-release
+			return tx, nil
+		})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err = c.Sign(ctx, models.SignOptions{TX: tx})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.False(t, IsRetryable(err), "the abandoned signature may still complete")
+	})
+
+	t.Run("concurrent refreshes only fetch the secret once", func(t *testing.T) {
+		secrets := &fakeSecrets{version: "v1", delay: 20 * time.Millisecond}
+
+		c, err := newTestClient(secrets, 0, nil)
+		require.NoError(t, err)
+
+		generation := c.currentGeneration()
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, c.refresh(context.Background(), generation))
+			}()
+		}
+
+		wg.Wait()
+
+		require.Equal(t, 2, secrets.fetches)
+	})
+
+	t.Run("signatures do not wait for a ttl refresh in flight", func(t *testing.T) {
+		secrets := &fakeSecrets{version: "v1"}
+
+		c, err := newTestClient(secrets, time.Hour, func(tsm.ECDSAClient, types.Signer, models.SignOptions) (*types.Transaction, error) {
+			return tx, nil
+		})
+		require.NoError(t, err)
+
+		c.refreshedAt = time.Now().Add(-2 * time.Hour)
+		secrets.delay = 200 * time.Millisecond
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				_, err := c.Sign(context.Background(), models.SignOptions{TX: tx})
+				assert.NoError(t, err)
+			}()
+		}
+
+		wg.Wait()
+
+		require.Equal(t, 2, secrets.fetches)
+	})
+
+	t.Run("failed ttl refreshes back off", func(t *testing.T) {
+		secrets := &fakeSecrets{version: "v1"}
+
+		c, err := newTestClient(secrets, time.Hour, func(tsm.ECDSAClient, types.Signer, models.SignOptions) (*types.Transaction, error) {
+			return tx, nil
+		})
+		require.NoError(t, err)
+
+		c.refreshedAt = time.Now().Add(-2 * time.Hour)
+		secrets.err = errors.New("secrets manager unavailable")
+
+		for i := 0; i < 3; i++ {
+			_, err = c.Sign(context.Background(), models.SignOptions{TX: tx})
+			require.NoError(t, err, "the current session is used while the secret is unreachable")
+		}
+
+		require.Equal(t, 2, secrets.fetches)
+
+		// once the retry interval passed the secret is fetched again
+		c.retryAt = time.Now().Add(-time.Second)
+		secrets.err = nil
+		secrets.version = "v2"
+
+		_, err = c.Sign(context.Background(), models.SignOptions{TX: tx})
+		require.NoError(t, err)
+		require.Equal(t, 3, secrets.fetches)
+		require.Equal(t, "v2", c.secretVersion)
+	})
+}
+
+func TestClient_PublicKey(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	c, err := newTestClient(&fakeSecrets{version: "v1"}, 0, nil)
+	require.NoError(t, err)
+
+	var gotPath []uint32
+
+	c.publicKey = func(_ tsm.ECDSAClient, keyID string, path []uint32) ([]byte, error) {
+		if keyID != "MizBEqdhZ160syGCPFxYo6Lkxbiw" {
+			return nil, errors.New("key not found")
+		}
+
+		gotPath = path
+
+		return ethtx.MarshalPublicKey(&key.PublicKey)
+	}
+
+	publicKey, err := c.PublicKey(context.Background(), "MizBEqdhZ160syGCPFxYo6Lkxbiw", []uint32{44, 60, 0, 0, 1})
+	require.NoError(t, err)
+	require.Equal(t, crypto.PubkeyToAddress(key.PublicKey), crypto.PubkeyToAddress(*publicKey))
+	require.Equal(t, []uint32{44, 60, 0, 0, 1}, gotPath)
+
+	_, err = c.PublicKey(context.Background(), "unknown", []uint32{44, 60, 0, 0, 1})
+	require.ErrorContains(t, err, "key not found")
+}
+
+func TestClient_SignHash(t *testing.T) {
+	secrets := &fakeSecrets{version: "v1"}
+	digest := crypto.Keccak256([]byte("user operation"))
+
+	c, err := newTestClient(secrets, 0, nil)
+	require.NoError(t, err)
+
+	calls := 0
+
+	c.signHash = func(_ tsm.ECDSAClient, opts models.SignOptions) ([]byte, error) {
+		calls++
+		if secrets.version == "v1" {
+			secrets.version = "v2"
+			return nil, errors.New("rpc error: 401 Unauthorized")
+		}
+
+		return append(opts.Digest, make([]byte, 33)...), nil
+	}
+
+	sig, err := c.SignHash(context.Background(), models.SignOptions{Digest: digest})
+	require.NoError(t, err)
+	require.Equal(t, digest, sig[:32])
+	require.Equal(t, 2, calls, "rejected credentials are refreshed as for transactions")
+
+	_, err = c.SignHash(context.Background(), models.SignOptions{Digest: digest[:31]})
+	require.Error(t, err)
+}
+
+func TestEthereumSignature(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	digest := crypto.Keccak256([]byte("user operation"))
+
+	expected, err := crypto.Sign(digest, key)
+	require.NoError(t, err)
+
+	r := new(big.Int).SetBytes(expected[:32])
+	s := new(big.Int).SetBytes(expected[32:64])
+	v := int(expected[64])
+
+	lowS, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	require.NoError(t, err)
+
+	sig, err := ethereumSignature(lowS, v)
+	require.NoError(t, err)
+	require.Equal(t, expected, sig)
+
+	// the TSM may return the high S form, its recovery ID is the other one
+	highS, err := asn1.Marshal(struct{ R, S *big.Int }{r, new(big.Int).Sub(secp256k1N, s)})
+	require.NoError(t, err)
+
+	sig, err = ethereumSignature(highS, v^1)
+	require.NoError(t, err)
+	require.Equal(t, expected, sig)
+
+	_, err = ethereumSignature(lowS, 2)
+	require.Error(t, err)
+
+	_, err = ethereumSignature([]byte("not der"), v)
+	require.Error(t, err)
+}
+
+func TestIsRetryable(t *testing.T) {
+	tt := []struct {
+		err       error
+		retryable bool
+	}{
+		{err: errors.New("dial tcp 10.0.0.1:443: connection refused"), retryable: true},
+		{err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, retryable: true},
+		{err: errors.New("rpc error: code = Unavailable desc = node is restarting"), retryable: true},
+		{err: fmt.Errorf("signing failed: %w", statusErr(http.StatusServiceUnavailable)), retryable: true},
+		{err: statusErr(http.StatusInternalServerError), retryable: false},
+		{err: fmt.Errorf("%w: %w", errSignTimeout, context.DeadlineExceeded), retryable: false},
+		{err: context.DeadlineExceeded, retryable: false},
+		{err: errors.New("unexpected response from the tsm"), retryable: false},
+		{err: errors.New("Invalid key ID"), retryable: false},
+		{err: errors.New("invalid chain path [44 60]"), retryable: false},
+		{err: errors.New("rpc error: 401 Unauthorized"), retryable: false},
+		{err: context.Canceled, retryable: false},
+	}
+
+	for _, v := range tt {
+		t.Run(v.err.Error(), func(t *testing.T) {
+			require.Equal(t, v.retryable, IsRetryable(v.err))
+		})
+	}
+}
+
+type statusErr int
+
+func (e statusErr) Error() string   { return fmt.Sprintf("tsm node returned status %d", int(e)) }
+func (e statusErr) StatusCode() int { return int(e) }
+
+func TestIsAuthError(t *testing.T) {
+	tt := []struct {
+		err  error
+		auth bool
+	}{
+		{err: errors.New("rpc error: 401 Unauthorized"), auth: true},
+		{err: errors.New("rpc error: code = PermissionDenied desc = session expired"), auth: true},
+		{err: fmt.Errorf("signing failed: %w", statusErr(http.StatusForbidden)), auth: true},
+		{err: statusErr(http.StatusInternalServerError)},
+		{err: errors.New("key 4014031fa not found")},
+		{err: errors.New("no signature for hash 0x401403 at 44/60/0/0/401")},
+		{err: errors.New("message authentication code of the response is invalid")},
+	}
+
+	for _, v := range tt {
+		t.Run(v.err.Error(), func(t *testing.T) {
+			require.Equal(t, v.auth, isAuthError(v.err))
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/ethtx"
+)
+
+func TestToMessageAttributes(t *testing.T) {
+	chainID := "614"
+
+	attributes := toMessageAttributes(map[string]events.SQSMessageAttribute{
+		"chain_id": {DataType: "Number", StringValue: &chainID},
+	})
+
+	require.Equal(t, "614", aws.ToString(attributes["chain_id"].StringValue))
+	require.Equal(t, "Number", aws.ToString(attributes["chain_id"].DataType))
+}
+
+func TestFIFOAttributes(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	signer := types.LatestSignerForChainID(big.NewInt(614))
+	to := common.HexToAddress("0xe004bb7a6cd6e00d3dabf717d809e665bdeaa671")
+
+	sign := func(nonce uint64) *types.Transaction {
+		tx, err := types.SignNewTx(key, signer, &types.DynamicFeeTx{
+			ChainID:   big.NewInt(614),
+			Nonce:     nonce,
+			GasTipCap: big.NewInt(1),
+			GasFeeCap: big.NewInt(1),
+			Gas:       21000,
+			To:        &to,
+		})
+		require.NoError(t, err)
+
+		return tx
+	}
+
+	first, second := sign(1), sign(2)
+	item := models.SignedTXQueueItem{ID: "1", SignedTX: ethtx.Encode(first)}
+
+	sender := strings.ToLower(crypto.PubkeyToAddress(key.PublicKey).Hex())
+
+	require.Equal(t, "614:"+sender, messageGroupID(item, first))
+	require.Equal(t, messageGroupID(item, first), messageGroupID(item, second))
+	require.NotEqual(t, deduplicationID(item, first), deduplicationID(item, second))
+	require.Equal(t, signer.Hash(first).Hex(), deduplicationID(item, first))
+
+	require.Equal(t, "custom", messageGroupID(models.SignedTXQueueItem{GroupID: "custom"}, first))
+	require.Equal(t, "transaction", messageGroupID(models.SignedTXQueueItem{ID: "3", TransactionID: "transaction"}, nil))
+	require.Equal(t, "3", deduplicationID(models.SignedTXQueueItem{ID: "3"}, nil))
+
+	require.True(t, isFIFO("signed-transactions.fifo"))
+	require.False(t, isFIFO("signed-transactions"))
+}
+
+func TestQueueURLs(t *testing.T) {
+	resolved := 0
+
+	urls := &queueURLs{
+		resolve: func(_ context.Context, queueName string) (string, error) {
+			resolved++
+
+			if queueName == "missing" {
+				return "", errors.New("queue does not exist")
+			}
+
+			return "https://sqs.eu-west-2.amazonaws.com/000000000000/" + queueName, nil
+		},
+		urls: map[string]string{},
+	}
+
+	for i := 0; i < 2; i++ {
+		url, err := urls.get(context.Background(), "signed_eth")
+		require.NoError(t, err)
+		require.Equal(t, "https://sqs.eu-west-2.amazonaws.com/000000000000/signed_eth", url)
+	}
+
+	require.Equal(t, 1, resolved)
+
+	// failures are not remembered
+	for i := 0; i < 2; i++ {
+		_, err := urls.get(context.Background(), "missing")
+		require.Error(t, err)
+	}
+
+	require.Equal(t, 3, resolved)
+}
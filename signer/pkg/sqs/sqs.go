@@ -2,19 +2,27 @@
 package sqs
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsConfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
 	awstrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/aws/aws-sdk-go-v2/aws"
 
 	"github.com/mara-labs/transactionsigner/config"
 	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/chains"
+	"github.com/mara-labs/transactionsigner/pkg/ethtx"
+	"github.com/mara-labs/transactionsigner/pkg/msgauth"
+	"github.com/mara-labs/transactionsigner/pkg/queue"
 )
 
 const defaultRegion = "eu-west-2"
@@ -39,13 +47,49 @@ func getLocalstackEndpoint(cfg config.Configuration) string {
 type Client struct {
 	sqsClient *sqs.Client
 
-	writeSQSQueueURL string
+	router    *queue.Router
+	writeURLs *queueURLs
+
+	readSQSQueueURL string
+
+	visibilityTimeout time.Duration
+	waitTime          time.Duration
+
+	auth *msgauth.Signer
+}
+
+// queueURLs resolves queue names to URLs on first use and remembers them, so
+// output queues that are never written to are never looked up
+type queueURLs struct {
+	resolve func(ctx context.Context, queueName string) (string, error)
+
+	mu   sync.Mutex
+	urls map[string]string
+}
+
+func (q *queueURLs) get(ctx context.Context, queueName string) (string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if url, ok := q.urls[queueName]; ok {
+		return url, nil
+	}
+
+	url, err := q.resolve(ctx, queueName)
+	if err != nil {
+		return "", fmt.Errorf("could not resolve the url of queue %s: %w", queueName, err)
+	}
+
+	q.urls[queueName] = url
+
+	return url, nil
 }
 
 // New creates an instance of a sqs queue implementation
-func New(cfg config.Configuration) (*Client, error) {
-	if len(cfg.SQSWriteQueueName) == 0 {
-		return nil, errors.New("please provide the name of the queue to write to")
+func New(cfg config.Configuration, chainRegistry *chains.Registry) (*Client, error) {
+	router, err := queue.NewRouter(cfg, chainRegistry)
+	if err != nil {
+		return nil, err
 	}
 
 	opts := []func(*awsConfig.LoadOptions) error{}
@@ -64,6 +108,11 @@ func New(cfg config.Configuration) (*Client, error) {
 		})))
 	}
 
+	auth, err := msgauth.NewSigner(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	conf, err := awsConfig.LoadDefaultConfig(context.Background(), opts...)
 	if err != nil {
 		return nil, err
@@ -73,34 +122,252 @@ func New(cfg config.Configuration) (*Client, error) {
 
 	sqsClient := sqs.NewFromConfig(conf)
 
-	writeQueueResult, err := sqsClient.GetQueueUrl(context.Background(), &sqs.GetQueueUrlInput{
-		QueueName: aws.String(cfg.SQSWriteQueueName),
-	})
-	if err != nil {
-		return nil, err
+	client := &Client{
+		router: router,
+		writeURLs: &queueURLs{
+			resolve: func(ctx context.Context, queueName string) (string, error) {
+				out, err := sqsClient.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(queueName)})
+				if err != nil {
+					return "", err
+				}
+
+				return *out.QueueUrl, nil
+			},
+			urls: map[string]string{},
+		},
+		sqsClient:         sqsClient,
+		visibilityTimeout: cfg.WorkerVisibilityTimeout,
+		waitTime:          cfg.WorkerWaitTime,
+		auth:              auth,
+	}
+
+	if len(cfg.SQSReadQueueName) != 0 {
+		readQueueResult, err := sqsClient.GetQueueUrl(context.Background(), &sqs.GetQueueUrlInput{
+			QueueName: aws.String(cfg.SQSReadQueueName),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		client.readSQSQueueURL = *readQueueResult.QueueUrl
 	}
 
-	return &Client{
-		writeSQSQueueURL: *writeQueueResult.QueueUrl,
-		sqsClient:        sqsClient,
-	}, nil
+	return client, nil
 }
 
 // Close closes the underlying AWS connection
 func (c *Client) Close() error { return nil }
 
-// Add appends the item to the SQS queue
+// Add appends the item to the output queue of its chain. The current trace
+// context and the transaction ID, chain ID and hash travel as message
+// attributes so consumers can continue the trace and filter without decoding
+// the body, along with the signature of the body when outbound message keys
+// are set
 func (c *Client) Add(ctx context.Context, item models.SignedTXQueueItem) error {
-	var b bytes.Buffer
+	body, err := queue.Encode(item)
+	if err != nil {
+		return err
+	}
+
+	// items are added by the signer so their transaction always decodes, a
+	// nil tx only leaves out the attributes derived from it
+	tx, _ := ethtx.Decode(item.SignedTX)
+
+	queueName, err := c.router.RouteItem(item, tx)
+	if err != nil {
+		return err
+	}
+
+	var groupID, dedupID string
+
+	if isFIFO(queueName) {
+		groupID, dedupID = messageGroupID(item, tx), deduplicationID(item, tx)
+	}
 
-	if err := json.NewEncoder(&b).Encode(item); err != nil {
+	return c.send(ctx, queueName, body, queue.Attributes(ctx, item, tx), groupID, dedupID)
+}
+
+// AddUserOperation appends the signed user operation to the user operation
+// queue of its chain. FIFO queues keep the operations of a smart account in
+// order and drop operations signed again under the same user operation hash
+func (c *Client) AddUserOperation(ctx context.Context, item models.SignedUserOperationQueueItem) error {
+	body, err := queue.Encode(item)
+	if err != nil {
+		return err
+	}
+
+	queueName, err := c.router.RouteUserOperation(item.ChainID)
+	if err != nil {
+		return err
+	}
+
+	var groupID, dedupID string
+
+	if isFIFO(queueName) {
+		groupID = fmt.Sprintf("%d:%s", item.ChainID, strings.ToLower(item.UserOperation.Sender.Hex()))
+		dedupID = item.UserOpHash
+	}
+
+	return c.send(ctx, queueName, body, queue.UserOperationAttributes(ctx, item), groupID, dedupID)
+}
+
+// send signs and sends the message, the group and deduplication IDs are only
+// set for FIFO queues
+func (c *Client) send(ctx context.Context, queueName string, body string, attributes map[string]events.SQSMessageAttribute, groupID, dedupID string) error {
+	queueURL, err := c.writeURLs.get(ctx, queueName)
+	if err != nil {
 		return err
 	}
 
-	_, err := c.sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
-		QueueUrl:    aws.String(c.writeSQSQueueURL),
-		MessageBody: aws.String(b.String()),
+	c.auth.Sign(ctx, body, attributes)
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:          aws.String(queueURL),
+		MessageBody:       aws.String(body),
+		MessageAttributes: toMessageAttributes(attributes),
+	}
+
+	if len(groupID) != 0 {
+		input.MessageGroupId = aws.String(groupID)
+		input.MessageDeduplicationId = aws.String(dedupID)
+	}
+
+	_, err = c.sqsClient.SendMessage(ctx, input)
+
+	return err
+}
+
+func toMessageAttributes(attributes map[string]events.SQSMessageAttribute) map[string]types.MessageAttributeValue {
+	values := make(map[string]types.MessageAttributeValue, len(attributes))
+
+	for k, v := range attributes {
+		values[k] = types.MessageAttributeValue{
+			DataType:         aws.String(v.DataType),
+			StringValue:      v.StringValue,
+			BinaryValue:      v.BinaryValue,
+			StringListValues: v.StringListValues,
+			BinaryListValues: v.BinaryListValues,
+		}
+	}
+
+	return values
+}
+
+// isFIFO checks the name of the queue, AWS requires FIFO queue names to end
+// with .fifo
+func isFIFO(queueName string) bool {
+	return strings.HasSuffix(queueName, ".fifo")
+}
+
+// messageGroupID groups the transactions of a sender on a chain so they
+// reach the broadcaster in nonce order. Items whose transaction can not be
+// decoded are grouped on their own
+func messageGroupID(item models.SignedTXQueueItem, tx *ethtypes.Transaction) string {
+	if len(item.GroupID) != 0 {
+		return item.GroupID
+	}
+
+	if tx != nil {
+		if sender, err := ethtx.Sender(tx); err == nil {
+			return fmt.Sprintf("%s:%s", tx.ChainId(), strings.ToLower(sender.Hex()))
+		}
+	}
+
+	if len(item.TransactionID) != 0 {
+		return item.TransactionID
+	}
+
+	return item.ID
+}
+
+// deduplicationID is the signing hash of the transaction. Signatures are not
+// deterministic, so the hash of the signed transaction would let a message that
+// was signed again after a retry through a second time
+func deduplicationID(item models.SignedTXQueueItem, tx *ethtypes.Transaction) string {
+	if tx != nil {
+		return ethtypes.LatestSignerForChainID(tx.ChainId()).Hash(tx).Hex()
+	}
+
+	return item.ID
+}
+
+// Receive long polls the read queue for up to maxMessages items. They stay
+// hidden for WORKER_VISIBILITY_TIMEOUT, the default of the queue when it is
+// not set
+func (c *Client) Receive(ctx context.Context, maxMessages int) ([]events.SQSMessage, error) {
+	if len(c.readSQSQueueURL) == 0 {
+		return nil, errors.New("please provide the name of the queue to read from")
+	}
+
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl:              aws.String(c.readSQSQueueURL),
+		MaxNumberOfMessages:   int32(maxMessages),
+		WaitTimeSeconds:       int32(c.waitTime / time.Second),
+		AttributeNames:        []types.QueueAttributeName{types.QueueAttributeNameAll},
+		MessageAttributeNames: []string{"All"},
+	}
+
+	if c.visibilityTimeout > 0 {
+		input.VisibilityTimeout = int32(c.visibilityTimeout / time.Second)
+	}
+
+	result, err := c.sqsClient.ReceiveMessage(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]events.SQSMessage, 0, len(result.Messages))
+
+	for _, msg := range result.Messages {
+		messages = append(messages, toSQSMessage(msg))
+	}
+
+	return messages, nil
+}
+
+// Delete acknowledges the message so it is not delivered again
+func (c *Client) Delete(ctx context.Context, receiptHandle string) error {
+	_, err := c.sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(c.readSQSQueueURL),
+		ReceiptHandle: aws.String(receiptHandle),
+	})
+
+	return err
+}
+
+// ExtendVisibility hides the message from other consumers for the given
+// timeout. A zero timeout makes the message visible again right away
+func (c *Client) ExtendVisibility(ctx context.Context, receiptHandle string, timeout time.Duration) error {
+	_, err := c.sqsClient.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(c.readSQSQueueURL),
+		ReceiptHandle:     aws.String(receiptHandle),
+		VisibilityTimeout: int32(timeout / time.Second),
 	})
 
 	return err
 }
+
+func toSQSMessage(msg types.Message) events.SQSMessage {
+	attributes := make(map[string]events.SQSMessageAttribute, len(msg.MessageAttributes))
+
+	for k, v := range msg.MessageAttributes {
+		attributes[k] = events.SQSMessageAttribute{
+			StringValue:      v.StringValue,
+			BinaryValue:      v.BinaryValue,
+			StringListValues: v.StringListValues,
+			BinaryListValues: v.BinaryListValues,
+			DataType:         aws.ToString(v.DataType),
+		}
+	}
+
+	return events.SQSMessage{
+		MessageId:              aws.ToString(msg.MessageId),
+		ReceiptHandle:          aws.ToString(msg.ReceiptHandle),
+		Body:                   aws.ToString(msg.Body),
+		Md5OfBody:              aws.ToString(msg.MD5OfBody),
+		Md5OfMessageAttributes: aws.ToString(msg.MD5OfMessageAttributes),
+		Attributes:             msg.Attributes,
+		MessageAttributes:      attributes,
+		EventSource:            "aws:sqs",
+	}
+}
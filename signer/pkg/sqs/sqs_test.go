@@ -4,11 +4,13 @@ import (
 	"context"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
 	"github.com/mara-labs/transactionsigner/config"
 	"github.com/mara-labs/transactionsigner/models"
+	"github.com/mara-labs/transactionsigner/pkg/queue/queuetest"
 )
 
 func TestClient_Add(t *testing.T) {
@@ -21,9 +23,42 @@ func TestClient_Add(t *testing.T) {
 		MaraChainID:           "123456",
 	}
 
-	client, err := New(cfg)
+	client, err := New(cfg, nil)
 
 	require.NoError(t, err)
 
 	require.NoError(t, client.Add(context.Background(), models.SignedTXQueueItem{}))
 }
+
+func TestClient_Conformance(t *testing.T) {
+	queueName := os.Getenv("SQS_QUEUE_NAME")
+
+	queuetest.Run(t, func(t *testing.T) queuetest.Queue {
+		client, err := New(config.Configuration{
+			Environment:            "local",
+			SQSWriteQueueName:      queueName,
+			SQSReadQueueName:       queueName,
+			UserOperationQueueName: queueName,
+			SQSLocalstackEndpoint:  os.Getenv("SQS_LOCALSTACK_ENDPOINT"),
+			WorkerWaitTime:         time.Second,
+		}, nil)
+		require.NoError(t, err)
+
+		// the suite expects an empty queue, SQS only allows a purge a minute
+		// so leftovers of other tests are drained instead
+		for {
+			messages, err := client.Receive(context.Background(), 10)
+			require.NoError(t, err)
+
+			if len(messages) == 0 {
+				break
+			}
+
+			for _, msg := range messages {
+				require.NoError(t, client.Delete(context.Background(), msg.ReceiptHandle))
+			}
+		}
+
+		return client
+	})
+}
@@ -0,0 +1,73 @@
+// Package tracing carries Datadog trace context across queue hops in SQS
+// message attributes
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/aws/aws-lambda-go/events"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// Attribute is the message attribute holding the trace context. It is the one
+// used by the Datadog integrations so traces also continue into services
+// instrumented by them
+const Attribute = "_datadog"
+
+// Inject encodes the context of the span in ctx for the trace context
+// attribute. It returns false when ctx holds no span
+func Inject(ctx context.Context) (string, bool) {
+	span, ok := tracer.SpanFromContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	carrier := tracer.TextMapCarrier{}
+
+	if err := tracer.Inject(span.Context(), carrier); err != nil {
+		return "", false
+	}
+
+	b, err := json.Marshal(carrier)
+	if err != nil {
+		return "", false
+	}
+
+	return string(b), true
+}
+
+// Extract decodes the trace context attribute of an inbound message. Messages
+// fanned out by SNS carry it as a binary value. It returns false when the
+// message carries no usable trace context
+func Extract(attributes map[string]events.SQSMessageAttribute) (ddtrace.SpanContext, bool) {
+	attribute, ok := attributes[Attribute]
+	if !ok {
+		return nil, false
+	}
+
+	var value []byte
+
+	switch {
+	case attribute.StringValue != nil:
+		value = []byte(*attribute.StringValue)
+	case len(attribute.BinaryValue) != 0:
+		value = attribute.BinaryValue
+	default:
+		return nil, false
+	}
+
+	carrier := tracer.TextMapCarrier{}
+
+	if err := json.Unmarshal(value, &carrier); err != nil {
+		return nil, false
+	}
+
+	spanContext, err := tracer.Extract(carrier)
+	if err != nil {
+		return nil, false
+	}
+
+	return spanContext, true
+}
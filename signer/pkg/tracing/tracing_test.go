@@ -0,0 +1,61 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+func TestInjectExtract(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	_, ok := Inject(context.Background())
+	require.False(t, ok)
+
+	span, ctx := tracer.StartSpanFromContext(context.Background(), "upstream")
+	defer span.Finish()
+
+	value, ok := Inject(ctx)
+	require.True(t, ok)
+
+	tt := []struct {
+		name      string
+		attribute events.SQSMessageAttribute
+		ok        bool
+	}{
+		{
+			name:      "string attribute",
+			attribute: events.SQSMessageAttribute{DataType: "String", StringValue: &value},
+			ok:        true,
+		},
+		{
+			name:      "binary attribute from sns",
+			attribute: events.SQSMessageAttribute{DataType: "Binary", BinaryValue: []byte(value)},
+			ok:        true,
+		},
+		{
+			name:      "empty attribute",
+			attribute: events.SQSMessageAttribute{DataType: "String"},
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			spanContext, ok := Extract(map[string]events.SQSMessageAttribute{Attribute: v.attribute})
+			require.Equal(t, v.ok, ok)
+
+			if v.ok {
+				require.Equal(t, span.Context().TraceID(), spanContext.TraceID())
+				require.Equal(t, span.Context().SpanID(), spanContext.SpanID())
+			}
+		})
+	}
+
+	_, ok = Extract(nil)
+	require.False(t, ok)
+}
@@ -0,0 +1,121 @@
+// Package userop computes the hashes of ERC-4337 user operations and the
+// signatures smart accounts expect for them
+package userop
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/mara-labs/transactionsigner/models"
+)
+
+// ErrInvalidUserOperation is returned for user operations missing a field the
+// hash is computed from
+var ErrInvalidUserOperation = errors.New("invalid user operation")
+
+// Validate checks that every number of the operation is set. The signature
+// is left out, it is replaced once the operation is signed
+func Validate(op *models.UserOperation) error {
+	if op == nil {
+		return fmt.Errorf("%w: missing user_operation", ErrInvalidUserOperation)
+	}
+
+	if op.Sender == (common.Address{}) {
+		return fmt.Errorf("%w: missing sender", ErrInvalidUserOperation)
+	}
+
+	numbers := map[string]*big.Int{
+		"nonce":                (*big.Int)(op.Nonce),
+		"callGasLimit":         (*big.Int)(op.CallGasLimit),
+		"verificationGasLimit": (*big.Int)(op.VerificationGasLimit),
+		"preVerificationGas":   (*big.Int)(op.PreVerificationGas),
+		"maxFeePerGas":         (*big.Int)(op.MaxFeePerGas),
+		"maxPriorityFeePerGas": (*big.Int)(op.MaxPriorityFeePerGas),
+	}
+
+	for name, value := range numbers {
+		if value == nil {
+			return fmt.Errorf("%w: missing %s", ErrInvalidUserOperation, name)
+		}
+
+		if value.Sign() < 0 || value.BitLen() > 256 {
+			return fmt.Errorf("%w: %s is not a uint256", ErrInvalidUserOperation, name)
+		}
+	}
+
+	return nil
+}
+
+// Hash returns the userOpHash of the operation for the EntryPoint and chain,
+// the hash EntryPoint.getUserOpHash of the v0.6 EntryPoint returns. op must
+// pass Validate
+func Hash(op *models.UserOperation, entryPoint common.Address, chainID *big.Int) common.Hash {
+	packed := crypto.Keccak256(
+		common.LeftPadBytes(op.Sender.Bytes(), 32),
+		word(op.Nonce),
+		crypto.Keccak256(op.InitCode),
+		crypto.Keccak256(op.CallData),
+		word(op.CallGasLimit),
+		word(op.VerificationGasLimit),
+		word(op.PreVerificationGas),
+		word(op.MaxFeePerGas),
+		word(op.MaxPriorityFeePerGas),
+		crypto.Keccak256(op.PaymasterAndData),
+	)
+
+	return crypto.Keccak256Hash(
+		packed,
+		common.LeftPadBytes(entryPoint.Bytes(), 32),
+		common.LeftPadBytes(chainID.Bytes(), 32),
+	)
+}
+
+// word encodes a validated number as a 32 byte ABI word
+func word(n *hexutil.Big) []byte {
+	return common.LeftPadBytes((*big.Int)(n).Bytes(), 32)
+}
+
+// Digest returns the hash the owner of a smart account signs. Accounts such as
+// the SimpleAccount of the reference implementation recover the owner from an
+// EIP-191 signed message of the userOpHash
+func Digest(userOpHash common.Hash) []byte {
+	return accounts.TextHash(userOpHash.Bytes())
+}
+
+// Signature converts a [R || S || V] signature with V 0 or 1 to the form
+// ecrecover takes, with V 27 or 28
+func Signature(sig []byte) ([]byte, error) {
+	if len(sig) != crypto.SignatureLength || sig[crypto.RecoveryIDOffset] > 1 {
+		return nil, errors.New("invalid signature")
+	}
+
+	out := make([]byte, crypto.SignatureLength)
+	copy(out, sig)
+	out[crypto.RecoveryIDOffset] += 27
+
+	return out, nil
+}
+
+// Recover returns the address that signed the user operation hash
+func Recover(userOpHash common.Hash, signature []byte) (common.Address, error) {
+	if len(signature) != crypto.SignatureLength || signature[crypto.RecoveryIDOffset] < 27 {
+		return common.Address{}, errors.New("invalid signature")
+	}
+
+	sig := make([]byte, crypto.SignatureLength)
+	copy(sig, signature)
+	sig[crypto.RecoveryIDOffset] -= 27
+
+	publicKey, err := crypto.SigToPub(Digest(userOpHash), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	return crypto.PubkeyToAddress(*publicKey), nil
+}
@@ -0,0 +1,114 @@
+package userop
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mara-labs/transactionsigner/models"
+)
+
+var entryPoint = common.HexToAddress("0x5FF137D4b0FDCD49DcA30c7CF57E578a026d2789")
+
+func newUserOperation() *models.UserOperation {
+	// nonces carry a 192 bit key above the sequence
+	nonce, _ := new(big.Int).SetString("1000000000000000000000000000000000000000000000000", 16)
+
+	return &models.UserOperation{
+		Sender:               common.HexToAddress("0x6ac7ea33f8831ea9dcc53393aaa88b25a785dbf0"),
+		Nonce:                (*hexutil.Big)(nonce),
+		CallData:             common.FromHex("0xb61d27f6"),
+		CallGasLimit:         (*hexutil.Big)(big.NewInt(35000)),
+		VerificationGasLimit: (*hexutil.Big)(big.NewInt(70000)),
+		PreVerificationGas:   (*hexutil.Big)(big.NewInt(21000)),
+		MaxFeePerGas:         (*hexutil.Big)(big.NewInt(30e9)),
+		MaxPriorityFeePerGas: (*hexutil.Big)(big.NewInt(2e9)),
+		PaymasterAndData:     common.FromHex("0x"),
+	}
+}
+
+func TestHash(t *testing.T) {
+	op := newUserOperation()
+
+	// the EntryPoint abi encodes the operation with its dynamic fields
+	// hashed, and then the hash with the EntryPoint and chain
+	newType := func(name string) abi.Type {
+		typ, err := abi.NewType(name, "", nil)
+		require.NoError(t, err)
+
+		return typ
+	}
+
+	address, uint256, bytes32 := newType("address"), newType("uint256"), newType("bytes32")
+
+	packed, err := abi.Arguments{
+		{Type: address}, {Type: uint256}, {Type: bytes32}, {Type: bytes32}, {Type: uint256},
+		{Type: uint256}, {Type: uint256}, {Type: uint256}, {Type: uint256}, {Type: bytes32},
+	}.Pack(
+		op.Sender, (*big.Int)(op.Nonce),
+		crypto.Keccak256Hash(op.InitCode), crypto.Keccak256Hash(op.CallData),
+		(*big.Int)(op.CallGasLimit), (*big.Int)(op.VerificationGasLimit), (*big.Int)(op.PreVerificationGas),
+		(*big.Int)(op.MaxFeePerGas), (*big.Int)(op.MaxPriorityFeePerGas),
+		crypto.Keccak256Hash(op.PaymasterAndData),
+	)
+	require.NoError(t, err)
+
+	encoded, err := abi.Arguments{{Type: bytes32}, {Type: address}, {Type: uint256}}.
+		Pack(crypto.Keccak256Hash(packed), entryPoint, big.NewInt(614))
+	require.NoError(t, err)
+
+	require.Equal(t, crypto.Keccak256Hash(encoded), Hash(op, entryPoint, big.NewInt(614)))
+
+	// known answer for mainnet, computed from the abi.encode layout of
+	// UserOperationLib.pack and getUserOpHash of the v0.6 EntryPoint with an
+	// independent keccak256
+	require.Equal(t, common.HexToHash("0xd06c77431c8cd3041e15ed194f8502b5044d7f9fa8e1c170919bdd83bf345033"),
+		Hash(op, entryPoint, big.NewInt(1)))
+
+	// the hash is bound to the chain and the EntryPoint
+	require.NotEqual(t, Hash(op, entryPoint, big.NewInt(614)), Hash(op, entryPoint, big.NewInt(1)))
+	require.NotEqual(t, Hash(op, entryPoint, big.NewInt(614)), Hash(op, common.Address{1}, big.NewInt(614)))
+}
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, Validate(newUserOperation()))
+	require.ErrorIs(t, Validate(nil), ErrInvalidUserOperation)
+
+	withoutSender := newUserOperation()
+	withoutSender.Sender = common.Address{}
+	require.ErrorIs(t, Validate(withoutSender), ErrInvalidUserOperation)
+
+	withoutGas := newUserOperation()
+	withoutGas.CallGasLimit = nil
+	require.ErrorIs(t, Validate(withoutGas), ErrInvalidUserOperation)
+
+	negative := newUserOperation()
+	negative.MaxFeePerGas = (*hexutil.Big)(big.NewInt(-1))
+	require.ErrorIs(t, Validate(negative), ErrInvalidUserOperation)
+}
+
+func TestSignature(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	hash := Hash(newUserOperation(), entryPoint, big.NewInt(614))
+
+	sig, err := crypto.Sign(Digest(hash), key)
+	require.NoError(t, err)
+
+	signature, err := Signature(sig)
+	require.NoError(t, err)
+	require.Contains(t, []byte{27, 28}, signature[crypto.RecoveryIDOffset])
+
+	owner, err := Recover(hash, signature)
+	require.NoError(t, err)
+	require.Equal(t, crypto.PubkeyToAddress(key.PublicKey), owner)
+
+	_, err = Signature(signature)
+	require.Error(t, err, "the signature was converted already")
+}
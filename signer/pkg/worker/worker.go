@@ -0,0 +1,250 @@
+// Package worker implements a long running process that polls a queue and
+// hands every message to the same handler lambda uses
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/models"
+)
+
+const (
+	// maximum amount of messages SQS hands out in one receive call
+	maxBatchSize = 10
+
+	// messageGroupAttribute is set on messages received from FIFO queues
+	messageGroupAttribute = "MessageGroupId"
+
+	receiveErrorBackoff = time.Second
+)
+
+// Handler processes a single message. A nil error acknowledges the message
+type Handler func(context.Context, events.SQSMessage) error
+
+// Worker polls a queue with a fixed amount of goroutines
+type Worker struct {
+	consumer models.Consumer
+	handler  Handler
+
+	concurrency       int
+	maxMessages       int
+	visibilityTimeout time.Duration
+}
+
+// New creates a worker that feeds messages from the consumer to the handler
+func New(cfg config.Configuration, consumer models.Consumer, handler Handler) (*Worker, error) {
+	if cfg.WorkerConcurrency <= 0 {
+		return nil, errors.New("please provide a positive WORKER_CONCURRENCY")
+	}
+
+	if cfg.WorkerMaxMessages <= 0 || cfg.WorkerMaxMessages > maxBatchSize {
+		return nil, errors.New("WORKER_MAX_MESSAGES must be between 1 and 10")
+	}
+
+	if cfg.WorkerVisibilityTimeout < 2*time.Second {
+		return nil, errors.New("WORKER_VISIBILITY_TIMEOUT must be at least 2 seconds")
+	}
+
+	return &Worker{
+		consumer:          consumer,
+		handler:           handler,
+		concurrency:       cfg.WorkerConcurrency,
+		maxMessages:       cfg.WorkerMaxMessages,
+		visibilityTimeout: cfg.WorkerVisibilityTimeout,
+	}, nil
+}
+
+// Run polls the queue until ctx is cancelled. Messages that are already being
+// processed when that happens are allowed to finish before Run returns so a
+// signature is never abandoned halfway
+func (w *Worker) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for i := 0; i < w.concurrency; i++ {
+		wg.Add(1)
+
+		go func(id int) {
+			defer wg.Done()
+			w.poll(ctx, id)
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+func (w *Worker) poll(ctx context.Context, id int) {
+	logger := log.WithField("worker_id", id)
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		messages, err := w.consumer.Receive(ctx, w.maxMessages)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			logger.WithError(err).Error("could not receive messages from the queue")
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(receiveErrorBackoff):
+			}
+
+			continue
+		}
+
+		if !w.processBatch(ctx, messages) {
+			return
+		}
+	}
+}
+
+// processBatch processes the received messages in order. It reports false
+// when ctx was cancelled, the messages that were not started are released
+func (w *Worker) processBatch(ctx context.Context, messages []events.SQSMessage) bool {
+	held := newBatch(messages)
+
+	// the whole batch is kept hidden, the messages waiting behind a slow
+	// signature would otherwise become visible to other consumers
+	heartbeatCtx, stopHeartbeat := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopHeartbeat()
+
+	go w.heartbeat(heartbeatCtx, held)
+
+	// groups of a FIFO queue with a failed message, the later messages of
+	// the group must not overtake it
+	failedGroups := map[string]bool{}
+
+	for i, msg := range messages {
+		if ctx.Err() != nil {
+			held.done(messages[i:]...)
+			w.release(messages[i:])
+			return false
+		}
+
+		group := msg.Attributes[messageGroupAttribute]
+
+		if len(group) != 0 && failedGroups[group] {
+			held.done(msg)
+			w.release(messages[i : i+1])
+			continue
+		}
+
+		if !w.process(ctx, held, msg) && len(group) != 0 {
+			failedGroups[group] = true
+		}
+	}
+
+	return true
+}
+
+// process hands the message to the handler and deletes it once it was
+// processed. It reports whether the handler succeeded
+func (w *Worker) process(ctx context.Context, held *batch, msg events.SQSMessage) bool {
+	logger := log.WithField("message_id", msg.MessageId)
+
+	// in-flight messages must survive a shutdown signal
+	processCtx := context.WithoutCancel(ctx)
+
+	err := w.handler(processCtx, msg)
+
+	// a failed message becomes visible again once its timeout runs out
+	held.done(msg)
+
+	if err != nil {
+		logger.WithError(err).Error("could not process message, it will be retried")
+		return false
+	}
+
+	if err := w.consumer.Delete(processCtx, msg.ReceiptHandle); err != nil {
+		logger.WithError(err).Error("could not delete processed message")
+	}
+
+	return true
+}
+
+// batch holds the messages of a receive call the worker is not done with
+type batch struct {
+	mu      sync.Mutex
+	pending []events.SQSMessage
+}
+
+func newBatch(messages []events.SQSMessage) *batch {
+	return &batch{pending: append([]events.SQSMessage(nil), messages...)}
+}
+
+// done stops extending the visibility of the messages
+func (b *batch) done(messages ...events.SQSMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, msg := range messages {
+		for i, pending := range b.pending {
+			if pending.ReceiptHandle == msg.ReceiptHandle {
+				b.pending = append(b.pending[:i], b.pending[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// heartbeat keeps extending the visibility of the messages of the batch
+// while they wait or are being processed, so slow signatures do not let
+// another consumer pick them up
+func (w *Worker) heartbeat(ctx context.Context, held *batch) {
+	ticker := time.NewTicker(w.visibilityTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.extend(ctx, held)
+		}
+	}
+}
+
+// extend extends the visibility of the pending messages. The batch stays
+// locked meanwhile so a message that is released is not extended afterwards
+func (w *Worker) extend(ctx context.Context, held *batch) {
+	held.mu.Lock()
+	defer held.mu.Unlock()
+
+	for _, msg := range held.pending {
+		if err := w.consumer.ExtendVisibility(ctx, msg.ReceiptHandle, w.visibilityTimeout); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			log.WithField("message_id", msg.MessageId).
+				WithError(err).
+				Error("could not extend message visibility")
+		}
+	}
+}
+
+// release makes messages that were received but not processed visible again
+// so another consumer can pick them up straight away
+func (w *Worker) release(messages []events.SQSMessage) {
+	ctx := context.Background()
+
+	for _, msg := range messages {
+		if err := w.consumer.ExtendVisibility(ctx, msg.ReceiptHandle, 0); err != nil {
+			log.WithField("message_id", msg.MessageId).
+				WithError(err).
+				Error("could not release message")
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/mara-labs/transactionsigner/config"
+	"github.com/mara-labs/transactionsigner/mocks"
+)
+
+func TestNew(t *testing.T) {
+	tt := []struct {
+		name     string
+		cfg      config.Configuration
+		hasError bool
+	}{
+		{
+			name:     "no concurrency",
+			cfg:      config.Configuration{WorkerMaxMessages: 1, WorkerVisibilityTimeout: time.Minute},
+			hasError: true,
+		},
+		{
+			name:     "batch too large",
+			cfg:      config.Configuration{WorkerConcurrency: 1, WorkerMaxMessages: 11, WorkerVisibilityTimeout: time.Minute},
+			hasError: true,
+		},
+		{
+			name:     "visibility timeout too short",
+			cfg:      config.Configuration{WorkerConcurrency: 1, WorkerMaxMessages: 1, WorkerVisibilityTimeout: time.Second},
+			hasError: true,
+		},
+		{
+			name: "valid configuration",
+			cfg:  config.Configuration{WorkerConcurrency: 1, WorkerMaxMessages: 10, WorkerVisibilityTimeout: time.Minute},
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			_, err := New(v.cfg, nil, nil)
+			if v.hasError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestWorker_Run(t *testing.T) {
+	cfg := config.Configuration{
+		WorkerConcurrency:       1,
+		WorkerMaxMessages:       10,
+		WorkerVisibilityTimeout: 2 * time.Second,
+	}
+
+	tt := []struct {
+		name       string
+		handlerErr error
+		mockFn     func(*mocks.MockConsumer, context.CancelFunc)
+	}{
+		{
+			name: "processed message is deleted",
+			mockFn: func(c *mocks.MockConsumer, cancel context.CancelFunc) {
+				c.EXPECT().Receive(gomock.Any(), 10).Times(1).
+					Return([]events.SQSMessage{{MessageId: "1", ReceiptHandle: "handle-1"}}, nil)
+
+				c.EXPECT().Delete(gomock.Any(), "handle-1").Times(1).
+					DoAndReturn(func(context.Context, string) error {
+						cancel()
+						return nil
+					})
+			},
+		},
+		{
+			name:       "failed message is left on the queue",
+			handlerErr: errors.New("could not sign"),
+			mockFn: func(c *mocks.MockConsumer, cancel context.CancelFunc) {
+				gomock.InOrder(
+					c.EXPECT().Receive(gomock.Any(), 10).Times(1).
+						Return([]events.SQSMessage{{MessageId: "1", ReceiptHandle: "handle-1"}}, nil),
+					c.EXPECT().Receive(gomock.Any(), 10).Times(1).
+						DoAndReturn(func(context.Context, int) ([]events.SQSMessage, error) {
+							cancel()
+							return nil, nil
+						}),
+				)
+			},
+		},
+		{
+			name: "messages that were not started are released on shutdown",
+			mockFn: func(c *mocks.MockConsumer, cancel context.CancelFunc) {
+				c.EXPECT().Receive(gomock.Any(), 10).Times(1).
+					DoAndReturn(func(context.Context, int) ([]events.SQSMessage, error) {
+						cancel()
+						return []events.SQSMessage{{MessageId: "1", ReceiptHandle: "handle-1"}}, nil
+					})
+
+				c.EXPECT().ExtendVisibility(gomock.Any(), "handle-1", time.Duration(0)).Times(1).
+					Return(nil)
+			},
+		},
+		{
+			name: "receive errors do not stop the worker",
+			mockFn: func(c *mocks.MockConsumer, cancel context.CancelFunc) {
+				gomock.InOrder(
+					c.EXPECT().Receive(gomock.Any(), 10).Times(1).
+						Return(nil, errors.New("queue is unavailable")),
+					c.EXPECT().Receive(gomock.Any(), 10).Times(1).
+						DoAndReturn(func(context.Context, int) ([]events.SQSMessage, error) {
+							cancel()
+							return nil, nil
+						}),
+				)
+			},
+		},
+	}
+
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			consumer := mocks.NewMockConsumer(ctrl)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			v.mockFn(consumer, cancel)
+
+			w, err := New(cfg, consumer, func(context.Context, events.SQSMessage) error {
+				return v.handlerErr
+			})
+			require.NoError(t, err)
+
+			w.Run(ctx)
+		})
+	}
+}
+
+func TestWorker_RunFIFO(t *testing.T) {
+	cfg := config.Configuration{
+		WorkerConcurrency:       1,
+		WorkerMaxMessages:       10,
+		WorkerVisibilityTimeout: 2 * time.Second,
+	}
+
+	ctrl := gomock.NewController(t)
+	consumer := mocks.NewMockConsumer(ctrl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	message := func(id, group string) events.SQSMessage {
+		return events.SQSMessage{
+			MessageId:     id,
+			ReceiptHandle: "handle-" + id,
+			Attributes:    map[string]string{"MessageGroupId": group},
+		}
+	}
+
+	gomock.InOrder(
+		consumer.EXPECT().Receive(gomock.Any(), 10).Times(1).
+			Return([]events.SQSMessage{
+				message("1", "614:0xa"),
+				message("2", "614:0xb"),
+				message("3", "614:0xa"),
+			}, nil),
+		consumer.EXPECT().Receive(gomock.Any(), 10).Times(1).
+			DoAndReturn(func(context.Context, int) ([]events.SQSMessage, error) {
+				cancel()
+				return nil, nil
+			}),
+	)
+
+	// the second message of the failed group is released untouched, the
+	// other group goes ahead
+	consumer.EXPECT().Delete(gomock.Any(), "handle-2").Times(1).Return(nil)
+	consumer.EXPECT().ExtendVisibility(gomock.Any(), "handle-3", time.Duration(0)).Times(1).Return(nil)
+
+	var handled []string
+
+	w, err := New(cfg, consumer, func(_ context.Context, msg events.SQSMessage) error {
+		handled = append(handled, msg.MessageId)
+
+		if msg.MessageId == "1" {
+			return errors.New("could not sign")
+		}
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	w.Run(ctx)
+
+	require.Equal(t, []string{"1", "2"}, handled)
+}
+
+func TestWorker_RunSlowBatch(t *testing.T) {
+	cfg := config.Configuration{
+		WorkerConcurrency:       1,
+		WorkerMaxMessages:       10,
+		WorkerVisibilityTimeout: 2 * time.Second,
+	}
+
+	ctrl := gomock.NewController(t)
+	consumer := mocks.NewMockConsumer(ctrl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	gomock.InOrder(
+		consumer.EXPECT().Receive(gomock.Any(), 10).Times(1).
+			Return([]events.SQSMessage{
+				{MessageId: "1", ReceiptHandle: "handle-1"},
+				{MessageId: "2", ReceiptHandle: "handle-2"},
+				{MessageId: "3", ReceiptHandle: "handle-3"},
+			}, nil),
+		consumer.EXPECT().Receive(gomock.Any(), 10).Times(1).
+			DoAndReturn(func(context.Context, int) ([]events.SQSMessage, error) {
+				cancel()
+				return nil, nil
+			}),
+	)
+
+	var mu sync.Mutex
+
+	extended := map[string]int{}
+
+	consumer.EXPECT().ExtendVisibility(gomock.Any(), gomock.Any(), 2*time.Second).AnyTimes().
+		DoAndReturn(func(_ context.Context, receiptHandle string, _ time.Duration) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			extended[receiptHandle]++
+			return nil
+		})
+
+	consumer.EXPECT().Delete(gomock.Any(), gomock.Any()).Times(3).Return(nil)
+
+	w, err := New(cfg, consumer, func(_ context.Context, msg events.SQSMessage) error {
+		if msg.MessageId == "1" {
+			// longer than the visibility timeout of the batch
+			time.Sleep(2500 * time.Millisecond)
+			return nil
+		}
+
+		// the messages waiting behind the slow one were kept hidden
+		mu.Lock()
+		defer mu.Unlock()
+
+		require.NotZero(t, extended[msg.ReceiptHandle], msg.MessageId)
+		return nil
+	})
+	require.NoError(t, err)
+
+	w.Run(ctx)
+}